@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,9 +11,12 @@ import (
 	"time"
 	"waf-go/internal/config"
 	"waf-go/internal/db"
-	"waf-go/internal/proxy"
 	"waf-go/internal/router"
 	"waf-go/internal/service"
+	"waf-go/internal/waf"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
@@ -27,9 +29,6 @@ func main() {
 	// 初始化Redis客户端
 	redisClient := db.InitRedis(cfg)
 
-	// 创建代理管理器
-	proxyManager := proxy.NewProxyManager()
-
 	// 创建服务
 	services := service.NewServices(database, redisClient, cfg)
 
@@ -41,32 +40,42 @@ func main() {
 		log.Printf("加载域名配置失败: %v", err)
 	}
 
-	// 创建HTTP服务器
+	// 启动后台任务（ACME证书签发与续期、OCSP装订）
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	services.StartBackgroundTasks(bgCtx)
+
+	// 创建HTTP服务器，开启h2c时同时接受HTTP/2明文连接（gRPC）
+	var httpHandler http.Handler = r
+	if cfg.Server.H2C {
+		httpHandler = h2c.NewHandler(r, &http2.Server{})
+	}
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.HTTPPort),
-		Handler: r,
+		Handler: httpHandler,
 	}
 
 	// 创建HTTPS服务器
 	httpsServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.HTTPSPort),
 		Handler: r,
-		TLSConfig: &tls.Config{
-			GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				// 根据SNI获取证书
-				if tlsConfig := proxyManager.GetTLSConfig(info.ServerName); tlsConfig != nil {
-					return &tlsConfig.Certificates[0], nil
-				}
-				return nil, fmt.Errorf("no certificate for domain: %s", info.ServerName)
-			},
-			MinVersion: tls.VersionTLS12,
-		},
+		// 证书存储与DomainService共享，域名更新后立即生效
+		TLSConfig: services.GetCertificateStore().TLSConfig(),
+	}
+	if err := http2.ConfigureServer(httpsServer, &http2.Server{}); err != nil {
+		log.Fatalf("配置HTTP/2失败: %v", err)
+	}
+
+	// HTTP监听器记录原始请求头，供WAF检查请求走私特征；HTTPS连接只能检查net/http解析后的请求
+	httpListener, err := waf.ListenFraming(httpServer)
+	if err != nil {
+		log.Fatalf("HTTP服务器启动失败: %v", err)
 	}
 
 	// 启动HTTP和HTTPS服务器
 	go func() {
 		log.Printf("HTTP服务器启动在端口 %d", cfg.Server.HTTPPort)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP服务器启动失败: %v", err)
 		}
 	}()
@@ -0,0 +1,143 @@
+// modsec-import 将ModSecurity SecLang规则文件转换为WAF规则。
+// 默认只输出转换报告；指定 -apply 时按配置连接数据库，导入规则并新建策略。
+//
+//	modsec-import rules.conf
+//	modsec-import -apply -policy "CRS legacy" -tenant 1 rules.conf
+//	cat *.conf | modsec-import -json -
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"waf-go/internal/config"
+	"waf-go/internal/db"
+	"waf-go/internal/modsec"
+	"waf-go/internal/service"
+	"waf-go/internal/waf"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "导入数据库，否则只输出转换报告")
+	policyName := flag.String("policy", "", "导入时新建的策略名称")
+	description := flag.String("description", "", "策略描述")
+	tenantID := flag.Uint("tenant", 0, "租户ID，0表示全局规则")
+	overwrite := flag.Bool("overwrite", false, "覆盖已存在的同名规则（modsec-<id>）")
+	jsonOutput := flag.Bool("json", false, "以JSON格式输出转换结果")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s [选项] <规则文件|->\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	content, err := readInput(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("读取规则文件失败: %v", err)
+	}
+
+	if !*apply {
+		translation := modsec.Translate(content)
+		if *jsonOutput {
+			printJSON(translation)
+			return
+		}
+		for _, rule := range translation.Rules {
+			fmt.Printf("规则 %s (第%d行): %s %s\n", rule.Rule.Name, rule.Line, rule.Rule.MatchType, rule.Rule.Action)
+		}
+		for _, exclusion := range translation.Exclusions {
+			printExclusion(exclusion)
+		}
+		printReport(translation.Report)
+		return
+	}
+
+	if *policyName == "" {
+		log.Fatal("导入时必须指定 -policy")
+	}
+
+	// 加载配置并连接数据库
+	cfg := config.LoadConfig()
+	database := db.InitDB(cfg)
+	wafEngine := waf.NewWAFEngine(database, db.InitRedis(cfg))
+
+	importService := service.NewModSecImportService(database, wafEngine)
+	result, err := importService.ImportRules(&service.ModSecImportRequest{
+		Content:     content,
+		PolicyName:  *policyName,
+		Description: *description,
+		Overwrite:   *overwrite,
+		TenantID:    *tenantID,
+	})
+	if err != nil {
+		log.Fatalf("导入ModSecurity规则失败: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(result)
+		return
+	}
+	fmt.Printf("已创建策略 %s (ID %d)\n", result.Policy.Name, result.Policy.ID)
+	printReport(result.Report)
+	fmt.Println("运行中的WAF服务在规则变更或重启后加载导入的规则")
+}
+
+// readInput 读取规则文件，文件名为空或-时读取标准输入
+func readInput(path string) (string, error) {
+	if path == "" || path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("输出JSON失败: %v", err)
+	}
+}
+
+func printExclusion(exclusion modsec.TranslatedExclusion) {
+	skipped := exclusion.Exclusion.RuleTag
+	if exclusion.ModSecRuleID != 0 {
+		skipped = modsec.RuleName(exclusion.ModSecRuleID)
+	}
+	path := exclusion.Exclusion.Path
+	if path == "" {
+		path = "所有路径"
+	}
+	target := exclusion.Exclusion.Target
+	if target == "" {
+		target = "整条规则"
+	}
+	fmt.Printf("规则排除 (第%d行): 跳过 %s 的 %s，路径 %s\n", exclusion.Line, skipped, target, path)
+}
+
+func printReport(report modsec.Report) {
+	fmt.Printf("\n共 %d 条指令，转换规则 %d 条，规则排除 %d 条，无法转换 %d 条，警告 %d 条\n",
+		report.Directives, report.Rules, report.Exclusions, len(report.Untranslated), len(report.Warnings))
+	printEntries("无法转换", report.Untranslated)
+	printEntries("警告", report.Warnings)
+}
+
+func printEntries(title string, entries []modsec.ReportEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, entry := range entries {
+		if entry.RuleID != 0 {
+			fmt.Printf("  第%d行 [%d] %s\n", entry.Line, entry.RuleID, entry.Reason)
+		} else {
+			fmt.Printf("  第%d行 %s\n", entry.Line, entry.Reason)
+		}
+		if entry.Directive != "" {
+			fmt.Printf("      %s\n", entry.Directive)
+		}
+	}
+}
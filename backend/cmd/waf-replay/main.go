@@ -0,0 +1,141 @@
+// waf-replay 将访问日志或HAR文件中的请求回放到指定域名，按指定策略试运行WAF检查，
+// 输出放行和拦截统计以及每条规则命中的请求。回放不计入速率限制，不记录攻击日志。
+//
+//	waf-replay -domain 1 access.log
+//	waf-replay -domain 1 -policies 3,5 -format json access.json
+//	cat session.har | waf-replay -domain 1 -json -
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"waf-go/internal/config"
+	"waf-go/internal/db"
+	"waf-go/internal/replay"
+	"waf-go/internal/service"
+	"waf-go/internal/waf"
+)
+
+func main() {
+	domainID := flag.Uint("domain", 0, "回放到的域名ID")
+	policies := flag.String("policies", "", "使用的策略ID，多个以逗号分隔，为空时使用域名当前关联的策略")
+	format := flag.String("format", replay.FormatAuto, "日志格式："+strings.Join(replay.Formats, ", "))
+	limit := flag.Int("limit", 0, "回放的最大请求数，默认10000")
+	samples := flag.Int("samples", 3, "每条规则输出的命中请求数")
+	jsonOutput := flag.Bool("json", false, "以JSON格式输出回放结果")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s -domain <域名ID> [选项] <日志文件|->\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *domainID == 0 {
+		log.Fatal("必须指定 -domain")
+	}
+	policyIDs, err := parseIDs(*policies)
+	if err != nil {
+		log.Fatalf("策略ID无效: %v", err)
+	}
+	content, err := readInput(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("读取日志文件失败: %v", err)
+	}
+
+	// 加载配置并连接数据库
+	cfg := config.LoadConfig()
+	database := db.InitDB(cfg)
+	wafEngine := waf.NewWAFEngine(database, db.InitRedis(cfg))
+
+	replayService := service.NewReplayService(database, wafEngine)
+	report, err := replayService.Replay(&service.ReplayRequest{
+		Content:   content,
+		Format:    *format,
+		DomainID:  *domainID,
+		PolicyIDs: policyIDs,
+		Limit:     *limit,
+	})
+	if err != nil {
+		log.Fatalf("回放失败: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(report)
+		return
+	}
+	printReport(report, *samples)
+}
+
+// parseIDs 解析逗号分隔的ID
+func parseIDs(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// readInput 读取日志文件，文件名为空或-时读取标准输入
+func readInput(path string) (string, error) {
+	if path == "" || path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("输出JSON失败: %v", err)
+	}
+}
+
+func printReport(report *service.ReplayReport, samples int) {
+	policies := "域名当前关联的策略"
+	if len(report.PolicyIDs) > 0 {
+		policies = fmt.Sprintf("策略 %v", report.PolicyIDs)
+	}
+	fmt.Printf("回放到 %s (ID %d)，%s，日志格式 %s\n", report.Domain, report.DomainID, policies, report.Format)
+	fmt.Printf("请求 %d: 放行 %d, 拦截 %d, 本应拦截 %d, 质询 %d, 记录 %d\n",
+		report.Total, report.Allowed, report.Blocked, report.WouldBlock, report.Challenged, report.Logged)
+	if report.Skipped > 0 || report.Failed > 0 {
+		fmt.Printf("无法解析 %d 行，无法构造 %d 个请求\n", report.Skipped, report.Failed)
+		for _, parseError := range report.ParseErrors {
+			fmt.Printf("  第%d行: %s\n", parseError.Line, parseError.Message)
+		}
+	}
+	if report.Truncated {
+		fmt.Println("请求数超过限制，超出部分未回放")
+	}
+
+	for _, rule := range report.Rules {
+		fmt.Printf("\n规则 %s (ID %d): 命中 %d, 拦截 %d\n", rule.Name, rule.RuleID, rule.Hits, rule.Blocks)
+		for i, hit := range rule.Requests {
+			if i >= samples {
+				break
+			}
+			status := "-"
+			if hit.Status != 0 {
+				status = strconv.Itoa(hit.Status)
+			}
+			fmt.Printf("  第%d行 %s %s %s 原状态码 %s -> %s: %s\n",
+				hit.Line, hit.ClientIP, hit.Method, hit.URL, status, hit.Action, hit.MatchValue)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"waf-go/internal/config"
+	"waf-go/internal/models"
+	"waf-go/internal/utils"
+
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+)
+
+// ACME证书状态
+const (
+	ACMEStatusPending = "pending"
+	ACMEStatusIssuing = "issuing"
+	ACMEStatusValid   = "valid"
+	ACMEStatusFailed  = "failed"
+)
+
+// ACME验证方式
+const (
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// ACMEManager ACME证书管理器，负责签发、续期并提供证书
+type ACMEManager struct {
+	db  *gorm.DB
+	cfg config.ACMEConfig
+
+	clientMu sync.Mutex
+	client   *acme.Client
+
+	httpTokens sync.Map // HTTP-01: token -> key authorization
+	alpnCerts  sync.Map // TLS-ALPN-01: 域名 -> *tls.Certificate
+	inflight   sync.Map // 正在签发的域名ID
+
+	store *Store // 已签发证书写入共享证书存储
+}
+
+// NewACMEManager 创建ACME证书管理器，并向证书存储注册TLS-ALPN-01验证证书
+func NewACMEManager(db *gorm.DB, cfg config.ACMEConfig, store *Store) *ACMEManager {
+	m := &ACMEManager{
+		db:    db,
+		cfg:   cfg,
+		store: store,
+	}
+	store.challenge = m.challengeCertificate
+	return m
+}
+
+// Enabled 是否启用ACME
+func (m *ACMEManager) Enabled() bool {
+	return m.cfg.Enabled
+}
+
+// Start 加载已签发的证书并启动后台续期任务
+func (m *ACMEManager) Start(ctx context.Context) {
+	if !m.cfg.Enabled {
+		return
+	}
+
+	if err := m.LoadCertificates(); err != nil {
+		log.Printf("Failed to load ACME certificates: %v", err)
+	}
+
+	interval := time.Duration(m.cfg.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		m.RenewDue(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.RenewDue(ctx)
+			}
+		}
+	}()
+}
+
+// LoadCertificates 从数据库加载所有已签发的ACME证书到证书存储（续期失败的旧证书在过期前仍可使用）
+func (m *ACMEManager) LoadCertificates() error {
+	var records []models.ACMECertificate
+	if err := m.db.Where("certificate <> ''").Find(&records).Error; err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		cert, err := m.decodeCertificate(&record)
+		if err != nil {
+			log.Printf("Failed to decode ACME certificate for %s: %v", record.Domain, err)
+			continue
+		}
+		m.store.SetACMECertificate(recordDomain(&record), cert)
+	}
+
+	log.Printf("Loaded %d ACME certificates", len(records))
+	return nil
+}
+
+// RenewDue 为缺少证书、即将过期或上次失败已过退避时间的域名签发证书
+func (m *ACMEManager) RenewDue(ctx context.Context) {
+	var domains []models.Domain
+	if err := m.db.Where("cert_source = ? AND enabled = ?", "acme", true).Find(&domains).Error; err != nil {
+		log.Printf("Failed to list ACME domains: %v", err)
+		return
+	}
+
+	renewBefore := time.Duration(m.cfg.RenewBeforeDays) * 24 * time.Hour
+	now := time.Now()
+
+	for i := range domains {
+		domain := &domains[i]
+		var record models.ACMECertificate
+		err := m.db.Where("domain_id = ?", domain.ID).First(&record).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to get ACME status for %s: %v", domain.Domain, err)
+			continue
+		}
+
+		due := errors.Is(err, gorm.ErrRecordNotFound) ||
+			record.Domain != domain.Domain ||
+			record.NotAfter == nil ||
+			record.NotAfter.Sub(now) < renewBefore
+		if !due {
+			continue
+		}
+
+		// 失败后按失败次数退避，最长24小时
+		if record.Status == ACMEStatusFailed && record.LastAttemptAt != nil {
+			backoff := time.Duration(record.FailureCount) * time.Hour
+			if backoff > 24*time.Hour {
+				backoff = 24 * time.Hour
+			}
+			if now.Sub(*record.LastAttemptAt) < backoff {
+				continue
+			}
+		}
+
+		if err := m.Obtain(ctx, domain); err != nil {
+			log.Printf("ACME renewal failed for %s: %v", domain.Domain, err)
+		}
+	}
+}
+
+// RequestCertificate 异步为域名签发证书
+func (m *ACMEManager) RequestCertificate(domain *models.Domain) {
+	if !m.cfg.Enabled {
+		return
+	}
+	d := *domain
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := m.Obtain(ctx, &d); err != nil {
+			log.Printf("ACME issuance failed for %s: %v", d.Domain, err)
+		}
+	}()
+}
+
+// Obtain 为域名签发（或续期）证书并保存
+func (m *ACMEManager) Obtain(ctx context.Context, domain *models.Domain) error {
+	if !m.cfg.Enabled {
+		return errors.New("ACME未启用")
+	}
+	if _, busy := m.inflight.LoadOrStore(domain.ID, struct{}{}); busy {
+		return fmt.Errorf("域名 %s 正在签发证书", domain.Domain)
+	}
+	defer m.inflight.Delete(domain.ID)
+
+	record := m.markAttempt(domain)
+
+	certPEM, keyPEM, err := m.issue(ctx, domain)
+	if err != nil {
+		m.markFailure(record, err)
+		return err
+	}
+
+	if err := m.saveCertificate(record, certPEM, keyPEM); err != nil {
+		m.markFailure(record, err)
+		return err
+	}
+
+	log.Printf("ACME certificate issued for %s", domain.Domain)
+	return nil
+}
+
+// issue 完成ACME订单流程，返回PEM格式的证书链和私钥
+func (m *ACMEManager) issue(ctx context.Context, domain *models.Domain) ([]byte, []byte, error) {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain.Domain))
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建订单失败: %v", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL, domain); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("等待订单就绪失败: %v", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain.Domain},
+		DNSNames: []string{domain.Domain},
+	}, certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodePrivateKey(certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// authorize 完成单个授权的验证
+func (m *ACMEManager) authorize(ctx context.Context, client *acme.Client, authzURL string, domain *models.Domain) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("获取授权失败: %v", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	challengeType := domain.ACMEChallenge
+	if challengeType == "" {
+		challengeType = ChallengeHTTP01
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == challengeType {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("ACME服务未提供 %s 验证方式", challengeType)
+	}
+
+	switch challengeType {
+	case ChallengeHTTP01:
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		m.httpTokens.Store(challenge.Token, keyAuth)
+		defer m.httpTokens.Delete(challenge.Token)
+	case ChallengeTLSALPN01:
+		cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain.Domain)
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(domain.Domain)
+		m.alpnCerts.Store(name, &cert)
+		defer m.alpnCerts.Delete(name)
+	default:
+		return fmt.Errorf("不支持的验证方式: %s", challengeType)
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("提交验证失败: %v", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("域名验证失败: %v", err)
+	}
+	return nil
+}
+
+// getClient 获取ACME客户端，首次调用时加载或注册账户
+func (m *ACMEManager) getClient(ctx context.Context) (*acme.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	httpClient, err := m.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var account models.ACMEAccount
+	err = m.db.Where("directory_url = ?", m.cfg.DirectoryURL).First(&account).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取ACME账户失败: %v", err)
+	}
+
+	if err == nil {
+		keyPEM, err := utils.DecryptString(m.cfg.EncryptionKey, account.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("解密ACME账户私钥失败: %v", err)
+		}
+		key, err := parsePrivateKey([]byte(keyPEM))
+		if err != nil {
+			return nil, err
+		}
+		m.client = &acme.Client{
+			Key:          key,
+			DirectoryURL: m.cfg.DirectoryURL,
+			HTTPClient:   httpClient,
+			KID:          acme.KeyID(account.AccountURL),
+		}
+		return m.client, nil
+	}
+
+	// 注册新账户
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: m.cfg.DirectoryURL,
+		HTTPClient:   httpClient,
+	}
+
+	acct := &acme.Account{}
+	if m.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	registered, err := client.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil {
+		return nil, fmt.Errorf("注册ACME账户失败: %v", err)
+	}
+
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := utils.EncryptString(m.cfg.EncryptionKey, string(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("加密ACME账户私钥失败: %v", err)
+	}
+
+	account = models.ACMEAccount{
+		DirectoryURL: m.cfg.DirectoryURL,
+		Email:        m.cfg.Email,
+		AccountURL:   registered.URI,
+		PrivateKey:   encryptedKey,
+	}
+	if err := m.db.Create(&account).Error; err != nil {
+		return nil, fmt.Errorf("保存ACME账户失败: %v", err)
+	}
+
+	m.client = client
+	return m.client, nil
+}
+
+// httpClient 构建访问ACME服务的HTTP客户端，支持信任本地测试CA
+func (m *ACMEManager) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: m.cfg.InsecureSkipVerify,
+	}
+
+	if m.cfg.CACertFile != "" {
+		caPEM, err := os.ReadFile(m.cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取ACME CA证书失败: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("ACME CA证书格式无效")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: 60 * time.Second}, nil
+}
+
+// markAttempt 记录一次签发尝试
+func (m *ACMEManager) markAttempt(domain *models.Domain) *models.ACMECertificate {
+	now := time.Now()
+	var record models.ACMECertificate
+	err := m.db.Where("domain_id = ?", domain.ID).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		record = models.ACMECertificate{
+			DomainID: domain.ID,
+			Domain:   domain.Domain,
+			Status:   ACMEStatusIssuing,
+			TenantID: domain.TenantID,
+		}
+		record.LastAttemptAt = &now
+		if err := m.db.Create(&record).Error; err != nil {
+			log.Printf("Failed to create ACME record for %s: %v", domain.Domain, err)
+		}
+		return &record
+	}
+
+	record.Domain = domain.Domain
+	record.Status = ACMEStatusIssuing
+	record.LastAttemptAt = &now
+	m.db.Model(&record).Updates(map[string]interface{}{
+		"domain":          record.Domain,
+		"status":          record.Status,
+		"last_attempt_at": now,
+	})
+	return &record
+}
+
+// markFailure 记录签发失败
+func (m *ACMEManager) markFailure(record *models.ACMECertificate, cause error) {
+	// 内存中的旧证书继续提供服务，失败原因保存下来供界面展示
+	m.db.Model(record).Updates(map[string]interface{}{
+		"status":        ACMEStatusFailed,
+		"last_error":    cause.Error(),
+		"failure_count": gorm.Expr("failure_count + ?", 1),
+	})
+}
+
+// saveCertificate 加密保存证书并加载到证书存储
+func (m *ACMEManager) saveCertificate(record *models.ACMECertificate, certPEM, keyPEM []byte) error {
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("签发的证书无效: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("解析证书失败: %v", err)
+	}
+	tlsCert.Leaf = leaf
+
+	encryptedCert, err := utils.EncryptString(m.cfg.EncryptionKey, string(certPEM))
+	if err != nil {
+		return fmt.Errorf("加密证书失败: %v", err)
+	}
+	encryptedKey, err := utils.EncryptString(m.cfg.EncryptionKey, string(keyPEM))
+	if err != nil {
+		return fmt.Errorf("加密私钥失败: %v", err)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"certificate":   encryptedCert,
+		"private_key":   encryptedKey,
+		"issuer":        leaf.Issuer.String(),
+		"serial_number": leaf.SerialNumber.Text(16),
+		"not_before":    leaf.NotBefore,
+		"not_after":     leaf.NotAfter,
+		"status":        ACMEStatusValid,
+		"last_error":    "",
+		"failure_count": 0,
+		"renewed_at":    now,
+	}
+	if err := m.db.Model(record).Updates(updates).Error; err != nil {
+		return fmt.Errorf("保存证书失败: %v", err)
+	}
+
+	m.store.SetACMECertificate(recordDomain(record), &tlsCert)
+	return nil
+}
+
+// recordDomain 构造证书存储所需的域名信息
+func recordDomain(record *models.ACMECertificate) *models.Domain {
+	return &models.Domain{
+		ID:       record.DomainID,
+		Domain:   record.Domain,
+		TenantID: record.TenantID,
+	}
+}
+
+// decodeCertificate 解密数据库中的证书记录
+func (m *ACMEManager) decodeCertificate(record *models.ACMECertificate) (*tls.Certificate, error) {
+	certPEM, err := utils.DecryptString(m.cfg.EncryptionKey, record.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := utils.DecryptString(m.cfg.EncryptionKey, record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// HTTPChallengeResponse 返回HTTP-01验证的响应内容
+func (m *ACMEManager) HTTPChallengeResponse(token string) (string, bool) {
+	if value, ok := m.httpTokens.Load(token); ok {
+		return value.(string), true
+	}
+	return "", false
+}
+
+// challengeCertificate 返回TLS-ALPN-01验证证书
+func (m *ACMEManager) challengeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	if cert, ok := m.alpnCerts.Load(strings.ToLower(hello.ServerName)); ok {
+		return cert.(*tls.Certificate), true
+	}
+	return nil, false
+}
+
+// Certificate 获取域名已签发的ACME证书
+func (m *ACMEManager) Certificate(domainID uint) (*tls.Certificate, error) {
+	record, err := m.GetStatus(domainID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Certificate == "" {
+		return nil, errors.New("证书尚未签发")
+	}
+	return m.decodeCertificate(record)
+}
+
+// GetStatus 获取域名的ACME证书状态
+func (m *ACMEManager) GetStatus(domainID uint) (*models.ACMECertificate, error) {
+	var record models.ACMECertificate
+	if err := m.db.Where("domain_id = ?", domainID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// RemoveDomain 从证书存储中移除域名的ACME证书
+func (m *ACMEManager) RemoveDomain(domain string) {
+	m.store.RemoveACMECertificate(domain)
+}
+
+// encodePrivateKey 将私钥编码为PEM格式
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parsePrivateKey 解析PEM格式的私钥
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("私钥格式无效")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("不支持的私钥类型")
+	}
+	return signer, nil
+}
@@ -0,0 +1,105 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// 客户端证书认证模式
+const (
+	ClientAuthNone          = "none"            // 不请求客户端证书
+	ClientAuthOptional      = "optional"        // 请求客户端证书但不校验
+	ClientAuthRequired      = "required"        // 必须提供由CA签发的客户端证书
+	ClientAuthVerifyIfGiven = "verify_if_given" // 提供了客户端证书时必须由CA签发
+)
+
+// ClientCertInfo 客户端证书信息
+type ClientCertInfo struct {
+	Subject     string
+	Issuer      string
+	SANs        []string
+	Fingerprint string // SHA-256指纹，小写十六进制
+	Serial      string
+	Verified    bool // 是否已通过域名CA校验
+}
+
+// clientAuth 域名的客户端证书认证配置
+type clientAuth struct {
+	mode   string
+	pool   *x509.CertPool
+	config *tls.Config // 握手时使用的TLS配置
+}
+
+// ParseClientCAs 解析PEM格式的客户端CA证书包
+func ParseClientCAs(caPEM string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("客户端CA证书格式无效")
+	}
+	return pool, nil
+}
+
+// ClientCertificate 从TLS连接状态中提取客户端证书信息，未提供证书时返回nil
+func ClientCertificate(state *tls.ConnectionState) *ClientCertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := state.PeerCertificates[0]
+	return &ClientCertInfo{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		SANs:        subjectAltNames(cert),
+		Fingerprint: Fingerprint(cert),
+		Serial:      cert.SerialNumber.Text(16),
+		Verified:    len(state.VerifiedChains) > 0,
+	}
+}
+
+// Fingerprint 返回证书的SHA-256指纹（小写十六进制，无分隔符）
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint 规范化用户输入的指纹，兼容带冒号、空格和大写的格式
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256:")
+	return strings.NewReplacer(":", "", " ", "", "-", "").Replace(fingerprint)
+}
+
+// subjectAltNames 汇总证书的DNS、邮箱、URI和IP类型SAN
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	return sans
+}
+
+// tlsClientAuthType 将认证模式转换为TLS握手参数
+func tlsClientAuthType(mode string) tls.ClientAuthType {
+	switch mode {
+	case ClientAuthOptional:
+		return tls.RequestClientCert
+	case ClientAuthRequired:
+		return tls.RequireAndVerifyClientCert
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven
+	default:
+		return tls.NoClientCert
+	}
+}
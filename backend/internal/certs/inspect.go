@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CertificateDetail 证书详情
+type CertificateDetail struct {
+	DomainID      uint      `json:"domain_id"`
+	Domain        string    `json:"domain"`
+	Source        string    `json:"source"`
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	DNSNames      []string  `json:"dns_names"`
+	KeyType       string    `json:"key_type"`
+	SerialNumber  string    `json:"serial_number"`
+	NotBefore     time.Time `json:"not_before"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	ChainLength   int       `json:"chain_length"`
+	SelfSigned    bool      `json:"self_signed"`
+	Warnings      []string  `json:"warnings,omitempty"` // 不影响使用但需要注意的问题，如系统根证书无法验证证书链
+}
+
+// Inspect 提取证书详情
+func Inspect(cert *tls.Certificate) *CertificateDetail {
+	leaf := cert.Leaf
+	return &CertificateDetail{
+		Subject:       leaf.Subject.String(),
+		Issuer:        leaf.Issuer.String(),
+		DNSNames:      leaf.DNSNames,
+		KeyType:       KeyType(leaf),
+		SerialNumber:  leaf.SerialNumber.Text(16),
+		NotBefore:     leaf.NotBefore,
+		NotAfter:      leaf.NotAfter,
+		DaysRemaining: DaysRemaining(leaf.NotAfter),
+		ChainLength:   len(cert.Certificate),
+		SelfSigned:    isSelfSigned(leaf),
+		Warnings:      chainWarnings(cert),
+	}
+}
+
+// chainWarnings 只有叶子证书且不是自签名时，用系统根证书校验以发现缺少的中间证书。
+// 私有CA签发的证书同样无法通过校验，因此只作为警告，不拒绝上传
+func chainWarnings(cert *tls.Certificate) []string {
+	leaf := cert.Leaf
+	if len(cert.Certificate) != 1 || isSelfSigned(leaf) {
+		return nil
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{}); err != nil {
+		var unknown x509.UnknownAuthorityError
+		if errors.As(err, &unknown) {
+			return []string{"系统根证书无法验证该证书：证书链可能不完整（请同时上传中间证书），或证书由私有CA签发"}
+		}
+	}
+	return nil
+}
+
+// DaysRemaining 返回距离过期的天数，已过期时为负数
+func DaysRemaining(notAfter time.Time) int {
+	return int(time.Until(notAfter).Hours() / 24)
+}
+
+// ValidateKeyPair 上传时校验证书：私钥是否匹配、是否在有效期内、证书链顺序和签名是否正确、是否覆盖域名。
+// 证书链能否由系统根证书验证不在此校验，见chainWarnings
+func ValidateKeyPair(domain, certPEM, keyPEM string) (*tls.Certificate, error) {
+	cert, err := ParseKeyPair(certPEM, keyPEM)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not match") {
+			return nil, errors.New("证书与私钥不匹配")
+		}
+		return nil, fmt.Errorf("证书或私钥格式无效: %v", err)
+	}
+	leaf := cert.Leaf
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("证书尚未生效，生效时间: %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("证书已过期，过期时间: %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if domain != "" && !coversDomain(leaf, domain) {
+		return nil, fmt.Errorf("证书不包含域名 %s，证书域名: %s", domain, strings.Join(leaf.DNSNames, ", "))
+	}
+
+	// 证书链中每张证书必须由下一张签发
+	chain := []*x509.Certificate{leaf}
+	for i, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("证书链第%d张证书无效: %v", i+2, err)
+		}
+		chain = append(chain, c)
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, fmt.Errorf("证书链顺序错误：第%d张证书不是由第%d张证书签发", i+1, i+2)
+		}
+	}
+
+	return cert, nil
+}
+
+// coversDomain 检查证书是否覆盖域名，支持通配符域名配置
+func coversDomain(leaf *x509.Certificate, domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if strings.HasPrefix(domain, "*.") {
+		for _, name := range leaf.DNSNames {
+			if strings.EqualFold(name, domain) {
+				return true
+			}
+		}
+		return false
+	}
+	if domain == "*" {
+		return true
+	}
+	return leaf.VerifyHostname(domain) == nil
+}
+
+// isSelfSigned 是否为自签名证书
+func isSelfSigned(cert *x509.Certificate) bool {
+	if cert.Subject.String() != cert.Issuer.String() {
+		return false
+	}
+	// 自签名叶子证书通常不是CA证书，不能用CheckSignatureFrom
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,612 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"waf-go/internal/config"
+	"waf-go/internal/models"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/ocsp"
+)
+
+// 证书来源
+const (
+	SourceManual = "manual" // 域名配置中上传的主证书
+	SourceExtra  = "extra"  // 域名附加证书
+	SourceACME   = "acme"   // ACME自动签发
+)
+
+// storedCert 存储中的一张证书
+type storedCert struct {
+	cert     *tls.Certificate
+	domain   string
+	domainID uint
+	tenantID uint
+	source   string
+	keyType  string
+}
+
+// CertificateInfo 证书信息，用于到期列表展示
+type CertificateInfo struct {
+	DomainID      uint      `json:"domain_id"`
+	Domain        string    `json:"domain"`
+	TenantID      uint      `json:"tenant_id"`
+	Source        string    `json:"source"`
+	KeyType       string    `json:"key_type"`
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	DNSNames      []string  `json:"dns_names"`
+	SerialNumber  string    `json:"serial_number"`
+	NotBefore     time.Time `json:"not_before"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	OCSPStapled   bool      `json:"ocsp_stapled"`
+}
+
+// Store SNI证书存储，DomainService、ACME管理器和HTTPS监听器共享同一实例
+type Store struct {
+	cfg config.TLSConfig
+
+	mu          sync.RWMutex
+	certs       map[string][]*storedCert // 域名（小写，可为*.example.com或*）-> 证书列表
+	clientAuths map[string]*clientAuth   // 域名 -> 客户端证书认证配置
+	defaultCert *tls.Certificate
+
+	// challenge 返回ACME TLS-ALPN-01验证证书
+	challenge func(hello *tls.ClientHelloInfo) (*tls.Certificate, bool)
+
+	ocspClient *http.Client
+}
+
+// NewStore 创建证书存储并加载默认证书
+func NewStore(cfg config.TLSConfig) *Store {
+	s := &Store{
+		cfg:         cfg,
+		certs:       make(map[string][]*storedCert),
+		clientAuths: make(map[string]*clientAuth),
+		ocspClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := s.loadDefaultCertificate(); err != nil {
+		log.Printf("Failed to load default certificate: %v", err)
+	}
+	return s
+}
+
+// TLSConfig 返回HTTPS监听器使用的TLS配置
+func (s *Store) TLSConfig() *tls.Config {
+	config := s.baseTLSConfig()
+	config.GetConfigForClient = s.getConfigForClient
+	return config
+}
+
+// baseTLSConfig 不含客户端证书认证的基础TLS配置
+func (s *Store) baseTLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// getConfigForClient 根据SNI返回启用了客户端证书认证的TLS配置，未启用时返回nil使用基础配置
+func (s *Store) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	// ACME验证连接不请求客户端证书
+	for _, proto := range hello.SupportedProtos {
+		if proto == acme.ALPNProto {
+			return nil, nil
+		}
+	}
+
+	if auth := s.lookupClientAuth(hello.ServerName); auth != nil {
+		return auth.config, nil
+	}
+	return nil, nil
+}
+
+// lookupClientAuth 查找域名的客户端证书认证配置
+func (s *Store) lookupClientAuth(name string) *clientAuth {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range lookupKeys(name) {
+		if auth, ok := s.clientAuths[key]; ok {
+			return auth
+		}
+	}
+	return nil
+}
+
+// VerifyClientAuth 在HTTP层校验客户端证书，防止客户端用未启用认证的SNI握手后通过Host访问启用认证的域名
+func (s *Store) VerifyClientAuth(host string, state *tls.ConnectionState) error {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	auth := s.lookupClientAuth(host)
+	if auth == nil || auth.mode == ClientAuthOptional {
+		return nil
+	}
+
+	if state == nil || len(state.PeerCertificates) == 0 {
+		if auth.mode == ClientAuthRequired {
+			return errors.New("client certificate required")
+		}
+		return nil
+	}
+
+	// 握手时已按同一配置校验过
+	if len(state.VerifiedChains) > 0 && s.lookupClientAuth(state.ServerName) == auth {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         auth.pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("client certificate verification failed: %v", err)
+	}
+	return nil
+}
+
+// setClientAuth 设置域名的客户端证书认证配置
+func (s *Store) setClientAuth(domain *models.Domain) error {
+	name := strings.ToLower(domain.Domain)
+	mode := domain.ClientAuthMode
+	if mode == "" || mode == ClientAuthNone {
+		s.mu.Lock()
+		delete(s.clientAuths, name)
+		s.mu.Unlock()
+		return nil
+	}
+
+	auth := &clientAuth{mode: mode}
+	if domain.ClientCACerts != "" {
+		pool, err := ParseClientCAs(domain.ClientCACerts)
+		if err != nil {
+			return err
+		}
+		auth.pool = pool
+	} else if mode != ClientAuthOptional {
+		return errors.New("client CA bundle is required")
+	}
+
+	config := s.baseTLSConfig()
+	config.ClientAuth = tlsClientAuthType(mode)
+	config.ClientCAs = auth.pool
+	auth.config = config
+
+	s.mu.Lock()
+	s.clientAuths[name] = auth
+	s.mu.Unlock()
+	return nil
+}
+
+// GetCertificate 根据SNI选择证书：精确匹配 > 通配符 > 全局域名(*) > 默认证书
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.challenge != nil {
+		for _, proto := range hello.SupportedProtos {
+			if proto == acme.ALPNProto {
+				if cert, ok := s.challenge(hello); ok {
+					return cert, nil
+				}
+				return nil, fmt.Errorf("no ACME challenge for domain: %s", hello.ServerName)
+			}
+		}
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range lookupKeys(name) {
+		if cert := selectCertificate(s.certs[key], hello); cert != nil {
+			return cert, nil
+		}
+	}
+
+	if s.defaultCert != nil {
+		return s.defaultCert, nil
+	}
+	return nil, fmt.Errorf("no certificate for domain: %s", name)
+}
+
+// lookupKeys 返回SNI依次尝试的存储键
+func lookupKeys(name string) []string {
+	keys := []string{}
+	if name != "" {
+		keys = append(keys, name)
+		if idx := strings.Index(name, "."); idx > 0 {
+			keys = append(keys, "*"+name[idx:])
+		}
+	}
+	return append(keys, "*")
+}
+
+// selectCertificate 在同一域名的多张证书中选择客户端支持的一张（ECDSA优先）
+func selectCertificate(certs []*storedCert, hello *tls.ClientHelloInfo) *tls.Certificate {
+	if len(certs) == 0 {
+		return nil
+	}
+	for _, c := range certs {
+		if hello.SupportsCertificate(c.cert) == nil {
+			return c.cert
+		}
+	}
+	// 没有完全匹配时仍返回第一张，由握手给出具体错误
+	return certs[0].cert
+}
+
+// UpdateDomain 热加载域名的手动证书和附加证书（域名仍使用ACME时保留ACME证书）
+func (s *Store) UpdateDomain(domain *models.Domain, extra []models.DomainCertificate) error {
+	name := strings.ToLower(domain.Domain)
+	if !domain.Enabled || domain.Protocol != "https" {
+		s.RemoveDomain(domain.Domain)
+		return nil
+	}
+
+	if err := s.setClientAuth(domain); err != nil {
+		return fmt.Errorf("invalid client CA certificates: %v", err)
+	}
+
+	var loaded []*storedCert
+	if domain.CertSource != SourceACME && domain.SSLCertificate != "" {
+		cert, err := ParseKeyPair(domain.SSLCertificate, domain.SSLPrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid SSL certificate: %v", err)
+		}
+		loaded = append(loaded, newStoredCert(cert, domain, SourceManual))
+	}
+	for _, item := range extra {
+		if !item.Enabled {
+			continue
+		}
+		cert, err := ParseKeyPair(item.Certificate, item.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid SSL certificate #%d: %v", item.ID, err)
+		}
+		loaded = append(loaded, newStoredCert(cert, domain, SourceExtra))
+	}
+
+	s.mu.Lock()
+	for _, c := range s.certs[name] {
+		if c.source == SourceACME && domain.CertSource == SourceACME {
+			loaded = append(loaded, c)
+		}
+	}
+	s.setLocked(name, loaded)
+	s.mu.Unlock()
+
+	go s.refreshOCSP(name)
+	return nil
+}
+
+// SetACMECertificate 设置域名的ACME证书
+func (s *Store) SetACMECertificate(domain *models.Domain, cert *tls.Certificate) {
+	name := strings.ToLower(domain.Domain)
+
+	s.mu.Lock()
+	loaded := []*storedCert{newStoredCert(cert, domain, SourceACME)}
+	for _, c := range s.certs[name] {
+		if c.source != SourceACME {
+			loaded = append(loaded, c)
+		}
+	}
+	s.setLocked(name, loaded)
+	s.mu.Unlock()
+
+	go s.refreshOCSP(name)
+}
+
+// RemoveACMECertificate 移除域名的ACME证书，保留其他来源的证书
+func (s *Store) RemoveACMECertificate(domain string) {
+	name := strings.ToLower(domain)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []*storedCert
+	for _, c := range s.certs[name] {
+		if c.source != SourceACME {
+			kept = append(kept, c)
+		}
+	}
+	s.setLocked(name, kept)
+}
+
+// RemoveDomain 移除域名的全部证书和客户端证书认证配置
+func (s *Store) RemoveDomain(domain string) {
+	name := strings.ToLower(domain)
+	s.mu.Lock()
+	delete(s.certs, name)
+	delete(s.clientAuths, name)
+	s.mu.Unlock()
+}
+
+// setLocked 按ECDSA优先、过期时间倒序排序后保存，调用方需持有写锁
+func (s *Store) setLocked(name string, certs []*storedCert) {
+	if len(certs) == 0 {
+		delete(s.certs, name)
+		return
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		ei := strings.HasPrefix(certs[i].keyType, "ECDSA")
+		ej := strings.HasPrefix(certs[j].keyType, "ECDSA")
+		if ei != ej {
+			return ei
+		}
+		return certs[i].cert.Leaf.NotAfter.After(certs[j].cert.Leaf.NotAfter)
+	})
+	s.certs[name] = certs
+}
+
+// List 列出存储中的全部证书，按到期时间升序
+func (s *Store) List() []CertificateInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []CertificateInfo
+	for _, certs := range s.certs {
+		for _, c := range certs {
+			leaf := c.cert.Leaf
+			infos = append(infos, CertificateInfo{
+				DomainID:      c.domainID,
+				Domain:        c.domain,
+				TenantID:      c.tenantID,
+				Source:        c.source,
+				KeyType:       c.keyType,
+				Subject:       leaf.Subject.String(),
+				Issuer:        leaf.Issuer.String(),
+				DNSNames:      leaf.DNSNames,
+				SerialNumber:  leaf.SerialNumber.Text(16),
+				NotBefore:     leaf.NotBefore,
+				NotAfter:      leaf.NotAfter,
+				DaysRemaining: DaysRemaining(leaf.NotAfter),
+				OCSPStapled:   len(c.cert.OCSPStaple) > 0,
+			})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].NotAfter.Before(infos[j].NotAfter)
+	})
+	return infos
+}
+
+// StartOCSPStapling 启动OCSP响应定时刷新
+func (s *Store) StartOCSPStapling(ctx context.Context) {
+	if !s.cfg.OCSPStapling {
+		return
+	}
+
+	interval := time.Duration(s.cfg.OCSPRefreshInterval) * time.Second
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.mu.RLock()
+				names := make([]string, 0, len(s.certs))
+				for name := range s.certs {
+					names = append(names, name)
+				}
+				s.mu.RUnlock()
+				for _, name := range names {
+					s.refreshOCSP(name)
+				}
+			}
+		}
+	}()
+}
+
+// refreshOCSP 为域名的证书获取OCSP响应并装订
+func (s *Store) refreshOCSP(name string) {
+	if !s.cfg.OCSPStapling {
+		return
+	}
+
+	s.mu.RLock()
+	current := append([]*storedCert(nil), s.certs[name]...)
+	s.mu.RUnlock()
+
+	for _, c := range current {
+		staple, err := s.fetchOCSP(c.cert)
+		if err != nil {
+			log.Printf("OCSP fetch failed for %s: %v", name, err)
+			continue
+		}
+		if staple == nil {
+			continue
+		}
+
+		// 复制证书后替换，避免与正在进行的握手产生数据竞争
+		stapled := *c.cert
+		stapled.OCSPStaple = staple
+
+		s.mu.Lock()
+		for i, existing := range s.certs[name] {
+			if existing == c {
+				updated := *c
+				updated.cert = &stapled
+				s.certs[name][i] = &updated
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// fetchOCSP 向证书中声明的OCSP服务查询状态，证书未声明OCSP服务或缺少签发者时返回nil
+func (s *Store) fetchOCSP(cert *tls.Certificate) ([]byte, error) {
+	leaf := cert.Leaf
+	if leaf == nil || len(leaf.OCSPServer) == 0 || len(cert.Certificate) < 2 {
+		return nil, nil
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.ocspClient.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned %d", resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Status != ocsp.Good {
+		return nil, fmt.Errorf("certificate OCSP status is %d", parsed.Status)
+	}
+	return raw, nil
+}
+
+// loadDefaultCertificate 加载配置的默认证书，未配置时生成自签名证书
+func (s *Store) loadDefaultCertificate() error {
+	if s.cfg.DefaultCertFile != "" && s.cfg.DefaultKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.DefaultCertFile, s.cfg.DefaultKeyFile)
+		if err != nil {
+			return err
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+		s.defaultCert = &cert
+		return nil
+	}
+
+	cert, err := selfSignedCertificate("waf-default")
+	if err != nil {
+		return err
+	}
+	s.defaultCert = cert
+	return nil
+}
+
+// newStoredCert 创建存储条目
+func newStoredCert(cert *tls.Certificate, domain *models.Domain, source string) *storedCert {
+	return &storedCert{
+		cert:     cert,
+		domain:   domain.Domain,
+		domainID: domain.ID,
+		tenantID: domain.TenantID,
+		source:   source,
+		keyType:  KeyType(cert.Leaf),
+	}
+}
+
+// ParseKeyPair 解析PEM格式的证书和私钥，并填充Leaf
+func ParseKeyPair(certPEM, keyPEM string) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// KeyType 返回证书公钥类型描述，如 RSA-2048、ECDSA-P256
+func KeyType(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + strings.ReplaceAll(pub.Curve.Params().Name, "-", "")
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return "unknown"
+	}
+}
+
+// selfSignedCertificate 生成自签名证书，作为没有匹配证书时的兜底
+func selfSignedCertificate(commonName string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if leaf == nil {
+		return nil, errors.New("failed to parse self-signed certificate")
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -21,6 +21,8 @@ type Config struct {
 	Redis    RedisConfig    `yaml:"redis" json:"redis"`
 	WAF      WAFConfig      `yaml:"waf" json:"waf"`
 	JWT      JWTConfig      `yaml:"jwt" json:"jwt"`
+	ACME     ACMEConfig     `yaml:"acme" json:"acme"`
+	TLS      TLSConfig      `yaml:"tls" json:"tls"`
 }
 
 // ServerConfig 服务器配置
@@ -28,6 +30,7 @@ type ServerConfig struct {
 	Mode      string `yaml:"mode" json:"mode"`
 	HTTPPort  int    `yaml:"http_port" json:"http_port"`
 	HTTPSPort int    `yaml:"https_port" json:"https_port"`
+	H2C       bool   `yaml:"h2c" json:"h2c"` // HTTP端口是否接受HTTP/2明文（h2c）连接，供内网gRPC客户端使用
 }
 
 // DatabaseConfig 数据库配置
@@ -51,11 +54,14 @@ type RedisConfig struct {
 
 // WAFConfig WAF配置
 type WAFConfig struct {
-	RateLimitWindow int  `yaml:"rate_limit_window" json:"rate_limit_window"`
-	MaxRequests     int  `yaml:"max_requests" json:"max_requests"`
-	EnableRateLimit bool `yaml:"enable_rate_limit" json:"enable_rate_limit"`
-	EnableBlacklist bool `yaml:"enable_blacklist" json:"enable_blacklist"`
-	EnableWhitelist bool `yaml:"enable_whitelist" json:"enable_whitelist"`
+	RateLimitWindow int    `yaml:"rate_limit_window" json:"rate_limit_window"`
+	MaxRequests     int    `yaml:"max_requests" json:"max_requests"`
+	EnableRateLimit bool   `yaml:"enable_rate_limit" json:"enable_rate_limit"`
+	EnableBlacklist bool   `yaml:"enable_blacklist" json:"enable_blacklist"`
+	EnableWhitelist bool   `yaml:"enable_whitelist" json:"enable_whitelist"`
+	GeoIPDatabase   string `yaml:"geoip_database" json:"geoip_database"` // MaxMind GeoIP2/GeoLite2 City数据库路径，供规则表达式查询客户端地理位置
+	ClamAVAddress   string `yaml:"clamav_address" json:"clamav_address"` // clamd地址，unix socket路径（如 /var/run/clamav/clamd.ctl）或 host:port，供文件上传策略扫描文件
+	ClamAVTimeout   int    `yaml:"clamav_timeout" json:"clamav_timeout"` // 扫描单个文件的超时时间（秒）
 }
 
 // JWTConfig JWT配置
@@ -64,6 +70,28 @@ type JWTConfig struct {
 	Expire int    `yaml:"expire" json:"expire"`
 }
 
+// ACMEConfig ACME自动证书配置
+type ACMEConfig struct {
+	Enabled            bool   `yaml:"enabled" json:"enabled"`
+	DirectoryURL       string `yaml:"directory_url" json:"directory_url"`               // ACME目录地址，测试时可指向本地Pebble等CA
+	Email              string `yaml:"email" json:"email"`                               // 账户联系邮箱
+	CACertFile         string `yaml:"ca_cert_file" json:"ca_cert_file"`                 // 访问ACME服务时额外信任的根证书（本地测试CA）
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"` // 跳过ACME服务的TLS校验，仅用于测试
+	RenewBeforeDays    int    `yaml:"renew_before_days" json:"renew_before_days"`       // 证书到期前多少天开始续期
+	CheckInterval      int    `yaml:"check_interval" json:"check_interval"`             // 续期检查间隔（秒）
+	EncryptionKey      string `yaml:"encryption_key" json:"-"`                          // 证书和私钥入库加密密钥
+}
+
+// TLSConfig HTTPS监听器证书配置
+type TLSConfig struct {
+	DefaultCertFile     string `yaml:"default_cert_file" json:"default_cert_file"`         // 没有匹配证书时使用的默认证书，未配置时使用自签名证书
+	DefaultKeyFile      string `yaml:"default_key_file" json:"default_key_file"`           // 默认证书私钥
+	OCSPStapling        bool   `yaml:"ocsp_stapling" json:"ocsp_stapling"`                 // 是否启用OCSP装订
+	OCSPRefreshInterval int    `yaml:"ocsp_refresh_interval" json:"ocsp_refresh_interval"` // OCSP响应刷新间隔（秒）
+	ExpiryAlertDays     []int  `yaml:"expiry_alert_days" json:"expiry_alert_days"`         // 证书到期告警阈值（天）
+	ExpiryCheckInterval int    `yaml:"expiry_check_interval" json:"expiry_check_interval"` // 证书到期检查间隔（秒）
+}
+
 // LoadConfig 加载配置
 func LoadConfig() *Config {
 	once.Do(func() {
@@ -95,11 +123,25 @@ func LoadConfig() *Config {
 				EnableRateLimit: true,
 				EnableBlacklist: true,
 				EnableWhitelist: true,
+				ClamAVTimeout:   30,
 			},
 			JWT: JWTConfig{
 				Secret: "waf-secret-key-change-in-production",
 				Expire: 86400, // 24小时
 			},
+			ACME: ACMEConfig{
+				Enabled:         false,
+				DirectoryURL:    "https://acme-v02.api.letsencrypt.org/directory",
+				RenewBeforeDays: 30,
+				CheckInterval:   3600,
+				EncryptionKey:   "waf-acme-key-change-in-production",
+			},
+			TLS: TLSConfig{
+				OCSPStapling:        true,
+				OCSPRefreshInterval: 21600,
+				ExpiryAlertDays:     []int{30, 14, 3},
+				ExpiryCheckInterval: 3600,
+			},
 		}
 
 		// 从配置文件加载
@@ -167,10 +209,35 @@ func loadFromEnv() {
 		config.JWT.Secret = secret
 	}
 
+	// ACME配置
+	if directoryURL := os.Getenv("ACME_DIRECTORY_URL"); directoryURL != "" {
+		config.ACME.DirectoryURL = directoryURL
+	}
+	if email := os.Getenv("ACME_EMAIL"); email != "" {
+		config.ACME.Email = email
+	}
+	if caCertFile := os.Getenv("ACME_CA_CERT_FILE"); caCertFile != "" {
+		config.ACME.CACertFile = caCertFile
+	}
+	if key := os.Getenv("ACME_ENCRYPTION_KEY"); key != "" {
+		config.ACME.EncryptionKey = key
+	}
+
+	// TLS配置
+	if certFile := os.Getenv("TLS_DEFAULT_CERT_FILE"); certFile != "" {
+		config.TLS.DefaultCertFile = certFile
+	}
+	if keyFile := os.Getenv("TLS_DEFAULT_KEY_FILE"); keyFile != "" {
+		config.TLS.DefaultKeyFile = keyFile
+	}
+
 	// 服务器配置
 	if port := getEnvInt("SERVER_PORT", 0); port != 0 {
 		config.Server.HTTPPort = port
 	}
+	if h2c := os.Getenv("SERVER_H2C"); h2c != "" {
+		config.Server.H2C = h2c == "true"
+	}
 }
 
 // Get 获取配置实例
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"waf-go/internal/certs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ACMEHandler ACME验证处理器
+type ACMEHandler struct {
+	acmeManager *certs.ACMEManager
+}
+
+// NewACMEHandler 创建ACME验证处理器实例
+func NewACMEHandler(acmeManager *certs.ACMEManager) *ACMEHandler {
+	return &ACMEHandler{
+		acmeManager: acmeManager,
+	}
+}
+
+// HTTPChallenge 响应ACME HTTP-01验证请求
+func (h *ACMEHandler) HTTPChallenge(c *gin.Context) {
+	keyAuth, ok := h.acmeManager.HTTPChallengeResponse(c.Param("token"))
+	if !ok {
+		c.String(http.StatusNotFound, "challenge not found")
+		return
+	}
+
+	c.Header("Content-Type", "text/plain")
+	c.String(http.StatusOK, keyAuth)
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APISpecHandler struct {
+	apiSpecService  *service.APISpecService
+	securityService *service.TenantSecurityService
+}
+
+func NewAPISpecHandler(apiSpecService *service.APISpecService, securityService *service.TenantSecurityService) *APISpecHandler {
+	return &APISpecHandler{
+		apiSpecService:  apiSpecService,
+		securityService: securityService,
+	}
+}
+
+// GetAPISpecs 获取域名OpenAPI规范
+// @Summary 获取域名OpenAPI规范
+// @Description 获取域名上传的OpenAPI规范及其生效路径和模式
+// @Tags OpenAPI
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.APISpec}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/api-specs [get]
+func (h *APISpecHandler) GetAPISpecs(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	specs, err := h.apiSpecService.GetAPISpecs(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取OpenAPI规范成功", specs)
+}
+
+// CreateAPISpec 上传OpenAPI规范
+// @Summary 上传OpenAPI规范
+// @Description 上传OpenAPI 3规范（JSON或YAML），按规范校验请求的路径、方法、参数、请求体和Content-Type。模式：enforce拦截违规请求，log_only仅记录攻击日志，learn只统计违规用于完善规范
+// @Tags OpenAPI
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param spec body service.CreateAPISpecRequest true "OpenAPI规范"
+// @Success 200 {object} utils.Response{data=models.APISpec}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/api-specs [post]
+func (h *APISpecHandler) CreateAPISpec(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateAPISpecRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	spec, err := h.apiSpecService.CreateAPISpec(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "上传OpenAPI规范失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "上传OpenAPI规范成功", spec)
+}
+
+// UpdateAPISpec 更新OpenAPI规范
+// @Summary 更新OpenAPI规范
+// @Description 更新OpenAPI规范的内容、生效路径或模式，修改后立即生效
+// @Tags OpenAPI
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param spec_id path int true "规范ID"
+// @Param spec body service.UpdateAPISpecRequest true "OpenAPI规范"
+// @Success 200 {object} utils.Response{data=models.APISpec}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/api-specs/{spec_id} [put]
+func (h *APISpecHandler) UpdateAPISpec(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	specID, err := strconv.ParseUint(c.Param("spec_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规范ID")
+		return
+	}
+
+	var req service.UpdateAPISpecRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	spec, err := h.apiSpecService.UpdateAPISpec(domainID, uint(specID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新OpenAPI规范失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新OpenAPI规范成功", spec)
+}
+
+// DeleteAPISpec 删除OpenAPI规范
+// @Summary 删除OpenAPI规范
+// @Description 删除OpenAPI规范及其学习记录，删除后立即生效
+// @Tags OpenAPI
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param spec_id path int true "规范ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/api-specs/{spec_id} [delete]
+func (h *APISpecHandler) DeleteAPISpec(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	specID, err := strconv.ParseUint(c.Param("spec_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规范ID")
+		return
+	}
+
+	if err := h.apiSpecService.DeleteAPISpec(domainID, uint(specID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除OpenAPI规范失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除OpenAPI规范成功", nil)
+}
+
+// GetAPISpecObservations 获取OpenAPI学习记录
+// @Summary 获取OpenAPI学习记录
+// @Description 获取learn模式下按方法、路径、参数和约束聚合的违规统计，按出现次数排序
+// @Tags OpenAPI
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param spec_id path int true "规范ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=utils.PageData}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/api-specs/{spec_id}/observations [get]
+func (h *APISpecHandler) GetAPISpecObservations(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	specID, err := strconv.ParseUint(c.Param("spec_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规范ID")
+		return
+	}
+
+	var req service.APISpecObservationListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	observations, total, err := h.apiSpecService.GetAPISpecObservations(domainID, uint(specID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.PageResponse(c, "获取OpenAPI学习记录成功", observations, total, req.Page, req.PageSize)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *APISpecHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
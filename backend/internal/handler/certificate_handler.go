@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CertificateHandler struct {
+	certificateService *service.CertificateService
+	securityService    *service.TenantSecurityService
+}
+
+func NewCertificateHandler(certificateService *service.CertificateService, securityService *service.TenantSecurityService) *CertificateHandler {
+	return &CertificateHandler{
+		certificateService: certificateService,
+		securityService:    securityService,
+	}
+}
+
+// GetCertificates 获取证书到期列表
+// @Summary 获取证书到期列表
+// @Description 获取当前HTTPS监听器中生效的全部证书及剩余天数，按到期时间排序
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param expiring_days query int false "只返回指定天数内过期的证书"
+// @Param domain query string false "域名"
+// @Success 200 {object} utils.Response{data=[]certs.CertificateInfo}
+// @Failure 400 {object} utils.Response
+// @Router /api/v1/certificates [get]
+func (h *CertificateHandler) GetCertificates(c *gin.Context) {
+	var req service.CertificateListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	list := h.certificateService.GetCertificates(&req, userCtx)
+	utils.SuccessResponse(c, "获取证书列表成功", list)
+}
+
+// GetDomainCertificate 获取域名证书详情
+// @Summary 获取域名证书详情
+// @Description 获取域名当前主证书（手动上传或ACME签发）的过期时间、签发者、SAN和密钥类型
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=certs.CertificateDetail}
+// @Failure 400 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /api/v1/domains/{id}/certificate [get]
+func (h *CertificateHandler) GetDomainCertificate(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.certificateService.GetDomainCertificateDetail(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "获取证书详情失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取证书详情成功", detail)
+}
+
+// GetDomainCertificates 获取域名附加证书
+// @Summary 获取域名附加证书
+// @Description 获取域名配置的附加证书列表
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.DomainCertificate}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/certificates [get]
+func (h *CertificateHandler) GetDomainCertificates(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.certificateService.GetDomainCertificates(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取附加证书成功", list)
+}
+
+// CreateDomainCertificate 添加域名附加证书
+// @Summary 添加域名附加证书
+// @Description 为域名添加附加证书（如同时配置RSA和ECDSA证书），握手时按客户端能力选择
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param certificate body service.CreateDomainCertificateRequest true "证书信息"
+// @Success 200 {object} utils.Response{data=models.DomainCertificate}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/certificates [post]
+func (h *CertificateHandler) CreateDomainCertificate(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateDomainCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	item, err := h.certificateService.CreateDomainCertificate(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "添加附加证书失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "添加附加证书成功", item)
+}
+
+// UpdateDomainCertificate 更新域名附加证书
+// @Summary 更新域名附加证书
+// @Description 更新附加证书内容或启用状态
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param cert_id path int true "证书ID"
+// @Param certificate body service.UpdateDomainCertificateRequest true "证书信息"
+// @Success 200 {object} utils.Response{data=models.DomainCertificate}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/certificates/{cert_id} [put]
+func (h *CertificateHandler) UpdateDomainCertificate(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	certID, err := strconv.ParseUint(c.Param("cert_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的证书ID")
+		return
+	}
+
+	var req service.UpdateDomainCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	item, err := h.certificateService.UpdateDomainCertificate(domainID, uint(certID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新附加证书失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新附加证书成功", item)
+}
+
+// DeleteDomainCertificate 删除域名附加证书
+// @Summary 删除域名附加证书
+// @Description 删除附加证书并立即从HTTPS监听器中移除
+// @Tags 证书管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param cert_id path int true "证书ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/certificates/{cert_id} [delete]
+func (h *CertificateHandler) DeleteDomainCertificate(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	certID, err := strconv.ParseUint(c.Param("cert_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的证书ID")
+		return
+	}
+
+	if err := h.certificateService.DeleteDomainCertificate(domainID, uint(certID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除附加证书失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除附加证书成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *CertificateHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -370,3 +370,76 @@ func (h *DomainHandler) BatchDeleteDomains(c *gin.Context) {
 
 	utils.SuccessResponse(c, "批量删除域名配置成功", nil)
 }
+
+// GetDomainACMEStatus 获取域名ACME证书状态
+// @Summary 获取域名ACME证书状态
+// @Description 获取ACME自动证书的签发、续期状态和最近一次失败原因
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=models.ACMECertificate}
+// @Failure 400 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /api/v1/domains/{id}/acme [get]
+func (h *DomainHandler) GetDomainACMEStatus(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return
+	}
+
+	status, err := h.domainService.GetACMEStatus(uint(id))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "获取ACME证书状态失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取ACME证书状态成功", status)
+}
+
+// RenewDomainACMECertificate 立即续期域名ACME证书
+// @Summary 立即续期域名ACME证书
+// @Description 触发一次ACME证书签发，结果通过状态接口查询
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/acme/renew [post]
+func (h *DomainHandler) RenewDomainACMECertificate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return
+	}
+
+	if err := h.domainService.RenewACMECertificate(uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "续期ACME证书失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "已提交ACME证书续期任务", nil)
+}
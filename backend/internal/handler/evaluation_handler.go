@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+	"waf-go/internal/waf"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EvaluationHandler struct {
+	evaluationService *service.EvaluationService
+	securityService   *service.TenantSecurityService
+}
+
+func NewEvaluationHandler(evaluationService *service.EvaluationService, securityService *service.TenantSecurityService) *EvaluationHandler {
+	return &EvaluationHandler{
+		evaluationService: evaluationService,
+		securityService:   securityService,
+	}
+}
+
+// Evaluate 试运行WAF检查
+// @Summary 试运行WAF检查
+// @Description 用模拟请求执行与线上相同的检查，返回检查过的白名单、黑名单等阶段、每条规则的命中结果和匹配值以及最终动作。试运行不计入速率限制、学习会话和影子策略，不记录攻击日志
+// @Tags WAF检查
+// @Accept json
+// @Produce json
+// @Param request body waf.EvaluationRequest true "模拟请求"
+// @Success 200 {object} utils.Response{data=waf.DecisionTrace}
+// @Failure 400 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Router /api/v1/waf/evaluate [post]
+func (h *EvaluationHandler) Evaluate(c *gin.Context) {
+	var req waf.EvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	// 只能试运行本租户的域名，包括未配置的域名落到的通配符域名，检查通过后才执行
+	domain, err := h.evaluationService.GetDomain(&req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if domain != nil {
+		userCtx := middleware.GetUserContext(c)
+		if err := h.securityService.ValidateDomainOwnership(userCtx, domain.ID); err != nil {
+			utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+			return
+		}
+	}
+
+	trace, err := h.evaluationService.Evaluate(&req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "试运行成功", trace)
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GraphQLHandler struct {
+	graphqlService  *service.GraphQLService
+	securityService *service.TenantSecurityService
+}
+
+func NewGraphQLHandler(graphqlService *service.GraphQLService, securityService *service.TenantSecurityService) *GraphQLHandler {
+	return &GraphQLHandler{
+		graphqlService:  graphqlService,
+		securityService: securityService,
+	}
+}
+
+// GetGraphQLEndpoints 获取域名GraphQL端点
+// @Summary 获取域名GraphQL端点
+// @Description 获取域名配置的GraphQL端点及其查询限制
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.GraphQLEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/graphql-endpoints [get]
+func (h *GraphQLHandler) GetGraphQLEndpoints(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	endpoints, err := h.graphqlService.GetGraphQLEndpoints(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取GraphQL端点成功", endpoints)
+}
+
+// CreateGraphQLEndpoint 创建GraphQL端点
+// @Summary 创建GraphQL端点
+// @Description 为域名路径开启GraphQL解析，限制查询深度、别名数、字段数、复杂度、批量大小及内省查询
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint body service.CreateGraphQLEndpointRequest true "GraphQL端点"
+// @Success 200 {object} utils.Response{data=models.GraphQLEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/graphql-endpoints [post]
+func (h *GraphQLHandler) CreateGraphQLEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateGraphQLEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	endpoint, err := h.graphqlService.CreateGraphQLEndpoint(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建GraphQL端点失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建GraphQL端点成功", endpoint)
+}
+
+// UpdateGraphQLEndpoint 更新GraphQL端点
+// @Summary 更新GraphQL端点
+// @Description 更新GraphQL端点的路径和查询限制，修改后立即生效
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint_id path int true "端点ID"
+// @Param endpoint body service.UpdateGraphQLEndpointRequest true "GraphQL端点"
+// @Success 200 {object} utils.Response{data=models.GraphQLEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/graphql-endpoints/{endpoint_id} [put]
+func (h *GraphQLHandler) UpdateGraphQLEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	endpointID, err := strconv.ParseUint(c.Param("endpoint_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的端点ID")
+		return
+	}
+
+	var req service.UpdateGraphQLEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	endpoint, err := h.graphqlService.UpdateGraphQLEndpoint(domainID, uint(endpointID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新GraphQL端点失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新GraphQL端点成功", endpoint)
+}
+
+// DeleteGraphQLEndpoint 删除GraphQL端点
+// @Summary 删除GraphQL端点
+// @Description 删除域名的GraphQL端点，删除后该路径不再进行GraphQL检查
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint_id path int true "端点ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/graphql-endpoints/{endpoint_id} [delete]
+func (h *GraphQLHandler) DeleteGraphQLEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	endpointID, err := strconv.ParseUint(c.Param("endpoint_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的端点ID")
+		return
+	}
+
+	if err := h.graphqlService.DeleteGraphQLEndpoint(domainID, uint(endpointID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除GraphQL端点失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除GraphQL端点成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *GraphQLHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GRPCHandler struct {
+	grpcService     *service.GRPCService
+	securityService *service.TenantSecurityService
+}
+
+func NewGRPCHandler(grpcService *service.GRPCService, securityService *service.TenantSecurityService) *GRPCHandler {
+	return &GRPCHandler{
+		grpcService:     grpcService,
+		securityService: securityService,
+	}
+}
+
+// GetGRPCDescriptors 获取域名gRPC描述文件
+// @Summary 获取域名gRPC描述文件
+// @Description 获取域名上传的gRPC描述文件及其包含的服务
+// @Tags gRPC
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.GRPCDescriptorSet}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/grpc-descriptors [get]
+func (h *GRPCHandler) GetGRPCDescriptors(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	sets, err := h.grpcService.GetGRPCDescriptors(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取gRPC描述文件成功", sets)
+}
+
+// CreateGRPCDescriptor 上传gRPC描述文件
+// @Summary 上传gRPC描述文件
+// @Description 上传base64编码的FileDescriptorSet（protoc --include_imports --descriptor_set_out生成），用于grpc_message规则解码请求消息
+// @Tags gRPC
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param descriptor body service.CreateGRPCDescriptorRequest true "描述文件"
+// @Success 200 {object} utils.Response{data=models.GRPCDescriptorSet}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/grpc-descriptors [post]
+func (h *GRPCHandler) CreateGRPCDescriptor(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateGRPCDescriptorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	set, err := h.grpcService.CreateGRPCDescriptor(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "上传gRPC描述文件失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "上传gRPC描述文件成功", set)
+}
+
+// DeleteGRPCDescriptor 删除gRPC描述文件
+// @Summary 删除gRPC描述文件
+// @Description 删除域名的gRPC描述文件，删除后立即生效
+// @Tags gRPC
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param descriptor_id path int true "描述文件ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/grpc-descriptors/{descriptor_id} [delete]
+func (h *GRPCHandler) DeleteGRPCDescriptor(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	descriptorID, err := strconv.ParseUint(c.Param("descriptor_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的描述文件ID")
+		return
+	}
+
+	if err := h.grpcService.DeleteGRPCDescriptor(domainID, uint(descriptorID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除gRPC描述文件失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除gRPC描述文件成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *GRPCHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LearningHandler struct {
+	learningService *service.LearningService
+	securityService *service.TenantSecurityService
+}
+
+func NewLearningHandler(learningService *service.LearningService, securityService *service.TenantSecurityService) *LearningHandler {
+	return &LearningHandler{
+		learningService: learningService,
+		securityService: securityService,
+	}
+}
+
+// GetLearningSessions 获取域名学习会话
+// @Summary 获取域名学习会话
+// @Description 获取域名的学习会话列表
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.LearningSession}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions [get]
+func (h *LearningHandler) GetLearningSessions(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.learningService.GetLearningSessions(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取学习会话成功", sessions)
+}
+
+// StartLearningSession 开始学习会话
+// @Summary 开始学习会话
+// @Description 在指定时长内记录域名未被拦截请求的路径、方法、参数和Content-Type，以及命中的规则
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session body service.StartLearningRequest true "学习会话"
+// @Success 200 {object} utils.Response{data=models.LearningSession}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions [post]
+func (h *LearningHandler) StartLearningSession(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.StartLearningRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	session, err := h.learningService.StartLearningSession(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "开始学习会话失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "开始学习会话成功", session)
+}
+
+// StopLearningSession 停止学习会话
+// @Summary 停止学习会话
+// @Description 停止记录并保存已记录的数据
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Success 200 {object} utils.Response{data=models.LearningSession}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/stop [post]
+func (h *LearningHandler) StopLearningSession(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	session, err := h.learningService.StopLearningSession(domainID, sessionID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "停止学习会话失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "停止学习会话成功", session)
+}
+
+// DeleteLearningSession 删除学习会话
+// @Summary 删除学习会话
+// @Description 删除学习会话及其记录的接口和规则命中
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id} [delete]
+func (h *LearningHandler) DeleteLearningSession(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.learningService.DeleteLearningSession(domainID, sessionID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除学习会话失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除学习会话成功", nil)
+}
+
+// GetLearningEndpoints 获取学习到的接口
+// @Summary 获取学习到的接口
+// @Description 获取按方法和归一化路径聚合的流量特征，包括参数名称、值类型和长度范围
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Success 200 {object} utils.Response{data=[]models.LearningEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/endpoints [get]
+func (h *LearningHandler) GetLearningEndpoints(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	endpoints, err := h.learningService.GetLearningEndpoints(domainID, sessionID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取学习数据成功", endpoints)
+}
+
+// GetLearningRuleHits 获取学习期间的规则命中
+// @Summary 获取学习期间的规则命中
+// @Description 获取学习期间按规则、方法和路径聚合的命中记录
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Success 200 {object} utils.Response{data=[]models.LearningRuleHit}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/rule-hits [get]
+func (h *LearningHandler) GetLearningRuleHits(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	hits, err := h.learningService.GetLearningRuleHits(domainID, sessionID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取规则命中记录成功", hits)
+}
+
+// MarkLearningRuleHit 标记规则命中
+// @Summary 标记规则命中
+// @Description 标记规则命中是否为正常流量，标记为正常流量的命中将生成规则排除建议
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Param hit_id path int true "命中记录ID"
+// @Param mark body service.MarkRuleHitRequest true "标记"
+// @Success 200 {object} utils.Response{data=models.LearningRuleHit}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/rule-hits/{hit_id} [put]
+func (h *LearningHandler) MarkLearningRuleHit(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+	hitID, err := strconv.ParseUint(c.Param("hit_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的命中记录ID")
+		return
+	}
+
+	var req service.MarkRuleHitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	hit, err := h.learningService.MarkLearningRuleHit(domainID, sessionID, uint(hitID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "标记规则命中失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "标记规则命中成功", hit)
+}
+
+// GetLearningProposal 获取学习建议
+// @Summary 获取学习建议
+// @Description 根据学习数据生成OpenAPI规范（正向安全模型），并根据标记为正常流量的规则命中生成规则排除
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Success 200 {object} utils.Response{data=service.LearningProposal}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/proposal [get]
+func (h *LearningHandler) GetLearningProposal(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	proposal, err := h.learningService.GetLearningProposal(domainID, sessionID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成学习建议失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "生成学习建议成功", proposal)
+}
+
+// ApplyLearningProposal 应用学习建议
+// @Summary 应用学习建议
+// @Description 上传生成的OpenAPI规范并创建规则排除，会话需先停止
+// @Tags 学习模式
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param session_id path int true "学习会话ID"
+// @Param apply body service.ApplyLearningRequest true "应用选项"
+// @Success 200 {object} utils.Response{data=service.LearningApplyResult}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/learning-sessions/{session_id}/apply [post]
+func (h *LearningHandler) ApplyLearningProposal(c *gin.Context) {
+	domainID, sessionID, ok := h.parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	var req service.ApplyLearningRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.learningService.ApplyLearningProposal(domainID, sessionID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "应用学习建议失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "应用学习建议成功", result)
+}
+
+// parseSessionID 解析域名ID和学习会话ID
+func (h *LearningHandler) parseSessionID(c *gin.Context) (uint, uint, bool) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	sessionID, err := strconv.ParseUint(c.Param("session_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的学习会话ID")
+		return 0, 0, false
+	}
+	return domainID, uint(sessionID), true
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *LearningHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -75,6 +75,46 @@ func (h *LogHandler) GetAttackLogList(c *gin.Context) {
 	})
 }
 
+// GetWebSocketSessions 获取WebSocket会话列表，会话中的违规消息可按session_id在攻击日志中按request_id查询
+func (h *LogHandler) GetWebSocketSessions(c *gin.Context) {
+	var req service.WebSocketSessionListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 设置租户ID
+	role := c.GetString("role")
+	if role != "admin" {
+		req.TenantID = c.GetUint("tenant_id")
+	}
+
+	sessions, total, err := h.logService.GetWebSocketSessionList(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取成功",
+		"data": gin.H{
+			"list":  sessions,
+			"total": total,
+			"page":  req.Page,
+			"size":  req.PageSize,
+		},
+	})
+}
+
 // GetAttackLogDetail 获取攻击日志详情
 func (h *LogHandler) GetAttackLogDetail(c *gin.Context) {
 	idStr := c.Param("id")
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginEndpointHandler struct {
+	loginEndpointService *service.LoginEndpointService
+	securityService      *service.TenantSecurityService
+}
+
+func NewLoginEndpointHandler(loginEndpointService *service.LoginEndpointService, securityService *service.TenantSecurityService) *LoginEndpointHandler {
+	return &LoginEndpointHandler{
+		loginEndpointService: loginEndpointService,
+		securityService:      securityService,
+	}
+}
+
+// GetLoginEndpoints 获取域名登录接口
+// @Summary 获取域名登录接口
+// @Description 获取域名配置的登录防护接口
+// @Tags LoginEndpoint
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.LoginEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/login-endpoints [get]
+func (h *LoginEndpointHandler) GetLoginEndpoints(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	endpoints, err := h.loginEndpointService.GetLoginEndpoints(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取登录接口成功", endpoints)
+}
+
+// CreateLoginEndpoint 创建登录接口
+// @Summary 创建登录接口
+// @Description 为域名登录接口开启撞库和暴力破解防护：按用户名、IP及用户名+IP统计失败次数，逐步延迟、质询或拦截，并检测同一IP尝试大量用户名
+// @Tags LoginEndpoint
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint body service.CreateLoginEndpointRequest true "登录接口"
+// @Success 200 {object} utils.Response{data=models.LoginEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/login-endpoints [post]
+func (h *LoginEndpointHandler) CreateLoginEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateLoginEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	endpoint, err := h.loginEndpointService.CreateLoginEndpoint(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建登录接口失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建登录接口成功", endpoint)
+}
+
+// UpdateLoginEndpoint 更新登录接口
+// @Summary 更新登录接口
+// @Description 更新登录接口的失败判断条件和防护阈值，修改后立即生效
+// @Tags LoginEndpoint
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint_id path int true "登录接口ID"
+// @Param endpoint body service.UpdateLoginEndpointRequest true "登录接口"
+// @Success 200 {object} utils.Response{data=models.LoginEndpoint}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/login-endpoints/{endpoint_id} [put]
+func (h *LoginEndpointHandler) UpdateLoginEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	endpointID, ok := h.parseEndpointID(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateLoginEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	endpoint, err := h.loginEndpointService.UpdateLoginEndpoint(domainID, endpointID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新登录接口失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新登录接口成功", endpoint)
+}
+
+// DeleteLoginEndpoint 删除登录接口
+// @Summary 删除登录接口
+// @Description 删除域名的登录接口，删除后该接口不再进行登录防护
+// @Tags LoginEndpoint
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint_id path int true "登录接口ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/login-endpoints/{endpoint_id} [delete]
+func (h *LoginEndpointHandler) DeleteLoginEndpoint(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	endpointID, ok := h.parseEndpointID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.loginEndpointService.DeleteLoginEndpoint(domainID, endpointID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除登录接口失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除登录接口成功", nil)
+}
+
+// ResetLoginFailures 清除登录失败计数
+// @Summary 清除登录失败计数
+// @Description 清除登录接口上指定用户名和/或IP的失败计数，用于解除误拦截
+// @Tags LoginEndpoint
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param endpoint_id path int true "登录接口ID"
+// @Param reset body service.ResetLoginFailuresRequest true "用户名和IP"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/login-endpoints/{endpoint_id}/reset [post]
+func (h *LoginEndpointHandler) ResetLoginFailures(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	endpointID, ok := h.parseEndpointID(c)
+	if !ok {
+		return
+	}
+
+	var req service.ResetLoginFailuresRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	if err := h.loginEndpointService.ResetLoginFailures(domainID, endpointID, &req); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "清除登录失败计数失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "清除登录失败计数成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *LoginEndpointHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// parseEndpointID 解析登录接口ID
+func (h *LoginEndpointHandler) parseEndpointID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("endpoint_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的登录接口ID")
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ModSecHandler struct {
+	importService *service.ModSecImportService
+}
+
+func NewModSecHandler(importService *service.ModSecImportService) *ModSecHandler {
+	return &ModSecHandler{
+		importService: importService,
+	}
+}
+
+// ImportRules 导入ModSecurity规则
+// @Summary 导入ModSecurity规则
+// @Description 解析SecRule/SecAction等SecLang指令，转换为规则并放入新建策略，ctl:ruleRemove*、SecRuleRemoveById等转换为策略级规则排除；dry_run为true时只返回转换结果和报告
+// @Tags 规则管理
+// @Accept json
+// @Produce json
+// @Param import body service.ModSecImportRequest true "ModSecurity规则"
+// @Success 200 {object} utils.Response{data=service.ModSecImportResult}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/rules/import/modsec [post]
+func (h *ModSecHandler) ImportRules(c *gin.Context) {
+	var req service.ModSecImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	req.TenantID = c.GetUint("tenant_id")
+
+	result, err := h.importService.ImportRules(&req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "导入ModSecurity规则失败: "+err.Error())
+		return
+	}
+
+	message := "导入ModSecurity规则成功"
+	if req.DryRun {
+		message = "转换ModSecurity规则成功"
+	}
+	utils.SuccessResponse(c, message, result)
+}
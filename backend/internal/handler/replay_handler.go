@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReplayHandler struct {
+	replayService   *service.ReplayService
+	securityService *service.TenantSecurityService
+}
+
+func NewReplayHandler(replayService *service.ReplayService, securityService *service.TenantSecurityService) *ReplayHandler {
+	return &ReplayHandler{
+		replayService:   replayService,
+		securityService: securityService,
+	}
+}
+
+// Replay 回放历史流量
+// @Summary 回放历史流量
+// @Description 解析nginx/Apache combined日志、JSON访问日志或HAR文件，将请求回放到指定域名，按指定策略试运行，返回放行和拦截统计以及每条规则命中的请求。回放不计入速率限制、学习会话和影子策略，不记录攻击日志
+// @Tags WAF检查
+// @Accept json
+// @Produce json
+// @Param request body service.ReplayRequest true "回放请求"
+// @Success 200 {object} utils.Response{data=service.ReplayReport}
+// @Failure 400 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/waf/replay [post]
+func (h *ReplayHandler) Replay(c *gin.Context) {
+	var req service.ReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	// 只能回放到本租户的域名，使用本租户的策略
+	userCtx := middleware.GetUserContext(c)
+	if err := h.securityService.ValidateDomainOwnership(userCtx, req.DomainID); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return
+	}
+	for _, policyID := range req.PolicyIDs {
+		if err := h.securityService.ValidatePolicyOwnership(userCtx, policyID); err != nil {
+			utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+			return
+		}
+	}
+
+	report, err := h.replayService.Replay(&req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "回放失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "回放成功", report)
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RewriteHandler struct {
+	rewriteService  *service.RewriteService
+	securityService *service.TenantSecurityService
+}
+
+func NewRewriteHandler(rewriteService *service.RewriteService, securityService *service.TenantSecurityService) *RewriteHandler {
+	return &RewriteHandler{
+		rewriteService:  rewriteService,
+		securityService: securityService,
+	}
+}
+
+// GetRewriteRules 获取域名重写规则
+// @Summary 获取域名重写规则
+// @Description 获取域名的请求/响应头修改、URL重写和重定向规则，按优先级排序
+// @Tags 重写规则
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.RewriteRule}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rewrites [get]
+func (h *RewriteHandler) GetRewriteRules(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	rules, err := h.rewriteService.GetRewriteRules(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取重写规则成功", rules)
+}
+
+// CreateRewriteRule 创建域名重写规则
+// @Summary 创建域名重写规则
+// @Description 创建重写规则，值中支持 ${host}、${uri}、${path}、${query}、${method}、${client_ip}、${scheme}、${http_<header>} 变量和 $1 等正则分组
+// @Tags 重写规则
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param rule body service.CreateRewriteRuleRequest true "重写规则"
+// @Success 200 {object} utils.Response{data=models.RewriteRule}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rewrites [post]
+func (h *RewriteHandler) CreateRewriteRule(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateRewriteRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	rule, err := h.rewriteService.CreateRewriteRule(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建重写规则失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建重写规则成功", rule)
+}
+
+// UpdateRewriteRule 更新域名重写规则
+// @Summary 更新域名重写规则
+// @Description 更新重写规则，修改后立即生效
+// @Tags 重写规则
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param rule_id path int true "规则ID"
+// @Param rule body service.UpdateRewriteRuleRequest true "重写规则"
+// @Success 200 {object} utils.Response{data=models.RewriteRule}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rewrites/{rule_id} [put]
+func (h *RewriteHandler) UpdateRewriteRule(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规则ID")
+		return
+	}
+
+	var req service.UpdateRewriteRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	rule, err := h.rewriteService.UpdateRewriteRule(domainID, uint(ruleID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新重写规则失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新重写规则成功", rule)
+}
+
+// DeleteRewriteRule 删除域名重写规则
+// @Summary 删除域名重写规则
+// @Description 删除重写规则，删除后立即生效
+// @Tags 重写规则
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param rule_id path int true "规则ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rewrites/{rule_id} [delete]
+func (h *RewriteHandler) DeleteRewriteRule(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规则ID")
+		return
+	}
+
+	if err := h.rewriteService.DeleteRewriteRule(domainID, uint(ruleID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除重写规则失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除重写规则成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *RewriteHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RuleExclusionHandler struct {
+	exclusionService *service.RuleExclusionService
+	securityService  *service.TenantSecurityService
+}
+
+func NewRuleExclusionHandler(exclusionService *service.RuleExclusionService, securityService *service.TenantSecurityService) *RuleExclusionHandler {
+	return &RuleExclusionHandler{
+		exclusionService: exclusionService,
+		securityService:  securityService,
+	}
+}
+
+// GetDomainRuleExclusions 获取域名级规则排除
+// @Summary 获取域名级规则排除
+// @Description 获取域名的规则排除列表，不包括所用策略的排除
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rule-exclusions [get]
+func (h *RuleExclusionHandler) GetDomainRuleExclusions(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	exclusions, err := h.exclusionService.GetDomainRuleExclusions(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取规则排除成功", exclusions)
+}
+
+// CreateDomainRuleExclusion 创建域名级规则排除
+// @Summary 创建域名级规则排除
+// @Description 路径匹配时跳过指定规则或带有指定标签的规则，target为空时跳过整条规则，为body:参数名或header:名称时只排除该检查目标
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param exclusion body service.CreateRuleExclusionRequest true "规则排除"
+// @Success 200 {object} utils.Response{data=models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rule-exclusions [post]
+func (h *RuleExclusionHandler) CreateDomainRuleExclusion(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateRuleExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	exclusion, err := h.exclusionService.CreateDomainRuleExclusion(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建规则排除成功", exclusion)
+}
+
+// UpdateDomainRuleExclusion 更新域名级规则排除
+// @Summary 更新域名级规则排除
+// @Description 更新域名级规则排除
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param exclusion_id path int true "规则排除ID"
+// @Param exclusion body service.UpdateRuleExclusionRequest true "规则排除"
+// @Success 200 {object} utils.Response{data=models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rule-exclusions/{exclusion_id} [put]
+func (h *RuleExclusionHandler) UpdateDomainRuleExclusion(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	exclusionID, ok := parseExclusionID(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateRuleExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	exclusion, err := h.exclusionService.UpdateDomainRuleExclusion(domainID, exclusionID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新规则排除成功", exclusion)
+}
+
+// DeleteDomainRuleExclusion 删除域名级规则排除
+// @Summary 删除域名级规则排除
+// @Description 删除域名级规则排除
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param exclusion_id path int true "规则排除ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/rule-exclusions/{exclusion_id} [delete]
+func (h *RuleExclusionHandler) DeleteDomainRuleExclusion(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	exclusionID, ok := parseExclusionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.exclusionService.DeleteDomainRuleExclusion(domainID, exclusionID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除规则排除成功", nil)
+}
+
+// GetPolicyRuleExclusions 获取策略级规则排除
+// @Summary 获取策略级规则排除
+// @Description 获取策略的规则排除列表，策略级排除作用于使用该策略的所有域名
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "策略ID"
+// @Success 200 {object} utils.Response{data=[]models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/policies/{id}/rule-exclusions [get]
+func (h *RuleExclusionHandler) GetPolicyRuleExclusions(c *gin.Context) {
+	policyID, ok := h.parsePolicyID(c)
+	if !ok {
+		return
+	}
+
+	exclusions, err := h.exclusionService.GetPolicyRuleExclusions(policyID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取规则排除成功", exclusions)
+}
+
+// CreatePolicyRuleExclusion 创建策略级规则排除
+// @Summary 创建策略级规则排除
+// @Description 路径匹配时跳过指定规则或带有指定标签的规则，作用于使用该策略的所有域名
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "策略ID"
+// @Param exclusion body service.CreateRuleExclusionRequest true "规则排除"
+// @Success 200 {object} utils.Response{data=models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/policies/{id}/rule-exclusions [post]
+func (h *RuleExclusionHandler) CreatePolicyRuleExclusion(c *gin.Context) {
+	policyID, ok := h.parsePolicyID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateRuleExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	exclusion, err := h.exclusionService.CreatePolicyRuleExclusion(policyID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建规则排除成功", exclusion)
+}
+
+// UpdatePolicyRuleExclusion 更新策略级规则排除
+// @Summary 更新策略级规则排除
+// @Description 更新策略级规则排除
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "策略ID"
+// @Param exclusion_id path int true "规则排除ID"
+// @Param exclusion body service.UpdateRuleExclusionRequest true "规则排除"
+// @Success 200 {object} utils.Response{data=models.RuleExclusion}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/policies/{id}/rule-exclusions/{exclusion_id} [put]
+func (h *RuleExclusionHandler) UpdatePolicyRuleExclusion(c *gin.Context) {
+	policyID, ok := h.parsePolicyID(c)
+	if !ok {
+		return
+	}
+	exclusionID, ok := parseExclusionID(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateRuleExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	exclusion, err := h.exclusionService.UpdatePolicyRuleExclusion(policyID, exclusionID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新规则排除成功", exclusion)
+}
+
+// DeletePolicyRuleExclusion 删除策略级规则排除
+// @Summary 删除策略级规则排除
+// @Description 删除策略级规则排除
+// @Tags 规则排除
+// @Accept json
+// @Produce json
+// @Param id path int true "策略ID"
+// @Param exclusion_id path int true "规则排除ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/policies/{id}/rule-exclusions/{exclusion_id} [delete]
+func (h *RuleExclusionHandler) DeletePolicyRuleExclusion(c *gin.Context) {
+	policyID, ok := h.parsePolicyID(c)
+	if !ok {
+		return
+	}
+	exclusionID, ok := parseExclusionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.exclusionService.DeletePolicyRuleExclusion(policyID, exclusionID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除规则排除失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除规则排除成功", nil)
+}
+
+// parseExclusionID 解析规则排除ID
+func parseExclusionID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("exclusion_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规则排除ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *RuleExclusionHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// parsePolicyID 解析策略ID并验证策略所有权
+func (h *RuleExclusionHandler) parsePolicyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的策略ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证策略所有权
+	if err := h.securityService.ValidatePolicyOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
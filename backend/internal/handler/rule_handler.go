@@ -368,3 +368,64 @@ func (h *RuleHandler) BatchDeleteRules(c *gin.Context) {
 
 	utils.SuccessResponse(c, "规则删除成功", nil)
 }
+
+// GetRuleEvaluationStats 获取规则计算耗时统计
+// @Summary 获取规则计算耗时统计
+// @Description 返回WAF引擎启动以来各规则的计算次数、命中次数、总耗时、平均和最长耗时，按总耗时降序，用于找出开销大的规则
+// @Tags 规则管理
+// @Produce json
+// @Param limit query int false "返回条数，默认50，0表示全部"
+// @Success 200 {object} utils.Response{data=[]service.RuleEvaluationStat}
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/rules/evaluation-stats [get]
+func (h *RuleHandler) GetRuleEvaluationStats(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的limit参数")
+		return
+	}
+
+	stats, err := h.ruleService.GetRuleEvaluationStats(c.GetUint("tenant_id"), limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取规则耗时统计失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取成功", stats)
+}
+
+// TestRule 执行规则测试用例
+// @Summary 执行规则测试用例
+// @Description 用测试用例的模拟请求单独计算规则，检查必须命中和不得命中的用例是否符合预期。请求体中的用例不为空时执行这些用例，否则执行规则保存的用例
+// @Tags 规则管理
+// @Accept json
+// @Produce json
+// @Param id path int true "规则ID"
+// @Param request body service.TestRuleRequest false "测试用例"
+// @Success 200 {object} utils.Response{data=service.RuleTestReport}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/rules/{id}/test [post]
+func (h *RuleHandler) TestRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的规则ID")
+		return
+	}
+
+	var req service.TestRuleRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+			return
+		}
+	}
+
+	report, err := h.ruleService.TestRule(uint(id), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "执行测试用例失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "执行测试用例成功", report)
+}
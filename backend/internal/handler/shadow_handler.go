@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShadowHandler struct {
+	shadowService   *service.ShadowService
+	securityService *service.TenantSecurityService
+}
+
+func NewShadowHandler(shadowService *service.ShadowService, securityService *service.TenantSecurityService) *ShadowHandler {
+	return &ShadowHandler{
+		shadowService:   shadowService,
+		securityService: securityService,
+	}
+}
+
+// GetShadowReport 获取影子策略差异报告
+// @Summary 获取影子策略差异报告
+// @Description 按规则统计影子策略拦截而生效策略放行、以及生效策略拦截而影子策略放行的请求数和样本请求
+// @Tags 影子策略
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=service.ShadowReport}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/shadow-report [get]
+func (h *ShadowHandler) GetShadowReport(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.shadowService.GetShadowReport(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取影子策略差异报告成功", report)
+}
+
+// ResetShadowReport 清空影子策略差异报告
+// @Summary 清空影子策略差异报告
+// @Description 删除域名的影子策略统计和差异，重新开始比较
+// @Tags 影子策略
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/shadow-report [delete]
+func (h *ShadowHandler) ResetShadowReport(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.shadowService.ResetShadowReport(domainID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "清空影子策略差异报告失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "清空影子策略差异报告成功", nil)
+}
+
+// PromoteShadowPolicy 影子策略转为生效
+// @Summary 影子策略转为生效
+// @Description 将域名的影子策略转为生效策略，参与请求处理
+// @Tags 影子策略
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param policy_id path int true "策略ID"
+// @Success 200 {object} utils.Response{data=models.DomainPolicy}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/shadow-policies/{policy_id}/promote [post]
+func (h *ShadowHandler) PromoteShadowPolicy(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	policyID, err := strconv.ParseUint(c.Param("policy_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的策略ID")
+		return
+	}
+
+	domainPolicy, err := h.shadowService.PromoteShadowPolicy(domainID, uint(policyID))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "影子策略转为生效失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "影子策略转为生效成功", domainPolicy)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *ShadowHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
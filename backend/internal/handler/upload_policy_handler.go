@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"waf-go/internal/middleware"
+	"waf-go/internal/service"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UploadPolicyHandler struct {
+	uploadPolicyService *service.UploadPolicyService
+	securityService     *service.TenantSecurityService
+}
+
+func NewUploadPolicyHandler(uploadPolicyService *service.UploadPolicyService, securityService *service.TenantSecurityService) *UploadPolicyHandler {
+	return &UploadPolicyHandler{
+		uploadPolicyService: uploadPolicyService,
+		securityService:     securityService,
+	}
+}
+
+// GetUploadPolicies 获取域名文件上传策略
+// @Summary 获取域名文件上传策略
+// @Description 获取域名配置的文件上传策略
+// @Tags UploadPolicy
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Success 200 {object} utils.Response{data=[]models.UploadPolicy}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/upload-policies [get]
+func (h *UploadPolicyHandler) GetUploadPolicies(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	policies, err := h.uploadPolicyService.GetUploadPolicies(domainID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "获取文件上传策略成功", policies)
+}
+
+// CreateUploadPolicy 创建文件上传策略
+// @Summary 创建文件上传策略
+// @Description 为域名路径前缀检查multipart上传文件：大小、数量、扩展名、按内容识别的类型、双扩展名、多态文件及ClamAV病毒扫描
+// @Tags UploadPolicy
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param policy body service.CreateUploadPolicyRequest true "文件上传策略"
+// @Success 200 {object} utils.Response{data=models.UploadPolicy}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/upload-policies [post]
+func (h *UploadPolicyHandler) CreateUploadPolicy(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreateUploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	policy, err := h.uploadPolicyService.CreateUploadPolicy(domainID, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建文件上传策略失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "创建文件上传策略成功", policy)
+}
+
+// UpdateUploadPolicy 更新文件上传策略
+// @Summary 更新文件上传策略
+// @Description 更新文件上传策略的路径前缀和检查项，修改后立即生效
+// @Tags UploadPolicy
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param policy_id path int true "策略ID"
+// @Param policy body service.UpdateUploadPolicyRequest true "文件上传策略"
+// @Success 200 {object} utils.Response{data=models.UploadPolicy}
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/upload-policies/{policy_id} [put]
+func (h *UploadPolicyHandler) UpdateUploadPolicy(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	policyID, err := strconv.ParseUint(c.Param("policy_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的策略ID")
+		return
+	}
+
+	var req service.UpdateUploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	policy, err := h.uploadPolicyService.UpdateUploadPolicy(domainID, uint(policyID), &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新文件上传策略失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "更新文件上传策略成功", policy)
+}
+
+// DeleteUploadPolicy 删除文件上传策略
+// @Summary 删除文件上传策略
+// @Description 删除域名的文件上传策略，删除后该路径前缀不再按策略检查上传文件
+// @Tags UploadPolicy
+// @Accept json
+// @Produce json
+// @Param id path int true "域名ID"
+// @Param policy_id path int true "策略ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Failure 500 {object} utils.Response
+// @Router /api/v1/domains/{id}/upload-policies/{policy_id} [delete]
+func (h *UploadPolicyHandler) DeleteUploadPolicy(c *gin.Context) {
+	domainID, ok := h.parseDomainID(c)
+	if !ok {
+		return
+	}
+	policyID, err := strconv.ParseUint(c.Param("policy_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的策略ID")
+		return
+	}
+
+	if err := h.uploadPolicyService.DeleteUploadPolicy(domainID, uint(policyID)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除文件上传策略失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "删除文件上传策略成功", nil)
+}
+
+// parseDomainID 解析域名ID并验证域名所有权
+func (h *UploadPolicyHandler) parseDomainID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的域名ID")
+		return 0, false
+	}
+
+	// 获取用户上下文
+	userCtx := middleware.GetUserContext(c)
+
+	// 验证域名所有权
+	if err := h.securityService.ValidateDomainOwnership(userCtx, uint(id)); err != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "权限不足")
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -36,21 +36,58 @@ type User struct {
 
 // Domain 域名配置表（简化版）
 type Domain struct {
-	ID             uint      `json:"id" gorm:"primarykey;column:id"`                                           // 域名配置ID，主键
-	Domain         string    `json:"domain" gorm:"not null;uniqueIndex;type:varchar(255);column:domain"`       // 域名，全局唯一
-	Protocol       string    `json:"protocol" gorm:"type:enum('http','https');default:'http';column:protocol"` // 协议：http 或 https
-	Port           int       `json:"port" gorm:"default:80;column:port"`                                       // 监听端口
-	SSLCertificate string    `json:"ssl_certificate" gorm:"type:text;column:ssl_certificate"`                  // SSL证书内容（PEM格式）
-	SSLPrivateKey  string    `json:"ssl_private_key" gorm:"type:text;column:ssl_private_key"`                  // SSL私钥内容（PEM格式）
-	BackendURL     string    `json:"backend_url" gorm:"not null;type:varchar(500);column:backend_url"`         // 后端服务地址
-	TenantID       uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                         // 所属租户ID
-	Enabled        bool      `json:"enabled" gorm:"default:true;index;column:enabled"`                         // 是否启用
-	CreatedAt      time.Time `json:"created_at" gorm:"column:created_at"`                                      // 创建时间
-	UpdatedAt      time.Time `json:"updated_at" gorm:"column:updated_at"`                                      // 更新时间
-	Tenant         *Tenant   `json:"tenant,omitempty" gorm:"foreignKey:TenantID"`                              // 关联的租户信息
+	ID                            uint   `json:"id" gorm:"primarykey;column:id"`                                                                  // 域名配置ID，主键
+	Domain                        string `json:"domain" gorm:"not null;uniqueIndex;type:varchar(255);column:domain"`                              // 域名，全局唯一
+	Protocol                      string `json:"protocol" gorm:"type:enum('http','https');default:'http';column:protocol"`                        // 协议：http 或 https
+	Port                          int    `json:"port" gorm:"default:80;column:port"`                                                              // 监听端口
+	SSLCertificate                string `json:"ssl_certificate" gorm:"type:text;column:ssl_certificate"`                                         // SSL证书内容（PEM格式）
+	SSLPrivateKey                 string `json:"ssl_private_key" gorm:"type:text;column:ssl_private_key"`                                         // SSL私钥内容（PEM格式）
+	CertSource                    string `json:"cert_source" gorm:"type:varchar(20);default:'manual';column:cert_source"`                         // 证书来源：manual(手动上传), acme(ACME自动签发)
+	ACMEChallenge                 string `json:"acme_challenge" gorm:"type:varchar(20);default:'http-01';column:acme_challenge"`                  // ACME验证方式：http-01, tls-alpn-01
+	ClientAuthMode                string `json:"client_auth_mode" gorm:"type:varchar(20);default:'none';column:client_auth_mode"`                 // 客户端证书认证模式：none, optional(请求不校验), required(必须), verify_if_given(提供时校验)
+	ClientCACerts                 string `json:"client_ca_certs" gorm:"type:text;column:client_ca_certs"`                                         // 校验客户端证书的CA证书包（PEM格式）
+	BackendURL                    string `json:"backend_url" gorm:"not null;type:varchar(500);column:backend_url"`                                // 后端服务地址
+	UpstreamTLSInsecureSkipVerify bool   `json:"upstream_tls_insecure_skip_verify" gorm:"default:false;column:upstream_tls_insecure_skip_verify"` // 跳过后端证书校验，仅用于无法更换证书的旧系统
+	UpstreamCACerts               string `json:"upstream_ca_certs" gorm:"type:text;column:upstream_ca_certs"`                                     // 校验后端证书的CA证书包（PEM格式），为空时使用系统根证书
+	UpstreamServerName            string `json:"upstream_server_name" gorm:"type:varchar(255);column:upstream_server_name"`                       // 连接后端时使用的SNI和证书校验域名，为空时使用后端地址中的主机名
+	UpstreamClientCert            string `json:"upstream_client_cert" gorm:"type:text;column:upstream_client_cert"`                               // 向后端出示的客户端证书（PEM格式）
+	UpstreamClientKey             string `json:"upstream_client_key" gorm:"type:text;column:upstream_client_key"`                                 // 向后端出示的客户端证书私钥（PEM格式）
+	UpstreamHTTP2                 bool   `json:"upstream_http2" gorm:"default:false;column:upstream_http2"`                                       // 使用HTTP/2连接后端，http后端为h2c（gRPC后端需要开启）
+	ForceHTTPS                    bool   `json:"force_https" gorm:"default:false;column:force_https"`                                             // 是否将HTTP请求重定向到HTTPS
+	HTTPSRedirectCode             int    `json:"https_redirect_code" gorm:"default:301;column:https_redirect_code"`                               // HTTPS重定向状态码：301, 308
+	HSTSEnabled                   bool   `json:"hsts_enabled" gorm:"default:false;column:hsts_enabled"`                                           // 是否在HTTPS响应中添加HSTS头
+	HSTSMaxAge                    int    `json:"hsts_max_age" gorm:"default:31536000;column:hsts_max_age"`                                        // HSTS max-age（秒）
+	HSTSIncludeSubdomains         bool   `json:"hsts_include_subdomains" gorm:"default:false;column:hsts_include_subdomains"`                     // HSTS是否包含子域名
+	HSTSPreload                   bool   `json:"hsts_preload" gorm:"default:false;column:hsts_preload"`                                           // HSTS是否声明preload
+	SecurityHeaders               string `json:"security_headers" gorm:"type:text;column:security_headers"`                                       // 注入或覆盖的响应头，JSON对象格式，如 {"X-Frame-Options":"DENY"}
+	StripResponseHeaders          string `json:"strip_response_headers" gorm:"type:text;column:strip_response_headers"`                           // 移除的后端响应头，JSON数组格式，如 ["Server","X-Powered-By"]
+	PreserveHost                  bool   `json:"preserve_host" gorm:"default:false;column:preserve_host"`                                         // 是否将客户端请求的Host头原样转发给后端（虚拟主机后端需要开启）
+	Mode                          string `json:"mode" gorm:"type:varchar(20);default:'enforce';column:mode"`                                      // 防护模式：enforce(拦截), detect_only(只记录would_block，请求照常转发), off(不检查)
+
+	// WebSocket配置
+	WebSocketEnabled        bool `json:"websocket_enabled" gorm:"default:true;column:websocket_enabled"`                      // 是否允许WebSocket连接
+	WebSocketIdleTimeout    int  `json:"websocket_idle_timeout" gorm:"default:300;column:websocket_idle_timeout"`             // 空闲超时（秒），0表示不限制
+	WebSocketMaxDuration    int  `json:"websocket_max_duration" gorm:"default:0;column:websocket_max_duration"`               // 最长连接时间（秒），0表示不限制
+	WebSocketMaxMessageSize int  `json:"websocket_max_message_size" gorm:"default:1048576;column:websocket_max_message_size"` // 客户端单条消息最大字节数，0表示不限制
+
+	// 协议校验配置
+	ProtocolValidation  bool      `json:"protocol_validation" gorm:"default:false;column:protocol_validation"` // 是否在规则检查前校验HTTP协议（请求走私、编码、限制等），开启后域名的所有请求都经过WAF检查
+	AllowedMethods      string    `json:"allowed_methods" gorm:"type:text;column:allowed_methods"`             // 允许的请求方法，JSON数组格式，如 ["GET","POST"]，为空表示不限制
+	MaxHeaderCount      int       `json:"max_header_count" gorm:"default:100;column:max_header_count"`         // 最大请求头个数，0表示不限制
+	MaxHeaderSize       int       `json:"max_header_size" gorm:"default:32768;column:max_header_size"`         // 请求头总字节数上限，0表示不限制
+	MaxURLLength        int       `json:"max_url_length" gorm:"default:8192;column:max_url_length"`            // 请求URI（路径和查询串）最大长度，0表示不限制
+	MaxArgCount         int       `json:"max_arg_count" gorm:"default:256;column:max_arg_count"`               // 查询参数和表单参数最大个数，0表示不限制
+	AllowedContentTypes string    `json:"allowed_content_types" gorm:"type:text;column:allowed_content_types"` // 允许的请求体Content-Type，JSON数组格式，支持 multipart/* 通配，为空表示不限制
+	TenantID            uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                    // 所属租户ID
+	Enabled             bool      `json:"enabled" gorm:"default:true;index;column:enabled"`                    // 是否启用
+	CreatedAt           time.Time `json:"created_at" gorm:"column:created_at"`                                 // 创建时间
+	UpdatedAt           time.Time `json:"updated_at" gorm:"column:updated_at"`                                 // 更新时间
+	Tenant              *Tenant   `json:"tenant,omitempty" gorm:"foreignKey:TenantID"`                         // 关联的租户信息
 
 	// 多对多关系 - 通过关联表连接
 	Policies []Policy `json:"policies,omitempty" gorm:"many2many:domain_policies"` // 域名关联的策略列表
+
+	RewriteRules []RewriteRule `json:"rewrite_rules,omitempty" gorm:"foreignKey:DomainID"` // 域名的重写规则
 }
 
 // TableName 指定Domain模型使用的表名
@@ -64,6 +101,7 @@ type Policy struct {
 	Name        string    `json:"name" gorm:"not null;type:varchar(255);uniqueIndex:idx_policy_name_tenant;column:name"`
 	Description string    `json:"description" gorm:"column:description"`
 	Enabled     bool      `json:"enabled" gorm:"default:true;index;column:enabled"`
+	Mode        string    `json:"mode" gorm:"type:varchar(20);default:'enforce';column:mode"` // 防护模式：enforce, detect_only, off
 	TenantID    uint      `json:"tenant_id" gorm:"uniqueIndex:idx_policy_name_tenant;index;column:tenant_id"`
 	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"column:updated_at"`
@@ -76,14 +114,17 @@ type Rule struct {
 	ID           uint      `json:"id" gorm:"primarykey;column:id"`                                                      // 规则ID，主键
 	Name         string    `json:"name" gorm:"not null;type:varchar(255);uniqueIndex:idx_rule_name_tenant;column:name"` // 规则名称，在同一租户内唯一
 	Description  string    `json:"description" gorm:"column:description"`                                               // 规则描述
-	MatchType    string    `json:"match_type" gorm:"not null;type:varchar(50);index;column:match_type"`                 // 匹配类型：uri(URI路径), ip(IP地址), header(请求头), body(请求体), user_agent(用户代理)
+	MatchType    string    `json:"match_type" gorm:"not null;type:varchar(50);index;column:match_type"`                 // 匹配类型：uri(URI路径), ip(IP地址), header(请求头), body(请求体), user_agent(用户代理), client_cert_subject/client_cert_san/client_cert_fingerprint(客户端证书), ws_message(WebSocket文本消息), grpc_service/grpc_method/grpc_message(gRPC服务、方法和解码后的请求消息), graphql_operation_name/graphql_operation_type(GraphQL操作名称和类型), file_name/file_size/file_type(上传文件的文件名、字节数和按内容识别的类型), compound(组合条件)
 	Pattern      string    `json:"pattern" gorm:"not null;column:pattern"`                                              // 匹配模式，具体的匹配规则内容
-	MatchMode    string    `json:"match_mode" gorm:"not null;type:varchar(50);column:match_mode"`                       // 匹配模式：exact(精确匹配), regex(正则匹配), contains(包含匹配)
-	Action       string    `json:"action" gorm:"not null;type:varchar(50);index;column:action"`                         // 执行动作：block(阻断), allow(放行), log(仅记录)
+	Conditions   string    `json:"conditions" gorm:"type:text;column:conditions"`                                       // 组合条件，JSON格式的AND/OR/NOT条件树，仅compound类型使用
+	MatchMode    string    `json:"match_mode" gorm:"not null;type:varchar(50);column:match_mode"`                       // 匹配模式：exact(精确匹配), regex(正则匹配), contains(包含匹配), cel(CEL表达式，pattern为表达式)
+	Action       string    `json:"action" gorm:"not null;type:varchar(50);index;column:action"`                         // 执行动作：block(阻断，WebSocket消息为关闭连接), allow(放行), log(仅记录), drop(丢弃WebSocket消息)
 	ResponseCode int       `json:"response_code" gorm:"default:403;column:response_code"`                               // 阻断时返回的HTTP状态码，默认403
 	ResponseMsg  string    `json:"response_msg" gorm:"column:response_msg"`                                             // 阻断时返回的消息内容
 	Priority     int       `json:"priority" gorm:"default:1;index;column:priority"`                                     // 规则优先级，数字越大优先级越高
 	Enabled      bool      `json:"enabled" gorm:"default:true;index;column:enabled"`                                    // 规则是否启用
+	Tags         string    `json:"tags" gorm:"type:varchar(500);column:tags"`                                           // 规则标签，多个以逗号分隔，如 sqli,xss，规则排除可按标签跳过规则
+	TestCases    string    `json:"test_cases" gorm:"type:text;column:test_cases"`                                       // 测试用例，JSON数组，每项为模拟请求及是否应命中，保存后可通过测试接口执行
 	TenantID     uint      `json:"tenant_id" gorm:"uniqueIndex:idx_rule_name_tenant;index;column:tenant_id"`            // 所属租户ID，0表示全局规则
 	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`                                                 // 创建时间
 	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`                                                 // 更新时间
@@ -93,7 +134,7 @@ type Rule struct {
 // BlackList 黑名单表 - 黑名单条目定义
 type BlackList struct {
 	ID        uint      `json:"id" gorm:"primarykey;column:id"`                                                                         // 黑名单ID，主键
-	Type      string    `json:"type" gorm:"not null;type:varchar(50);uniqueIndex:idx_blacklist_type_value_tenant;column:type"`          // 黑名单类型：ip(IP地址), uri(URI路径), user_agent(用户代理)
+	Type      string    `json:"type" gorm:"not null;type:varchar(50);uniqueIndex:idx_blacklist_type_value_tenant;column:type"`          // 黑名单类型：ip(IP地址), uri(URI路径), user_agent(用户代理), client_cert(客户端证书SHA-256指纹)
 	Value     string    `json:"value" gorm:"not null;type:varchar(500);uniqueIndex:idx_blacklist_type_value_tenant;index;column:value"` // 黑名单值，具体的IP、URI或User-Agent
 	Comment   string    `json:"comment" gorm:"column:comment"`                                                                          // 备注说明
 	TenantID  uint      `json:"tenant_id" gorm:"uniqueIndex:idx_blacklist_type_value_tenant;index;column:tenant_id"`                    // 所属租户ID，0表示全局黑名单
@@ -106,7 +147,7 @@ type BlackList struct {
 // WhiteList 白名单表 - 白名单条目定义
 type WhiteList struct {
 	ID        uint      `json:"id" gorm:"primarykey;column:id"`                                                                         // 白名单ID，主键
-	Type      string    `json:"type" gorm:"not null;type:varchar(50);uniqueIndex:idx_whitelist_type_value_tenant;column:type"`          // 白名单类型：ip(IP地址), uri(URI路径), user_agent(用户代理)
+	Type      string    `json:"type" gorm:"not null;type:varchar(50);uniqueIndex:idx_whitelist_type_value_tenant;column:type"`          // 白名单类型：ip(IP地址), uri(URI路径), user_agent(用户代理), client_cert(客户端证书SHA-256指纹)
 	Value     string    `json:"value" gorm:"not null;type:varchar(500);uniqueIndex:idx_whitelist_type_value_tenant;index;column:value"` // 白名单值，具体的IP、URI或User-Agent
 	Comment   string    `json:"comment" gorm:"column:comment"`                                                                          // 备注说明
 	TenantID  uint      `json:"tenant_id" gorm:"uniqueIndex:idx_whitelist_type_value_tenant;index;column:tenant_id"`                    // 所属租户ID，0表示全局白名单
@@ -127,6 +168,8 @@ type DomainPolicy struct {
 	PolicyID  uint      `json:"policy_id" gorm:"not null;uniqueIndex:idx_domain_policy;column:policy_id"` // 策略ID
 	Priority  int       `json:"priority" gorm:"default:1;column:priority"`                                // 策略在该域名下的优先级，数字越大优先级越高
 	Enabled   bool      `json:"enabled" gorm:"default:true;index;column:enabled"`                         // 是否启用此关联
+	Mode      string    `json:"mode" gorm:"type:varchar(20);default:'enforce';column:mode"`               // 该域名下策略的防护模式：enforce, detect_only, off，与域名和策略的模式取最宽松的一个
+	Shadow    bool      `json:"shadow" gorm:"default:false;column:shadow"`                                // 影子策略：在旁路评估线上流量并统计与生效策略的差异，不影响请求处理结果
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`                                      // 创建时间
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`                                      // 更新时间
 	Domain    *Domain   `json:"domain,omitempty" gorm:"foreignKey:DomainID"`                              // 关联的域名配置
@@ -166,8 +209,10 @@ type AttackLog struct {
 	RuleName       string    `json:"rule_name" gorm:"type:varchar(255);index;column:rule_name"`                               // 触发的规则名称
 	MatchField     string    `json:"match_field" gorm:"type:varchar(100);column:match_field"`                                 // 匹配的字段名称
 	MatchValue     string    `json:"match_value" gorm:"type:text;column:match_value"`                                         // 匹配值
-	Action         string    `json:"action" gorm:"type:varchar(50);column:action"`                                            // 执行动作
+	Username       string    `json:"username" gorm:"type:varchar(255);index;column:username"`                                 // 登录接口请求的用户名，登录接口配置了脱敏时为脱敏后的值
+	Action         string    `json:"action" gorm:"type:varchar(50);column:action"`                                            // 执行动作，excluded表示命中被规则排除跳过，would_block表示检测模式下本应拦截但已放行
 	ResponseCode   int       `json:"response_code" gorm:"column:response_code"`                                               // 响应状态码
+	SuppressedHits string    `json:"suppressed_hits" gorm:"type:text;column:suppressed_hits"`                                 // 被规则排除跳过的命中，JSON格式
 	TenantID       uint      `json:"tenant_id" gorm:"index;column:tenant_id"`                                                 // 租户ID
 	CreatedAt      time.Time `json:"created_at" gorm:"index;column:created_at"`                                               // 创建时间
 }
@@ -200,6 +245,296 @@ type Webhook struct {
 	Tenant    *Tenant   `json:"tenant,omitempty" gorm:"foreignKey:TenantID"`                                            // 关联的租户信息
 }
 
+// ACMEAccount ACME账户表 - 每个ACME目录地址对应一个账户
+type ACMEAccount struct {
+	ID           uint      `json:"id" gorm:"primarykey;column:id"`                                                   // 账户ID，主键
+	DirectoryURL string    `json:"directory_url" gorm:"not null;type:varchar(500);uniqueIndex;column:directory_url"` // ACME目录地址
+	Email        string    `json:"email" gorm:"type:varchar(255);column:email"`                                      // 联系邮箱
+	AccountURL   string    `json:"account_url" gorm:"type:varchar(500);column:account_url"`                          // ACME服务返回的账户地址
+	PrivateKey   string    `json:"-" gorm:"type:text;column:private_key"`                                            // 账户私钥（加密存储）
+	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`                                              // 创建时间
+	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`                                              // 更新时间
+}
+
+// ACMECertificate ACME证书表 - 记录自动签发的证书及续期状态
+type ACMECertificate struct {
+	ID            uint       `json:"id" gorm:"primarykey;column:id"`                                 // 证书记录ID，主键
+	DomainID      uint       `json:"domain_id" gorm:"not null;uniqueIndex;column:domain_id"`         // 域名ID
+	Domain        string     `json:"domain" gorm:"type:varchar(255);index;column:domain"`            // 域名
+	Certificate   string     `json:"-" gorm:"type:text;column:certificate"`                          // 证书链（PEM格式，加密存储）
+	PrivateKey    string     `json:"-" gorm:"type:text;column:private_key"`                          // 证书私钥（PEM格式，加密存储）
+	Issuer        string     `json:"issuer" gorm:"type:varchar(500);column:issuer"`                  // 签发者
+	SerialNumber  string     `json:"serial_number" gorm:"type:varchar(100);column:serial_number"`    // 证书序列号
+	NotBefore     *time.Time `json:"not_before" gorm:"column:not_before"`                            // 生效时间
+	NotAfter      *time.Time `json:"not_after" gorm:"index;column:not_after"`                        // 过期时间
+	Status        string     `json:"status" gorm:"type:varchar(20);default:'pending';column:status"` // 状态：pending(待签发), issuing(签发中), valid(有效), failed(失败)
+	LastError     string     `json:"last_error" gorm:"type:text;column:last_error"`                  // 最近一次失败原因
+	FailureCount  int        `json:"failure_count" gorm:"default:0;column:failure_count"`            // 连续失败次数
+	LastAttemptAt *time.Time `json:"last_attempt_at" gorm:"column:last_attempt_at"`                  // 最近一次签发/续期尝试时间
+	RenewedAt     *time.Time `json:"renewed_at" gorm:"column:renewed_at"`                            // 最近一次成功签发时间
+	TenantID      uint       `json:"tenant_id" gorm:"index;column:tenant_id"`                        // 租户ID
+	CreatedAt     time.Time  `json:"created_at" gorm:"column:created_at"`                            // 创建时间
+	UpdatedAt     time.Time  `json:"updated_at" gorm:"column:updated_at"`                            // 更新时间
+}
+
+// DomainCertificate 域名附加证书表 - 同一域名可配置多张证书（如RSA和ECDSA），握手时按客户端能力选择
+type DomainCertificate struct {
+	ID          uint       `json:"id" gorm:"primarykey;column:id"`                           // 证书ID，主键
+	DomainID    uint       `json:"domain_id" gorm:"not null;index;column:domain_id"`         // 域名ID
+	Name        string     `json:"name" gorm:"type:varchar(255);column:name"`                // 证书名称
+	Certificate string     `json:"certificate" gorm:"type:text;not null;column:certificate"` // 证书链（PEM格式）
+	PrivateKey  string     `json:"-" gorm:"type:text;not null;column:private_key"`           // 私钥（PEM格式）
+	KeyType     string     `json:"key_type" gorm:"type:varchar(50);column:key_type"`         // 密钥类型，如 RSA-2048、ECDSA-P256
+	Issuer      string     `json:"issuer" gorm:"type:varchar(500);column:issuer"`            // 签发者
+	NotAfter    *time.Time `json:"not_after" gorm:"index;column:not_after"`                  // 过期时间
+	Enabled     bool       `json:"enabled" gorm:"default:true;column:enabled"`               // 是否启用
+	TenantID    uint       `json:"tenant_id" gorm:"not null;index;column:tenant_id"`         // 租户ID
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at"`                      // 创建时间
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"column:updated_at"`                      // 更新时间
+}
+
+// WebSocketSession WebSocket会话记录表 - 连接关闭时写入
+type WebSocketSession struct {
+	ID          uint      `json:"id" gorm:"primarykey;column:id"`                              // 会话记录ID，主键
+	SessionID   string    `json:"session_id" gorm:"type:varchar(255);index;column:session_id"` // 会话唯一标识符，与攻击日志的request_id对应
+	DomainID    uint      `json:"domain_id" gorm:"index;column:domain_id"`                     // 域名ID
+	Domain      string    `json:"domain" gorm:"type:varchar(255);index;column:domain"`         // 域名
+	ClientIP    string    `json:"client_ip" gorm:"type:varchar(45);index;column:client_ip"`    // 客户端IP地址
+	UserAgent   string    `json:"user_agent" gorm:"column:user_agent"`                         // 用户代理字符串
+	RequestURI  string    `json:"request_uri" gorm:"type:varchar(500);column:request_uri"`     // 握手请求URI
+	MessagesIn  int64     `json:"messages_in" gorm:"default:0;column:messages_in"`             // 客户端发送的消息数
+	MessagesOut int64     `json:"messages_out" gorm:"default:0;column:messages_out"`           // 后端发送的消息数
+	BytesIn     int64     `json:"bytes_in" gorm:"default:0;column:bytes_in"`                   // 客户端发送的负载字节数
+	BytesOut    int64     `json:"bytes_out" gorm:"default:0;column:bytes_out"`                 // 后端发送的负载字节数
+	Violations  int       `json:"violations" gorm:"default:0;column:violations"`               // 命中WAF规则的消息数
+	CloseReason string    `json:"close_reason" gorm:"type:varchar(50);column:close_reason"`    // 关闭原因：client_closed, backend_closed, idle_timeout, max_duration, policy_violation, message_too_big, error
+	StartedAt   time.Time `json:"started_at" gorm:"index;column:started_at"`                   // 连接建立时间
+	EndedAt     time.Time `json:"ended_at" gorm:"column:ended_at"`                             // 连接关闭时间
+	TenantID    uint      `json:"tenant_id" gorm:"index;column:tenant_id"`                     // 租户ID
+	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at"`                         // 创建时间
+}
+
+// GRPCDescriptorSet gRPC描述文件表 - 用于解码gRPC请求消息
+type GRPCDescriptorSet struct {
+	ID        uint      `json:"id" gorm:"primarykey;column:id"`                   // 描述文件ID，主键
+	DomainID  uint      `json:"domain_id" gorm:"not null;index;column:domain_id"` // 域名ID
+	Name      string    `json:"name" gorm:"type:varchar(255);column:name"`        // 名称
+	Content   []byte    `json:"-" gorm:"type:longblob;column:content"`            // FileDescriptorSet二进制内容（protoc --include_imports --descriptor_set_out生成）
+	Services  string    `json:"services" gorm:"type:text;column:services"`        // 包含的服务全名，JSON数组
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"` // 租户ID
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`              // 创建时间
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`              // 更新时间
+}
+
+// RewriteRule 重写规则表 - 代理转发时修改请求/响应头、重写URL或重定向
+type RewriteRule struct {
+	ID         uint      `json:"id" gorm:"primarykey;column:id"`                          // 规则ID，主键
+	DomainID   uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`        // 域名ID
+	Name       string    `json:"name" gorm:"type:varchar(255);column:name"`               // 规则名称
+	Location   string    `json:"location" gorm:"type:varchar(500);column:location"`       // 生效路径前缀，为空表示整个域名
+	Type       string    `json:"type" gorm:"not null;type:varchar(30);column:type"`       // 规则类型：request_header_add/set/remove, response_header_add/set/remove, url_rewrite, redirect
+	HeaderName string    `json:"header_name" gorm:"type:varchar(255);column:header_name"` // 头部名称（头部规则使用）
+	Pattern    string    `json:"pattern" gorm:"type:varchar(1000);column:pattern"`        // 匹配请求URI的正则表达式（url_rewrite、redirect使用）
+	Value      string    `json:"value" gorm:"type:text;column:value"`                     // 头部值或替换目标，支持 ${host} 等变量和 $1 等正则分组
+	StatusCode int       `json:"status_code" gorm:"default:0;column:status_code"`         // 重定向状态码：301, 302, 307, 308
+	Priority   int       `json:"priority" gorm:"default:0;column:priority"`               // 优先级，数字越大越先执行
+	Enabled    bool      `json:"enabled" gorm:"default:true;column:enabled"`              // 是否启用
+	TenantID   uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`        // 租户ID
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`                     // 创建时间
+	UpdatedAt  time.Time `json:"updated_at" gorm:"column:updated_at"`                     // 更新时间
+}
+
+// GraphQLEndpoint GraphQL端点表 - 对配置路径的GraphQL请求进行解析和滥用限制
+type GraphQLEndpoint struct {
+	ID                 uint      `json:"id" gorm:"primarykey;column:id"`                                      // 端点ID，主键
+	DomainID           uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`                    // 域名ID
+	Path               string    `json:"path" gorm:"not null;type:varchar(500);column:path"`                  // GraphQL请求路径，如 /graphql
+	MaxDepth           int       `json:"max_depth" gorm:"default:0;column:max_depth"`                         // 最大查询深度，0表示不限制
+	MaxAliases         int       `json:"max_aliases" gorm:"default:0;column:max_aliases"`                     // 最大别名数，0表示不限制
+	MaxFields          int       `json:"max_fields" gorm:"default:0;column:max_fields"`                       // 最大字段数（展开片段后），0表示不限制
+	MaxComplexity      int       `json:"max_complexity" gorm:"default:0;column:max_complexity"`               // 最大复杂度，列表参数first/last/limit等作为子字段的乘数，0表示不限制
+	MaxBatchSize       int       `json:"max_batch_size" gorm:"default:0;column:max_batch_size"`               // 批量请求最大查询数，0表示不限制
+	BlockIntrospection bool      `json:"block_introspection" gorm:"default:false;column:block_introspection"` // 是否禁止__schema/__type内省查询
+	Action             string    `json:"action" gorm:"type:varchar(20);default:'block';column:action"`        // 超出限制时的动作：block, log
+	Enabled            bool      `json:"enabled" gorm:"default:true;column:enabled"`                          // 是否启用
+	TenantID           uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                    // 租户ID
+	CreatedAt          time.Time `json:"created_at" gorm:"column:created_at"`                                 // 创建时间
+	UpdatedAt          time.Time `json:"updated_at" gorm:"column:updated_at"`                                 // 更新时间
+}
+
+// APISpec OpenAPI规范表 - 按域名和路径前缀校验请求的路径、方法、参数、请求体和Content-Type
+type APISpec struct {
+	ID         uint      `json:"id" gorm:"primarykey;column:id"`                              // 规范ID，主键
+	DomainID   uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`            // 域名ID
+	Name       string    `json:"name" gorm:"type:varchar(255);column:name"`                   // 名称
+	Location   string    `json:"location" gorm:"type:varchar(500);column:location"`           // 生效路径前缀，规范中的路径相对于该前缀，为空表示整个域名
+	Mode       string    `json:"mode" gorm:"type:varchar(20);default:'log_only';column:mode"` // 模式：enforce(拦截), log_only(仅记录), learn(学习，只统计违规不记录攻击日志)
+	Content    string    `json:"content" gorm:"type:longtext;column:content"`                 // OpenAPI 3规范内容，JSON或YAML
+	Version    string    `json:"version" gorm:"type:varchar(100);column:version"`             // 规范中的info.version
+	Operations int       `json:"operations" gorm:"default:0;column:operations"`               // 规范定义的操作数
+	Enabled    bool      `json:"enabled" gorm:"default:true;column:enabled"`                  // 是否启用
+	TenantID   uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`            // 租户ID
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`                         // 创建时间
+	UpdatedAt  time.Time `json:"updated_at" gorm:"column:updated_at"`                         // 更新时间
+}
+
+// APISpecObservation OpenAPI学习记录表 - learn模式下按违规类型聚合的请求统计，用于完善规范
+type APISpecObservation struct {
+	ID         uint      `json:"id" gorm:"primarykey;column:id"`                             // 记录ID，主键
+	SpecID     uint      `json:"spec_id" gorm:"not null;index;column:spec_id"`               // 规范ID
+	DomainID   uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`           // 域名ID
+	Method     string    `json:"method" gorm:"type:varchar(10);column:method"`               // 请求方法
+	Path       string    `json:"path" gorm:"type:varchar(500);column:path"`                  // 规范中的路径模板，未定义的路径为归一化后的请求路径
+	Parameter  string    `json:"parameter" gorm:"type:varchar(255);column:parameter"`        // 违规的参数，如 query.limit, body/user/email, path, method
+	Constraint string    `json:"constraint" gorm:"type:varchar(100);column:constraint_name"` // 违反的约束，如 required, type, maxLength, content_type
+	Sample     string    `json:"sample" gorm:"type:text;column:sample"`                      // 最近一次违规的说明和值
+	Count      int64     `json:"count" gorm:"default:0;column:count"`                        // 出现次数
+	FirstSeen  time.Time `json:"first_seen" gorm:"column:first_seen"`                        // 首次出现时间
+	LastSeen   time.Time `json:"last_seen" gorm:"column:last_seen"`                          // 最近出现时间
+	TenantID   uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`           // 租户ID
+}
+
+// LearningSession 学习会话表 - 在指定时间内记录域名的正常流量，生成正向安全规范和规则排除建议
+type LearningSession struct {
+	ID        uint       `json:"id" gorm:"primarykey;column:id"`                                         // 会话ID，主键
+	DomainID  uint       `json:"domain_id" gorm:"not null;index;column:domain_id"`                       // 域名ID
+	Name      string     `json:"name" gorm:"type:varchar(255);column:name"`                              // 名称
+	Status    string     `json:"status" gorm:"type:varchar(20);default:'recording';index;column:status"` // 状态：recording(记录中), stopped(已停止), applied(已应用)
+	Requests  int64      `json:"requests" gorm:"default:0;column:requests"`                              // 记录的请求数
+	StartedAt time.Time  `json:"started_at" gorm:"column:started_at"`                                    // 开始时间
+	EndsAt    time.Time  `json:"ends_at" gorm:"column:ends_at"`                                          // 计划结束时间，到期后自动停止记录
+	StoppedAt *time.Time `json:"stopped_at" gorm:"column:stopped_at"`                                    // 实际停止时间
+	TenantID  uint       `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                       // 租户ID
+	CreatedAt time.Time  `json:"created_at" gorm:"column:created_at"`                                    // 创建时间
+	UpdatedAt time.Time  `json:"updated_at" gorm:"column:updated_at"`                                    // 更新时间
+}
+
+// LearningEndpoint 学习到的接口表 - 按方法和归一化路径聚合的流量特征
+type LearningEndpoint struct {
+	ID           uint      `json:"id" gorm:"primarykey;column:id"`                                                 // 记录ID，主键
+	SessionID    uint      `json:"session_id" gorm:"not null;uniqueIndex:idx_learning_endpoint;column:session_id"` // 学习会话ID
+	DomainID     uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`                               // 域名ID
+	Method       string    `json:"method" gorm:"type:varchar(10);uniqueIndex:idx_learning_endpoint;column:method"` // 请求方法
+	Path         string    `json:"path" gorm:"type:varchar(500);uniqueIndex:idx_learning_endpoint;column:path"`    // 归一化路径，数字、UUID等路径段替换为 {id}、{uuid} 等占位符
+	ContentTypes string    `json:"content_types" gorm:"type:text;column:content_types"`                            // 出现过的请求Content-Type，JSON数组
+	Parameters   string    `json:"parameters" gorm:"type:mediumtext;column:parameters"`                            // 参数特征：名称、位置、值类型、长度范围，JSON数组
+	Count        int64     `json:"count" gorm:"default:0;column:count"`                                            // 请求数
+	TenantID     uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                               // 租户ID
+	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`                                            // 创建时间
+	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`                                            // 更新时间
+}
+
+// LearningRuleHit 学习期间的规则命中表 - 运维标记为正常流量的命中将生成规则排除建议
+type LearningRuleHit struct {
+	ID         uint      `json:"id" gorm:"primarykey;column:id"`                          // 记录ID，主键
+	SessionID  uint      `json:"session_id" gorm:"not null;index;column:session_id"`      // 学习会话ID
+	DomainID   uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`        // 域名ID
+	RuleID     uint      `json:"rule_id" gorm:"index;column:rule_id"`                     // 命中的规则ID
+	RuleName   string    `json:"rule_name" gorm:"type:varchar(255);column:rule_name"`     // 命中的规则名称
+	Method     string    `json:"method" gorm:"type:varchar(10);column:method"`            // 请求方法
+	Path       string    `json:"path" gorm:"type:varchar(500);column:path"`               // 归一化路径
+	MatchField string    `json:"match_field" gorm:"type:varchar(100);column:match_field"` // 匹配字段
+	Sample     string    `json:"sample" gorm:"type:text;column:sample"`                   // 最近一次命中的匹配值
+	Count      int64     `json:"count" gorm:"default:0;column:count"`                     // 命中次数
+	Legitimate bool      `json:"legitimate" gorm:"default:false;column:legitimate"`       // 是否被标记为正常流量
+	FirstSeen  time.Time `json:"first_seen" gorm:"column:first_seen"`                     // 首次命中时间
+	LastSeen   time.Time `json:"last_seen" gorm:"column:last_seen"`                       // 最近命中时间
+	TenantID   uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`        // 租户ID
+}
+
+// ShadowStat 影子策略评估汇总表 - 每个域名一条
+type ShadowStat struct {
+	ID           uint      `json:"id" gorm:"primarykey;column:id"`                         // 记录ID，主键
+	DomainID     uint      `json:"domain_id" gorm:"not null;uniqueIndex;column:domain_id"` // 域名ID
+	Requests     int64     `json:"requests" gorm:"default:0;column:requests"`              // 评估的请求数
+	Agreed       int64     `json:"agreed" gorm:"default:0;column:agreed"`                  // 影子策略与生效策略结果一致的请求数
+	ShadowBlocks int64     `json:"shadow_blocks" gorm:"default:0;column:shadow_blocks"`    // 影子策略拦截、生效策略放行的请求数
+	LiveBlocks   int64     `json:"live_blocks" gorm:"default:0;column:live_blocks"`        // 生效策略拦截、影子策略放行的请求数
+	Dropped      int64     `json:"dropped" gorm:"default:0;column:dropped"`                // 评估队列已满未评估的请求数
+	Since        time.Time `json:"since" gorm:"column:since"`                              // 开始统计时间
+	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`                    // 更新时间
+	TenantID     uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`       // 租户ID
+}
+
+// ShadowDiff 影子策略差异表 - 按规则统计影子策略与生效策略处理结果不一致的请求
+type ShadowDiff struct {
+	ID        uint      `json:"id" gorm:"primarykey;column:id"`                                                          // 记录ID，主键
+	DomainID  uint      `json:"domain_id" gorm:"not null;uniqueIndex:idx_shadow_diff;column:domain_id"`                  // 域名ID
+	RuleID    uint      `json:"rule_id" gorm:"not null;uniqueIndex:idx_shadow_diff;column:rule_id"`                      // 导致拦截的规则ID，shadow_block为影子策略的规则，live_block为生效策略的规则
+	RuleName  string    `json:"rule_name" gorm:"type:varchar(255);column:rule_name"`                                     // 规则名称
+	Direction string    `json:"direction" gorm:"type:varchar(20);not null;uniqueIndex:idx_shadow_diff;column:direction"` // 差异方向：shadow_block(影子拦截、生效放行), live_block(生效拦截、影子放行)
+	Count     int64     `json:"count" gorm:"default:0;column:count"`                                                     // 请求数
+	Samples   string    `json:"samples" gorm:"type:text;column:samples"`                                                 // 最近的样本请求，JSON数组
+	FirstSeen time.Time `json:"first_seen" gorm:"column:first_seen"`                                                     // 首次出现时间
+	LastSeen  time.Time `json:"last_seen" gorm:"column:last_seen"`                                                       // 最近出现时间
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                                        // 租户ID
+}
+
+// UploadPolicy 文件上传策略表 - 按域名和路径前缀检查multipart/form-data请求中的上传文件
+type UploadPolicy struct {
+	ID                    uint      `json:"id" gorm:"primarykey;column:id"`                                             // 策略ID，主键
+	DomainID              uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`                           // 域名ID
+	Name                  string    `json:"name" gorm:"type:varchar(255);column:name"`                                  // 名称
+	Path                  string    `json:"path" gorm:"type:varchar(500);column:path"`                                  // 生效路径前缀，为空表示整个域名，多个策略匹配时使用最长的前缀
+	MaxFileSize           int64     `json:"max_file_size" gorm:"default:0;column:max_file_size"`                        // 单个文件最大字节数，0表示不限制
+	MaxFileCount          int       `json:"max_file_count" gorm:"default:0;column:max_file_count"`                      // 单个请求最多文件数，0表示不限制
+	AllowedExtensions     string    `json:"allowed_extensions" gorm:"type:text;column:allowed_extensions"`              // 允许的扩展名，JSON数组格式，如 [".jpg",".png"]，为空表示不限制
+	AllowedMIMETypes      string    `json:"allowed_mime_types" gorm:"type:text;column:allowed_mime_types"`              // 允许的文件类型（按文件内容识别），JSON数组格式，支持 image/* 通配，为空表示不限制
+	BlockDoubleExtensions bool      `json:"block_double_extensions" gorm:"default:true;column:block_double_extensions"` // 是否拦截双扩展名（如 shell.php.jpg）
+	BlockPolyglots        bool      `json:"block_polyglots" gorm:"default:true;column:block_polyglots"`                 // 是否拦截嵌入了脚本或其他文件格式的图片、PDF等文件
+	ScanMalware           bool      `json:"scan_malware" gorm:"default:false;column:scan_malware"`                      // 是否通过ClamAV扫描文件内容，需要在配置中指定clamd地址
+	Action                string    `json:"action" gorm:"type:varchar(20);default:'block';column:action"`               // 违规时的动作：block, log
+	Enabled               bool      `json:"enabled" gorm:"default:true;column:enabled"`                                 // 是否启用
+	TenantID              uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                           // 租户ID
+	CreatedAt             time.Time `json:"created_at" gorm:"column:created_at"`                                        // 创建时间
+	UpdatedAt             time.Time `json:"updated_at" gorm:"column:updated_at"`                                        // 更新时间
+}
+
+// LoginEndpoint 登录接口表 - 按用户名、IP和用户名+IP统计登录失败次数，防护暴力破解和撞库
+type LoginEndpoint struct {
+	ID                 uint      `json:"id" gorm:"primarykey;column:id"`                                         // 登录接口ID，主键
+	DomainID           uint      `json:"domain_id" gorm:"not null;index;column:domain_id"`                       // 域名ID
+	Name               string    `json:"name" gorm:"type:varchar(255);column:name"`                              // 名称
+	Path               string    `json:"path" gorm:"not null;type:varchar(500);column:path"`                     // 登录接口路径，精确匹配
+	Method             string    `json:"method" gorm:"type:varchar(10);default:'POST';column:method"`            // 请求方法
+	UsernameField      string    `json:"username_field" gorm:"not null;type:varchar(255);column:username_field"` // 用户名字段：表单字段名或JSON字段路径（如 user.email），请求体中没有时读取查询参数
+	FailureStatusCodes string    `json:"failure_status_codes" gorm:"type:text;column:failure_status_codes"`      // 表示登录失败的响应状态码，JSON数组格式，如 [401,403]
+	FailureBodyPattern string    `json:"failure_body_pattern" gorm:"type:text;column:failure_body_pattern"`      // 表示登录失败的响应体正则表达式，与状态码任一匹配即为失败
+	FailureWindow      int       `json:"failure_window" gorm:"default:900;column:failure_window"`                // 失败次数的统计窗口（秒），窗口内没有新的失败时计数清零
+	DelayAfter         int       `json:"delay_after" gorm:"default:3;column:delay_after"`                        // 用户名+IP失败次数达到该值后延迟转发，0表示不延迟
+	DelayMs            int       `json:"delay_ms" gorm:"default:500;column:delay_ms"`                            // 首次延迟的毫秒数，之后每次失败翻倍
+	MaxDelayMs         int       `json:"max_delay_ms" gorm:"default:8000;column:max_delay_ms"`                   // 最大延迟毫秒数
+	ChallengeAfter     int       `json:"challenge_after" gorm:"default:5;column:challenge_after"`                // 用户名+IP失败次数达到该值后要求通过JS工作量证明质询，0表示不质询
+	MaxUserIPFailures  int       `json:"max_user_ip_failures" gorm:"default:10;column:max_user_ip_failures"`     // 用户名+IP失败次数达到该值后拦截，0表示不限制
+	MaxIPFailures      int       `json:"max_ip_failures" gorm:"default:50;column:max_ip_failures"`               // IP失败次数达到该值后拦截，0表示不限制
+	MaxUserFailures    int       `json:"max_user_failures" gorm:"default:20;column:max_user_failures"`           // 用户名在所有IP上的失败次数达到该值后对该用户名的登录要求质询（不拦截，避免锁定账号本人），0表示不限制
+	MaxUsernamesPerIP  int       `json:"max_usernames_per_ip" gorm:"default:10;column:max_usernames_per_ip"`     // 同一IP在窗口内尝试的不同用户名数达到该值后拦截（撞库），0表示不限制
+	MaskUsername       bool      `json:"mask_username" gorm:"default:false;column:mask_username"`                // 攻击日志中是否对用户名脱敏
+	Enabled            bool      `json:"enabled" gorm:"default:true;column:enabled"`                             // 是否启用
+	TenantID           uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                       // 租户ID
+	CreatedAt          time.Time `json:"created_at" gorm:"column:created_at"`                                    // 创建时间
+	UpdatedAt          time.Time `json:"updated_at" gorm:"column:updated_at"`                                    // 更新时间
+}
+
+// RuleExclusion 规则排除表 - 请求路径匹配时跳过指定规则或规则标签，可只排除某个检查目标
+type RuleExclusion struct {
+	ID        uint      `json:"id" gorm:"primarykey;column:id"`                                        // 排除ID，主键
+	DomainID  uint      `json:"domain_id" gorm:"default:0;index;column:domain_id"`                     // 域名ID，0表示策略级排除
+	PolicyID  uint      `json:"policy_id" gorm:"default:0;index;column:policy_id"`                     // 策略ID，0表示域名级排除；策略级排除作用于使用该策略的所有域名
+	Name      string    `json:"name" gorm:"type:varchar(255);column:name"`                             // 名称
+	RuleID    uint      `json:"rule_id" gorm:"default:0;index;column:rule_id"`                         // 跳过的规则ID，0表示按规则标签匹配
+	RuleTag   string    `json:"rule_tag" gorm:"type:varchar(100);column:rule_tag"`                     // 跳过带有该标签的规则
+	Target    string    `json:"target" gorm:"type:varchar(255);column:target"`                         // 排除的检查目标：为空表示跳过整条规则；匹配类型如body, user_agent；body:参数名 排除请求体参数；header:名称 排除请求头
+	PathMatch string    `json:"path_match" gorm:"type:varchar(20);default:'prefix';column:path_match"` // 路径匹配方式：exact, prefix, regex
+	Path      string    `json:"path" gorm:"type:varchar(500);column:path"`                             // 路径，为空表示所有路径
+	Source    string    `json:"source" gorm:"type:varchar(20);default:'manual';column:source"`         // 来源：manual(手动创建), learning(学习会话生成), modsec(ModSecurity规则导入)
+	Comment   string    `json:"comment" gorm:"type:varchar(500);column:comment"`                       // 备注
+	Enabled   bool      `json:"enabled" gorm:"default:true;index;column:enabled"`                      // 是否启用
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;column:tenant_id"`                      // 租户ID
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`                                   // 创建时间
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`                                   // 更新时间
+}
+
 // 数据库迁移
 func AutoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
@@ -218,5 +553,22 @@ func AutoMigrate(db *gorm.DB) error {
 		&AttackLog{},
 		&RateLimit{},
 		&Webhook{},
+		&ACMEAccount{},
+		&ACMECertificate{},
+		&DomainCertificate{},
+		&RewriteRule{},
+		&WebSocketSession{},
+		&GRPCDescriptorSet{},
+		&GraphQLEndpoint{},
+		&APISpec{},
+		&APISpecObservation{},
+		&LearningSession{},
+		&LearningEndpoint{},
+		&LearningRuleHit{},
+		&RuleExclusion{},
+		&ShadowStat{},
+		&ShadowDiff{},
+		&UploadPolicy{},
+		&LoginEndpoint{},
 	)
 }
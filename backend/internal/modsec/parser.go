@@ -0,0 +1,304 @@
+// Package modsec 解析ModSecurity SecLang规则并转换为本项目的规则、策略和规则排除
+package modsec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Directive SecLang指令，如 SecRule ARGS "@rx foo" "id:1,deny"
+type Directive struct {
+	Line int      // 指令起始行号
+	Name string   // 指令名称
+	Args []string // 去掉引号后的参数
+	Text string   // 指令原文（已合并续行）
+}
+
+// Variable SecRule的变量，如 REQUEST_HEADERS:User-Agent、!ARGS:foo、&ARGS
+type Variable struct {
+	Name     string // 变量名，大写
+	Selector string // 选择器，如请求头名、参数名；/.../表示正则选择器
+	Exclude  bool   // 以!开头，从检查中去掉该变量
+	Count    bool   // 以&开头，检查变量的个数
+}
+
+// Operator SecRule的运算符，如 @rx、!@pm
+type Operator struct {
+	Name   string // 运算符名称，省略时为rx
+	Arg    string // 运算符参数
+	Negate bool   // 以!开头，结果取反
+}
+
+// Action SecRule/SecAction的动作，如 id:1001、t:lowercase、ctl:ruleRemoveById=942100
+type Action struct {
+	Name  string // 动作名称，小写
+	Value string // 动作参数，已去掉引号
+}
+
+// SecRule 解析后的SecRule或SecAction，SecAction没有变量和运算符
+type SecRule struct {
+	Directive
+	Variables []Variable
+	Operator  Operator
+	Actions   []Action
+}
+
+// ParseError 无法解析的指令
+type ParseError struct {
+	Line int    // 指令起始行号
+	Text string // 指令原文
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Parse 将SecLang文本解析为指令列表，支持#注释、行尾\续行以及单双引号参数
+func Parse(src string) ([]Directive, []*ParseError) {
+	var directives []Directive
+	var errs []*ParseError
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		line := strings.TrimSpace(lines[i])
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(lines[i])
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			errs = append(errs, &ParseError{Line: start, Text: line, Err: err})
+			continue
+		}
+		directives = append(directives, Directive{Line: start, Name: args[0], Args: args[1:], Text: line})
+	}
+	return directives, errs
+}
+
+// splitArgs 按空白拆分指令参数。引号内的\"转义为引号，其他反斜杠原样保留，以免破坏正则表达式
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote byte
+	inArg := false
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && i+1 < len(line) && line[i+1] == quote {
+				current.WriteByte(quote)
+				i++
+			} else if ch == quote {
+				quote = 0
+			} else {
+				current.WriteByte(ch)
+			}
+		case ch == '"' || ch == '\'':
+			quote, inArg = ch, true
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// ParseSecRule 解析SecRule（变量、运算符、动作）或SecAction（动作）
+func ParseSecRule(directive Directive) (*SecRule, error) {
+	rule := &SecRule{Directive: directive}
+	var actions string
+
+	switch {
+	case strings.EqualFold(directive.Name, "SecAction"):
+		if len(directive.Args) != 1 {
+			return nil, fmt.Errorf("SecAction expects 1 argument, got %d", len(directive.Args))
+		}
+		actions = directive.Args[0]
+	case strings.EqualFold(directive.Name, "SecRule"):
+		if len(directive.Args) < 2 || len(directive.Args) > 3 {
+			return nil, fmt.Errorf("SecRule expects 2 or 3 arguments, got %d", len(directive.Args))
+		}
+		variables, err := ParseVariables(directive.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		rule.Variables = variables
+		rule.Operator = ParseOperator(directive.Args[1])
+		if len(directive.Args) == 3 {
+			actions = directive.Args[2]
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a rule directive", directive.Name)
+	}
+
+	parsed, err := ParseActions(actions)
+	if err != nil {
+		return nil, err
+	}
+	rule.Actions = parsed
+	return rule, nil
+}
+
+// ParseVariables 解析以|分隔的变量列表，正则选择器（/.../）中的|不作为分隔符
+func ParseVariables(s string) ([]Variable, error) {
+	var parts []string
+	var current strings.Builder
+	inRegex := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case inRegex:
+			current.WriteByte(ch)
+			if ch == '\\' && i+1 < len(s) {
+				i++
+				current.WriteByte(s[i])
+			} else if ch == '/' {
+				inRegex = false
+			}
+		case ch == '/' && strings.HasSuffix(current.String(), ":"):
+			current.WriteByte(ch)
+			inRegex = true
+		case ch == '|':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	parts = append(parts, current.String())
+
+	variables := make([]Variable, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty variable in %q", s)
+		}
+		var variable Variable
+		if strings.HasPrefix(part, "!") {
+			variable.Exclude, part = true, part[1:]
+		}
+		if strings.HasPrefix(part, "&") {
+			variable.Count, part = true, part[1:]
+		}
+		name, selector, _ := strings.Cut(part, ":")
+		variable.Name = strings.ToUpper(strings.TrimSpace(name))
+		variable.Selector = strings.Trim(strings.TrimSpace(selector), "'")
+		if variable.Name == "" {
+			return nil, fmt.Errorf("empty variable name in %q", s)
+		}
+		variables = append(variables, variable)
+	}
+	return variables, nil
+}
+
+// ParseOperator 解析运算符，省略@运算符时为@rx
+func ParseOperator(s string) Operator {
+	var op Operator
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "!") {
+		op.Negate, s = true, strings.TrimSpace(s[1:])
+	}
+	if !strings.HasPrefix(s, "@") {
+		op.Name, op.Arg = "rx", s
+		return op
+	}
+	name, arg, _ := strings.Cut(s[1:], " ")
+	op.Name, op.Arg = name, strings.TrimSpace(arg)
+	return op
+}
+
+// ParseActions 解析以逗号分隔的动作列表，单引号内的逗号不作为分隔符
+func ParseActions(s string) ([]Action, error) {
+	var actions []Action
+	var current strings.Builder
+	inQuote := false
+
+	flush := func() {
+		part := strings.TrimSpace(current.String())
+		current.Reset()
+		if part == "" {
+			return
+		}
+		name, value, _ := strings.Cut(part, ":")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "\\'", "'")
+		}
+		actions = append(actions, Action{Name: strings.ToLower(strings.TrimSpace(name)), Value: value})
+	}
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && inQuote && i+1 < len(s) && s[i+1] == '\'':
+			current.WriteString("\\'")
+			i++
+		case ch == '\'':
+			inQuote = !inQuote
+			current.WriteByte(ch)
+		case ch == ',' && !inQuote:
+			flush()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in actions %q", s)
+	}
+	flush()
+	return actions, nil
+}
+
+// action 返回第一个指定名称的动作
+func (r *SecRule) action(name string) (Action, bool) {
+	for _, action := range r.Actions {
+		if action.Name == name {
+			return action, true
+		}
+	}
+	return Action{}, false
+}
+
+// actions 返回所有指定名称的动作
+func (r *SecRule) actions(name string) []Action {
+	var result []Action
+	for _, action := range r.Actions {
+		if action.Name == name {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
+// ID 返回规则的id动作，没有或无效时返回0
+func (r *SecRule) ID() int {
+	action, ok := r.action("id")
+	if !ok {
+		return 0
+	}
+	id, err := strconv.Atoi(action.Value)
+	if err != nil {
+		return 0
+	}
+	return id
+}
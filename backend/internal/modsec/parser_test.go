@@ -0,0 +1,146 @@
+package modsec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "# comment\n" +
+		"SecRule ARGS \"@rx a\\\"b\\d+\" \"id:1,deny\"\n" +
+		"\n" +
+		"SecRule REQUEST_HEADERS:User-Agent \\\n" +
+		"    \"@pm foo bar\" \\\r\n" +
+		"    \"id:2,msg:'x y'\"\n" +
+		"SecAction 'id:3,pass'\n" +
+		"SecRule ARGS \"unterminated\n" +
+		"\tSecMarker a\"b c\"d  \n"
+
+	directives, errs := Parse(src)
+
+	want := []Directive{
+		{Line: 2, Name: "SecRule", Args: []string{"ARGS", `@rx a"b\d+`, "id:1,deny"}, Text: `SecRule ARGS "@rx a\"b\d+" "id:1,deny"`},
+		{Line: 4, Name: "SecRule", Args: []string{"REQUEST_HEADERS:User-Agent", "@pm foo bar", "id:2,msg:'x y'"}, Text: `SecRule REQUEST_HEADERS:User-Agent  "@pm foo bar"  "id:2,msg:'x y'"`},
+		{Line: 7, Name: "SecAction", Args: []string{"id:3,pass"}, Text: "SecAction 'id:3,pass'"},
+		{Line: 9, Name: "SecMarker", Args: []string{"ab cd"}, Text: `SecMarker a"b c"d`},
+	}
+	if !reflect.DeepEqual(directives, want) {
+		t.Errorf("directives = %#v, want %#v", directives, want)
+	}
+	if len(errs) != 1 || errs[0].Line != 8 || errs[0].Text != `SecRule ARGS "unterminated` {
+		t.Errorf("errors = %v, want unterminated quote on line 8", errs)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Variable
+		wantErr bool
+	}{
+		{input: "ARGS", want: []Variable{{Name: "ARGS"}}},
+		{input: "args|request_headers:User-Agent", want: []Variable{{Name: "ARGS"}, {Name: "REQUEST_HEADERS", Selector: "User-Agent"}}},
+		{input: "ARGS|!ARGS:foo", want: []Variable{{Name: "ARGS"}, {Name: "ARGS", Selector: "foo", Exclude: true}}},
+		{input: "&ARGS|&REQUEST_HEADERS:Host", want: []Variable{{Name: "ARGS", Count: true}, {Name: "REQUEST_HEADERS", Selector: "Host", Count: true}}},
+		{input: "REQUEST_COOKIES:'session id'", want: []Variable{{Name: "REQUEST_COOKIES", Selector: "session id"}}},
+		{input: "ARGS:/^(a|b)$/|!ARGS:/x\\/|y/", want: []Variable{{Name: "ARGS", Selector: "/^(a|b)$/"}, {Name: "ARGS", Selector: `/x\/|y/`, Exclude: true}}},
+		{input: " ARGS | XML:/* ", want: []Variable{{Name: "ARGS"}, {Name: "XML", Selector: "/*"}}},
+		{input: "ARGS|", wantErr: true},
+		{input: "|ARGS", wantErr: true},
+		{input: "!", wantErr: true},
+		{input: ":foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVariables(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseVariables(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseVariables(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseOperator(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Operator
+	}{
+		{"@rx ^a b$", Operator{Name: "rx", Arg: "^a b$"}},
+		{"^admin", Operator{Name: "rx", Arg: "^admin"}},
+		{"!@pm foo bar", Operator{Name: "pm", Arg: "foo bar", Negate: true}},
+		{"! ^a", Operator{Name: "rx", Arg: "^a", Negate: true}},
+		{"@detectSQLi", Operator{Name: "detectSQLi"}},
+		{"  @streq   x  ", Operator{Name: "streq", Arg: "x"}},
+	}
+	for _, tt := range tests {
+		if got := ParseOperator(tt.input); got != tt.want {
+			t.Errorf("ParseOperator(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseActions(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Action
+		wantErr bool
+	}{
+		{input: ""},
+		{input: "id:1,deny,msg:'a, b',t:lowercase", want: []Action{{"id", "1"}, {"deny", ""}, {"msg", "a, b"}, {"t", "lowercase"}}},
+		{input: `msg:'it\'s, here'`, want: []Action{{"msg", "it's, here"}}},
+		{input: " ID:5 , Phase:2 ,", want: []Action{{"id", "5"}, {"phase", "2"}}},
+		{input: "setvar:'tx.score=+%{tx.critical}',ctl:ruleRemoveById=942100", want: []Action{{"setvar", "tx.score=+%{tx.critical}"}, {"ctl", "ruleRemoveById=942100"}}},
+		{input: "msg:'abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseActions(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseActions(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseActions(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSecRule(t *testing.T) {
+	directives, errs := Parse(`SecRule REQUEST_URI|!ARGS:q "!@contains /admin" "id:1001,phase:1,deny"` + "\n" +
+		`SecAction "id:1002,pass,nolog"` + "\n" +
+		`SecRule ARGS "@rx a"` + "\n" +
+		`SecAction` + "\n" +
+		`SecMarker END`)
+	if len(errs) != 0 || len(directives) != 5 {
+		t.Fatalf("Parse() = %d directives, errors %v", len(directives), errs)
+	}
+
+	rule, err := ParseSecRule(directives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVariables := []Variable{{Name: "REQUEST_URI"}, {Name: "ARGS", Selector: "q", Exclude: true}}
+	if !reflect.DeepEqual(rule.Variables, wantVariables) || rule.Operator != (Operator{Name: "contains", Arg: "/admin", Negate: true}) || rule.ID() != 1001 {
+		t.Errorf("SecRule = %+v", rule)
+	}
+
+	action, err := ParseSecRule(directives[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Variables != nil || action.ID() != 1002 || len(action.Actions) != 3 {
+		t.Errorf("SecAction = %+v", action)
+	}
+
+	rule, err = ParseSecRule(directives[2])
+	if err != nil || rule.Actions != nil || rule.ID() != 0 {
+		t.Errorf("SecRule without actions = %+v, %v", rule, err)
+	}
+
+	for _, directive := range directives[3:] {
+		if _, err := ParseSecRule(directive); err == nil {
+			t.Errorf("ParseSecRule(%q) expected error", directive.Text)
+		}
+	}
+}
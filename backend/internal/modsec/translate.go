@@ -0,0 +1,895 @@
+package modsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+)
+
+// RulePrefix 导入规则的名称前缀，规则名称为 modsec-<id>
+const RulePrefix = "modsec-"
+
+// 报告和规则字段的长度限制
+const (
+	maxDirectiveText = 200
+	maxNameLength    = 255
+	maxCommentLength = 500
+	maxTagsLength    = 500
+)
+
+// ReportEntry 报告中的一条指令及原因
+type ReportEntry struct {
+	Line      int    `json:"line"`                // 指令起始行号
+	RuleID    int    `json:"rule_id,omitempty"`   // ModSecurity规则ID
+	Directive string `json:"directive,omitempty"` // 指令原文（截断）
+	Reason    string `json:"reason"`              // 无法转换或近似转换的原因
+}
+
+// Report 转换报告
+type Report struct {
+	Directives   int           `json:"directives"`   // 指令总数
+	Rules        int           `json:"rules"`        // 转换出的规则数
+	Exclusions   int           `json:"exclusions"`   // 转换出的规则排除数
+	Untranslated []ReportEntry `json:"untranslated"` // 无法转换的指令
+	Warnings     []ReportEntry `json:"warnings"`     // 已转换但语义有差异的指令
+}
+
+// TranslatedRule 转换出的规则
+type TranslatedRule struct {
+	ModSecID int         `json:"modsec_id"` // ModSecurity规则ID
+	Line     int         `json:"line"`      // 指令起始行号
+	Rule     models.Rule `json:"rule"`
+}
+
+// TranslatedExclusion 转换出的规则排除，由ctl:ruleRemove*、SecRuleRemove*和SecRuleUpdateTarget*生成
+type TranslatedExclusion struct {
+	ModSecRuleID int                  `json:"modsec_rule_id,omitempty"` // 跳过的ModSecurity规则ID，0表示按标签跳过
+	Line         int                  `json:"line"`                     // 指令起始行号
+	Exclusion    models.RuleExclusion `json:"exclusion"`
+}
+
+// Translation SecLang规则的转换结果
+type Translation struct {
+	Rules      []TranslatedRule      `json:"rules"`
+	Exclusions []TranslatedExclusion `json:"exclusions"`
+	Report     Report                `json:"report"`
+}
+
+// RuleName 返回ModSecurity规则导入后的规则名称
+func RuleName(id int) string {
+	return fmt.Sprintf("%s%d", RulePrefix, id)
+}
+
+// conditionTarget 变量对应的条件目标
+type conditionTarget struct {
+	target string
+	name   string
+}
+
+type translator struct {
+	result        *Translation
+	defaultAction string     // SecDefaultAction的阻断动作转换后的规则动作，未设置时为log（pass）
+	defaultPhase  int        // SecDefaultAction的阶段
+	chain         []*SecRule // 未结束的chain规则
+}
+
+// Translate 将SecLang文本转换为规则和规则排除。SecRule的变量和运算符转换为组合条件树，
+// 简单的单条件规则转换为普通规则；ctl:ruleRemove*等转换为规则排除；
+// 无法转换的指令（响应阶段、TX变量、流程控制、不支持的运算符等）记录在报告中
+func Translate(src string) *Translation {
+	t := &translator{
+		result:        &Translation{Rules: []TranslatedRule{}, Exclusions: []TranslatedExclusion{}},
+		defaultAction: "log",
+		defaultPhase:  2,
+	}
+	t.result.Report.Untranslated = []ReportEntry{}
+	t.result.Report.Warnings = []ReportEntry{}
+
+	directives, errs := Parse(src)
+	for _, err := range errs {
+		t.result.Report.Untranslated = append(t.result.Report.Untranslated, ReportEntry{
+			Line:      err.Line,
+			Directive: truncate(err.Text, maxDirectiveText),
+			Reason:    err.Err.Error(),
+		})
+	}
+	for _, directive := range directives {
+		t.directive(directive)
+	}
+	t.endChain()
+
+	report := &t.result.Report
+	report.Directives = len(directives) + len(errs)
+	report.Rules = len(t.result.Rules)
+	report.Exclusions = len(t.result.Exclusions)
+	return t.result
+}
+
+func (t *translator) directive(d Directive) {
+	name := strings.ToLower(d.Name)
+	if name != "secrule" && name != "secaction" {
+		t.endChain()
+	}
+
+	switch name {
+	case "secrule", "secaction":
+		rule, err := ParseSecRule(d)
+		if err != nil {
+			if len(t.chain) > 0 {
+				err = fmt.Errorf("chained rule at line %d: %v", d.Line, err)
+				d = t.chain[0].Directive
+			}
+			t.chain = nil
+			t.untranslated(d, 0, err.Error())
+			return
+		}
+		t.chain = append(t.chain, rule)
+		if _, ok := rule.action("chain"); ok && rule.Variables != nil {
+			return
+		}
+		chain := t.chain
+		t.chain = nil
+		t.translateChain(chain)
+	case "secdefaultaction":
+		t.secDefaultAction(d)
+	case "secruleremovebyid":
+		for _, spec := range d.Args {
+			t.removeByID(d, 0, spec, "", "", "")
+		}
+	case "secruleremovebytag":
+		if len(d.Args) != 1 {
+			t.untranslated(d, 0, "SecRuleRemoveByTag expects 1 argument")
+			return
+		}
+		t.addExclusion(d, 0, 0, d.Args[0], "", "", "")
+	case "secruleupdatetargetbyid", "secruleupdatetargetbytag":
+		t.updateTarget(d)
+	case "secmarker", "seccomponentsignature":
+		// 只用于skipAfter跳转和标识规则集，无需转换
+	default:
+		t.untranslated(d, 0, fmt.Sprintf("directive %s is not supported", d.Name))
+	}
+}
+
+// endChain 未结束的chain规则记录为无法转换
+func (t *translator) endChain() {
+	if len(t.chain) == 0 {
+		return
+	}
+	head := t.chain[0]
+	t.chain = nil
+	t.untranslated(head.Directive, head.ID(), "chain is not terminated")
+}
+
+// secDefaultAction 记录默认阻断动作和阶段，block动作和未指定阻断动作的规则使用默认阻断动作
+func (t *translator) secDefaultAction(d Directive) {
+	if len(d.Args) != 1 {
+		t.untranslated(d, 0, "SecDefaultAction expects 1 argument")
+		return
+	}
+	actions, err := ParseActions(d.Args[0])
+	if err != nil {
+		t.untranslated(d, 0, err.Error())
+		return
+	}
+	for _, action := range actions {
+		switch action.Name {
+		case "deny", "drop", "redirect", "proxy":
+			t.defaultAction = "block"
+		case "pass":
+			t.defaultAction = "log"
+		case "allow":
+			t.defaultAction = "allow"
+		case "phase":
+			if phase, ok := parsePhase(action.Value); ok {
+				t.defaultPhase = phase
+			}
+		}
+	}
+}
+
+// translateChain 转换一条规则及其chain规则，chain中的条件以AND组合
+func (t *translator) translateChain(chain []*SecRule) {
+	head := chain[0]
+	id := head.ID()
+	if id == 0 {
+		t.untranslated(head.Directive, 0, "rule has no id")
+		return
+	}
+
+	phase := t.defaultPhase
+	if action, ok := head.action("phase"); ok {
+		parsed, ok := parsePhase(action.Value)
+		if !ok {
+			t.untranslated(head.Directive, id, fmt.Sprintf("invalid phase %q", action.Value))
+			return
+		}
+		phase = parsed
+	}
+	if phase > 2 {
+		t.untranslated(head.Directive, id, fmt.Sprintf("phase %d inspects the response or logging, only request phases 1 and 2 are supported", phase))
+		return
+	}
+
+	var ctls []Action
+	for _, rule := range chain {
+		for _, name := range []string{"skip", "skipafter"} {
+			if _, ok := rule.action(name); ok {
+				t.untranslated(head.Directive, id, fmt.Sprintf("flow control action %s is not supported", name))
+				return
+			}
+		}
+		ctls = append(ctls, rule.actions("ctl")...)
+	}
+	if len(ctls) > 0 {
+		t.translateCtl(chain, ctls)
+		return
+	}
+	if head.Variables == nil {
+		t.untranslated(head.Directive, id, "SecAction without ctl only sets variables and has no condition to translate")
+		return
+	}
+
+	var warnings []string
+	conditions := make([]waf.RuleCondition, 0, len(chain))
+	for i, rule := range chain {
+		condition, warns, err := memberCondition(rule)
+		if err != nil {
+			reason := err.Error()
+			if i > 0 {
+				reason = fmt.Sprintf("chained rule at line %d: %s", rule.Line, reason)
+			}
+			t.untranslated(head.Directive, id, reason)
+			return
+		}
+		conditions = append(conditions, condition)
+		warnings = append(warnings, warns...)
+	}
+	condition := combine("and", conditions)
+	if err := waf.ValidateRuleCondition(&condition); err != nil {
+		t.untranslated(head.Directive, id, err.Error())
+		return
+	}
+
+	action, responseCode, warns := t.ruleAction(chain)
+	warnings = append(warnings, warns...)
+
+	rule := models.Rule{
+		Name:         RuleName(id),
+		Description:  fmt.Sprintf("ModSecurity rule %d", id),
+		Action:       action,
+		ResponseCode: responseCode,
+		Priority:     1,
+		Enabled:      true,
+		Tags:         ruleTags(head),
+	}
+	if msg, ok := head.action("msg"); ok && msg.Value != "" {
+		rule.Description = msg.Value
+	}
+	setRuleMatch(&rule, condition)
+
+	t.result.Rules = append(t.result.Rules, TranslatedRule{ModSecID: id, Line: head.Line, Rule: rule})
+	for _, variable := range head.Variables {
+		if !variable.Exclude {
+			continue
+		}
+		target, err := exclusionTarget(variable)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("variable exclusion !%s ignored: %v", variableText(variable), err))
+			continue
+		}
+		t.addExclusion(head.Directive, id, id, "", target, "", "")
+	}
+	for _, warning := range warnings {
+		t.warning(head.Directive, id, warning)
+	}
+}
+
+// ruleAction 转换阻断动作和响应状态码，返回无法转换的动作说明
+func (t *translator) ruleAction(chain []*SecRule) (string, int, []string) {
+	head := chain[0]
+	action, responseCode := "", 403
+	var warnings []string
+
+	for _, a := range head.Actions {
+		switch a.Name {
+		case "deny", "drop":
+			action = "block"
+		case "pass":
+			action = "log"
+		case "allow":
+			action = "allow"
+		case "block":
+			action = t.defaultAction
+			if action == "log" {
+				warnings = append(warnings, "block resolves to pass because no SecDefaultAction sets a disruptive action, translated to log")
+			}
+		case "redirect", "proxy":
+			action = "block"
+			warnings = append(warnings, fmt.Sprintf("%s is translated to block", a.Name))
+		case "status":
+			code, err := strconv.Atoi(a.Value)
+			if err != nil || code < 100 || code > 599 {
+				warnings = append(warnings, fmt.Sprintf("invalid status %q, using 403", a.Value))
+				continue
+			}
+			responseCode = code
+		}
+	}
+	if action == "" {
+		action = t.defaultAction
+	}
+
+	var ignored []string
+	seen := make(map[string]bool)
+	for _, rule := range chain {
+		for _, a := range rule.Actions {
+			if knownActions[a.Name] || seen[a.Name] {
+				continue
+			}
+			seen[a.Name] = true
+			ignored = append(ignored, a.Name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		warnings = append(warnings, "actions ignored: "+strings.Join(ignored, ", "))
+	}
+	return action, responseCode, warnings
+}
+
+// knownActions 已转换或不影响匹配结果的动作
+var knownActions = map[string]bool{
+	"id": true, "phase": true, "msg": true, "tag": true, "severity": true, "chain": true, "t": true, "ctl": true,
+	"deny": true, "drop": true, "block": true, "pass": true, "allow": true, "redirect": true, "proxy": true, "status": true,
+	"log": true, "nolog": true, "auditlog": true, "noauditlog": true, "capture": true, "logdata": true,
+	"ver": true, "rev": true, "maturity": true, "accuracy": true, "multimatch": true,
+}
+
+// ruleTags 转换tag动作，并加上modsec标签以便按标签排除导入的规则
+func ruleTags(rule *SecRule) string {
+	tags := []string{"modsec"}
+	for _, action := range rule.actions("tag") {
+		tag := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(action.Value, ",", "_")))
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	result := tags[0]
+	for _, tag := range tags[1:] {
+		if len(result)+1+len(tag) > maxTagsLength {
+			break
+		}
+		result += "," + tag
+	}
+	return result
+}
+
+// setRuleMatch 单个无名称叶子条件转换为普通规则，其他转换为组合规则
+func setRuleMatch(rule *models.Rule, condition waf.RuleCondition) {
+	if condition.Op == "" && (condition.Operator == "exact" || condition.Operator == "regex" || condition.Operator == "contains") {
+		switch {
+		case condition.Name == "" && (condition.Target == "uri" || condition.Target == "ip" || condition.Target == "body" || condition.Target == "user_agent"):
+			rule.MatchType, rule.Pattern, rule.MatchMode = condition.Target, condition.Value, condition.Operator
+			return
+		case condition.Target == "header":
+			rule.MatchType, rule.Pattern, rule.MatchMode = "header", condition.Name+":"+condition.Value, condition.Operator
+			return
+		}
+	}
+
+	data, _ := json.Marshal(condition)
+	rule.MatchType, rule.Conditions = "compound", string(data)
+}
+
+// memberCondition 将单条SecRule的变量和运算符转换为条件，多个变量任一匹配即命中
+func memberCondition(rule *SecRule) (waf.RuleCondition, []string, error) {
+	var warnings, untransformed []string
+	lowercase := false
+	for _, action := range rule.actions("t") {
+		switch name := strings.ToLower(action.Value); name {
+		case "none", "urldecode", "urldecodeuni":
+			// 查询参数和表单参数已经过URL解码
+		case "lowercase":
+			lowercase = true
+		case "length", "md5", "sha1", "hexencode", "base64encode":
+			return waf.RuleCondition{}, nil, fmt.Errorf("transformation t:%s changes the value and is not supported", action.Value)
+		default:
+			untransformed = append(untransformed, "t:"+action.Value)
+		}
+	}
+	if len(untransformed) > 0 {
+		warnings = append(warnings, "transformations not applied: "+strings.Join(untransformed, ", "))
+	}
+
+	op := rule.Operator
+	if strings.EqualFold(op.Name, "unconditionalMatch") {
+		return waf.RuleCondition{Target: "method", Operator: "exists"}, warnings, nil
+	}
+
+	var branches []waf.RuleCondition
+	var skipped []string
+	var firstErr error
+	for _, variable := range rule.Variables {
+		if variable.Exclude {
+			// 去掉的变量由translateChain转换为规则自身的排除
+			continue
+		}
+
+		var condition waf.RuleCondition
+		var err error
+		if variable.Count {
+			condition, err = countCondition(variable, op)
+		} else {
+			condition, err = variableCondition(variable, op, lowercase)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		branches = append(branches, condition)
+	}
+	if len(branches) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("rule has no variables to inspect")
+		}
+		return waf.RuleCondition{}, nil, firstErr
+	}
+	if len(skipped) > 0 {
+		warnings = append(warnings, "variables not translated: "+strings.Join(skipped, "; "))
+	}
+	return combine("or", branches), warnings, nil
+}
+
+// variableCondition 转换变量和运算符。运算符取反时，有名称的目标须存在且不匹配
+func variableCondition(variable Variable, op Operator, lowercase bool) (waf.RuleCondition, error) {
+	targets, err := variableTargets(variable)
+	if err != nil {
+		return waf.RuleCondition{}, err
+	}
+
+	branches := make([]waf.RuleCondition, 0, len(targets))
+	for _, target := range targets {
+		leaves, err := operatorLeaves(target, op, lowercase)
+		if err != nil {
+			return waf.RuleCondition{}, err
+		}
+		condition := combine("or", leaves)
+		if op.Negate {
+			condition = waf.RuleCondition{Op: "not", Conditions: []waf.RuleCondition{condition}}
+			if target.name != "" {
+				exists := waf.RuleCondition{Target: target.target, Name: target.name, Operator: "exists"}
+				condition = waf.RuleCondition{Op: "and", Conditions: []waf.RuleCondition{exists, condition}}
+			}
+		}
+		branches = append(branches, condition)
+	}
+	return combine("or", branches), nil
+}
+
+// countCondition 转换变量个数检查（&VAR），只支持判断变量是否存在
+func countCondition(variable Variable, op Operator) (waf.RuleCondition, error) {
+	targets, err := variableTargets(Variable{Name: variable.Name, Selector: variable.Selector})
+	if err != nil {
+		return waf.RuleCondition{}, err
+	}
+
+	unsupported := fmt.Errorf("count comparison &%s @%s %s is not supported, only presence checks are", variableText(variable), op.Name, op.Arg)
+	n, err := strconv.Atoi(strings.TrimSpace(op.Arg))
+	if err != nil {
+		return waf.RuleCondition{}, unsupported
+	}
+	var exists bool
+	switch opName := strings.ToLower(op.Name); {
+	case opName == "eq" && n == 0, opName == "lt" && n == 1, opName == "le" && n == 0:
+		exists = false
+	case opName == "gt" && n == 0, opName == "ge" && n == 1:
+		exists = true
+	default:
+		return waf.RuleCondition{}, unsupported
+	}
+	if op.Negate {
+		exists = !exists
+	}
+
+	leaves := make([]waf.RuleCondition, 0, len(targets))
+	for _, target := range targets {
+		leaves = append(leaves, waf.RuleCondition{Target: target.target, Name: target.name, Operator: "exists"})
+	}
+	condition := combine("or", leaves)
+	if !exists {
+		condition = waf.RuleCondition{Op: "not", Conditions: []waf.RuleCondition{condition}}
+	}
+	return condition, nil
+}
+
+// variableTargets 将ModSecurity变量映射为条件目标，ARGS同时检查查询参数和请求体参数。
+// REQUEST_URI包含查询字符串，映射为request_uri；REQUEST_FILENAME只有路径，映射为uri
+func variableTargets(variable Variable) ([]conditionTarget, error) {
+	selector := variable.Selector
+	if strings.HasPrefix(selector, "/") {
+		return nil, fmt.Errorf("regex selector %s is not supported", variableText(variable))
+	}
+
+	switch variable.Name {
+	case "REQUEST_URI", "REQUEST_URI_RAW":
+		return []conditionTarget{{target: "request_uri"}}, nil
+	case "REQUEST_FILENAME", "REQUEST_BASENAME":
+		return []conditionTarget{{target: "uri"}}, nil
+	case "QUERY_STRING":
+		return []conditionTarget{{target: "query"}}, nil
+	case "ARGS_GET":
+		return []conditionTarget{{target: "query", name: selector}}, nil
+	case "ARGS_POST":
+		return []conditionTarget{{target: "body", name: selector}}, nil
+	case "ARGS":
+		return []conditionTarget{{target: "query", name: selector}, {target: "body", name: selector}}, nil
+	case "REQUEST_BODY":
+		return []conditionTarget{{target: "body"}}, nil
+	case "REQUEST_METHOD":
+		return []conditionTarget{{target: "method"}}, nil
+	case "REMOTE_ADDR":
+		return []conditionTarget{{target: "ip"}}, nil
+	case "SERVER_NAME":
+		return []conditionTarget{{target: "host"}}, nil
+	case "REQUEST_HEADERS":
+		switch strings.ToLower(selector) {
+		case "":
+			return nil, fmt.Errorf("REQUEST_HEADERS without a header name is not supported")
+		case "user-agent":
+			return []conditionTarget{{target: "user_agent"}}, nil
+		case "content-type":
+			return []conditionTarget{{target: "content_type"}}, nil
+		case "host":
+			return []conditionTarget{{target: "host"}}, nil
+		}
+		return []conditionTarget{{target: "header", name: selector}}, nil
+	case "REQUEST_COOKIES":
+		if selector == "" {
+			return []conditionTarget{{target: "header", name: "Cookie"}}, nil
+		}
+		return []conditionTarget{{target: "cookie", name: selector}}, nil
+	}
+	return nil, fmt.Errorf("variable %s is not supported", variable.Name)
+}
+
+// operatorLeaves 将运算符转换为叶子条件，@ipMatch的多个网段转换为多个叶子条件
+func operatorLeaves(target conditionTarget, op Operator, lowercase bool) ([]waf.RuleCondition, error) {
+	if strings.Contains(op.Arg, "%{") {
+		return nil, fmt.Errorf("macro expansion in @%s argument is not supported", op.Name)
+	}
+	leaf := func(operator, value string) []waf.RuleCondition {
+		return []waf.RuleCondition{{Target: target.target, Name: target.name, Operator: operator, Value: value}}
+	}
+	caseless := func(pattern string) string {
+		if lowercase && !strings.HasPrefix(pattern, "(?i)") {
+			return "(?i)" + pattern
+		}
+		return pattern
+	}
+
+	switch strings.ToLower(op.Name) {
+	case "rx":
+		return leaf("regex", caseless(op.Arg)), nil
+	case "pm":
+		phrases := strings.Fields(op.Arg)
+		if len(phrases) == 0 {
+			return nil, fmt.Errorf("@pm requires at least one phrase")
+		}
+		return leaf("regex", "(?i)(?:"+quoteAll(phrases)+")"), nil
+	case "contains", "strmatch":
+		// WAF的contains、prefix和suffix不区分大小写，ModSecurity区分大小写，没有t:lowercase时转换为正则
+		if lowercase {
+			return leaf("contains", op.Arg), nil
+		}
+		return leaf("regex", regexp.QuoteMeta(op.Arg)), nil
+	case "containsword":
+		return leaf("regex", caseless(`\b`+regexp.QuoteMeta(op.Arg)+`\b`)), nil
+	case "streq":
+		if lowercase {
+			return leaf("regex", "(?i)^"+regexp.QuoteMeta(op.Arg)+"$"), nil
+		}
+		return leaf("exact", op.Arg), nil
+	case "beginswith":
+		if lowercase {
+			return leaf("prefix", op.Arg), nil
+		}
+		return leaf("regex", "^"+regexp.QuoteMeta(op.Arg)), nil
+	case "endswith":
+		if lowercase {
+			return leaf("suffix", op.Arg), nil
+		}
+		return leaf("regex", regexp.QuoteMeta(op.Arg)+"$"), nil
+	case "within":
+		values := strings.FieldsFunc(op.Arg, func(r rune) bool { return r == ' ' || r == ',' || r == '|' })
+		if len(values) == 0 {
+			return nil, fmt.Errorf("@within requires at least one value")
+		}
+		return leaf("regex", caseless("^(?:"+quoteAll(values)+")$")), nil
+	case "ipmatch":
+		if target.target != "ip" {
+			return nil, fmt.Errorf("@ipMatch is only supported on REMOTE_ADDR")
+		}
+		var leaves []waf.RuleCondition
+		for _, network := range strings.Split(op.Arg, ",") {
+			if network = strings.TrimSpace(network); network != "" {
+				leaves = append(leaves, leaf("cidr", network)...)
+			}
+		}
+		if len(leaves) == 0 {
+			return nil, fmt.Errorf("@ipMatch requires at least one address")
+		}
+		return leaves, nil
+	case "eq", "ge", "gt", "le", "lt":
+		return nil, fmt.Errorf("numeric operator @%s is only supported with variable counts (&VAR)", op.Name)
+	}
+	return nil, fmt.Errorf("operator @%s is not supported", op.Name)
+}
+
+// translateCtl 将带ctl:ruleRemove*的规则转换为规则排除，条件只能是对REQUEST_URI/REQUEST_FILENAME的单个检查
+func (t *translator) translateCtl(chain []*SecRule, ctls []Action) {
+	head := chain[0]
+	id := head.ID()
+	pathMatch, path, err := exclusionPath(chain)
+	if err != nil {
+		t.untranslated(head.Directive, id, err.Error())
+		return
+	}
+
+	for _, ctl := range ctls {
+		name, value, _ := strings.Cut(ctl.Value, "=")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ruleremovebyid":
+			t.removeByID(head.Directive, id, value, "", pathMatch, path)
+		case "ruleremovebytag":
+			t.addExclusion(head.Directive, id, 0, value, "", pathMatch, path)
+		case "ruleremovetargetbyid", "ruleremovetargetbytag":
+			ref, spec, ok := strings.Cut(value, ";")
+			if !ok {
+				t.untranslated(head.Directive, id, fmt.Sprintf("ctl:%s requires a target", name))
+				continue
+			}
+			variables, err := ParseVariables(spec)
+			if err != nil {
+				t.untranslated(head.Directive, id, err.Error())
+				continue
+			}
+			for _, variable := range variables {
+				target, err := exclusionTarget(variable)
+				if err != nil {
+					t.untranslated(head.Directive, id, err.Error())
+					continue
+				}
+				if strings.EqualFold(name, "ruleRemoveTargetById") {
+					t.removeByID(head.Directive, id, ref, target, pathMatch, path)
+				} else {
+					t.addExclusion(head.Directive, id, 0, ref, target, pathMatch, path)
+				}
+			}
+		default:
+			t.untranslated(head.Directive, id, fmt.Sprintf("ctl:%s is not supported", name))
+		}
+	}
+}
+
+// exclusionPath 获取ctl规则的路径条件，SecAction表示所有路径
+func exclusionPath(chain []*SecRule) (string, string, error) {
+	head := chain[0]
+	if head.Variables == nil && len(chain) == 1 {
+		return "", "", nil
+	}
+
+	unsupported := fmt.Errorf("ctl is only translated for a single condition on REQUEST_URI or REQUEST_FILENAME")
+	if len(chain) != 1 || len(head.Variables) != 1 || head.Operator.Negate {
+		return "", "", unsupported
+	}
+	variable := head.Variables[0]
+	if variable.Exclude || variable.Count ||
+		(variable.Name != "REQUEST_URI" && variable.Name != "REQUEST_FILENAME" && variable.Name != "REQUEST_BASENAME") {
+		return "", "", unsupported
+	}
+	if strings.Contains(head.Operator.Arg, "%{") {
+		return "", "", fmt.Errorf("macro expansion in @%s argument is not supported", head.Operator.Name)
+	}
+
+	switch strings.ToLower(head.Operator.Name) {
+	case "beginswith":
+		return "prefix", head.Operator.Arg, nil
+	case "streq":
+		return "exact", head.Operator.Arg, nil
+	case "rx":
+		return "regex", head.Operator.Arg, nil
+	}
+	return "", "", unsupported
+}
+
+// exclusionTarget 将要去掉的变量转换为排除目标
+func exclusionTarget(variable Variable) (string, error) {
+	if strings.HasPrefix(variable.Selector, "/") {
+		return "", fmt.Errorf("regex selector %s is not supported", variableText(variable))
+	}
+
+	switch variable.Name {
+	case "ARGS", "ARGS_POST":
+		if variable.Selector == "" {
+			return "body", nil
+		}
+		return "body:" + variable.Selector, nil
+	case "REQUEST_BODY":
+		return "body", nil
+	case "REQUEST_HEADERS":
+		if variable.Selector == "" {
+			return "header", nil
+		}
+		if strings.EqualFold(variable.Selector, "User-Agent") {
+			return "user_agent", nil
+		}
+		return "header:" + variable.Selector, nil
+	case "REQUEST_URI", "REQUEST_FILENAME":
+		return "uri", nil
+	case "REMOTE_ADDR":
+		return "ip", nil
+	}
+	return "", fmt.Errorf("target %s cannot be excluded, only ARGS/ARGS_POST, REQUEST_HEADERS, REQUEST_BODY, REQUEST_URI and REMOTE_ADDR are supported", variableText(variable))
+}
+
+// updateTarget 转换SecRuleUpdateTargetById/SecRuleUpdateTargetByTag，只支持去掉变量（!VAR）
+func (t *translator) updateTarget(d Directive) {
+	if len(d.Args) != 2 {
+		t.untranslated(d, 0, fmt.Sprintf("%s expects 2 arguments, replacing targets is not supported", d.Name))
+		return
+	}
+	variables, err := ParseVariables(d.Args[1])
+	if err != nil {
+		t.untranslated(d, 0, err.Error())
+		return
+	}
+
+	for _, variable := range variables {
+		if !variable.Exclude {
+			t.untranslated(d, 0, fmt.Sprintf("adding target %s is not supported", variableText(variable)))
+			continue
+		}
+		target, err := exclusionTarget(variable)
+		if err != nil {
+			t.untranslated(d, 0, err.Error())
+			continue
+		}
+		if strings.EqualFold(d.Name, "SecRuleUpdateTargetById") {
+			t.removeByID(d, 0, d.Args[0], target, "", "")
+		} else {
+			t.addExclusion(d, 0, 0, d.Args[0], target, "", "")
+		}
+	}
+}
+
+// removeByID 按规则ID生成规则排除，不支持ID范围
+func (t *translator) removeByID(d Directive, sourceID int, spec, target, pathMatch, path string) {
+	ruleID, err := strconv.Atoi(strings.TrimSpace(spec))
+	if err != nil || ruleID <= 0 {
+		if strings.Contains(spec, "-") {
+			t.untranslated(d, sourceID, fmt.Sprintf("rule ID range %s is not supported", spec))
+		} else {
+			t.untranslated(d, sourceID, fmt.Sprintf("invalid rule ID %q", spec))
+		}
+		return
+	}
+	t.addExclusion(d, sourceID, ruleID, "", target, pathMatch, path)
+}
+
+// addExclusion 生成跳过ModSecurity规则ID或标签的规则排除
+func (t *translator) addExclusion(d Directive, sourceID, ruleID int, tag, target, pathMatch, path string) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if ruleID == 0 && tag == "" {
+		t.untranslated(d, sourceID, "rule ID or tag is required")
+		return
+	}
+	if !waf.ValidExclusionTarget(target) {
+		t.untranslated(d, sourceID, fmt.Sprintf("invalid exclusion target %s", target))
+		return
+	}
+	if pathMatch == "" {
+		pathMatch = "prefix"
+	}
+	if pathMatch == "regex" {
+		if _, err := regexp.Compile(path); err != nil {
+			t.untranslated(d, sourceID, fmt.Sprintf("path regex is not supported: %v", err))
+			return
+		}
+	}
+
+	name := fmt.Sprintf("%s (line %d)", d.Name, d.Line)
+	if sourceID != 0 {
+		name = RuleName(sourceID)
+	}
+	t.result.Exclusions = append(t.result.Exclusions, TranslatedExclusion{
+		ModSecRuleID: ruleID,
+		Line:         d.Line,
+		Exclusion: models.RuleExclusion{
+			Name:      truncate(name, maxNameLength),
+			RuleTag:   tag,
+			Target:    target,
+			PathMatch: pathMatch,
+			Path:      path,
+			Source:    "modsec",
+			Comment:   truncate(d.Text, maxCommentLength),
+			Enabled:   true,
+		},
+	})
+}
+
+func (t *translator) untranslated(d Directive, ruleID int, reason string) {
+	t.result.Report.Untranslated = append(t.result.Report.Untranslated, reportEntry(d, ruleID, reason))
+}
+
+func (t *translator) warning(d Directive, ruleID int, reason string) {
+	t.result.Report.Warnings = append(t.result.Report.Warnings, reportEntry(d, ruleID, reason))
+}
+
+func reportEntry(d Directive, ruleID int, reason string) ReportEntry {
+	return ReportEntry{Line: d.Line, RuleID: ruleID, Directive: truncate(d.Text, maxDirectiveText), Reason: reason}
+}
+
+// parsePhase 解析阶段，支持数字和request/response/logging
+func parsePhase(value string) (int, bool) {
+	switch strings.ToLower(value) {
+	case "request":
+		return 2, true
+	case "response":
+		return 4, true
+	case "logging":
+		return 5, true
+	}
+	phase, err := strconv.Atoi(value)
+	if err != nil || phase < 1 || phase > 5 {
+		return 0, false
+	}
+	return phase, true
+}
+
+// combine 用and/or组合条件，只有一个条件时直接返回
+func combine(op string, conditions []waf.RuleCondition) waf.RuleCondition {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return waf.RuleCondition{Op: op, Conditions: conditions}
+}
+
+// quoteAll 转义并用|连接字符串
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = regexp.QuoteMeta(value)
+	}
+	return strings.Join(quoted, "|")
+}
+
+func variableText(variable Variable) string {
+	text := variable.Name
+	if variable.Count {
+		text = "&" + text
+	}
+	if variable.Selector != "" {
+		text += ":" + variable.Selector
+	}
+	return text
+}
+
+// truncate 按字符截断字符串
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"waf-go/internal/config"
+	"waf-go/internal/models"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// ResponseHeaderPolicy 域名的响应头策略
+type ResponseHeaderPolicy struct {
+	HSTS  string            // Strict-Transport-Security值，为空时不添加
+	Set   map[string]string // 注入或覆盖的响应头，值为空表示删除
+	Strip []string          // 移除的后端响应头
+}
+
+// BuildResponseHeaderPolicy 根据域名配置构建响应头策略
+func BuildResponseHeaderPolicy(domain *models.Domain) (*ResponseHeaderPolicy, error) {
+	policy := &ResponseHeaderPolicy{}
+
+	if domain.HSTSEnabled {
+		if domain.HSTSMaxAge < 0 {
+			return nil, errors.New("HSTS max-age must not be negative")
+		}
+		if domain.HSTSPreload && (domain.HSTSMaxAge < 31536000 || !domain.HSTSIncludeSubdomains) {
+			return nil, errors.New("HSTS preload requires max-age >= 31536000 and includeSubDomains")
+		}
+		hsts := "max-age=" + strconv.Itoa(domain.HSTSMaxAge)
+		if domain.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if domain.HSTSPreload {
+			hsts += "; preload"
+		}
+		policy.HSTS = hsts
+	}
+
+	if strings.TrimSpace(domain.SecurityHeaders) != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(domain.SecurityHeaders), &headers); err != nil {
+			return nil, fmt.Errorf("invalid security headers: %v", err)
+		}
+		policy.Set = make(map[string]string, len(headers))
+		for name, value := range headers {
+			if !httpguts.ValidHeaderFieldName(name) {
+				return nil, fmt.Errorf("invalid header name: %q", name)
+			}
+			if !httpguts.ValidHeaderFieldValue(value) {
+				return nil, fmt.Errorf("invalid value for header %s", name)
+			}
+			policy.Set[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	if strings.TrimSpace(domain.StripResponseHeaders) != "" {
+		var names []string
+		if err := json.Unmarshal([]byte(domain.StripResponseHeaders), &names); err != nil {
+			return nil, fmt.Errorf("invalid strip response headers: %v", err)
+		}
+		for _, name := range names {
+			if !httpguts.ValidHeaderFieldName(name) {
+				return nil, fmt.Errorf("invalid header name: %q", name)
+			}
+			policy.Strip = append(policy.Strip, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return policy, nil
+}
+
+// Apply 修改后端响应头，HSTS只在HTTPS响应中添加
+func (p *ResponseHeaderPolicy) Apply(header http.Header, secure bool) {
+	for _, name := range p.Strip {
+		header.Del(name)
+	}
+	for name, value := range p.Set {
+		if value == "" {
+			header.Del(name)
+			continue
+		}
+		header.Set(name, value)
+	}
+	if secure && p.HSTS != "" {
+		header.Set("Strict-Transport-Security", p.HSTS)
+	}
+}
+
+// RedirectToHTTPS 域名开启强制HTTPS时将HTTP请求重定向到HTTPS，已重定向时返回true
+func (pm *ProxyManager) RedirectToHTTPS(w http.ResponseWriter, r *http.Request) bool {
+	domain := pm.GetDomainConfig(r.Host)
+	if domain == nil || !domain.ForceHTTPS || r.TLS != nil {
+		return false
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := config.Get().Server.HTTPSPort; port != 0 && port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	code := http.StatusMovedPermanently
+	if domain.HTTPSRedirectCode == http.StatusPermanentRedirect {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	return true
+}
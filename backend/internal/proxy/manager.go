@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -8,26 +9,46 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"waf-go/internal/certs"
 	"waf-go/internal/models"
+	"waf-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
 )
 
 // ProxyManager 代理管理器
 type ProxyManager struct {
-	proxies   sync.Map
-	domains   map[string]*models.Domain
-	tlsConfig map[string]*tls.Config
-	mu        sync.RWMutex
+	proxies           sync.Map
+	domains           map[string]*models.Domain
+	rewriters         map[string]*Rewriter
+	wsInspector       WebSocketInspector
+	responseInspector ResponseInspector
+	mu                sync.RWMutex
+}
+
+// ResponseInspector 后端响应检查器，由WAF引擎实现
+type ResponseInspector interface {
+	// InspectResponse 响应转发给客户端之前调用，读取响应体后需要恢复
+	InspectResponse(resp *http.Response)
+}
+
+// SetResponseInspector 设置后端响应检查器
+func (pm *ProxyManager) SetResponseInspector(inspector ResponseInspector) {
+	pm.mu.Lock()
+	pm.responseInspector = inspector
+	pm.mu.Unlock()
 }
 
 // NewProxyManager 创建代理管理器
 func NewProxyManager() *ProxyManager {
 	return &ProxyManager{
 		domains:   make(map[string]*models.Domain),
-		tlsConfig: make(map[string]*tls.Config),
+		rewriters: make(map[string]*Rewriter),
 	}
 }
 
@@ -44,21 +65,54 @@ func (pm *ProxyManager) UpdateDomain(domain *models.Domain) error {
 		return fmt.Errorf("invalid backend URL: %v", err)
 	}
 
+	// 编译重写规则
+	rewriter, err := NewRewriter(domain.RewriteRules)
+	if err != nil {
+		return err
+	}
+
 	// 创建反向代理
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
 	// 自定义Director
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
+		// 变量在修改请求之前采集，保证插值使用的是客户端原始请求
+		vars := NewRewriteVars(req)
+		*req = *withRewriteVars(req, vars)
+
+		rewriter.RewriteURL(req, vars)
 		originalDirector(req)
-		pm.modifyRequest(req, target)
+		pm.modifyRequest(req, target, domain.PreserveHost)
+		rewriter.ApplyRequestHeaders(req, vars)
+	}
+
+	// 响应头处理（HSTS、安全头注入、移除泄露信息的响应头）
+	headerPolicy, err := BuildResponseHeaderPolicy(domain)
+	if err != nil {
+		return err
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if vars := rewriteVarsFrom(resp.Request); vars != nil {
+			rewriter.ApplyResponseHeaders(resp.Header, vars)
+		}
+		// resp.Request是从客户端请求克隆的，TLS字段反映客户端连接
+		headerPolicy.Apply(resp.Header, resp.Request != nil && resp.Request.TLS != nil)
+
+		pm.mu.RLock()
+		inspector := pm.responseInspector
+		pm.mu.RUnlock()
+		if inspector != nil {
+			inspector.InspectResponse(resp)
+		}
+		return nil
 	}
 
 	// 自定义错误处理
 	proxy.ErrorHandler = pm.errorHandler
 
 	// 配置Transport
-	proxy.Transport = &http.Transport{
+	transport := &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
 		DisableKeepAlives:   false,
 		MaxIdleConns:        100,
@@ -72,38 +126,54 @@ func (pm *ProxyManager) UpdateDomain(domain *models.Domain) error {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
-	// 如果是HTTPS，配置TLS
-	if domain.Protocol == "https" {
-		cert, err := tls.X509KeyPair([]byte(domain.SSLCertificate), []byte(domain.SSLPrivateKey))
+	// 配置后端TLS
+	if target.Scheme == "https" {
+		tlsConfig, err := BuildUpstreamTLSConfig(domain)
 		if err != nil {
-			return fmt.Errorf("invalid SSL certificate: %v", err)
+			return err
 		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	proxy.Transport = transport
 
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			MinVersion:   tls.VersionTLS12,
-		}
-		pm.mu.Lock()
-		pm.tlsConfig[domain.Domain] = tlsConfig
-		pm.mu.Unlock()
+	// 后端使用HTTP/2（gRPC），http后端使用h2c
+	if domain.UpstreamHTTP2 {
+		proxy.Transport = newHTTP2Transport(target, transport)
 	}
 
 	// 更新代理配置
 	pm.mu.Lock()
 	pm.proxies.Store(domain.Domain, proxy)
 	pm.domains[domain.Domain] = domain
+	pm.rewriters[domain.Domain] = rewriter
 	pm.mu.Unlock()
 
 	log.Printf("Domain updated: %s -> %s", domain.Domain, domain.BackendURL)
 	return nil
 }
 
+// newHTTP2Transport 创建HTTP/2后端Transport，http后端不经过TLS直接使用HTTP/2（h2c）
+func newHTTP2Transport(target *url.URL, base *http.Transport) *http2.Transport {
+	transport := &http2.Transport{
+		TLSClientConfig: base.TLSClientConfig,
+		ReadIdleTimeout: 30 * time.Second,
+		PingTimeout:     15 * time.Second,
+	}
+	if target.Scheme == "http" {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return base.DialContext(ctx, network, addr)
+		}
+	}
+	return transport
+}
+
 // RemoveDomain 移除域名配置
 func (pm *ProxyManager) RemoveDomain(domain string) {
 	pm.mu.Lock()
 	pm.proxies.Delete(domain)
 	delete(pm.domains, domain)
-	delete(pm.tlsConfig, domain)
+	delete(pm.rewriters, domain)
 	pm.mu.Unlock()
 	log.Printf("Domain removed: %s", domain)
 }
@@ -116,13 +186,6 @@ func (pm *ProxyManager) GetProxy(domain string) *httputil.ReverseProxy {
 	return nil
 }
 
-// GetTLSConfig 获取域名的TLS配置
-func (pm *ProxyManager) GetTLSConfig(domain string) *tls.Config {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-	return pm.tlsConfig[domain]
-}
-
 // GetDomainConfig 获取域名配置信息
 func (pm *ProxyManager) GetDomainConfig(domain string) *models.Domain {
 	pm.mu.RLock()
@@ -133,11 +196,14 @@ func (pm *ProxyManager) GetDomainConfig(domain string) *models.Domain {
 	return nil
 }
 
-// modifyRequest 修改请求
-func (pm *ProxyManager) modifyRequest(req *http.Request, target *url.URL) {
+// modifyRequest 修改请求，preserveHost为true时保留客户端的Host头
+func (pm *ProxyManager) modifyRequest(req *http.Request, target *url.URL, preserveHost bool) {
+	originalHost := req.Host
 	req.URL.Scheme = target.Scheme
 	req.URL.Host = target.Host
-	req.Host = target.Host
+	if !preserveHost {
+		req.Host = target.Host
+	}
 
 	// 添加代理相关的头部
 	if clientIP := req.Header.Get("X-Real-IP"); clientIP == "" {
@@ -166,13 +232,39 @@ func (pm *ProxyManager) modifyRequest(req *http.Request, target *url.URL) {
 
 	// 添加X-Forwarded-Host
 	if req.Header.Get("X-Forwarded-Host") == "" {
-		req.Header.Set("X-Forwarded-Host", req.Host)
+		req.Header.Set("X-Forwarded-Host", originalHost)
 	}
+
+	pm.setClientCertHeaders(req)
+}
+
+// setClientCertHeaders 将客户端证书信息转发给后端，并移除客户端伪造的同名请求头
+func (pm *ProxyManager) setClientCertHeaders(req *http.Request) {
+	for name := range req.Header {
+		if strings.HasPrefix(name, "X-Client-Cert-") {
+			req.Header.Del(name)
+		}
+	}
+
+	clientCert := certs.ClientCertificate(req.TLS)
+	if clientCert == nil {
+		return
+	}
+	req.Header.Set("X-Client-Cert-Subject", clientCert.Subject)
+	req.Header.Set("X-Client-Cert-Issuer", clientCert.Issuer)
+	req.Header.Set("X-Client-Cert-SAN", strings.Join(clientCert.SANs, ","))
+	req.Header.Set("X-Client-Cert-Fingerprint", clientCert.Fingerprint)
+	req.Header.Set("X-Client-Cert-Serial", clientCert.Serial)
+	req.Header.Set("X-Client-Cert-Verified", strconv.FormatBool(clientCert.Verified))
 }
 
 // errorHandler 错误处理
 func (pm *ProxyManager) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("Proxy error: %v", err)
+	if utils.IsGRPCRequest(r) {
+		utils.WriteGRPCError(w, http.StatusBadGateway, fmt.Sprintf("Proxy error: %v", err))
+		return
+	}
 	w.WriteHeader(http.StatusBadGateway)
 	w.Write([]byte(fmt.Sprintf("Proxy error: %v", err)))
 }
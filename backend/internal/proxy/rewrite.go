@@ -0,0 +1,326 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"waf-go/internal/models"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// 重写规则类型
+const (
+	RewriteRequestHeaderAdd     = "request_header_add"
+	RewriteRequestHeaderSet     = "request_header_set"
+	RewriteRequestHeaderRemove  = "request_header_remove"
+	RewriteResponseHeaderAdd    = "response_header_add"
+	RewriteResponseHeaderSet    = "response_header_set"
+	RewriteResponseHeaderRemove = "response_header_remove"
+	RewriteURL                  = "url_rewrite"
+	RewriteRedirect             = "redirect"
+)
+
+// rewriteVarPattern 匹配 ${name} 形式的变量
+var rewriteVarPattern = regexp.MustCompile(`\$\{([a-zA-Z0-9_-]+)\}`)
+
+// rewriteVarsKey 请求上下文中保存重写变量的键
+type rewriteVarsKey struct{}
+
+// rewriteRule 编译后的重写规则
+type rewriteRule struct {
+	models.RewriteRule
+	header string         // 规范化后的头部名称
+	regex  *regexp.Regexp // Pattern编译结果，为空时匹配所有请求
+}
+
+// Rewriter 域名的重写规则集合，按优先级排序
+type Rewriter struct {
+	rules []*rewriteRule
+}
+
+// RewriteVars 插值变量，在请求被修改之前从客户端原始请求中采集
+type RewriteVars struct {
+	Host     string
+	URI      string
+	Path     string
+	Query    string
+	Method   string
+	ClientIP string
+	Scheme   string
+	Header   http.Header
+}
+
+// NewRewriter 编译重写规则，校验规则类型、头部名称、正则表达式和重定向状态码
+func NewRewriter(rules []models.RewriteRule) (*Rewriter, error) {
+	rw := &Rewriter{}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		compiled, err := compileRewriteRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		rw.rules = append(rw.rules, compiled)
+	}
+	sort.SliceStable(rw.rules, func(i, j int) bool {
+		return rw.rules[i].Priority > rw.rules[j].Priority
+	})
+	return rw, nil
+}
+
+// ValidateRewriteRule 校验单条重写规则
+func ValidateRewriteRule(rule models.RewriteRule) error {
+	_, err := compileRewriteRule(rule)
+	return err
+}
+
+// compileRewriteRule 编译单条重写规则
+func compileRewriteRule(rule models.RewriteRule) (*rewriteRule, error) {
+	compiled := &rewriteRule{RewriteRule: rule}
+
+	switch rule.Type {
+	case RewriteRequestHeaderAdd, RewriteRequestHeaderSet, RewriteRequestHeaderRemove,
+		RewriteResponseHeaderAdd, RewriteResponseHeaderSet, RewriteResponseHeaderRemove:
+		if !httpguts.ValidHeaderFieldName(rule.HeaderName) {
+			return nil, fmt.Errorf("invalid header name: %q", rule.HeaderName)
+		}
+		compiled.header = http.CanonicalHeaderKey(rule.HeaderName)
+	case RewriteURL:
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("url_rewrite rule requires a pattern")
+		}
+		if !strings.HasPrefix(rule.Value, "/") {
+			return nil, fmt.Errorf("url_rewrite target must start with /")
+		}
+	case RewriteRedirect:
+		if rule.Value == "" {
+			return nil, fmt.Errorf("redirect rule requires a target")
+		}
+		switch rule.StatusCode {
+		case 0:
+			compiled.StatusCode = http.StatusFound
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("invalid redirect status code: %d", rule.StatusCode)
+		}
+	default:
+		return nil, fmt.Errorf("invalid rewrite rule type: %s", rule.Type)
+	}
+
+	if rule.Pattern != "" {
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite pattern: %v", err)
+		}
+		compiled.regex = regex
+	}
+	return compiled, nil
+}
+
+// NewRewriteVars 从客户端请求中采集插值变量
+func NewRewriteVars(r *http.Request) *RewriteVars {
+	vars := &RewriteVars{
+		Host:     r.Host,
+		URI:      r.URL.RequestURI(),
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Method:   r.Method,
+		ClientIP: r.RemoteAddr,
+		Scheme:   "http",
+		Header:   r.Header.Clone(),
+	}
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		vars.ClientIP = ip
+	}
+	if r.TLS != nil {
+		vars.Scheme = "https"
+	}
+	return vars
+}
+
+// lookup 返回变量值，http_<name> 读取客户端请求头（下划线视为连字符）
+func (v *RewriteVars) lookup(name string) string {
+	switch name {
+	case "host":
+		return v.Host
+	case "uri":
+		return v.URI
+	case "path":
+		return v.Path
+	case "query":
+		return v.Query
+	case "method":
+		return v.Method
+	case "client_ip":
+		return v.ClientIP
+	case "scheme":
+		return v.Scheme
+	}
+	if strings.HasPrefix(name, "http_") {
+		return v.Header.Get(strings.ReplaceAll(strings.TrimPrefix(name, "http_"), "_", "-"))
+	}
+	return ""
+}
+
+// Interpolate 替换值中的 ${name} 变量，未知变量替换为空
+func (v *RewriteVars) Interpolate(value string) string {
+	return rewriteVarPattern.ReplaceAllStringFunc(value, func(m string) string {
+		return v.lookup(strings.ToLower(m[2 : len(m)-1]))
+	})
+}
+
+// expand 先插值变量，再展开正则分组引用（$1、${1}），变量值中的$会被转义
+func (rule *rewriteRule) expand(vars *RewriteVars, path string, match []int) string {
+	template := rewriteVarPattern.ReplaceAllStringFunc(rule.Value, func(m string) string {
+		name := m[2 : len(m)-1]
+		if isGroupReference(name) {
+			return m
+		}
+		return strings.ReplaceAll(vars.lookup(strings.ToLower(name)), "$", "$$")
+	})
+	if rule.regex == nil || match == nil {
+		return strings.ReplaceAll(template, "$$", "$")
+	}
+	return string(rule.regex.ExpandString(nil, template, path, match))
+}
+
+// isGroupReference 判断 ${name} 是否为正则分组引用
+func isGroupReference(name string) bool {
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// applies 规则是否作用于该路径
+func (rule *rewriteRule) applies(path string) bool {
+	return rule.Location == "" || strings.HasPrefix(path, rule.Location)
+}
+
+// Redirect 返回第一条命中的重定向规则的目标地址和状态码
+func (rw *Rewriter) Redirect(vars *RewriteVars) (string, int, bool) {
+	for _, rule := range rw.rules {
+		if rule.Type != RewriteRedirect || !rule.applies(vars.Path) {
+			continue
+		}
+		var match []int
+		if rule.regex != nil {
+			if match = rule.regex.FindStringSubmatchIndex(vars.Path); match == nil {
+				continue
+			}
+		}
+		return rule.expand(vars, vars.Path, match), rule.StatusCode, true
+	}
+	return "", 0, false
+}
+
+// RewriteURL 按顺序执行URL重写，目标中包含查询串时替换原查询串
+func (rw *Rewriter) RewriteURL(req *http.Request, vars *RewriteVars) {
+	for _, rule := range rw.rules {
+		if rule.Type != RewriteURL || !rule.applies(vars.Path) {
+			continue
+		}
+		match := rule.regex.FindStringSubmatchIndex(req.URL.Path)
+		if match == nil {
+			continue
+		}
+		target := rule.expand(vars, req.URL.Path, match)
+		if path, query, ok := strings.Cut(target, "?"); ok {
+			req.URL.Path = path
+			req.URL.RawQuery = query
+		} else {
+			req.URL.Path = target
+		}
+		req.URL.RawPath = ""
+	}
+}
+
+// ApplyRequestHeaders 修改转发给后端的请求头，设置Host时同时修改req.Host
+func (rw *Rewriter) ApplyRequestHeaders(req *http.Request, vars *RewriteVars) {
+	for _, rule := range rw.rules {
+		if !rule.applies(vars.Path) {
+			continue
+		}
+		switch rule.Type {
+		case RewriteRequestHeaderAdd, RewriteRequestHeaderSet:
+			value := vars.Interpolate(rule.Value)
+			if !httpguts.ValidHeaderFieldValue(value) {
+				continue
+			}
+			if rule.header == "Host" {
+				req.Host = value
+				continue
+			}
+			if rule.Type == RewriteRequestHeaderAdd {
+				req.Header.Add(rule.header, value)
+			} else {
+				req.Header.Set(rule.header, value)
+			}
+		case RewriteRequestHeaderRemove:
+			req.Header.Del(rule.header)
+		}
+	}
+}
+
+// ApplyResponseHeaders 修改返回给客户端的响应头
+func (rw *Rewriter) ApplyResponseHeaders(header http.Header, vars *RewriteVars) {
+	for _, rule := range rw.rules {
+		if !rule.applies(vars.Path) {
+			continue
+		}
+		switch rule.Type {
+		case RewriteResponseHeaderAdd, RewriteResponseHeaderSet:
+			value := vars.Interpolate(rule.Value)
+			if !httpguts.ValidHeaderFieldValue(value) {
+				continue
+			}
+			if rule.Type == RewriteResponseHeaderAdd {
+				header.Add(rule.header, value)
+			} else {
+				header.Set(rule.header, value)
+			}
+		case RewriteResponseHeaderRemove:
+			header.Del(rule.header)
+		}
+	}
+}
+
+// withRewriteVars 将插值变量保存到请求上下文，供响应阶段使用
+func withRewriteVars(req *http.Request, vars *RewriteVars) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), rewriteVarsKey{}, vars))
+}
+
+// rewriteVarsFrom 从请求上下文中读取插值变量
+func rewriteVarsFrom(req *http.Request) *RewriteVars {
+	if req == nil {
+		return nil
+	}
+	vars, _ := req.Context().Value(rewriteVarsKey{}).(*RewriteVars)
+	return vars
+}
+
+// ApplyRedirects 执行域名的重定向规则，已重定向时返回true
+func (pm *ProxyManager) ApplyRedirects(w http.ResponseWriter, r *http.Request) bool {
+	pm.mu.RLock()
+	rw := pm.rewriters[r.Host]
+	pm.mu.RUnlock()
+	if rw == nil {
+		return false
+	}
+
+	target, code, ok := rw.Redirect(NewRewriteVars(r))
+	if !ok {
+		return false
+	}
+	http.Redirect(w, r, target, code)
+	return true
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"waf-go/internal/models"
+)
+
+// BuildUpstreamTLSConfig 根据域名配置构建连接https后端时使用的TLS配置
+func BuildUpstreamTLSConfig(domain *models.Domain) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         domain.UpstreamServerName,
+		InsecureSkipVerify: domain.UpstreamTLSInsecureSkipVerify,
+	}
+
+	if domain.UpstreamCACerts != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(domain.UpstreamCACerts)) {
+			return nil, errors.New("invalid upstream CA certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	if domain.UpstreamClientCert != "" || domain.UpstreamClientKey != "" {
+		if domain.UpstreamClientCert == "" || domain.UpstreamClientKey == "" {
+			return nil, errors.New("upstream client certificate and key must be provided together")
+		}
+		cert, err := tls.X509KeyPair([]byte(domain.UpstreamClientCert), []byte(domain.UpstreamClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,575 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+)
+
+// WebSocket消息检查结果，与规则动作一致
+const (
+	WebSocketAllow = "allow" // 转发消息
+	WebSocketLog   = "log"   // 记录并转发消息
+	WebSocketDrop  = "drop"  // 丢弃消息，保持连接
+	WebSocketBlock = "block" // 关闭连接
+)
+
+// WebSocket会话关闭原因
+const (
+	WebSocketClosedByClient  = "client_closed"
+	WebSocketClosedByBackend = "backend_closed"
+	WebSocketIdleTimeout     = "idle_timeout"
+	WebSocketMaxDuration     = "max_duration"
+	WebSocketPolicyViolation = "policy_violation"
+	WebSocketMessageTooBig   = "message_too_big"
+	WebSocketError           = "error"
+)
+
+// WebSocket帧操作码
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpClose        = 0x8
+)
+
+// WebSocket关闭状态码（RFC 6455 7.4.1）
+const (
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsClosePolicyViolation = 1008
+	wsCloseMessageTooBig   = 1009
+)
+
+// wsMaxFrameSize 未限制消息大小时单帧和客户端单条消息（含全部分片）的上限，防止异常帧或无限分片耗尽内存
+const wsMaxFrameSize = 32 << 20
+
+var errWSFrameTooBig = errors.New("websocket: frame too large")
+
+// WebSocketInspector WebSocket消息检查器，由WAF引擎实现
+type WebSocketInspector interface {
+	// StartSession 连接建立时调用，返回文本消息检查函数，返回nil表示不检查
+	StartSession(session *models.WebSocketSession) func(message []byte) string
+	// EndSession 连接关闭时调用，用于记录会话
+	EndSession(session *models.WebSocketSession)
+}
+
+// SetWebSocketInspector 设置WebSocket消息检查器
+func (pm *ProxyManager) SetWebSocketInspector(inspector WebSocketInspector) {
+	pm.mu.Lock()
+	pm.wsInspector = inspector
+	pm.mu.Unlock()
+}
+
+// IsWebSocketRequest 是否为WebSocket升级请求
+func IsWebSocketRequest(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// ServeWebSocket 代理WebSocket连接，非WebSocket请求返回false
+func (pm *ProxyManager) ServeWebSocket(c *gin.Context) bool {
+	r := c.Request
+	if !IsWebSocketRequest(r) {
+		return false
+	}
+
+	pm.mu.RLock()
+	domain := pm.domains[r.Host]
+	inspector := pm.wsInspector
+	pm.mu.RUnlock()
+	rp := pm.GetProxy(r.Host)
+	if domain == nil || rp == nil {
+		return false
+	}
+
+	if !domain.WebSocketEnabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "WebSocket is disabled",
+		})
+		return true
+	}
+
+	pm.proxyWebSocket(c, domain, rp, inspector)
+	return true
+}
+
+// proxyWebSocket 完成与后端的握手后逐帧转发，检查客户端发送的文本消息
+func (pm *ProxyManager) proxyWebSocket(c *gin.Context, domain *models.Domain, rp *httputil.ReverseProxy, inspector WebSocketInspector) {
+	r := c.Request
+	w := c.Writer
+
+	// 复用代理的Director，保证URL重写、Host和转发头与普通请求一致
+	outreq := r.Clone(r.Context())
+	rp.Director(outreq)
+	for _, h := range []string{"Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding"} {
+		outreq.Header.Del(h)
+	}
+	outreq.Header.Set("Connection", "Upgrade")
+	outreq.Header.Set("Upgrade", "websocket")
+	// 不协商压缩扩展，保证可以检查消息明文
+	outreq.Header.Del("Sec-WebSocket-Extensions")
+
+	var tlsConfig *tls.Config
+	switch transport := rp.Transport.(type) {
+	case *http.Transport:
+		tlsConfig = transport.TLSClientConfig
+	case *http2.Transport:
+		tlsConfig = transport.TLSClientConfig
+	}
+	backend, err := dialWebSocketBackend(r.Context(), outreq.URL, tlsConfig)
+	if err != nil {
+		pm.errorHandler(w, r, err)
+		return
+	}
+
+	backend.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := outreq.Write(backend); err != nil {
+		backend.Close()
+		pm.errorHandler(w, r, err)
+		return
+	}
+	backendReader := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(backendReader, outreq)
+	if err != nil {
+		backend.Close()
+		pm.errorHandler(w, r, err)
+		return
+	}
+	backend.SetDeadline(time.Time{})
+
+	// 后端拒绝升级时原样返回响应
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer backend.Close()
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		backend.Close()
+		pm.errorHandler(w, r, fmt.Errorf("backend switched to unexpected protocol %q", resp.Header.Get("Upgrade")))
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		backend.Close()
+		pm.errorHandler(w, r, errors.New("websocket: response writer does not support hijacking"))
+		return
+	}
+	client, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		backend.Close()
+		log.Printf("WebSocket hijack failed: %v", err)
+		return
+	}
+
+	resp.Header.Del("Sec-WebSocket-Extensions")
+	var handshake bytes.Buffer
+	handshake.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	resp.Header.Write(&handshake)
+	handshake.WriteString("\r\n")
+	if _, err := client.Write(handshake.Bytes()); err != nil {
+		client.Close()
+		backend.Close()
+		return
+	}
+
+	session := &models.WebSocketSession{
+		SessionID:  fmt.Sprintf("ws_%d", time.Now().UnixNano()),
+		DomainID:   domain.ID,
+		Domain:     domain.Domain,
+		ClientIP:   c.ClientIP(),
+		UserAgent:  r.UserAgent(),
+		RequestURI: r.URL.RequestURI(),
+		StartedAt:  time.Now(),
+		TenantID:   domain.TenantID,
+	}
+
+	conn := &wsConn{
+		session:       session,
+		client:        client,
+		backend:       backend,
+		clientReader:  clientBuf.Reader,
+		backendReader: backendReader,
+		maxMessage:    int64(domain.WebSocketMaxMessageSize),
+		idleTimeout:   time.Duration(domain.WebSocketIdleTimeout) * time.Second,
+		maxDuration:   time.Duration(domain.WebSocketMaxDuration) * time.Second,
+		done:          make(chan struct{}),
+	}
+	if inspector != nil {
+		conn.inspect = inspector.StartSession(session)
+	}
+	conn.run()
+
+	session.EndedAt = time.Now()
+	conn.reasonMu.Lock()
+	session.CloseReason = conn.reason
+	conn.reasonMu.Unlock()
+	log.Printf("WebSocket session %s closed: %s (%s%s, in=%d out=%d violations=%d)",
+		session.SessionID, session.CloseReason, session.Domain, session.RequestURI,
+		session.MessagesIn, session.MessagesOut, session.Violations)
+	if inspector != nil {
+		inspector.EndSession(session)
+	}
+}
+
+// dialWebSocketBackend 连接后端，https后端使用与普通请求相同的TLS配置
+func dialWebSocketBackend(ctx context.Context, target *url.URL, tlsConfig *tls.Config) (net.Conn, error) {
+	addr := target.Host
+	if target.Port() == "" {
+		if target.Scheme == "https" {
+			addr = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "https" {
+		return conn, nil
+	}
+
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = target.Hostname()
+	}
+	// WebSocket升级只能在HTTP/1.1上进行
+	cfg.NextProtos = []string{"http/1.1"}
+
+	tlsConn := tls.Client(conn, cfg)
+	handshakeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// wsConn 一个WebSocket代理连接
+type wsConn struct {
+	session       *models.WebSocketSession
+	client        net.Conn
+	backend       net.Conn
+	clientReader  *bufio.Reader
+	backendReader *bufio.Reader
+	clientMu      sync.Mutex // 客户端写锁
+	backendMu     sync.Mutex // 后端写锁
+	inspect       func(message []byte) string
+	maxMessage    int64
+	idleTimeout   time.Duration
+	maxDuration   time.Duration
+	lastActive    atomic.Int64
+	reasonMu      sync.Mutex
+	reason        string
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// run 双向转发直到任一方向结束
+func (c *wsConn) run() {
+	c.touch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.relayClient()
+	}()
+	go func() {
+		defer wg.Done()
+		c.relayBackend()
+	}()
+	go c.watch()
+	wg.Wait()
+}
+
+// relayClient 转发客户端消息，文本消息组装完整后交给WAF检查
+func (c *wsConn) relayClient() {
+	var (
+		messageType byte
+		size        int64
+		frames      [][]byte
+		payload     []byte
+	)
+	for {
+		// size为当前分片消息已接收的字节数，限制的是整条消息而不是单帧
+		limit := int64(wsMaxFrameSize) - size
+		if c.maxMessage > 0 {
+			limit = c.maxMessage - size
+		}
+		frame, err := readWSFrame(c.clientReader, limit)
+		if errors.Is(err, errWSFrameTooBig) {
+			c.closeWith(wsCloseMessageTooBig, WebSocketMessageTooBig)
+			return
+		}
+		if err != nil {
+			c.shutdown(WebSocketClosedByClient)
+			return
+		}
+		if !frame.masked {
+			c.closeWith(wsCloseProtocolError, WebSocketError)
+			return
+		}
+		c.touch()
+
+		// 控制帧可以穿插在分片消息中，直接转发
+		if frame.opcode >= wsOpClose {
+			if frame.opcode == wsOpClose {
+				c.setReason(WebSocketClosedByClient)
+			}
+			c.writeBackend(frame.raw)
+			continue
+		}
+
+		if frame.opcode != wsOpContinuation {
+			messageType, size, frames, payload = frame.opcode, 0, nil, nil
+		}
+		size += int64(len(frame.payload))
+
+		if messageType == wsOpText && c.inspect != nil {
+			frames = append(frames, frame.raw)
+			payload = append(payload, frame.payload...)
+			if !frame.fin {
+				continue
+			}
+			switch c.inspect(payload) {
+			case WebSocketBlock:
+				c.closeWith(wsClosePolicyViolation, WebSocketPolicyViolation)
+				return
+			case WebSocketDrop:
+			default:
+				for _, raw := range frames {
+					c.writeBackend(raw)
+				}
+			}
+			frames, payload = nil, nil
+		} else {
+			c.writeBackend(frame.raw)
+		}
+
+		if frame.fin {
+			c.session.MessagesIn++
+			c.session.BytesIn += size
+			size = 0
+		}
+	}
+}
+
+// relayBackend 原样转发后端消息
+func (c *wsConn) relayBackend() {
+	for {
+		frame, err := readWSFrame(c.backendReader, wsMaxFrameSize)
+		if err != nil {
+			c.shutdown(WebSocketClosedByBackend)
+			return
+		}
+		c.touch()
+
+		if frame.opcode == wsOpClose {
+			c.setReason(WebSocketClosedByBackend)
+		}
+		if frame.opcode < wsOpClose {
+			c.session.BytesOut += int64(len(frame.payload))
+			if frame.fin {
+				c.session.MessagesOut++
+			}
+		}
+		c.writeClient(frame.raw)
+	}
+}
+
+// watch 检查空闲超时和最长连接时间
+func (c *wsConn) watch() {
+	if c.idleTimeout <= 0 && c.maxDuration <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			if c.maxDuration > 0 && now.Sub(c.session.StartedAt) >= c.maxDuration {
+				c.closeWith(wsCloseGoingAway, WebSocketMaxDuration)
+				return
+			}
+			if c.idleTimeout > 0 && now.Sub(time.Unix(0, c.lastActive.Load())) >= c.idleTimeout {
+				c.closeWith(wsCloseGoingAway, WebSocketIdleTimeout)
+				return
+			}
+		}
+	}
+}
+
+// touch 记录最近活动时间
+func (c *wsConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// writeClient 向客户端写入帧
+func (c *wsConn) writeClient(frame []byte) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.client.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.client.Write(frame)
+}
+
+// writeBackend 向后端写入帧
+func (c *wsConn) writeBackend(frame []byte) {
+	c.backendMu.Lock()
+	defer c.backendMu.Unlock()
+	c.backend.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.backend.Write(frame)
+}
+
+// setReason 记录关闭原因，只保留第一次设置的原因
+func (c *wsConn) setReason(reason string) {
+	c.reasonMu.Lock()
+	if c.reason == "" {
+		c.reason = reason
+	}
+	c.reasonMu.Unlock()
+}
+
+// closeWith 向双方发送关闭帧后断开连接
+func (c *wsConn) closeWith(code int, reason string) {
+	c.setReason(reason)
+	c.writeClient(wsCloseFrame(code, false))
+	c.writeBackend(wsCloseFrame(wsCloseGoingAway, true))
+	c.shutdown(reason)
+}
+
+// shutdown 断开双方连接
+func (c *wsConn) shutdown(reason string) {
+	c.setReason(reason)
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.client.Close()
+		c.backend.Close()
+	})
+}
+
+// wsFrame WebSocket帧
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	payload []byte // 解除掩码后的负载
+	raw     []byte // 原始帧，用于原样转发
+}
+
+// readWSFrame 读取一个完整的帧，负载超过limit时返回errWSFrameTooBig
+func readWSFrame(r *bufio.Reader, limit int64) (*wsFrame, error) {
+	header := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	frame := &wsFrame{
+		fin:    header[0]&0x80 != 0,
+		opcode: header[0] & 0x0f,
+		masked: header[1]&0x80 != 0,
+	}
+	// 未协商扩展，保留位必须为0
+	if header[0]&0x70 != 0 {
+		return nil, errors.New("websocket: reserved bits set")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		header = append(header, ext...)
+		length = int64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		header = append(header, ext...)
+		if ext[0]&0x80 != 0 {
+			return nil, errors.New("websocket: invalid frame length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext))
+	}
+	if frame.opcode >= wsOpClose && (length > 125 || !frame.fin) {
+		return nil, errors.New("websocket: invalid control frame")
+	}
+	if length > limit {
+		return nil, errWSFrameTooBig
+	}
+
+	var key []byte
+	if frame.masked {
+		key = make([]byte, 4)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		header = append(header, key...)
+	}
+
+	frame.raw = make([]byte, len(header)+int(length))
+	copy(frame.raw, header)
+	if _, err := io.ReadFull(r, frame.raw[len(header):]); err != nil {
+		return nil, err
+	}
+	frame.payload = frame.raw[len(header):]
+	if frame.masked {
+		payload := make([]byte, length)
+		for i, b := range frame.payload {
+			payload[i] = b ^ key[i%4]
+		}
+		frame.payload = payload
+	}
+	return frame, nil
+}
+
+// wsCloseFrame 构造关闭帧，发往后端的帧必须加掩码
+func wsCloseFrame(code int, masked bool) []byte {
+	payload := []byte{byte(code >> 8), byte(code)}
+	if !masked {
+		return append([]byte{0x80 | wsOpClose, byte(len(payload))}, payload...)
+	}
+	key := make([]byte, 4)
+	rand.Read(key)
+	frame := append([]byte{0x80 | wsOpClose, 0x80 | byte(len(payload))}, key...)
+	for i, b := range payload {
+		frame = append(frame, b^key[i%4])
+	}
+	return frame
+}
@@ -0,0 +1,328 @@
+// Package replay 解析访问日志和HAR文件，转换为可交给WAF引擎试运行的模拟请求
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"waf-go/internal/waf"
+)
+
+// 支持的日志格式
+const (
+	FormatAuto     = "auto"     // 按内容自动识别
+	FormatCombined = "combined" // nginx/Apache combined日志
+	FormatJSON     = "json"     // 每行一个JSON对象的访问日志
+	FormatHAR      = "har"      // 浏览器导出的HAR文件
+)
+
+// Formats 支持的日志格式
+var Formats = []string{FormatAuto, FormatCombined, FormatJSON, FormatHAR}
+
+// MaxErrors 结果中保留的错误数
+const MaxErrors = 50
+
+// Entry 日志中的一个请求
+type Entry struct {
+	Line    int                   `json:"line"`             // 日志行号，HAR文件为条目序号
+	Status  int                   `json:"status,omitempty"` // 日志记录的原响应状态码
+	Request waf.EvaluationRequest `json:"request"`
+}
+
+// ParseError 无法解析的日志行
+type ParseError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Result 解析结果
+type Result struct {
+	Format  string       `json:"format"`  // 实际使用的格式
+	Entries []Entry      `json:"entries"` // 解析出的请求
+	Skipped int          `json:"skipped"` // 无法解析的行数
+	Errors  []ParseError `json:"errors"`  // 无法解析的行，最多保留MaxErrors条
+}
+
+func (r *Result) addError(line int, format string, args ...interface{}) {
+	r.Skipped++
+	if len(r.Errors) < MaxErrors {
+		r.Errors = append(r.Errors, ParseError{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Parse 按格式解析日志内容，format为空或auto时自动识别
+func Parse(content, format string) (*Result, error) {
+	if format == "" || format == FormatAuto {
+		format = DetectFormat(content)
+	}
+
+	result := &Result{Format: format, Entries: []Entry{}, Errors: []ParseError{}}
+	switch format {
+	case FormatCombined:
+		parseLines(content, result, parseCombinedLine)
+	case FormatJSON:
+		parseLines(content, result, parseJSONLine)
+	case FormatHAR:
+		if err := parseHAR(content, result); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+	return result, nil
+}
+
+// DetectFormat 识别日志格式：以{开头且包含log.entries的为HAR，其他以{开头的为JSON日志，否则为combined
+func DetectFormat(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") {
+		var har struct {
+			Log *struct {
+				Entries json.RawMessage `json:"entries"`
+			} `json:"log"`
+		}
+		if json.Unmarshal([]byte(trimmed), &har) == nil && har.Log != nil && har.Log.Entries != nil {
+			return FormatHAR
+		}
+		return FormatJSON
+	}
+	return FormatCombined
+}
+
+// parseLines 逐行解析，跳过空行
+func parseLines(content string, result *Result, parse func(line string) (*Entry, error)) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry, err := parse(line)
+		if err != nil {
+			result.addError(lineNumber, "%v", err)
+			continue
+		}
+		entry.Line = lineNumber
+		result.Entries = append(result.Entries, *entry)
+	}
+	if err := scanner.Err(); err != nil {
+		result.addError(lineNumber+1, "%v", err)
+	}
+}
+
+// combinedPattern combined日志格式：
+// 客户端IP ident 用户 [时间] "请求行" 状态码 字节数 "Referer" "User-Agent"，最后两项可省略
+var combinedPattern = regexp.MustCompile(`^(\S+) \S+ \S+ \[[^\]]*\] "((?:[^"\\]|\\.)*)" (\d{3}|-) \S+(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// parseCombinedLine 解析一行combined日志
+func parseCombinedLine(line string) (*Entry, error) {
+	match := combinedPattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("not a combined log line")
+	}
+
+	method, uri, err := parseRequestLine(unescapeLogValue(match[2]))
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{
+		Request: waf.EvaluationRequest{
+			Method:   method,
+			URL:      uri,
+			ClientIP: match[1],
+			Headers:  map[string]string{},
+		},
+	}
+	entry.Status, _ = strconv.Atoi(match[3])
+	if referer := unescapeLogValue(match[4]); referer != "" && referer != "-" {
+		entry.Request.Headers["Referer"] = referer
+	}
+	if userAgent := unescapeLogValue(match[5]); userAgent != "" && userAgent != "-" {
+		entry.Request.Headers["User-Agent"] = userAgent
+	}
+	return entry, nil
+}
+
+// parseRequestLine 解析"GET /path HTTP/1.1"格式的请求行
+func parseRequestLine(requestLine string) (string, string, error) {
+	parts := strings.Fields(requestLine)
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("invalid request line: %q", requestLine)
+	}
+	return parts[0], parts[1], nil
+}
+
+// unescapeLogValue 还原日志中转义的字符：Apache的\"和\\，nginx的\xHH
+func unescapeLogValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		next := value[i+1]
+		if next == 'x' && i+3 < len(value) {
+			if n, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		if next == '"' || next == '\\' {
+			b.WriteByte(next)
+			i++
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// JSON日志中各字段可能使用的键，按顺序取第一个非空值
+var (
+	jsonClientIPKeys  = []string{"client_ip", "remote_addr", "ip", "clientip"}
+	jsonMethodKeys    = []string{"method", "request_method"}
+	jsonURIKeys       = []string{"request_uri", "uri", "url", "path"}
+	jsonQueryKeys     = []string{"query_string", "args", "query"}
+	jsonHostKeys      = []string{"host", "http_host", "server_name"}
+	jsonUserAgentKeys = []string{"user_agent", "http_user_agent"}
+	jsonRefererKeys   = []string{"referer", "http_referer"}
+	jsonBodyKeys      = []string{"request_body", "body"}
+	jsonStatusKeys    = []string{"status", "status_code"}
+)
+
+// parseJSONLine 解析一行JSON访问日志。支持nginx log_format escape=json常用的字段名，
+// 也支持request字段中的完整请求行和headers对象
+func parseJSONLine(line string) (*Entry, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+
+	request := waf.EvaluationRequest{
+		Method:   jsonString(fields, jsonMethodKeys),
+		URL:      jsonString(fields, jsonURIKeys),
+		Host:     jsonString(fields, jsonHostKeys),
+		ClientIP: jsonString(fields, jsonClientIPKeys),
+		Body:     jsonString(fields, jsonBodyKeys),
+		Headers:  map[string]string{},
+	}
+	if requestLine := jsonString(fields, []string{"request"}); requestLine != "" && (request.Method == "" || request.URL == "") {
+		method, uri, err := parseRequestLine(requestLine)
+		if err != nil {
+			return nil, err
+		}
+		if request.Method == "" {
+			request.Method = method
+		}
+		if request.URL == "" {
+			request.URL = uri
+		}
+	}
+	if request.URL == "" {
+		return nil, fmt.Errorf("missing request uri")
+	}
+	if query := jsonString(fields, jsonQueryKeys); query != "" && !strings.Contains(request.URL, "?") {
+		request.URL += "?" + query
+	}
+	// nginx未记录请求体时为"-"
+	if request.Body == "-" {
+		request.Body = ""
+	}
+
+	if headers, ok := fields["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			if s, ok := value.(string); ok {
+				request.Headers[name] = s
+			}
+		}
+	}
+	if userAgent := jsonString(fields, jsonUserAgentKeys); userAgent != "" && userAgent != "-" {
+		request.Headers["User-Agent"] = userAgent
+	}
+	if referer := jsonString(fields, jsonRefererKeys); referer != "" && referer != "-" {
+		request.Headers["Referer"] = referer
+	}
+
+	entry := &Entry{Request: request}
+	entry.Status, _ = strconv.Atoi(jsonString(fields, jsonStatusKeys))
+	return entry, nil
+}
+
+// jsonString 按键的顺序取第一个非空值，数字转为字符串
+func jsonString(fields map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		switch value := fields[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// harFile HAR文件中回放用到的字段
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status int `json:"status"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// parseHAR 解析HAR文件，HTTP/2的伪首部（:authority等）不作为请求头
+func parseHAR(content string, result *Result) error {
+	var har harFile
+	if err := json.Unmarshal([]byte(content), &har); err != nil {
+		return fmt.Errorf("invalid har file: %v", err)
+	}
+
+	for i, item := range har.Log.Entries {
+		if item.Request.URL == "" {
+			result.addError(i+1, "missing request url")
+			continue
+		}
+		request := waf.EvaluationRequest{
+			Method:  item.Request.Method,
+			URL:     item.Request.URL,
+			Headers: map[string]string{},
+		}
+		for _, header := range item.Request.Headers {
+			if strings.HasPrefix(header.Name, ":") {
+				continue
+			}
+			request.Headers[header.Name] = header.Value
+		}
+		if item.Request.PostData != nil {
+			request.Body = item.Request.PostData.Text
+		}
+		result.Entries = append(result.Entries, Entry{Line: i + 1, Status: item.Response.Status, Request: request})
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package replay
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"waf-go/internal/waf"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"log":{"version":"1.2","entries":[]}}`, FormatHAR},
+		{"  \n" + `{"log":{"entries":[{"request":{}}]}}`, FormatHAR},
+		{`{"log":{}}`, FormatJSON},
+		{`{"uri":"/","status":200}` + "\n" + `{"uri":"/a"}`, FormatJSON},
+		{`1.2.3.4 - - [10/Oct/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 1`, FormatCombined},
+		{"", FormatCombined},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat(tt.content); got != tt.want {
+			t.Errorf("DetectFormat(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestParseCombined(t *testing.T) {
+	content := strings.Join([]string{
+		`10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /search?q=%27+or+1=1 HTTP/1.1" 200 512 "https://example.com/" "Mozilla/5.0 (X11)"`,
+		``,
+		`10.0.0.2 - alice [10/Oct/2026:13:55:37 +0000] "POST /login HTTP/1.1" 403 -`,
+		`10.0.0.3 - - [10/Oct/2026:13:55:38 +0000] "GET /a\"b\x3Cscript HTTP/1.1" 200 1 "-" "curl \"x\" \\ \x41"`,
+		`garbage`,
+		`10.0.0.4 - - [10/Oct/2026:13:55:39 +0000] "-" 400 0 "-" "-"`,
+		`10.0.0.5 - - [10/Oct/2026:13:55:40 +0000] "GET /x HTTP/1.0" - 0`,
+	}, "\n")
+
+	result, err := Parse(content, FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != FormatCombined {
+		t.Errorf("format = %q, want %q", result.Format, FormatCombined)
+	}
+
+	want := []Entry{
+		{Line: 1, Status: 200, Request: waf.EvaluationRequest{Method: "GET", URL: "/search?q=%27+or+1=1", ClientIP: "10.0.0.1",
+			Headers: map[string]string{"Referer": "https://example.com/", "User-Agent": "Mozilla/5.0 (X11)"}}},
+		{Line: 3, Status: 403, Request: waf.EvaluationRequest{Method: "POST", URL: "/login", ClientIP: "10.0.0.2", Headers: map[string]string{}}},
+		{Line: 4, Status: 200, Request: waf.EvaluationRequest{Method: "GET", URL: `/a"b<script`, ClientIP: "10.0.0.3",
+			Headers: map[string]string{"User-Agent": `curl "x" \ A`}}},
+		{Line: 7, Request: waf.EvaluationRequest{Method: "GET", URL: "/x", ClientIP: "10.0.0.5", Headers: map[string]string{}}},
+	}
+	if !reflect.DeepEqual(result.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", result.Entries, want)
+	}
+	if result.Skipped != 2 || len(result.Errors) != 2 || result.Errors[0].Line != 5 || result.Errors[1].Line != 6 {
+		t.Errorf("skipped = %d, errors = %+v, want lines 5 and 6", result.Skipped, result.Errors)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	content := strings.Join([]string{
+		`{"remote_addr":"1.2.3.4","request_method":"GET","uri":"/p","args":"a=1","http_host":"example.com","http_user_agent":"ua","http_referer":"-","request_body":"-","status":200}`,
+		`{"ip":"5.6.7.8","request":"POST /api?x=1 HTTP/1.1","query_string":"y=2","headers":{"X-Test":"v","X-Number":1},"body":"{}","status":"201"}`,
+		`{"method":"GET"}`,
+		`not json`,
+		`{"request":"bad"}`,
+	}, "\n")
+
+	result, err := Parse(content, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Entry{
+		{Line: 1, Status: 200, Request: waf.EvaluationRequest{Method: "GET", URL: "/p?a=1", Host: "example.com", ClientIP: "1.2.3.4",
+			Headers: map[string]string{"User-Agent": "ua"}}},
+		{Line: 2, Status: 201, Request: waf.EvaluationRequest{Method: "POST", URL: "/api?x=1", ClientIP: "5.6.7.8", Body: "{}",
+			Headers: map[string]string{"X-Test": "v"}}},
+	}
+	if !reflect.DeepEqual(result.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", result.Entries, want)
+	}
+	var lines []int
+	for _, e := range result.Errors {
+		lines = append(lines, e.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{3, 4, 5}) {
+		t.Errorf("error lines = %v, want [3 4 5]", lines)
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	content := `{"log":{"version":"1.2","entries":[
+		{"request":{"method":"GET","url":"https://example.com/a?b=1","headers":[
+			{"name":":authority","value":"example.com"},
+			{"name":"Host","value":"example.com"},
+			{"name":"Cookie","value":"sid=1"}]},
+		 "response":{"status":200}},
+		{"request":{"method":"POST","url":"https://example.com/login","headers":[],
+			"postData":{"mimeType":"application/json","text":"{\"user\":\"admin\"}"}},
+		 "response":{"status":0}},
+		{"request":{"method":"GET","url":""},"response":{"status":200}}
+	]}}`
+
+	result, err := Parse(content, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != FormatHAR {
+		t.Errorf("format = %q, want %q", result.Format, FormatHAR)
+	}
+
+	want := []Entry{
+		{Line: 1, Status: 200, Request: waf.EvaluationRequest{Method: "GET", URL: "https://example.com/a?b=1",
+			Headers: map[string]string{"Host": "example.com", "Cookie": "sid=1"}}},
+		{Line: 2, Request: waf.EvaluationRequest{Method: "POST", URL: "https://example.com/login", Body: `{"user":"admin"}`,
+			Headers: map[string]string{}}},
+	}
+	if !reflect.DeepEqual(result.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", result.Entries, want)
+	}
+	if result.Skipped != 1 || len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Errorf("skipped = %d, errors = %+v, want entry 3", result.Skipped, result.Errors)
+	}
+
+	if _, err := Parse(`{"log":`, FormatHAR); err == nil {
+		t.Error("expected error for truncated har file")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("GET /", "xml"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+
+	result, err := Parse(strings.Repeat("garbage\n", MaxErrors+10), FormatCombined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != MaxErrors+10 || len(result.Errors) != MaxErrors || len(result.Entries) != 0 {
+		t.Errorf("skipped = %d, errors = %d, entries = %d, want %d, %d, 0",
+			result.Skipped, len(result.Errors), len(result.Entries), MaxErrors+10, MaxErrors)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"waf-go/internal/handler"
 	"waf-go/internal/middleware"
 	"waf-go/internal/service"
+	"waf-go/internal/utils"
+	"waf-go/internal/waf"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,14 +29,30 @@ func wafMiddleware(services *service.Services) gin.HandlerFunc {
 			return
 		}
 
+		// 登录防护要求质询时返回工作量证明质询页面
+		if result.Action == waf.ActionChallenge {
+			services.GetWAFEngine().LogAttack(c, result)
+			services.GetWAFEngine().WriteLoginChallenge(c, result)
+			c.Abort()
+			return
+		}
+
 		if result.Action == "block" {
 			services.GetWAFEngine().LogAttack(c, result)
+			// gRPC客户端无法解析JSON，返回对应的gRPC状态码
+			if utils.IsGRPCRequest(c.Request) {
+				utils.WriteGRPCError(c.Writer, result.StatusCode, result.Message)
+				c.Writer.WriteHeaderNow()
+				c.Abort()
+				return
+			}
 			c.JSON(result.StatusCode, gin.H{"message": result.Message})
 			c.Abort()
 			return
 		}
 
-		if result.Action == "log" {
+		// 检测模式下本应拦截的请求记录为would_block，照常转发
+		if result.Action == "log" || result.Action == waf.ActionWouldBlock || len(result.Suppressed) > 0 {
 			services.GetWAFEngine().LogAttack(c, result)
 		}
 
@@ -74,6 +92,23 @@ func Init(services *service.Services) *gin.Engine {
 	blackListHandler := handler.NewBlackListHandler(services.GetBlackListService())
 	configHandler := handler.NewConfigHandler(services.GetConfigService())
 	domainHandler := handler.NewDomainHandler(services.GetDomainService(), services.GetTenantSecurityService())
+	acmeHandler := handler.NewACMEHandler(services.GetACMEManager())
+	certificateHandler := handler.NewCertificateHandler(services.GetCertificateService(), services.GetTenantSecurityService())
+	rewriteHandler := handler.NewRewriteHandler(services.GetRewriteService(), services.GetTenantSecurityService())
+	grpcHandler := handler.NewGRPCHandler(services.GetGRPCService(), services.GetTenantSecurityService())
+	graphqlHandler := handler.NewGraphQLHandler(services.GetGraphQLService(), services.GetTenantSecurityService())
+	uploadPolicyHandler := handler.NewUploadPolicyHandler(services.GetUploadPolicyService(), services.GetTenantSecurityService())
+	loginEndpointHandler := handler.NewLoginEndpointHandler(services.GetLoginEndpointService(), services.GetTenantSecurityService())
+	apiSpecHandler := handler.NewAPISpecHandler(services.GetAPISpecService(), services.GetTenantSecurityService())
+	learningHandler := handler.NewLearningHandler(services.GetLearningService(), services.GetTenantSecurityService())
+	ruleExclusionHandler := handler.NewRuleExclusionHandler(services.GetRuleExclusionService(), services.GetTenantSecurityService())
+	modSecHandler := handler.NewModSecHandler(services.GetModSecImportService())
+	shadowHandler := handler.NewShadowHandler(services.GetShadowService(), services.GetTenantSecurityService())
+	evaluationHandler := handler.NewEvaluationHandler(services.GetEvaluationService(), services.GetTenantSecurityService())
+	replayHandler := handler.NewReplayHandler(services.GetReplayService(), services.GetTenantSecurityService())
+
+	// ACME HTTP-01 验证（不经过WAF和代理）
+	r.GET("/.well-known/acme-challenge/:token", acmeHandler.HTTPChallenge)
 
 	// API 路由组
 	api := r.Group("/api/v1")
@@ -93,6 +128,7 @@ func Init(services *service.Services) *gin.Engine {
 			rules := protected.Group("/rules")
 			{
 				rules.GET("", ruleHandler.GetRuleList)
+				rules.GET("/evaluation-stats", ruleHandler.GetRuleEvaluationStats)
 				rules.POST("", ruleHandler.CreateRule)
 				rules.GET("/:id", ruleHandler.GetRule)
 				rules.PUT("/:id", ruleHandler.UpdateRule)
@@ -100,8 +136,14 @@ func Init(services *service.Services) *gin.Engine {
 				rules.DELETE("/batch", ruleHandler.BatchDeleteRules)
 				rules.PATCH("/:id/toggle", ruleHandler.ToggleRule)
 				rules.POST("/:id/toggle", ruleHandler.ToggleRule)
+				rules.POST("/:id/test", ruleHandler.TestRule)
+				rules.POST("/import/modsec", modSecHandler.ImportRules)
 			}
 
+			// WAF检查试运行和流量回放
+			protected.POST("/waf/evaluate", evaluationHandler.Evaluate)
+			protected.POST("/waf/replay", replayHandler.Replay)
+
 			// 策略管理
 			policies := protected.Group("/policies")
 			{
@@ -115,6 +157,10 @@ func Init(services *service.Services) *gin.Engine {
 				policies.PATCH("/:id/toggle", policyHandler.TogglePolicy)
 				policies.GET("/:id/rules", policyHandler.GetPolicyRules)
 				policies.PUT("/:id/rules", policyHandler.UpdatePolicyRules)
+				policies.GET("/:id/rule-exclusions", ruleExclusionHandler.GetPolicyRuleExclusions)
+				policies.POST("/:id/rule-exclusions", ruleExclusionHandler.CreatePolicyRuleExclusion)
+				policies.PUT("/:id/rule-exclusions/:exclusion_id", ruleExclusionHandler.UpdatePolicyRuleExclusion)
+				policies.DELETE("/:id/rule-exclusions/:exclusion_id", ruleExclusionHandler.DeletePolicyRuleExclusion)
 			}
 
 			// 日志管理
@@ -130,6 +176,9 @@ func Init(services *service.Services) *gin.Engine {
 					attacks.POST("/clean", logHandler.CleanOldLogs)
 					attacks.GET("/export", logHandler.ExportAttackLogs)
 				}
+
+				// WebSocket会话
+				logs.GET("/websocket-sessions", logHandler.GetWebSocketSessions)
 			}
 
 			// 仪表盘
@@ -188,8 +237,59 @@ func Init(services *service.Services) *gin.Engine {
 				domains.POST("/:id/toggle", domainHandler.ToggleDomain)
 				domains.GET("/:id/policies", domainHandler.GetDomainPolicies)
 				domains.PUT("/:id/policies", domainHandler.UpdateDomainPolicies)
+				domains.GET("/:id/acme", domainHandler.GetDomainACMEStatus)
+				domains.POST("/:id/acme/renew", domainHandler.RenewDomainACMECertificate)
+				domains.GET("/:id/certificate", certificateHandler.GetDomainCertificate)
+				domains.GET("/:id/certificates", certificateHandler.GetDomainCertificates)
+				domains.POST("/:id/certificates", certificateHandler.CreateDomainCertificate)
+				domains.PUT("/:id/certificates/:cert_id", certificateHandler.UpdateDomainCertificate)
+				domains.DELETE("/:id/certificates/:cert_id", certificateHandler.DeleteDomainCertificate)
+				domains.GET("/:id/rewrites", rewriteHandler.GetRewriteRules)
+				domains.POST("/:id/rewrites", rewriteHandler.CreateRewriteRule)
+				domains.PUT("/:id/rewrites/:rule_id", rewriteHandler.UpdateRewriteRule)
+				domains.DELETE("/:id/rewrites/:rule_id", rewriteHandler.DeleteRewriteRule)
+				domains.GET("/:id/grpc-descriptors", grpcHandler.GetGRPCDescriptors)
+				domains.POST("/:id/grpc-descriptors", grpcHandler.CreateGRPCDescriptor)
+				domains.DELETE("/:id/grpc-descriptors/:descriptor_id", grpcHandler.DeleteGRPCDescriptor)
+				domains.GET("/:id/graphql-endpoints", graphqlHandler.GetGraphQLEndpoints)
+				domains.POST("/:id/graphql-endpoints", graphqlHandler.CreateGraphQLEndpoint)
+				domains.PUT("/:id/graphql-endpoints/:endpoint_id", graphqlHandler.UpdateGraphQLEndpoint)
+				domains.DELETE("/:id/graphql-endpoints/:endpoint_id", graphqlHandler.DeleteGraphQLEndpoint)
+				domains.GET("/:id/upload-policies", uploadPolicyHandler.GetUploadPolicies)
+				domains.POST("/:id/upload-policies", uploadPolicyHandler.CreateUploadPolicy)
+				domains.PUT("/:id/upload-policies/:policy_id", uploadPolicyHandler.UpdateUploadPolicy)
+				domains.DELETE("/:id/upload-policies/:policy_id", uploadPolicyHandler.DeleteUploadPolicy)
+				domains.GET("/:id/login-endpoints", loginEndpointHandler.GetLoginEndpoints)
+				domains.POST("/:id/login-endpoints", loginEndpointHandler.CreateLoginEndpoint)
+				domains.PUT("/:id/login-endpoints/:endpoint_id", loginEndpointHandler.UpdateLoginEndpoint)
+				domains.DELETE("/:id/login-endpoints/:endpoint_id", loginEndpointHandler.DeleteLoginEndpoint)
+				domains.POST("/:id/login-endpoints/:endpoint_id/reset", loginEndpointHandler.ResetLoginFailures)
+				domains.GET("/:id/api-specs", apiSpecHandler.GetAPISpecs)
+				domains.POST("/:id/api-specs", apiSpecHandler.CreateAPISpec)
+				domains.PUT("/:id/api-specs/:spec_id", apiSpecHandler.UpdateAPISpec)
+				domains.DELETE("/:id/api-specs/:spec_id", apiSpecHandler.DeleteAPISpec)
+				domains.GET("/:id/api-specs/:spec_id/observations", apiSpecHandler.GetAPISpecObservations)
+				domains.GET("/:id/learning-sessions", learningHandler.GetLearningSessions)
+				domains.POST("/:id/learning-sessions", learningHandler.StartLearningSession)
+				domains.DELETE("/:id/learning-sessions/:session_id", learningHandler.DeleteLearningSession)
+				domains.POST("/:id/learning-sessions/:session_id/stop", learningHandler.StopLearningSession)
+				domains.GET("/:id/learning-sessions/:session_id/endpoints", learningHandler.GetLearningEndpoints)
+				domains.GET("/:id/learning-sessions/:session_id/rule-hits", learningHandler.GetLearningRuleHits)
+				domains.PUT("/:id/learning-sessions/:session_id/rule-hits/:hit_id", learningHandler.MarkLearningRuleHit)
+				domains.GET("/:id/learning-sessions/:session_id/proposal", learningHandler.GetLearningProposal)
+				domains.POST("/:id/learning-sessions/:session_id/apply", learningHandler.ApplyLearningProposal)
+				domains.GET("/:id/rule-exclusions", ruleExclusionHandler.GetDomainRuleExclusions)
+				domains.POST("/:id/rule-exclusions", ruleExclusionHandler.CreateDomainRuleExclusion)
+				domains.PUT("/:id/rule-exclusions/:exclusion_id", ruleExclusionHandler.UpdateDomainRuleExclusion)
+				domains.DELETE("/:id/rule-exclusions/:exclusion_id", ruleExclusionHandler.DeleteDomainRuleExclusion)
+				domains.GET("/:id/shadow-report", shadowHandler.GetShadowReport)
+				domains.DELETE("/:id/shadow-report", shadowHandler.ResetShadowReport)
+				domains.POST("/:id/shadow-policies/:policy_id/promote", shadowHandler.PromoteShadowPolicy)
 				domains.DELETE("/batch", domainHandler.BatchDeleteDomains)
 			}
+
+			// 证书管理
+			protected.GET("/certificates", certificateHandler.GetCertificates)
 		}
 	}
 
@@ -229,16 +329,41 @@ func Init(services *service.Services) *gin.Engine {
 			return
 		}
 
-		// 检查域名是否关联了策略（即是否接入WAF）
-		hasPolicies := services.GetDomainService().HasDomainPolicies(c.Request.Host)
-		if hasPolicies {
-			// 域名关联了策略，需要经过WAF检查
+		// 强制HTTPS重定向
+		if services.GetDomainService().GetProxyManager().RedirectToHTTPS(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+
+		// 校验客户端证书（mTLS）
+		if err := services.GetCertificateStore().VerifyClientAuth(c.Request.Host, c.Request.TLS); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("Client certificate rejected: %v", err),
+			})
+			return
+		}
+
+		// 检查域名是否接入WAF：关联了策略，或开启了协议校验、配置了登录接口、文件上传策略、GraphQL端点、OpenAPI规范、学习会话等按域名生效的防护
+		if services.GetDomainService().HasWAFProtection(c.Request.Host) {
+			// 需要经过WAF检查
 			wafMiddleware(services)(c)
 			if c.IsAborted() {
 				return // WAF拦截了请求
 			}
 		}
 
+		// 执行重定向规则
+		if services.GetDomainService().GetProxyManager().ApplyRedirects(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+
+		// WebSocket连接逐帧转发并检查消息
+		if services.GetDomainService().GetProxyManager().ServeWebSocket(c) {
+			c.Abort()
+			return
+		}
+
 		// 转发到后端服务
 		proxy.ServeHTTP(c.Writer, c.Request)
 	})
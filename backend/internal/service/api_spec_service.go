@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// APISpecService OpenAPI规范服务，管理域名上传的规范，WAF按规范校验请求（正向安全模型）
+type APISpecService struct {
+	db            *gorm.DB
+	domainService *DomainService
+	wafEngine     *waf.WAFEngine
+}
+
+func NewAPISpecService(db *gorm.DB, domainService *DomainService, wafEngine *waf.WAFEngine) *APISpecService {
+	return &APISpecService{
+		db:            db,
+		domainService: domainService,
+		wafEngine:     wafEngine,
+	}
+}
+
+// CreateAPISpecRequest 上传OpenAPI规范请求
+type CreateAPISpecRequest struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Mode     string `json:"mode" binding:"omitempty,oneof=enforce log_only learn"`
+	Content  string `json:"content" binding:"required"` // OpenAPI 3规范，JSON或YAML
+	Enabled  *bool  `json:"enabled"`
+}
+
+// UpdateAPISpecRequest 更新OpenAPI规范请求
+type UpdateAPISpecRequest struct {
+	Name     *string `json:"name"`
+	Location *string `json:"location"`
+	Mode     string  `json:"mode" binding:"omitempty,oneof=enforce log_only learn"`
+	Content  *string `json:"content"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+// APISpecObservationListRequest OpenAPI学习记录查询请求
+type APISpecObservationListRequest struct {
+	Page     int `form:"page,default=1" binding:"min=1"`
+	PageSize int `form:"page_size,default=20" binding:"min=1,max=100"`
+}
+
+// GetAPISpecs 获取域名的OpenAPI规范
+func (s *APISpecService) GetAPISpecs(domainID uint) ([]models.APISpec, error) {
+	var specs []models.APISpec
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&specs).Error; err != nil {
+		return nil, fmt.Errorf("获取OpenAPI规范失败: %v", err)
+	}
+	return specs, nil
+}
+
+// CreateAPISpec 上传OpenAPI规范并立即生效
+func (s *APISpecService) CreateAPISpec(domainID uint, req *CreateAPISpecRequest) (*models.APISpec, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &models.APISpec{
+		DomainID: domain.ID,
+		Name:     req.Name,
+		Location: req.Location,
+		Mode:     req.Mode,
+		Content:  req.Content,
+		Enabled:  true,
+		TenantID: domain.TenantID,
+	}
+	if spec.Mode == "" {
+		spec.Mode = waf.APISpecLogOnly
+	}
+	if req.Enabled != nil {
+		spec.Enabled = *req.Enabled
+	}
+	if err := s.prepareSpec(spec); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(spec).Error; err != nil {
+		return nil, fmt.Errorf("保存OpenAPI规范失败: %v", err)
+	}
+	// enabled字段有默认值，显式设置false时需要单独更新
+	if !spec.Enabled {
+		if err := s.db.Model(spec).Update("enabled", false).Error; err != nil {
+			return nil, fmt.Errorf("保存OpenAPI规范失败: %v", err)
+		}
+	}
+
+	s.wafEngine.ResetAPISpecs(domain.ID)
+	s.domainService.ResetWAFProtection(domain.ID)
+	return spec, nil
+}
+
+// UpdateAPISpec 更新OpenAPI规范并立即生效
+func (s *APISpecService) UpdateAPISpec(domainID, specID uint, req *UpdateAPISpecRequest) (*models.APISpec, error) {
+	var spec models.APISpec
+	if err := s.db.Where("id = ? AND domain_id = ?", specID, domainID).First(&spec).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("OpenAPI规范不存在")
+		}
+		return nil, fmt.Errorf("获取OpenAPI规范失败: %v", err)
+	}
+
+	if req.Name != nil {
+		spec.Name = *req.Name
+	}
+	if req.Location != nil {
+		spec.Location = *req.Location
+	}
+	if req.Mode != "" {
+		spec.Mode = req.Mode
+	}
+	if req.Content != nil {
+		spec.Content = *req.Content
+	}
+	if req.Enabled != nil {
+		spec.Enabled = *req.Enabled
+	}
+	if err := s.prepareSpec(&spec); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&spec).Error; err != nil {
+		return nil, fmt.Errorf("更新OpenAPI规范失败: %v", err)
+	}
+
+	s.wafEngine.ResetAPISpecs(domainID)
+	s.domainService.ResetWAFProtection(domainID)
+	return &spec, nil
+}
+
+// DeleteAPISpec 删除OpenAPI规范及其学习记录
+func (s *APISpecService) DeleteAPISpec(domainID, specID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND domain_id = ?", specID, domainID).Delete(&models.APISpec{})
+		if result.Error != nil {
+			return fmt.Errorf("删除OpenAPI规范失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("OpenAPI规范不存在")
+		}
+		if err := tx.Where("spec_id = ?", specID).Delete(&models.APISpecObservation{}).Error; err != nil {
+			return fmt.Errorf("删除OpenAPI学习记录失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.wafEngine.ResetAPISpecs(domainID)
+	s.domainService.ResetWAFProtection(domainID)
+	return nil
+}
+
+// GetAPISpecObservations 获取learn模式下统计的违规记录，按出现次数排序
+func (s *APISpecService) GetAPISpecObservations(domainID, specID uint, req *APISpecObservationListRequest) ([]models.APISpecObservation, int64, error) {
+	s.wafEngine.FlushAPIObservations()
+
+	var observations []models.APISpecObservation
+	var total int64
+
+	query := s.db.Model(&models.APISpecObservation{}).Where("spec_id = ? AND domain_id = ?", specID, domainID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("获取OpenAPI学习记录失败: %v", err)
+	}
+
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Order("count DESC, id ASC").Offset(offset).Limit(req.PageSize).Find(&observations).Error; err != nil {
+		return nil, 0, fmt.Errorf("获取OpenAPI学习记录失败: %v", err)
+	}
+	return observations, total, nil
+}
+
+// prepareSpec 校验规范内容和路径前缀，并提取版本和操作数
+func (s *APISpecService) prepareSpec(spec *models.APISpec) error {
+	if spec.Location != "" && !strings.HasPrefix(spec.Location, "/") {
+		return fmt.Errorf("路径前缀必须以/开头")
+	}
+
+	doc, err := waf.ParseAPISpec([]byte(spec.Content))
+	if err != nil {
+		return fmt.Errorf("OpenAPI规范无效: %v", err)
+	}
+	if doc.Info != nil {
+		spec.Version = doc.Info.Version
+	}
+	spec.Operations = waf.CountAPIOperations(doc)
+	return nil
+}
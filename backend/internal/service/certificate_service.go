@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"waf-go/internal/certs"
+	"waf-go/internal/config"
+	"waf-go/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// CertificateService 证书服务，管理域名附加证书、提供证书到期列表并监控证书到期
+type CertificateService struct {
+	db             *gorm.DB
+	redis          *redis.Client
+	cfg            config.TLSConfig
+	certStore      *certs.Store
+	acmeManager    *certs.ACMEManager
+	domainService  *DomainService
+	webhookService *WebhookService
+}
+
+func NewCertificateService(db *gorm.DB, rdb *redis.Client, cfg config.TLSConfig, certStore *certs.Store, acmeManager *certs.ACMEManager, domainService *DomainService, webhookService *WebhookService) *CertificateService {
+	return &CertificateService{
+		db:             db,
+		redis:          rdb,
+		cfg:            cfg,
+		certStore:      certStore,
+		acmeManager:    acmeManager,
+		domainService:  domainService,
+		webhookService: webhookService,
+	}
+}
+
+// CreateDomainCertificateRequest 添加附加证书请求
+type CreateDomainCertificateRequest struct {
+	Name        string `json:"name"`
+	Certificate string `json:"certificate" binding:"required"`
+	PrivateKey  string `json:"private_key" binding:"required"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+// UpdateDomainCertificateRequest 更新附加证书请求
+type UpdateDomainCertificateRequest struct {
+	Name        string `json:"name"`
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+// CertificateListRequest 证书到期列表请求
+type CertificateListRequest struct {
+	ExpiringDays int    `form:"expiring_days"` // 只返回指定天数内过期的证书，0表示全部
+	Domain       string `form:"domain"`
+}
+
+// GetDomainCertificates 获取域名的附加证书
+func (s *CertificateService) GetDomainCertificates(domainID uint) ([]models.DomainCertificate, error) {
+	var list []models.DomainCertificate
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("获取附加证书失败: %v", err)
+	}
+	return list, nil
+}
+
+// CreateDomainCertificate 为域名添加附加证书（如同时提供RSA和ECDSA证书）
+func (s *CertificateService) CreateDomainCertificate(domainID uint, req *CreateDomainCertificateRequest) (*models.DomainCertificate, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+	if domain.Protocol != "https" {
+		return nil, fmt.Errorf("域名 %s 未使用HTTPS协议", domain.Domain)
+	}
+
+	item := &models.DomainCertificate{
+		DomainID:    domain.ID,
+		Name:        req.Name,
+		Certificate: req.Certificate,
+		PrivateKey:  req.PrivateKey,
+		Enabled:     true,
+		TenantID:    domain.TenantID,
+	}
+	if req.Enabled != nil {
+		item.Enabled = *req.Enabled
+	}
+	if err := fillCertificateInfo(domain.Domain, item); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(item).Error; err != nil {
+		return nil, fmt.Errorf("创建附加证书失败: %v", err)
+	}
+
+	if err := s.domainService.reloadCertificates(domain); err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+	return item, nil
+}
+
+// UpdateDomainCertificate 更新附加证书
+func (s *CertificateService) UpdateDomainCertificate(domainID, certID uint, req *UpdateDomainCertificateRequest) (*models.DomainCertificate, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.DomainCertificate
+	if err := s.db.Where("id = ? AND domain_id = ?", certID, domainID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("证书不存在")
+		}
+		return nil, fmt.Errorf("获取证书失败: %v", err)
+	}
+
+	if req.Name != "" {
+		item.Name = req.Name
+	}
+	if req.Certificate != "" || req.PrivateKey != "" {
+		if req.Certificate == "" || req.PrivateKey == "" {
+			return nil, fmt.Errorf("更换证书需要同时提供证书和私钥")
+		}
+		item.Certificate = req.Certificate
+		item.PrivateKey = req.PrivateKey
+		if err := fillCertificateInfo(domain.Domain, &item); err != nil {
+			return nil, err
+		}
+	}
+	if req.Enabled != nil {
+		item.Enabled = *req.Enabled
+	}
+
+	if err := s.db.Save(&item).Error; err != nil {
+		return nil, fmt.Errorf("更新附加证书失败: %v", err)
+	}
+
+	if err := s.domainService.reloadCertificates(domain); err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+	return &item, nil
+}
+
+// DeleteDomainCertificate 删除附加证书
+func (s *CertificateService) DeleteDomainCertificate(domainID, certID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", certID, domainID).Delete(&models.DomainCertificate{})
+	if result.Error != nil {
+		return fmt.Errorf("删除附加证书失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("证书不存在")
+	}
+
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return err
+	}
+	return s.domainService.reloadCertificates(domain)
+}
+
+// GetCertificates 获取当前生效证书的到期列表（带租户隔离）
+func (s *CertificateService) GetCertificates(req *CertificateListRequest, userCtx *UserContext) []certs.CertificateInfo {
+	list := []certs.CertificateInfo{}
+	for _, info := range s.certStore.List() {
+		if userCtx.Role != "admin" && info.TenantID != userCtx.TenantID {
+			continue
+		}
+		if req.ExpiringDays > 0 && info.DaysRemaining > req.ExpiringDays {
+			continue
+		}
+		if req.Domain != "" && info.Domain != req.Domain {
+			continue
+		}
+		list = append(list, info)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].NotAfter.Before(list[j].NotAfter)
+	})
+	return list
+}
+
+// GetDomainCertificateDetail 获取域名当前主证书详情（手动上传或ACME签发）
+func (s *CertificateService) GetDomainCertificateDetail(domainID uint) (*certs.CertificateDetail, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert *tls.Certificate
+	source := certs.SourceManual
+	if domain.CertSource == certs.SourceACME {
+		source = certs.SourceACME
+		if cert, err = s.acmeManager.Certificate(domain.ID); err != nil {
+			return nil, fmt.Errorf("获取ACME证书失败: %v", err)
+		}
+	} else {
+		if domain.SSLCertificate == "" {
+			return nil, fmt.Errorf("域名 %s 未配置证书", domain.Domain)
+		}
+		if cert, err = certs.ParseKeyPair(domain.SSLCertificate, domain.SSLPrivateKey); err != nil {
+			return nil, fmt.Errorf("解析证书失败: %v", err)
+		}
+	}
+
+	detail := certs.Inspect(cert)
+	detail.DomainID = domain.ID
+	detail.Domain = domain.Domain
+	detail.Source = source
+	return detail, nil
+}
+
+// StartExpiryMonitor 启动证书到期监控任务
+func (s *CertificateService) StartExpiryMonitor(ctx context.Context) {
+	if len(s.cfg.ExpiryAlertDays) == 0 {
+		return
+	}
+
+	interval := time.Duration(s.cfg.ExpiryCheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		s.CheckExpiry(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.CheckExpiry(ctx)
+			}
+		}
+	}()
+}
+
+// expiryTarget 待检查的证书
+type expiryTarget struct {
+	domain *models.Domain
+	source string
+	name   string
+	cert   *tls.Certificate
+}
+
+// CheckExpiry 检查所有HTTPS域名的证书（主证书、附加证书和ACME证书），到达告警阈值时发送Webhook通知
+func (s *CertificateService) CheckExpiry(ctx context.Context) {
+	var domains []models.Domain
+	if err := s.db.Where("protocol = ? AND enabled = ?", "https", true).Find(&domains).Error; err != nil {
+		log.Printf("获取HTTPS域名失败: %v", err)
+		return
+	}
+
+	for i := range domains {
+		for _, target := range s.collectCertificates(&domains[i]) {
+			s.checkCertificate(ctx, target)
+		}
+	}
+}
+
+// collectCertificates 收集域名的全部证书
+func (s *CertificateService) collectCertificates(domain *models.Domain) []expiryTarget {
+	var targets []expiryTarget
+
+	if domain.CertSource == certs.SourceACME {
+		if cert, err := s.acmeManager.Certificate(domain.ID); err == nil {
+			targets = append(targets, expiryTarget{domain: domain, source: certs.SourceACME, cert: cert})
+		}
+	} else if domain.SSLCertificate != "" {
+		cert, err := certs.ParseKeyPair(domain.SSLCertificate, domain.SSLPrivateKey)
+		if err != nil {
+			log.Printf("解析域名 %s 证书失败: %v", domain.Domain, err)
+		} else {
+			targets = append(targets, expiryTarget{domain: domain, source: certs.SourceManual, cert: cert})
+		}
+	}
+
+	var extra []models.DomainCertificate
+	if err := s.db.Where("domain_id = ? AND enabled = ?", domain.ID, true).Find(&extra).Error; err != nil {
+		log.Printf("获取域名 %s 附加证书失败: %v", domain.Domain, err)
+		return targets
+	}
+	for _, item := range extra {
+		cert, err := certs.ParseKeyPair(item.Certificate, item.PrivateKey)
+		if err != nil {
+			log.Printf("解析域名 %s 附加证书 #%d 失败: %v", domain.Domain, item.ID, err)
+			continue
+		}
+		targets = append(targets, expiryTarget{domain: domain, source: certs.SourceExtra, name: item.Name, cert: cert})
+	}
+
+	return targets
+}
+
+// checkCertificate 检查单张证书，同一证书的同一阈值只告警一次
+func (s *CertificateService) checkCertificate(ctx context.Context, target expiryTarget) {
+	leaf := target.cert.Leaf
+	days := certs.DaysRemaining(leaf.NotAfter)
+	threshold, ok := s.alertThreshold(days)
+	if !ok {
+		return
+	}
+
+	// 以证书序列号区分证书，续期后的新证书会重新告警
+	key := fmt.Sprintf("cert_expiry_alert:%d:%s:%d", target.domain.ID, leaf.SerialNumber.Text(16), threshold)
+	ttl := time.Until(leaf.NotAfter) + 7*24*time.Hour
+	if ttl < time.Hour {
+		ttl = time.Hour
+	}
+	first, err := s.redis.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+	if err != nil {
+		log.Printf("记录证书告警状态失败: %v", err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	detail := certs.Inspect(target.cert)
+	data := map[string]interface{}{
+		"domain_id":      target.domain.ID,
+		"domain":         target.domain.Domain,
+		"source":         target.source,
+		"name":           target.name,
+		"issuer":         detail.Issuer,
+		"dns_names":      detail.DNSNames,
+		"key_type":       detail.KeyType,
+		"serial_number":  detail.SerialNumber,
+		"not_after":      detail.NotAfter.Format(time.RFC3339),
+		"days_remaining": days,
+		"threshold":      threshold,
+		"expired":        days < 0,
+	}
+
+	sent, err := s.webhookService.Notify(target.domain.TenantID, WebhookEventCertificateExpiring, data)
+	if err != nil || sent == 0 {
+		if err != nil {
+			log.Printf("发送证书到期通知失败: %v", err)
+		} else {
+			log.Printf("证书到期通知未送达任何Webhook: %s 剩余 %d 天", target.domain.Domain, days)
+		}
+		// 没有成功送达时清除标记，下次检查重试
+		s.redis.Del(ctx, key)
+		return
+	}
+	log.Printf("证书到期告警: %s 剩余 %d 天", target.domain.Domain, days)
+}
+
+// alertThreshold 返回证书剩余天数命中的最小告警阈值，已过期返回0
+func (s *CertificateService) alertThreshold(days int) (int, bool) {
+	if days < 0 {
+		return 0, true
+	}
+	threshold, ok := 0, false
+	for _, t := range s.cfg.ExpiryAlertDays {
+		if days <= t && (!ok || t < threshold) {
+			threshold, ok = t, true
+		}
+	}
+	return threshold, ok
+}
+
+// fillCertificateInfo 校验证书与私钥并填充证书信息
+func fillCertificateInfo(domain string, item *models.DomainCertificate) error {
+	cert, err := certs.ValidateKeyPair(domain, item.Certificate, item.PrivateKey)
+	if err != nil {
+		return err
+	}
+	notAfter := cert.Leaf.NotAfter
+	item.KeyType = certs.KeyType(cert.Leaf)
+	item.Issuer = cert.Leaf.Issuer.String()
+	item.NotAfter = &notAfter
+	return nil
+}
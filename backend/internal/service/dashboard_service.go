@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"waf-go/internal/models"
+	"waf-go/internal/waf"
 
 	"gorm.io/gorm"
 )
@@ -15,6 +16,7 @@ type DashboardService struct {
 type DashboardStats struct {
 	TotalRequests       int64              `json:"total_requests"`
 	BlockedRequests     int64              `json:"blocked_requests"`
+	WouldBlockRequests  int64              `json:"would_block_requests"` // 检测模式下本应拦截的请求数
 	AllowedRequests     int64              `json:"allowed_requests"`
 	TopAttackIPs        []IPStat           `json:"top_attack_ips"`
 	TopAttackURIs       []URIStat          `json:"top_attack_uris"`
@@ -59,14 +61,15 @@ type DailyAttackStat struct {
 
 // DashboardOverview 仪表盘概览数据
 type DashboardOverview struct {
-	TotalDomains     int64 `json:"total_domains"`
-	TotalPolicies    int64 `json:"total_policies"`
-	TotalRules       int64 `json:"total_rules"`
-	TotalAttackLogs  int64 `json:"total_attack_logs"`
-	TodayAttackLogs  int64 `json:"today_attack_logs"`
-	BlockedRequests  int64 `json:"blocked_requests"`
-	PassedRequests   int64 `json:"passed_requests"`
-	TopAttackDomains []struct {
+	TotalDomains       int64 `json:"total_domains"`
+	TotalPolicies      int64 `json:"total_policies"`
+	TotalRules         int64 `json:"total_rules"`
+	TotalAttackLogs    int64 `json:"total_attack_logs"`
+	TodayAttackLogs    int64 `json:"today_attack_logs"`
+	BlockedRequests    int64 `json:"blocked_requests"`
+	WouldBlockRequests int64 `json:"would_block_requests"` // 检测模式下本应拦截的请求数
+	PassedRequests     int64 `json:"passed_requests"`
+	TopAttackDomains   []struct {
 		DomainID string `json:"domain_id"`
 		Domain   string `json:"domain"`
 		Count    int64  `json:"count"`
@@ -128,13 +131,19 @@ func (s *DashboardService) GetDashboardStats(tenantID uint, days int) (*Dashboar
 	}
 
 	// 被阻止的请求数
-	err = query.Where("action = ?", "block").Count(&stats.BlockedRequests).Error
+	err = query.Session(&gorm.Session{}).Where("action = ?", "block").Count(&stats.BlockedRequests).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 检测模式下本应阻止的请求数，与实际阻止分开统计
+	err = query.Session(&gorm.Session{}).Where("action = ?", waf.ActionWouldBlock).Count(&stats.WouldBlockRequests).Error
 	if err != nil {
 		return nil, err
 	}
 
 	// 允许的请求数（记录但未阻止）
-	stats.AllowedRequests = stats.TotalRequests - stats.BlockedRequests
+	stats.AllowedRequests = stats.TotalRequests - stats.BlockedRequests - stats.WouldBlockRequests
 
 	// 获取Top攻击IP
 	topIPs, err := s.getTopAttackIPs(tenantID, startTime, endTime, 10)
@@ -448,6 +457,13 @@ func (s *DashboardService) GetOverview(tenantID uint) (*DashboardOverview, error
 		return nil, err
 	}
 
+	if err := s.db.Model(&models.AttackLog{}).
+		Joins("JOIN domains ON attack_logs.domain_id = domains.id").
+		Where("domains.tenant_id = ? AND action = ?", tenantID, waf.ActionWouldBlock).
+		Count(&overview.WouldBlockRequests).Error; err != nil {
+		return nil, err
+	}
+
 	if err := s.db.Model(&models.AttackLog{}).
 		Joins("JOIN domains ON attack_logs.domain_id = domains.id").
 		Where("domains.tenant_id = ? AND action = 'pass'", tenantID).
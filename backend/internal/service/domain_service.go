@@ -4,8 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
+	"waf-go/internal/certs"
 	"waf-go/internal/models"
 	"waf-go/internal/proxy"
+	"waf-go/internal/waf"
 
 	"gorm.io/gorm"
 )
@@ -14,13 +18,31 @@ type DomainService struct {
 	db              *gorm.DB
 	securityService *TenantSecurityService
 	proxyManager    *proxy.ProxyManager
+	certStore       *certs.Store
+	acmeManager     *certs.ACMEManager
+
+	protectionMu sync.RWMutex
+	protection   map[uint]wafProtection // 域名ID -> 是否关联了策略或配置了按域名生效的防护
+}
+
+// wafProtectionTTL 域名防护配置检查结果的缓存时间。本服务和各防护配置服务修改配置时立即清除缓存，
+// 其他途径的变更（如在策略中关联域名、学习会话到期）最迟在该时间后生效
+const wafProtectionTTL = 30 * time.Second
+
+// wafProtection 缓存的域名防护配置检查结果
+type wafProtection struct {
+	protected bool
+	expires   time.Time
 }
 
-func NewDomainService(db *gorm.DB, proxyManager *proxy.ProxyManager) *DomainService {
+func NewDomainService(db *gorm.DB, proxyManager *proxy.ProxyManager, certStore *certs.Store, acmeManager *certs.ACMEManager) *DomainService {
 	return &DomainService{
 		db:              db,
 		securityService: NewTenantSecurityService(db),
 		proxyManager:    proxyManager,
+		certStore:       certStore,
+		acmeManager:     acmeManager,
+		protection:      make(map[uint]wafProtection),
 	}
 }
 
@@ -32,19 +54,105 @@ type CreateDomainRequest struct {
 	Port           int    `json:"port" binding:"required,min=1,max=65535"`
 	SSLCertificate string `json:"ssl_certificate"`
 	SSLPrivateKey  string `json:"ssl_private_key"`
+	CertSource     string `json:"cert_source" binding:"omitempty,oneof=manual acme"`
+	ACMEChallenge  string `json:"acme_challenge" binding:"omitempty,oneof=http-01 tls-alpn-01"`
+	ClientAuthMode string `json:"client_auth_mode" binding:"omitempty,oneof=none optional required verify_if_given"`
+	ClientCACerts  string `json:"client_ca_certs"`
 	BackendURL     string `json:"backend_url" binding:"required"`
 	Enabled        bool   `json:"enabled"`
+
+	// 后端TLS配置，仅对https后端生效
+	UpstreamTLSInsecureSkipVerify bool   `json:"upstream_tls_insecure_skip_verify"`
+	UpstreamCACerts               string `json:"upstream_ca_certs"`
+	UpstreamServerName            string `json:"upstream_server_name"`
+	UpstreamClientCert            string `json:"upstream_client_cert"`
+	UpstreamClientKey             string `json:"upstream_client_key"`
+	UpstreamHTTP2                 bool   `json:"upstream_http2"` // 使用HTTP/2连接后端，http后端为h2c
+
+	// HTTPS重定向、HSTS和响应头配置
+	ForceHTTPS            bool   `json:"force_https"`
+	HTTPSRedirectCode     int    `json:"https_redirect_code" binding:"omitempty,oneof=301 308"`
+	HSTSEnabled           bool   `json:"hsts_enabled"`
+	HSTSMaxAge            int    `json:"hsts_max_age" binding:"omitempty,min=0"`
+	HSTSIncludeSubdomains bool   `json:"hsts_include_subdomains"`
+	HSTSPreload           bool   `json:"hsts_preload"`
+	SecurityHeaders       string `json:"security_headers"`
+	StripResponseHeaders  string `json:"strip_response_headers"`
+
+	// 是否将客户端Host头转发给后端
+	PreserveHost bool `json:"preserve_host"`
+
+	// 防护模式：enforce(默认), detect_only, off
+	Mode string `json:"mode" binding:"omitempty,oneof=enforce detect_only off"`
+
+	// WebSocket配置，未设置时使用默认值（允许连接、空闲300秒、单条消息1MB）
+	WebSocketEnabled        *bool `json:"websocket_enabled"`
+	WebSocketIdleTimeout    *int  `json:"websocket_idle_timeout" binding:"omitempty,min=0"`
+	WebSocketMaxDuration    int   `json:"websocket_max_duration" binding:"omitempty,min=0"`
+	WebSocketMaxMessageSize *int  `json:"websocket_max_message_size" binding:"omitempty,min=0"`
+
+	// 协议校验配置，未设置时使用默认值（不校验、100个请求头、请求头32KB、URI 8KB、256个参数）
+	ProtocolValidation  *bool  `json:"protocol_validation"`
+	AllowedMethods      string `json:"allowed_methods"`
+	MaxHeaderCount      *int   `json:"max_header_count" binding:"omitempty,min=0"`
+	MaxHeaderSize       *int   `json:"max_header_size" binding:"omitempty,min=0"`
+	MaxURLLength        *int   `json:"max_url_length" binding:"omitempty,min=0"`
+	MaxArgCount         *int   `json:"max_arg_count" binding:"omitempty,min=0"`
+	AllowedContentTypes string `json:"allowed_content_types"`
 }
 
 // UpdateDomainRequest 更新域名配置请求
 type UpdateDomainRequest struct {
-	Domain         string `json:"domain"`
-	Protocol       string `json:"protocol" binding:"omitempty,oneof=http https"`
-	Port           int    `json:"port" binding:"omitempty,min=1,max=65535"`
-	SSLCertificate string `json:"ssl_certificate"`
-	SSLPrivateKey  string `json:"ssl_private_key"`
-	BackendURL     string `json:"backend_url"`
-	Enabled        *bool  `json:"enabled"`
+	Domain         string  `json:"domain"`
+	Protocol       string  `json:"protocol" binding:"omitempty,oneof=http https"`
+	Port           int     `json:"port" binding:"omitempty,min=1,max=65535"`
+	SSLCertificate string  `json:"ssl_certificate"`
+	SSLPrivateKey  string  `json:"ssl_private_key"`
+	CertSource     string  `json:"cert_source" binding:"omitempty,oneof=manual acme"`
+	ACMEChallenge  string  `json:"acme_challenge" binding:"omitempty,oneof=http-01 tls-alpn-01"`
+	ClientAuthMode string  `json:"client_auth_mode" binding:"omitempty,oneof=none optional required verify_if_given"`
+	ClientCACerts  *string `json:"client_ca_certs"`
+	BackendURL     string  `json:"backend_url"`
+	Enabled        *bool   `json:"enabled"`
+
+	// 后端TLS配置，为空字符串时清除
+	UpstreamTLSInsecureSkipVerify *bool   `json:"upstream_tls_insecure_skip_verify"`
+	UpstreamCACerts               *string `json:"upstream_ca_certs"`
+	UpstreamServerName            *string `json:"upstream_server_name"`
+	UpstreamClientCert            *string `json:"upstream_client_cert"`
+	UpstreamClientKey             *string `json:"upstream_client_key"`
+	UpstreamHTTP2                 *bool   `json:"upstream_http2"`
+
+	// HTTPS重定向、HSTS和响应头配置
+	ForceHTTPS            *bool   `json:"force_https"`
+	HTTPSRedirectCode     int     `json:"https_redirect_code" binding:"omitempty,oneof=301 308"`
+	HSTSEnabled           *bool   `json:"hsts_enabled"`
+	HSTSMaxAge            *int    `json:"hsts_max_age" binding:"omitempty,min=0"`
+	HSTSIncludeSubdomains *bool   `json:"hsts_include_subdomains"`
+	HSTSPreload           *bool   `json:"hsts_preload"`
+	SecurityHeaders       *string `json:"security_headers"`
+	StripResponseHeaders  *string `json:"strip_response_headers"`
+
+	// 是否将客户端Host头转发给后端
+	PreserveHost *bool `json:"preserve_host"`
+
+	// 防护模式
+	Mode string `json:"mode" binding:"omitempty,oneof=enforce detect_only off"`
+
+	// WebSocket配置
+	WebSocketEnabled        *bool `json:"websocket_enabled"`
+	WebSocketIdleTimeout    *int  `json:"websocket_idle_timeout" binding:"omitempty,min=0"`
+	WebSocketMaxDuration    *int  `json:"websocket_max_duration" binding:"omitempty,min=0"`
+	WebSocketMaxMessageSize *int  `json:"websocket_max_message_size" binding:"omitempty,min=0"`
+
+	// 协议校验配置，允许列表为空字符串时不限制
+	ProtocolValidation  *bool   `json:"protocol_validation"`
+	AllowedMethods      *string `json:"allowed_methods"`
+	MaxHeaderCount      *int    `json:"max_header_count" binding:"omitempty,min=0"`
+	MaxHeaderSize       *int    `json:"max_header_size" binding:"omitempty,min=0"`
+	MaxURLLength        *int    `json:"max_url_length" binding:"omitempty,min=0"`
+	MaxArgCount         *int    `json:"max_arg_count" binding:"omitempty,min=0"`
+	AllowedContentTypes *string `json:"allowed_content_types"`
 }
 
 // DomainListRequest 域名配置列表请求
@@ -64,6 +172,8 @@ type DomainPolicyResponse struct {
 	PolicyID uint           `json:"policy_id"`
 	Priority int            `json:"priority"`
 	Enabled  bool           `json:"enabled"`
+	Mode     string         `json:"mode"`
+	Shadow   bool           `json:"shadow"`
 	Policy   *models.Policy `json:"policy,omitempty"`
 }
 
@@ -74,9 +184,11 @@ type UpdateDomainPoliciesRequest struct {
 
 // DomainPolicyItem 域名策略关联项目
 type DomainPolicyItem struct {
-	PolicyID uint `json:"policy_id" binding:"required"`
-	Priority int  `json:"priority"`
-	Enabled  bool `json:"enabled"`
+	PolicyID uint   `json:"policy_id" binding:"required"`
+	Priority int    `json:"priority"`
+	Enabled  bool   `json:"enabled"`
+	Mode     string `json:"mode" binding:"omitempty,oneof=enforce detect_only off"` // 该域名下策略的防护模式，默认enforce
+	Shadow   bool   `json:"shadow"`                                                 // 是否作为影子策略，只评估不生效
 }
 
 // BatchDeleteRequest 批量删除请求
@@ -96,10 +208,29 @@ func (s *DomainService) CreateDomain(req *CreateDomainRequest) (*models.Domain,
 		return nil, fmt.Errorf("检查域名失败: %v", err)
 	}
 
+	if req.CertSource == "" {
+		req.CertSource = "manual"
+	}
+	if req.ACMEChallenge == "" {
+		req.ACMEChallenge = certs.ChallengeHTTP01
+	}
+	if req.ClientAuthMode == "" {
+		req.ClientAuthMode = certs.ClientAuthNone
+	}
+	if err := validateClientAuth(req.Protocol, req.ClientAuthMode, req.ClientCACerts); err != nil {
+		return nil, err
+	}
+
 	// HTTPS协议验证
 	if req.Protocol == "https" {
-		if req.SSLCertificate == "" || req.SSLPrivateKey == "" {
+		if req.CertSource == "acme" {
+			if !s.acmeManager.Enabled() {
+				return nil, fmt.Errorf("系统未启用ACME自动证书")
+			}
+		} else if req.SSLCertificate == "" || req.SSLPrivateKey == "" {
 			return nil, fmt.Errorf("HTTPS协议需要提供SSL证书和私钥")
+		} else if _, err := certs.ValidateKeyPair(req.Domain, req.SSLCertificate, req.SSLPrivateKey); err != nil {
+			return nil, fmt.Errorf("SSL证书校验失败: %v", err)
 		}
 	}
 
@@ -119,23 +250,127 @@ func (s *DomainService) CreateDomain(req *CreateDomainRequest) (*models.Domain,
 		Port:           req.Port,
 		SSLCertificate: req.SSLCertificate,
 		SSLPrivateKey:  req.SSLPrivateKey,
+		CertSource:     req.CertSource,
+		ACMEChallenge:  req.ACMEChallenge,
+		ClientAuthMode: req.ClientAuthMode,
+		ClientCACerts:  req.ClientCACerts,
 		BackendURL:     req.BackendURL,
 		Enabled:        req.Enabled,
+
+		UpstreamTLSInsecureSkipVerify: req.UpstreamTLSInsecureSkipVerify,
+		UpstreamCACerts:               req.UpstreamCACerts,
+		UpstreamServerName:            req.UpstreamServerName,
+		UpstreamClientCert:            req.UpstreamClientCert,
+		UpstreamClientKey:             req.UpstreamClientKey,
+		UpstreamHTTP2:                 req.UpstreamHTTP2,
+
+		ForceHTTPS:            req.ForceHTTPS,
+		HTTPSRedirectCode:     req.HTTPSRedirectCode,
+		HSTSEnabled:           req.HSTSEnabled,
+		HSTSMaxAge:            req.HSTSMaxAge,
+		HSTSIncludeSubdomains: req.HSTSIncludeSubdomains,
+		HSTSPreload:           req.HSTSPreload,
+		SecurityHeaders:       req.SecurityHeaders,
+		StripResponseHeaders:  req.StripResponseHeaders,
+
+		PreserveHost: req.PreserveHost,
+		Mode:         req.Mode,
+
+		WebSocketEnabled:        true,
+		WebSocketIdleTimeout:    300,
+		WebSocketMaxDuration:    req.WebSocketMaxDuration,
+		WebSocketMaxMessageSize: 1048576,
+
+		AllowedMethods:      req.AllowedMethods,
+		MaxHeaderCount:      100,
+		MaxHeaderSize:       32768,
+		MaxURLLength:        8192,
+		MaxArgCount:         256,
+		AllowedContentTypes: req.AllowedContentTypes,
+	}
+	if domain.HTTPSRedirectCode == 0 {
+		domain.HTTPSRedirectCode = 301
+	}
+	if domain.HSTSEnabled && domain.HSTSMaxAge == 0 {
+		domain.HSTSMaxAge = 31536000
+	}
+
+	if _, err := proxy.BuildUpstreamTLSConfig(domain); err != nil {
+		return nil, fmt.Errorf("后端TLS配置无效: %v", err)
+	}
+	if err := validateResponseHeaders(domain); err != nil {
+		return nil, err
+	}
+	if err := waf.ValidateProtocolConfig(domain); err != nil {
+		return nil, fmt.Errorf("协议校验配置无效: %v", err)
 	}
 
 	if err := s.db.Create(domain).Error; err != nil {
 		return nil, fmt.Errorf("创建域名失败: %v", err)
 	}
 
+	// 带默认值的字段为零值时GORM会写入默认值，显式设置的false和0需要单独更新
+	defaultUpdates := make(map[string]interface{})
+	if req.WebSocketEnabled != nil {
+		domain.WebSocketEnabled = *req.WebSocketEnabled
+		defaultUpdates["websocket_enabled"] = domain.WebSocketEnabled
+	}
+	if req.WebSocketIdleTimeout != nil {
+		domain.WebSocketIdleTimeout = *req.WebSocketIdleTimeout
+		defaultUpdates["websocket_idle_timeout"] = domain.WebSocketIdleTimeout
+	}
+	if req.WebSocketMaxMessageSize != nil {
+		domain.WebSocketMaxMessageSize = *req.WebSocketMaxMessageSize
+		defaultUpdates["websocket_max_message_size"] = domain.WebSocketMaxMessageSize
+	}
+	if req.ProtocolValidation != nil {
+		domain.ProtocolValidation = *req.ProtocolValidation
+		defaultUpdates["protocol_validation"] = domain.ProtocolValidation
+	}
+	if req.MaxHeaderCount != nil {
+		domain.MaxHeaderCount = *req.MaxHeaderCount
+		defaultUpdates["max_header_count"] = domain.MaxHeaderCount
+	}
+	if req.MaxHeaderSize != nil {
+		domain.MaxHeaderSize = *req.MaxHeaderSize
+		defaultUpdates["max_header_size"] = domain.MaxHeaderSize
+	}
+	if req.MaxURLLength != nil {
+		domain.MaxURLLength = *req.MaxURLLength
+		defaultUpdates["max_url_length"] = domain.MaxURLLength
+	}
+	if req.MaxArgCount != nil {
+		domain.MaxArgCount = *req.MaxArgCount
+		defaultUpdates["max_arg_count"] = domain.MaxArgCount
+	}
+	if len(defaultUpdates) > 0 {
+		if err := s.db.Model(domain).Updates(defaultUpdates).Error; err != nil {
+			s.db.Delete(domain)
+			return nil, fmt.Errorf("创建域名失败: %v", err)
+		}
+	}
+
 	// 更新代理配置
 	if domain.Enabled {
-		if err := s.proxyManager.UpdateDomain(domain); err != nil {
+		if err := s.updateProxy(domain); err != nil {
 			// 如果代理配置失败，回滚数据库
 			s.db.Delete(domain)
 			return nil, fmt.Errorf("配置代理失败: %v", err)
 		}
 	}
 
+	// 加载证书
+	if err := s.reloadCertificates(domain); err != nil {
+		s.proxyManager.RemoveDomain(domain.Domain)
+		s.db.Delete(domain)
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+
+	// ACME域名异步签发证书
+	if domain.Enabled && domain.Protocol == "https" && domain.CertSource == "acme" {
+		s.acmeManager.RequestCertificate(domain)
+	}
+
 	return domain, nil
 }
 
@@ -237,7 +472,15 @@ func (s *DomainService) UpdateDomain(id uint, req *UpdateDomainRequest) (*models
 	if protocol == "" {
 		protocol = domain.Protocol
 	}
-	if protocol == "https" {
+	certSource := req.CertSource
+	if certSource == "" {
+		certSource = domain.CertSource
+	}
+	if protocol == "https" && certSource == "acme" {
+		if !s.acmeManager.Enabled() {
+			return nil, fmt.Errorf("系统未启用ACME自动证书")
+		}
+	} else if protocol == "https" {
 		sslCert := req.SSLCertificate
 		sslKey := req.SSLPrivateKey
 		if sslCert == "" {
@@ -249,6 +492,108 @@ func (s *DomainService) UpdateDomain(id uint, req *UpdateDomainRequest) (*models
 		if sslCert == "" || sslKey == "" {
 			return nil, fmt.Errorf("HTTPS协议需要提供SSL证书和私钥")
 		}
+
+		// 证书、私钥或域名有变化时重新校验
+		domainName := req.Domain
+		if domainName == "" {
+			domainName = domain.Domain
+		}
+		if req.SSLCertificate != "" || req.SSLPrivateKey != "" || domainName != domain.Domain || domain.Protocol != "https" {
+			if _, err := certs.ValidateKeyPair(domainName, sslCert, sslKey); err != nil {
+				return nil, fmt.Errorf("SSL证书校验失败: %v", err)
+			}
+		}
+	}
+
+	// 客户端证书认证验证
+	clientAuthMode := req.ClientAuthMode
+	if clientAuthMode == "" {
+		clientAuthMode = domain.ClientAuthMode
+	}
+	clientCACerts := domain.ClientCACerts
+	if req.ClientCACerts != nil {
+		clientCACerts = *req.ClientCACerts
+	}
+	if err := validateClientAuth(protocol, clientAuthMode, clientCACerts); err != nil {
+		return nil, err
+	}
+
+	// 后端TLS配置验证
+	upstream := models.Domain{
+		UpstreamTLSInsecureSkipVerify: domain.UpstreamTLSInsecureSkipVerify,
+		UpstreamCACerts:               domain.UpstreamCACerts,
+		UpstreamServerName:            domain.UpstreamServerName,
+		UpstreamClientCert:            domain.UpstreamClientCert,
+		UpstreamClientKey:             domain.UpstreamClientKey,
+	}
+	if req.UpstreamTLSInsecureSkipVerify != nil {
+		upstream.UpstreamTLSInsecureSkipVerify = *req.UpstreamTLSInsecureSkipVerify
+	}
+	if req.UpstreamCACerts != nil {
+		upstream.UpstreamCACerts = *req.UpstreamCACerts
+	}
+	if req.UpstreamServerName != nil {
+		upstream.UpstreamServerName = *req.UpstreamServerName
+	}
+	if req.UpstreamClientCert != nil {
+		upstream.UpstreamClientCert = *req.UpstreamClientCert
+	}
+	if req.UpstreamClientKey != nil {
+		upstream.UpstreamClientKey = *req.UpstreamClientKey
+	}
+	if _, err := proxy.BuildUpstreamTLSConfig(&upstream); err != nil {
+		return nil, fmt.Errorf("后端TLS配置无效: %v", err)
+	}
+
+	// HTTPS重定向、HSTS和响应头验证
+	headers := models.Domain{
+		Protocol:              protocol,
+		ForceHTTPS:            domain.ForceHTTPS,
+		HSTSEnabled:           domain.HSTSEnabled,
+		HSTSMaxAge:            domain.HSTSMaxAge,
+		HSTSIncludeSubdomains: domain.HSTSIncludeSubdomains,
+		HSTSPreload:           domain.HSTSPreload,
+		SecurityHeaders:       domain.SecurityHeaders,
+		StripResponseHeaders:  domain.StripResponseHeaders,
+	}
+	if req.ForceHTTPS != nil {
+		headers.ForceHTTPS = *req.ForceHTTPS
+	}
+	if req.HSTSEnabled != nil {
+		headers.HSTSEnabled = *req.HSTSEnabled
+	}
+	if req.HSTSMaxAge != nil {
+		headers.HSTSMaxAge = *req.HSTSMaxAge
+	}
+	if req.HSTSIncludeSubdomains != nil {
+		headers.HSTSIncludeSubdomains = *req.HSTSIncludeSubdomains
+	}
+	if req.HSTSPreload != nil {
+		headers.HSTSPreload = *req.HSTSPreload
+	}
+	if req.SecurityHeaders != nil {
+		headers.SecurityHeaders = *req.SecurityHeaders
+	}
+	if req.StripResponseHeaders != nil {
+		headers.StripResponseHeaders = *req.StripResponseHeaders
+	}
+	if err := validateResponseHeaders(&headers); err != nil {
+		return nil, err
+	}
+
+	// 协议校验配置验证
+	protocolLists := models.Domain{
+		AllowedMethods:      domain.AllowedMethods,
+		AllowedContentTypes: domain.AllowedContentTypes,
+	}
+	if req.AllowedMethods != nil {
+		protocolLists.AllowedMethods = *req.AllowedMethods
+	}
+	if req.AllowedContentTypes != nil {
+		protocolLists.AllowedContentTypes = *req.AllowedContentTypes
+	}
+	if err := waf.ValidateProtocolConfig(&protocolLists); err != nil {
+		return nil, fmt.Errorf("协议校验配置无效: %v", err)
 	}
 
 	// 更新字段
@@ -275,12 +620,105 @@ func (s *DomainService) UpdateDomain(id uint, req *UpdateDomainRequest) (*models
 	if req.SSLPrivateKey != "" {
 		updates["ssl_private_key"] = req.SSLPrivateKey
 	}
+	if req.CertSource != "" {
+		updates["cert_source"] = req.CertSource
+	}
+	if req.ACMEChallenge != "" {
+		updates["acme_challenge"] = req.ACMEChallenge
+	}
+	if req.ClientAuthMode != "" {
+		updates["client_auth_mode"] = req.ClientAuthMode
+	}
+	if req.ClientCACerts != nil {
+		updates["client_ca_certs"] = *req.ClientCACerts
+	}
 	if req.BackendURL != "" {
 		updates["backend_url"] = req.BackendURL
 	}
 	if req.Enabled != nil {
 		updates["enabled"] = *req.Enabled
 	}
+	if req.UpstreamTLSInsecureSkipVerify != nil {
+		updates["upstream_tls_insecure_skip_verify"] = upstream.UpstreamTLSInsecureSkipVerify
+	}
+	if req.UpstreamCACerts != nil {
+		updates["upstream_ca_certs"] = upstream.UpstreamCACerts
+	}
+	if req.UpstreamServerName != nil {
+		updates["upstream_server_name"] = upstream.UpstreamServerName
+	}
+	if req.UpstreamClientCert != nil {
+		updates["upstream_client_cert"] = upstream.UpstreamClientCert
+	}
+	if req.UpstreamClientKey != nil {
+		updates["upstream_client_key"] = upstream.UpstreamClientKey
+	}
+	if req.UpstreamHTTP2 != nil {
+		updates["upstream_http2"] = *req.UpstreamHTTP2
+	}
+	if req.ForceHTTPS != nil {
+		updates["force_https"] = headers.ForceHTTPS
+	}
+	if req.HTTPSRedirectCode != 0 {
+		updates["https_redirect_code"] = req.HTTPSRedirectCode
+	}
+	if req.HSTSEnabled != nil {
+		updates["hsts_enabled"] = headers.HSTSEnabled
+	}
+	if req.HSTSMaxAge != nil {
+		updates["hsts_max_age"] = headers.HSTSMaxAge
+	}
+	if req.HSTSIncludeSubdomains != nil {
+		updates["hsts_include_subdomains"] = headers.HSTSIncludeSubdomains
+	}
+	if req.HSTSPreload != nil {
+		updates["hsts_preload"] = headers.HSTSPreload
+	}
+	if req.SecurityHeaders != nil {
+		updates["security_headers"] = headers.SecurityHeaders
+	}
+	if req.StripResponseHeaders != nil {
+		updates["strip_response_headers"] = headers.StripResponseHeaders
+	}
+	if req.PreserveHost != nil {
+		updates["preserve_host"] = *req.PreserveHost
+	}
+	if req.Mode != "" {
+		updates["mode"] = req.Mode
+	}
+	if req.WebSocketEnabled != nil {
+		updates["websocket_enabled"] = *req.WebSocketEnabled
+	}
+	if req.WebSocketIdleTimeout != nil {
+		updates["websocket_idle_timeout"] = *req.WebSocketIdleTimeout
+	}
+	if req.WebSocketMaxDuration != nil {
+		updates["websocket_max_duration"] = *req.WebSocketMaxDuration
+	}
+	if req.WebSocketMaxMessageSize != nil {
+		updates["websocket_max_message_size"] = *req.WebSocketMaxMessageSize
+	}
+	if req.ProtocolValidation != nil {
+		updates["protocol_validation"] = *req.ProtocolValidation
+	}
+	if req.AllowedMethods != nil {
+		updates["allowed_methods"] = *req.AllowedMethods
+	}
+	if req.MaxHeaderCount != nil {
+		updates["max_header_count"] = *req.MaxHeaderCount
+	}
+	if req.MaxHeaderSize != nil {
+		updates["max_header_size"] = *req.MaxHeaderSize
+	}
+	if req.MaxURLLength != nil {
+		updates["max_url_length"] = *req.MaxURLLength
+	}
+	if req.MaxArgCount != nil {
+		updates["max_arg_count"] = *req.MaxArgCount
+	}
+	if req.AllowedContentTypes != nil {
+		updates["allowed_content_types"] = *req.AllowedContentTypes
+	}
 
 	if err := s.db.Model(&domain).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("更新域名失败: %v", err)
@@ -293,10 +731,25 @@ func (s *DomainService) UpdateDomain(id uint, req *UpdateDomainRequest) (*models
 	}
 
 	// 更新代理配置
-	if err := s.proxyManager.UpdateDomain(updatedDomain); err != nil {
+	if domain.Domain != updatedDomain.Domain {
+		s.proxyManager.RemoveDomain(domain.Domain)
+	}
+	if err := s.updateProxy(updatedDomain); err != nil {
 		return nil, fmt.Errorf("更新代理配置失败: %v", err)
 	}
 
+	// 域名名称变化后旧证书失效，切换到ACME或改名时重新签发
+	if domain.Domain != updatedDomain.Domain {
+		s.certStore.RemoveDomain(domain.Domain)
+	}
+	if err := s.reloadCertificates(updatedDomain); err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+	if updatedDomain.Enabled && updatedDomain.Protocol == "https" && updatedDomain.CertSource == "acme" &&
+		(domain.CertSource != "acme" || domain.Domain != updatedDomain.Domain) {
+		s.acmeManager.RequestCertificate(updatedDomain)
+	}
+
 	return updatedDomain, nil
 }
 
@@ -307,8 +760,10 @@ func (s *DomainService) DeleteDomain(id uint) error {
 		return fmt.Errorf("域名不存在: %v", err)
 	}
 
-	// 移除代理配置
+	// 移除代理配置和证书
 	s.proxyManager.RemoveDomain(domain.Domain)
+	s.certStore.RemoveDomain(domain.Domain)
+	s.ResetWAFProtection(domain.ID)
 
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		// 删除域名策略关联
@@ -316,6 +771,55 @@ func (s *DomainService) DeleteDomain(id uint) error {
 			return fmt.Errorf("删除域名策略关联失败: %v", err)
 		}
 
+		// 删除ACME证书记录和附加证书
+		if err := tx.Where("domain_id = ?", id).Delete(&models.ACMECertificate{}).Error; err != nil {
+			return fmt.Errorf("删除ACME证书记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.DomainCertificate{}).Error; err != nil {
+			return fmt.Errorf("删除附加证书失败: %v", err)
+		}
+
+		// 删除重写规则、gRPC描述文件、GraphQL端点、文件上传策略、登录接口、OpenAPI规范、学习会话和规则排除
+		if err := tx.Where("domain_id = ?", id).Delete(&models.RewriteRule{}).Error; err != nil {
+			return fmt.Errorf("删除重写规则失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.GRPCDescriptorSet{}).Error; err != nil {
+			return fmt.Errorf("删除gRPC描述文件失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.GraphQLEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除GraphQL端点失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.UploadPolicy{}).Error; err != nil {
+			return fmt.Errorf("删除文件上传策略失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.LoginEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除登录接口失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.APISpecObservation{}).Error; err != nil {
+			return fmt.Errorf("删除OpenAPI学习记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.APISpec{}).Error; err != nil {
+			return fmt.Errorf("删除OpenAPI规范失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.LearningEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除学习数据失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.LearningRuleHit{}).Error; err != nil {
+			return fmt.Errorf("删除规则命中记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.LearningSession{}).Error; err != nil {
+			return fmt.Errorf("删除学习会话失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return fmt.Errorf("删除规则排除失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.ShadowDiff{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略差异失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", id).Delete(&models.ShadowStat{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略统计失败: %v", err)
+		}
+
 		// 删除域名
 		if err := tx.Delete(&domain).Error; err != nil {
 			return fmt.Errorf("删除域名失败: %v", err)
@@ -342,9 +846,12 @@ func (s *DomainService) ToggleDomain(id uint) error {
 
 	// 更新代理配置
 	domain.Enabled = newStatus
-	if err := s.proxyManager.UpdateDomain(&domain); err != nil {
+	if err := s.updateProxy(&domain); err != nil {
 		return fmt.Errorf("更新代理配置失败: %v", err)
 	}
+	if err := s.reloadCertificates(&domain); err != nil {
+		return fmt.Errorf("加载证书失败: %v", err)
+	}
 
 	return nil
 }
@@ -366,6 +873,8 @@ func (s *DomainService) GetDomainPolicies(domainID uint) ([]DomainPolicyResponse
 			PolicyID: dp.PolicyID,
 			Priority: dp.Priority,
 			Enabled:  dp.Enabled,
+			Mode:     dp.Mode,
+			Shadow:   dp.Shadow,
 			Policy:   dp.Policy,
 		}
 	}
@@ -375,6 +884,7 @@ func (s *DomainService) GetDomainPolicies(domainID uint) ([]DomainPolicyResponse
 
 // UpdateDomainPolicies 更新域名策略关联
 func (s *DomainService) UpdateDomainPolicies(domainID uint, req *UpdateDomainPoliciesRequest) error {
+	defer s.ResetWAFProtection(domainID)
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		// 删除现有关联
 		if err := tx.Where("domain_id = ?", domainID).Delete(&models.DomainPolicy{}).Error; err != nil {
@@ -388,6 +898,8 @@ func (s *DomainService) UpdateDomainPolicies(domainID uint, req *UpdateDomainPol
 				PolicyID: policy.PolicyID,
 				Priority: policy.Priority,
 				Enabled:  policy.Enabled,
+				Mode:     policy.Mode,
+				Shadow:   policy.Shadow,
 			}
 			if err := tx.Create(&domainPolicy).Error; err != nil {
 				return fmt.Errorf("创建策略关联失败: %v", err)
@@ -400,12 +912,66 @@ func (s *DomainService) UpdateDomainPolicies(domainID uint, req *UpdateDomainPol
 
 // BatchDeleteDomains 批量删除域名配置
 func (s *DomainService) BatchDeleteDomains(ids []uint) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	var domains []models.Domain
+	if err := s.db.Where("id IN ?", ids).Find(&domains).Error; err != nil {
+		return fmt.Errorf("获取域名失败: %v", err)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 删除相关联的策略关联
 		if err := tx.Where("domain_id IN ?", ids).Delete(&models.DomainPolicy{}).Error; err != nil {
 			return fmt.Errorf("删除域名策略关联失败: %v", err)
 		}
 
+		// 删除ACME证书记录和附加证书
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.ACMECertificate{}).Error; err != nil {
+			return fmt.Errorf("删除ACME证书记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.DomainCertificate{}).Error; err != nil {
+			return fmt.Errorf("删除附加证书失败: %v", err)
+		}
+
+		// 删除重写规则、gRPC描述文件、GraphQL端点、文件上传策略、登录接口、OpenAPI规范、学习会话和规则排除
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.RewriteRule{}).Error; err != nil {
+			return fmt.Errorf("删除重写规则失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.GRPCDescriptorSet{}).Error; err != nil {
+			return fmt.Errorf("删除gRPC描述文件失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.GraphQLEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除GraphQL端点失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.UploadPolicy{}).Error; err != nil {
+			return fmt.Errorf("删除文件上传策略失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.LoginEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除登录接口失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.APISpecObservation{}).Error; err != nil {
+			return fmt.Errorf("删除OpenAPI学习记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.APISpec{}).Error; err != nil {
+			return fmt.Errorf("删除OpenAPI规范失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.LearningEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除学习数据失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.LearningRuleHit{}).Error; err != nil {
+			return fmt.Errorf("删除规则命中记录失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.LearningSession{}).Error; err != nil {
+			return fmt.Errorf("删除学习会话失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return fmt.Errorf("删除规则排除失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.ShadowDiff{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略差异失败: %v", err)
+		}
+		if err := tx.Where("domain_id IN ?", ids).Delete(&models.ShadowStat{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略统计失败: %v", err)
+		}
+
 		// 删除域名配置
 		if err := tx.Where("id IN ?", ids).Delete(&models.Domain{}).Error; err != nil {
 			return fmt.Errorf("批量删除域名配置失败: %v", err)
@@ -413,6 +979,17 @@ func (s *DomainService) BatchDeleteDomains(ids []uint) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// 移除代理配置和证书
+	for _, domain := range domains {
+		s.proxyManager.RemoveDomain(domain.Domain)
+		s.certStore.RemoveDomain(domain.Domain)
+		s.ResetWAFProtection(domain.ID)
+	}
+	return nil
 }
 
 // LoadAllDomains 加载所有启用的域名到代理管理器
@@ -423,15 +1000,115 @@ func (s *DomainService) LoadAllDomains() error {
 	}
 
 	for _, domain := range domains {
-		if err := s.proxyManager.UpdateDomain(&domain); err != nil {
+		if err := s.updateProxy(&domain); err != nil {
 			log.Printf("加载域名 %s 失败: %v", domain.Domain, err)
 			continue
 		}
+		if err := s.reloadCertificates(&domain); err != nil {
+			log.Printf("加载域名 %s 证书失败: %v", domain.Domain, err)
+		}
 	}
 
 	return nil
 }
 
+// GetACMEStatus 获取域名的ACME证书签发状态
+func (s *DomainService) GetACMEStatus(id uint) (*models.ACMECertificate, error) {
+	domain, err := s.GetDomain(id)
+	if err != nil {
+		return nil, err
+	}
+	if domain.CertSource != "acme" {
+		return nil, fmt.Errorf("域名 %s 未使用ACME证书", domain.Domain)
+	}
+
+	status, err := s.acmeManager.GetStatus(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.ACMECertificate{
+			DomainID: domain.ID,
+			Domain:   domain.Domain,
+			Status:   certs.ACMEStatusPending,
+			TenantID: domain.TenantID,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取ACME状态失败: %v", err)
+	}
+	return status, nil
+}
+
+// RenewACMECertificate 立即为域名重新签发ACME证书（异步执行）
+func (s *DomainService) RenewACMECertificate(id uint) error {
+	domain, err := s.GetDomain(id)
+	if err != nil {
+		return err
+	}
+	if !s.acmeManager.Enabled() {
+		return fmt.Errorf("系统未启用ACME自动证书")
+	}
+	if domain.CertSource != "acme" {
+		return fmt.Errorf("域名 %s 未使用ACME证书", domain.Domain)
+	}
+	if !domain.Enabled {
+		return fmt.Errorf("域名 %s 未启用", domain.Domain)
+	}
+
+	s.acmeManager.RequestCertificate(domain)
+	return nil
+}
+
+// validateResponseHeaders 校验HTTPS重定向、HSTS和响应头配置
+func validateResponseHeaders(domain *models.Domain) error {
+	if (domain.ForceHTTPS || domain.HSTSEnabled) && domain.Protocol != "https" {
+		return fmt.Errorf("强制HTTPS和HSTS仅支持HTTPS协议的域名")
+	}
+	if _, err := proxy.BuildResponseHeaderPolicy(domain); err != nil {
+		return fmt.Errorf("响应头配置无效: %v", err)
+	}
+	return nil
+}
+
+// validateClientAuth 校验客户端证书认证配置，校验类模式必须提供有效的CA证书包
+func validateClientAuth(protocol, mode, caCerts string) error {
+	if mode == "" || mode == certs.ClientAuthNone {
+		return nil
+	}
+	if protocol != "https" {
+		return fmt.Errorf("客户端证书认证仅支持HTTPS协议")
+	}
+	if caCerts == "" {
+		if mode == certs.ClientAuthOptional {
+			return nil
+		}
+		return fmt.Errorf("客户端证书认证模式 %s 需要提供CA证书", mode)
+	}
+	if _, err := certs.ParseClientCAs(caCerts); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reloadCertificates 将域名的手动证书和附加证书热加载到证书存储
+func (s *DomainService) reloadCertificates(domain *models.Domain) error {
+	var extra []models.DomainCertificate
+	if err := s.db.Where("domain_id = ?", domain.ID).Find(&extra).Error; err != nil {
+		return err
+	}
+	return s.certStore.UpdateDomain(domain, extra)
+}
+
+// updateProxy 加载域名启用的重写规则并更新代理配置
+func (s *DomainService) updateProxy(domain *models.Domain) error {
+	if domain.Enabled {
+		var rules []models.RewriteRule
+		if err := s.db.Where("domain_id = ? AND enabled = ?", domain.ID, true).Find(&rules).Error; err != nil {
+			return err
+		}
+		domain.RewriteRules = rules
+	}
+	return s.proxyManager.UpdateDomain(domain)
+}
+
 // GetProxyManager 获取代理管理器
 func (s *DomainService) GetProxyManager() *proxy.ProxyManager {
 	return s.proxyManager
@@ -461,3 +1138,64 @@ func (s *DomainService) HasDomainPolicies(domain string) bool {
 
 	return count > 0
 }
+
+// HasWAFProtection 检查域名是否需要经过WAF检查：域名已启用，且开启了协议校验、关联了策略，
+// 或配置了登录接口、文件上传策略、GraphQL端点、OpenAPI规范、正在记录的学习会话等按域名生效的防护。
+// 每个代理请求都会调用，除协议校验外的检查结果按域名缓存
+func (s *DomainService) HasWAFProtection(domain string) bool {
+	domainConfig := s.GetDomainConfig(domain)
+	if domainConfig == nil || !domainConfig.Enabled {
+		return false
+	}
+	if domainConfig.ProtocolValidation {
+		return true
+	}
+
+	s.protectionMu.RLock()
+	cached, ok := s.protection[domainConfig.ID]
+	s.protectionMu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.protected
+	}
+
+	protected := s.loadWAFProtection(domainConfig.ID)
+	s.protectionMu.Lock()
+	s.protection[domainConfig.ID] = wafProtection{protected: protected, expires: time.Now().Add(wafProtectionTTL)}
+	s.protectionMu.Unlock()
+	return protected
+}
+
+// ResetWAFProtection 清除域名防护配置检查结果的缓存，域名的策略关联或防护配置变更后调用
+func (s *DomainService) ResetWAFProtection(domainID uint) {
+	s.protectionMu.Lock()
+	delete(s.protection, domainID)
+	s.protectionMu.Unlock()
+}
+
+// loadWAFProtection 查询域名是否关联了策略或配置了按域名生效的防护，查询失败时按需要检查处理，避免漏检
+func (s *DomainService) loadWAFProtection(domainID uint) bool {
+	checks := []struct {
+		model interface{}
+		query string
+		value interface{}
+	}{
+		{&models.DomainPolicy{}, "enabled = ?", true},
+		{&models.LoginEndpoint{}, "enabled = ?", true},
+		{&models.UploadPolicy{}, "enabled = ?", true},
+		{&models.GraphQLEndpoint{}, "enabled = ?", true},
+		{&models.APISpec{}, "enabled = ?", true},
+		// 学习会话只记录经过WAF检查的请求
+		{&models.LearningSession{}, "status = ?", waf.LearningRecording},
+	}
+	for _, check := range checks {
+		var count int64
+		if err := s.db.Model(check.model).Where("domain_id = ?", domainID).Where(check.query, check.value).Count(&count).Error; err != nil {
+			log.Printf("检查域名防护配置失败: %v", err)
+			return true
+		}
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+)
+
+// EvaluationService 试运行服务，用模拟请求查看WAF的完整检查过程
+type EvaluationService struct {
+	wafEngine *waf.WAFEngine
+}
+
+func NewEvaluationService(wafEngine *waf.WAFEngine) *EvaluationService {
+	return &EvaluationService{
+		wafEngine: wafEngine,
+	}
+}
+
+// GetDomain 获取模拟请求按哪个域名检查，域名未配置时返回nil
+func (s *EvaluationService) GetDomain(req *waf.EvaluationRequest) (*models.Domain, error) {
+	domain, err := s.wafEngine.EvaluationDomain(req)
+	if err != nil {
+		return nil, fmt.Errorf("模拟请求无效: %v", err)
+	}
+	return domain, nil
+}
+
+// Evaluate 对模拟请求执行WAF检查，返回各检查阶段、每条规则的计算结果和最终结果
+func (s *EvaluationService) Evaluate(req *waf.EvaluationRequest) (*waf.DecisionTrace, error) {
+	trace, err := s.wafEngine.Evaluate(req)
+	if err != nil {
+		return nil, fmt.Errorf("模拟请求无效: %v", err)
+	}
+	return trace, nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"waf-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// GraphQLService GraphQL端点服务，管理需要解析GraphQL查询并限制深度、别名、字段数和复杂度的路径
+type GraphQLService struct {
+	db            *gorm.DB
+	domainService *DomainService
+}
+
+func NewGraphQLService(db *gorm.DB, domainService *DomainService) *GraphQLService {
+	return &GraphQLService{
+		db:            db,
+		domainService: domainService,
+	}
+}
+
+// CreateGraphQLEndpointRequest 创建GraphQL端点请求
+type CreateGraphQLEndpointRequest struct {
+	Path               string `json:"path" binding:"required"`
+	MaxDepth           int    `json:"max_depth" binding:"min=0"`
+	MaxAliases         int    `json:"max_aliases" binding:"min=0"`
+	MaxFields          int    `json:"max_fields" binding:"min=0"`
+	MaxComplexity      int    `json:"max_complexity" binding:"min=0"`
+	MaxBatchSize       int    `json:"max_batch_size" binding:"min=0"`
+	BlockIntrospection bool   `json:"block_introspection"`
+	Action             string `json:"action" binding:"omitempty,oneof=block log"`
+	Enabled            *bool  `json:"enabled"`
+}
+
+// UpdateGraphQLEndpointRequest 更新GraphQL端点请求
+type UpdateGraphQLEndpointRequest struct {
+	Path               *string `json:"path"`
+	MaxDepth           *int    `json:"max_depth" binding:"omitempty,min=0"`
+	MaxAliases         *int    `json:"max_aliases" binding:"omitempty,min=0"`
+	MaxFields          *int    `json:"max_fields" binding:"omitempty,min=0"`
+	MaxComplexity      *int    `json:"max_complexity" binding:"omitempty,min=0"`
+	MaxBatchSize       *int    `json:"max_batch_size" binding:"omitempty,min=0"`
+	BlockIntrospection *bool   `json:"block_introspection"`
+	Action             string  `json:"action" binding:"omitempty,oneof=block log"`
+	Enabled            *bool   `json:"enabled"`
+}
+
+// GetGraphQLEndpoints 获取域名的GraphQL端点
+func (s *GraphQLService) GetGraphQLEndpoints(domainID uint) ([]models.GraphQLEndpoint, error) {
+	var endpoints []models.GraphQLEndpoint
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("获取GraphQL端点失败: %v", err)
+	}
+	return endpoints, nil
+}
+
+// CreateGraphQLEndpoint 创建GraphQL端点
+func (s *GraphQLService) CreateGraphQLEndpoint(domainID uint, req *CreateGraphQLEndpointRequest) (*models.GraphQLEndpoint, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &models.GraphQLEndpoint{
+		DomainID:           domain.ID,
+		Path:               req.Path,
+		MaxDepth:           req.MaxDepth,
+		MaxAliases:         req.MaxAliases,
+		MaxFields:          req.MaxFields,
+		MaxComplexity:      req.MaxComplexity,
+		MaxBatchSize:       req.MaxBatchSize,
+		BlockIntrospection: req.BlockIntrospection,
+		Action:             req.Action,
+		Enabled:            true,
+		TenantID:           domain.TenantID,
+	}
+	if endpoint.Action == "" {
+		endpoint.Action = "block"
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if err := s.validateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(endpoint).Error; err != nil {
+		return nil, fmt.Errorf("创建GraphQL端点失败: %v", err)
+	}
+	// enabled字段有默认值，显式设置false时需要单独更新
+	if !endpoint.Enabled {
+		if err := s.db.Model(endpoint).Update("enabled", false).Error; err != nil {
+			return nil, fmt.Errorf("创建GraphQL端点失败: %v", err)
+		}
+	}
+	s.domainService.ResetWAFProtection(endpoint.DomainID)
+	return endpoint, nil
+}
+
+// UpdateGraphQLEndpoint 更新GraphQL端点
+func (s *GraphQLService) UpdateGraphQLEndpoint(domainID, endpointID uint, req *UpdateGraphQLEndpointRequest) (*models.GraphQLEndpoint, error) {
+	var endpoint models.GraphQLEndpoint
+	if err := s.db.Where("id = ? AND domain_id = ?", endpointID, domainID).First(&endpoint).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("GraphQL端点不存在")
+		}
+		return nil, fmt.Errorf("获取GraphQL端点失败: %v", err)
+	}
+
+	if req.Path != nil {
+		endpoint.Path = *req.Path
+	}
+	if req.MaxDepth != nil {
+		endpoint.MaxDepth = *req.MaxDepth
+	}
+	if req.MaxAliases != nil {
+		endpoint.MaxAliases = *req.MaxAliases
+	}
+	if req.MaxFields != nil {
+		endpoint.MaxFields = *req.MaxFields
+	}
+	if req.MaxComplexity != nil {
+		endpoint.MaxComplexity = *req.MaxComplexity
+	}
+	if req.MaxBatchSize != nil {
+		endpoint.MaxBatchSize = *req.MaxBatchSize
+	}
+	if req.BlockIntrospection != nil {
+		endpoint.BlockIntrospection = *req.BlockIntrospection
+	}
+	if req.Action != "" {
+		endpoint.Action = req.Action
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if err := s.validateEndpoint(&endpoint); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&endpoint).Error; err != nil {
+		return nil, fmt.Errorf("更新GraphQL端点失败: %v", err)
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return &endpoint, nil
+}
+
+// DeleteGraphQLEndpoint 删除GraphQL端点
+func (s *GraphQLService) DeleteGraphQLEndpoint(domainID, endpointID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", endpointID, domainID).Delete(&models.GraphQLEndpoint{})
+	if result.Error != nil {
+		return fmt.Errorf("删除GraphQL端点失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("GraphQL端点不存在")
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return nil
+}
+
+// validateEndpoint 校验端点路径，同一域名下路径不能重复
+func (s *GraphQLService) validateEndpoint(endpoint *models.GraphQLEndpoint) error {
+	if !strings.HasPrefix(endpoint.Path, "/") {
+		return fmt.Errorf("GraphQL端点路径必须以/开头")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.GraphQLEndpoint{}).
+		Where("domain_id = ? AND path = ? AND id <> ?", endpoint.DomainID, endpoint.Path, endpoint.ID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("检查GraphQL端点失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("GraphQL端点路径已存在")
+	}
+	return nil
+}
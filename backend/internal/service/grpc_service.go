@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// GRPCService gRPC描述文件服务，管理域名上传的FileDescriptorSet，供grpc_message规则解码请求消息
+type GRPCService struct {
+	db            *gorm.DB
+	domainService *DomainService
+	wafEngine     *waf.WAFEngine
+}
+
+func NewGRPCService(db *gorm.DB, domainService *DomainService, wafEngine *waf.WAFEngine) *GRPCService {
+	return &GRPCService{
+		db:            db,
+		domainService: domainService,
+		wafEngine:     wafEngine,
+	}
+}
+
+// CreateGRPCDescriptorRequest 上传gRPC描述文件请求
+type CreateGRPCDescriptorRequest struct {
+	Name          string `json:"name"`
+	DescriptorSet string `json:"descriptor_set" binding:"required"` // base64编码的FileDescriptorSet（protoc --include_imports --descriptor_set_out）
+}
+
+// GetGRPCDescriptors 获取域名的gRPC描述文件
+func (s *GRPCService) GetGRPCDescriptors(domainID uint) ([]models.GRPCDescriptorSet, error) {
+	var sets []models.GRPCDescriptorSet
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&sets).Error; err != nil {
+		return nil, fmt.Errorf("获取gRPC描述文件失败: %v", err)
+	}
+	return sets, nil
+}
+
+// CreateGRPCDescriptor 上传gRPC描述文件
+func (s *GRPCService) CreateGRPCDescriptor(domainID uint, req *CreateGRPCDescriptorRequest) (*models.GRPCDescriptorSet, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := base64.StdEncoding.DecodeString(req.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("描述文件不是有效的base64编码: %v", err)
+	}
+	services, err := waf.ParseDescriptorSet(content)
+	if err != nil {
+		return nil, fmt.Errorf("描述文件无效: %v", err)
+	}
+	servicesJSON, _ := json.Marshal(services)
+
+	set := &models.GRPCDescriptorSet{
+		DomainID: domain.ID,
+		Name:     req.Name,
+		Content:  content,
+		Services: string(servicesJSON),
+		TenantID: domain.TenantID,
+	}
+	if err := s.db.Create(set).Error; err != nil {
+		return nil, fmt.Errorf("保存gRPC描述文件失败: %v", err)
+	}
+
+	s.wafEngine.ResetGRPCDescriptors(domain.ID)
+	return set, nil
+}
+
+// DeleteGRPCDescriptor 删除gRPC描述文件
+func (s *GRPCService) DeleteGRPCDescriptor(domainID, descriptorID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", descriptorID, domainID).Delete(&models.GRPCDescriptorSet{})
+	if result.Error != nil {
+		return fmt.Errorf("删除gRPC描述文件失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("gRPC描述文件不存在")
+	}
+
+	s.wafEngine.ResetGRPCDescriptors(domainID)
+	return nil
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// LearningService 学习模式服务，记录域名的正常流量特征，生成OpenAPI规范和规则排除建议
+type LearningService struct {
+	db             *gorm.DB
+	domainService  *DomainService
+	apiSpecService *APISpecService
+	wafEngine      *waf.WAFEngine
+}
+
+func NewLearningService(db *gorm.DB, domainService *DomainService, apiSpecService *APISpecService, wafEngine *waf.WAFEngine) *LearningService {
+	return &LearningService{
+		db:             db,
+		domainService:  domainService,
+		apiSpecService: apiSpecService,
+		wafEngine:      wafEngine,
+	}
+}
+
+// StartLearningRequest 开始学习会话请求
+type StartLearningRequest struct {
+	Name     string `json:"name"`
+	Duration int    `json:"duration" binding:"omitempty,min=1,max=43200"` // 记录时长（分钟），默认1440（一天）
+}
+
+// MarkRuleHitRequest 标记规则命中请求
+type MarkRuleHitRequest struct {
+	Legitimate bool `json:"legitimate"`
+}
+
+// ApplyLearningRequest 应用学习建议请求
+type ApplyLearningRequest struct {
+	ApplySpec       bool   `json:"apply_spec"`                                                 // 是否上传生成的OpenAPI规范
+	SpecMode        string `json:"spec_mode" binding:"omitempty,oneof=enforce log_only learn"` // 规范模式，默认log_only
+	Location        string `json:"location"`                                                   // 规范生效路径前缀
+	ApplyExclusions bool   `json:"apply_exclusions"`                                           // 是否创建规则排除
+}
+
+// LearningProposal 学习建议
+type LearningProposal struct {
+	Session    models.LearningSession `json:"session"`
+	Endpoints  int                    `json:"endpoints"`  // 学习到的接口数
+	Spec       string                 `json:"spec"`       // 生成的OpenAPI规范（JSON）
+	Exclusions []models.RuleExclusion `json:"exclusions"` // 根据标记为正常流量的规则命中生成的排除
+}
+
+// LearningApplyResult 应用学习建议的结果
+type LearningApplyResult struct {
+	Spec       *models.APISpec        `json:"spec,omitempty"`
+	Exclusions []models.RuleExclusion `json:"exclusions"`
+}
+
+// GetLearningSessions 获取域名的学习会话
+func (s *LearningService) GetLearningSessions(domainID uint) ([]models.LearningSession, error) {
+	var sessions []models.LearningSession
+	if err := s.db.Where("domain_id = ?", domainID).Order("id DESC").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("获取学习会话失败: %v", err)
+	}
+	return sessions, nil
+}
+
+// StartLearningSession 开始学习会话，同一域名同时只能有一个记录中的会话
+func (s *LearningService) StartLearningSession(domainID uint, req *StartLearningRequest) (*models.LearningSession, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.LearningSession{}).Where("domain_id = ? AND status = ?", domainID, waf.LearningRecording).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("检查学习会话失败: %v", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该域名已有记录中的学习会话")
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = 1440
+	}
+	now := time.Now()
+	session := &models.LearningSession{
+		DomainID:  domain.ID,
+		Name:      req.Name,
+		Status:    waf.LearningRecording,
+		StartedAt: now,
+		EndsAt:    now.Add(time.Duration(duration) * time.Minute),
+		TenantID:  domain.TenantID,
+	}
+	if session.Name == "" {
+		session.Name = fmt.Sprintf("%s-%s", domain.Domain, now.Format("20060102150405"))
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, fmt.Errorf("创建学习会话失败: %v", err)
+	}
+
+	s.wafEngine.StartLearning(*session)
+	s.domainService.ResetWAFProtection(session.DomainID)
+	return session, nil
+}
+
+// StopLearningSession 停止学习会话并保存已记录的数据
+func (s *LearningService) StopLearningSession(domainID, sessionID uint) (*models.LearningSession, error) {
+	session, err := s.getSession(domainID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != waf.LearningRecording {
+		return nil, fmt.Errorf("学习会话未在记录中")
+	}
+
+	s.wafEngine.StopLearning(domainID)
+
+	now := time.Now()
+	if err := s.db.Model(session).Updates(map[string]interface{}{"status": waf.LearningStopped, "stopped_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("停止学习会话失败: %v", err)
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return s.getSession(domainID, sessionID)
+}
+
+// DeleteLearningSession 删除学习会话及其记录的数据
+func (s *LearningService) DeleteLearningSession(domainID, sessionID uint) error {
+	session, err := s.getSession(domainID, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Status == waf.LearningRecording {
+		s.wafEngine.StopLearning(domainID)
+		defer s.domainService.ResetWAFProtection(domainID)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&models.LearningEndpoint{}).Error; err != nil {
+			return fmt.Errorf("删除学习数据失败: %v", err)
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&models.LearningRuleHit{}).Error; err != nil {
+			return fmt.Errorf("删除规则命中记录失败: %v", err)
+		}
+		if err := tx.Delete(session).Error; err != nil {
+			return fmt.Errorf("删除学习会话失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// GetLearningEndpoints 获取学习到的接口，按请求数排序
+func (s *LearningService) GetLearningEndpoints(domainID, sessionID uint) ([]models.LearningEndpoint, error) {
+	if _, err := s.getSession(domainID, sessionID); err != nil {
+		return nil, err
+	}
+	s.wafEngine.FlushLearning()
+
+	var endpoints []models.LearningEndpoint
+	if err := s.db.Where("session_id = ?", sessionID).Order("count DESC, path ASC").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("获取学习数据失败: %v", err)
+	}
+	return endpoints, nil
+}
+
+// GetLearningRuleHits 获取学习期间的规则命中，按命中次数排序
+func (s *LearningService) GetLearningRuleHits(domainID, sessionID uint) ([]models.LearningRuleHit, error) {
+	if _, err := s.getSession(domainID, sessionID); err != nil {
+		return nil, err
+	}
+	s.wafEngine.FlushLearning()
+
+	var hits []models.LearningRuleHit
+	if err := s.db.Where("session_id = ?", sessionID).Order("count DESC, id ASC").Find(&hits).Error; err != nil {
+		return nil, fmt.Errorf("获取规则命中记录失败: %v", err)
+	}
+	return hits, nil
+}
+
+// MarkLearningRuleHit 标记规则命中是否为正常流量
+func (s *LearningService) MarkLearningRuleHit(domainID, sessionID, hitID uint, req *MarkRuleHitRequest) (*models.LearningRuleHit, error) {
+	if _, err := s.getSession(domainID, sessionID); err != nil {
+		return nil, err
+	}
+
+	var hit models.LearningRuleHit
+	if err := s.db.Where("id = ? AND session_id = ?", hitID, sessionID).First(&hit).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("规则命中记录不存在")
+		}
+		return nil, fmt.Errorf("获取规则命中记录失败: %v", err)
+	}
+
+	hit.Legitimate = req.Legitimate
+	if err := s.db.Model(&hit).Update("legitimate", req.Legitimate).Error; err != nil {
+		return nil, fmt.Errorf("标记规则命中失败: %v", err)
+	}
+	return &hit, nil
+}
+
+// GetLearningProposal 根据学习数据生成OpenAPI规范和规则排除建议
+func (s *LearningService) GetLearningProposal(domainID, sessionID uint) (*LearningProposal, error) {
+	session, err := s.getSession(domainID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := s.GetLearningEndpoints(domainID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &LearningProposal{
+		Session:    *session,
+		Endpoints:  len(endpoints),
+		Exclusions: []models.RuleExclusion{},
+	}
+	if len(endpoints) > 0 {
+		spec, err := waf.LearnedSpec(session.Name, endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("生成OpenAPI规范失败: %v", err)
+		}
+		proposal.Spec = string(spec)
+	}
+
+	var hits []models.LearningRuleHit
+	if err := s.db.Where("session_id = ? AND legitimate = ?", sessionID, true).Order("rule_id ASC, path ASC").Find(&hits).Error; err != nil {
+		return nil, fmt.Errorf("获取规则命中记录失败: %v", err)
+	}
+	for _, hit := range hits {
+		exclusion := models.RuleExclusion{
+			DomainID:  session.DomainID,
+			Name:      fmt.Sprintf("%s %s %s", hit.RuleName, hit.Method, hit.Path),
+			RuleID:    hit.RuleID,
+			PathMatch: "exact",
+			Path:      hit.Path,
+			Source:    "learning",
+			Comment:   fmt.Sprintf("学习会话 %s 中命中%d次，已标记为正常流量", session.Name, hit.Count),
+			Enabled:   true,
+			TenantID:  session.TenantID,
+		}
+		// 含占位符的路径转换为正则表达式，匹配所有同类请求
+		if strings.Contains(hit.Path, "{") {
+			exclusion.PathMatch = "regex"
+			exclusion.Path = waf.PathPattern(hit.Path)
+		}
+		proposal.Exclusions = append(proposal.Exclusions, exclusion)
+	}
+	return proposal, nil
+}
+
+// ApplyLearningProposal 应用学习建议：上传生成的OpenAPI规范并创建规则排除
+func (s *LearningService) ApplyLearningProposal(domainID, sessionID uint, req *ApplyLearningRequest) (*LearningApplyResult, error) {
+	session, err := s.getSession(domainID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == waf.LearningRecording {
+		return nil, fmt.Errorf("请先停止学习会话")
+	}
+
+	proposal, err := s.GetLearningProposal(domainID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LearningApplyResult{Exclusions: []models.RuleExclusion{}}
+	if req.ApplySpec {
+		if proposal.Spec == "" {
+			return nil, fmt.Errorf("学习会话没有记录到接口")
+		}
+		mode := req.SpecMode
+		if mode == "" {
+			mode = waf.APISpecLogOnly
+		}
+		spec, err := s.apiSpecService.CreateAPISpec(domainID, &CreateAPISpecRequest{
+			Name:     session.Name,
+			Location: req.Location,
+			Mode:     mode,
+			Content:  proposal.Spec,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Spec = spec
+	}
+
+	if req.ApplyExclusions && len(proposal.Exclusions) > 0 {
+		if err := s.db.Create(&proposal.Exclusions).Error; err != nil {
+			return nil, fmt.Errorf("创建规则排除失败: %v", err)
+		}
+		result.Exclusions = proposal.Exclusions
+	}
+
+	if err := s.db.Model(session).Update("status", waf.LearningApplied).Error; err != nil {
+		return nil, fmt.Errorf("更新学习会话失败: %v", err)
+	}
+	return result, nil
+}
+
+// getSession 获取域名的学习会话
+func (s *LearningService) getSession(domainID, sessionID uint) (*models.LearningSession, error) {
+	var session models.LearningSession
+	if err := s.db.Where("id = ? AND domain_id = ?", sessionID, domainID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("学习会话不存在")
+		}
+		return nil, fmt.Errorf("获取学习会话失败: %v", err)
+	}
+	return &session, nil
+}
@@ -20,11 +20,23 @@ type LogListRequest struct {
 	RuleName   string    `form:"rule_name"`
 	Domain     string    `form:"domain"`
 	Action     string    `form:"action"`
+	Username   string    `form:"username"`
 	TenantID   uint      `form:"tenant_id"`
 	StartTime  time.Time `form:"start_time"`
 	EndTime    time.Time `form:"end_time"`
 }
 
+// WebSocketSessionListRequest WebSocket会话列表请求
+type WebSocketSessionListRequest struct {
+	Page          int    `form:"page,default=1"`
+	PageSize      int    `form:"page_size,default=10"`
+	ClientIP      string `form:"client_ip"`
+	Domain        string `form:"domain"`
+	CloseReason   string `form:"close_reason"`
+	HasViolations bool   `form:"has_violations"`
+	TenantID      uint   `form:"tenant_id"`
+}
+
 func NewLogService(db *gorm.DB) *LogService {
 	return &LogService{db: db}
 }
@@ -52,6 +64,9 @@ func (s *LogService) GetAttackLogList(req *LogListRequest) ([]models.AttackLog,
 	if req.Action != "" {
 		query = query.Where("action = ?", req.Action)
 	}
+	if req.Username != "" {
+		query = query.Where("username = ?", req.Username)
+	}
 	if req.TenantID > 0 {
 		query = query.Where("tenant_id = ?", req.TenantID)
 	}
@@ -78,6 +93,44 @@ func (s *LogService) GetAttackLogList(req *LogListRequest) ([]models.AttackLog,
 	return logs, total, nil
 }
 
+// GetWebSocketSessionList 获取WebSocket会话列表
+func (s *LogService) GetWebSocketSessionList(req *WebSocketSessionListRequest) ([]models.WebSocketSession, int64, error) {
+	var sessions []models.WebSocketSession
+	var total int64
+
+	query := s.db.Model(&models.WebSocketSession{})
+
+	// 添加筛选条件
+	if req.ClientIP != "" {
+		query = query.Where("client_ip = ?", req.ClientIP)
+	}
+	if req.Domain != "" {
+		query = query.Where("domain LIKE ?", "%"+req.Domain+"%")
+	}
+	if req.CloseReason != "" {
+		query = query.Where("close_reason = ?", req.CloseReason)
+	}
+	if req.HasViolations {
+		query = query.Where("violations > 0")
+	}
+	if req.TenantID > 0 {
+		query = query.Where("tenant_id = ?", req.TenantID)
+	}
+
+	// 计算总数
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 分页查询
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Offset(offset).Limit(req.PageSize).Order("started_at DESC").Find(&sessions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return sessions, total, nil
+}
+
 // GetAttackLogByID 根据ID获取攻击日志详情
 func (s *LogService) GetAttackLogByID(id uint, tenantID uint) (*models.AttackLog, error) {
 	var log models.AttackLog
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// LoginEndpointService 登录接口服务，管理域名下的登录防护配置：失败判断条件、渐进延迟、质询和拦截阈值
+type LoginEndpointService struct {
+	db            *gorm.DB
+	domainService *DomainService
+	wafEngine     *waf.WAFEngine
+}
+
+func NewLoginEndpointService(db *gorm.DB, domainService *DomainService, wafEngine *waf.WAFEngine) *LoginEndpointService {
+	return &LoginEndpointService{
+		db:            db,
+		domainService: domainService,
+		wafEngine:     wafEngine,
+	}
+}
+
+// CreateLoginEndpointRequest 创建登录接口请求，阈值字段不传时使用默认值，传0表示不启用对应的处理
+type CreateLoginEndpointRequest struct {
+	Name               string `json:"name"`
+	Path               string `json:"path" binding:"required"`
+	Method             string `json:"method"`
+	UsernameField      string `json:"username_field" binding:"required"`
+	FailureStatusCodes string `json:"failure_status_codes"`
+	FailureBodyPattern string `json:"failure_body_pattern"`
+	FailureWindow      int    `json:"failure_window" binding:"min=0"`
+	DelayAfter         *int   `json:"delay_after" binding:"omitempty,min=0"`
+	DelayMs            int    `json:"delay_ms" binding:"min=0"`
+	MaxDelayMs         int    `json:"max_delay_ms" binding:"min=0"`
+	ChallengeAfter     *int   `json:"challenge_after" binding:"omitempty,min=0"`
+	MaxUserIPFailures  *int   `json:"max_user_ip_failures" binding:"omitempty,min=0"`
+	MaxIPFailures      *int   `json:"max_ip_failures" binding:"omitempty,min=0"`
+	MaxUserFailures    *int   `json:"max_user_failures" binding:"omitempty,min=0"`
+	MaxUsernamesPerIP  *int   `json:"max_usernames_per_ip" binding:"omitempty,min=0"`
+	MaskUsername       bool   `json:"mask_username"`
+	Enabled            *bool  `json:"enabled"`
+}
+
+// UpdateLoginEndpointRequest 更新登录接口请求
+type UpdateLoginEndpointRequest struct {
+	Name               *string `json:"name"`
+	Path               *string `json:"path"`
+	Method             *string `json:"method"`
+	UsernameField      *string `json:"username_field"`
+	FailureStatusCodes *string `json:"failure_status_codes"`
+	FailureBodyPattern *string `json:"failure_body_pattern"`
+	FailureWindow      *int    `json:"failure_window" binding:"omitempty,min=0"`
+	DelayAfter         *int    `json:"delay_after" binding:"omitempty,min=0"`
+	DelayMs            *int    `json:"delay_ms" binding:"omitempty,min=0"`
+	MaxDelayMs         *int    `json:"max_delay_ms" binding:"omitempty,min=0"`
+	ChallengeAfter     *int    `json:"challenge_after" binding:"omitempty,min=0"`
+	MaxUserIPFailures  *int    `json:"max_user_ip_failures" binding:"omitempty,min=0"`
+	MaxIPFailures      *int    `json:"max_ip_failures" binding:"omitempty,min=0"`
+	MaxUserFailures    *int    `json:"max_user_failures" binding:"omitempty,min=0"`
+	MaxUsernamesPerIP  *int    `json:"max_usernames_per_ip" binding:"omitempty,min=0"`
+	MaskUsername       *bool   `json:"mask_username"`
+	Enabled            *bool   `json:"enabled"`
+}
+
+// ResetLoginFailuresRequest 清除登录失败计数请求，用户名和IP至少指定一个
+type ResetLoginFailuresRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+// GetLoginEndpoints 获取域名的登录接口
+func (s *LoginEndpointService) GetLoginEndpoints(domainID uint) ([]models.LoginEndpoint, error) {
+	var endpoints []models.LoginEndpoint
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("获取登录接口失败: %v", err)
+	}
+	return endpoints, nil
+}
+
+// CreateLoginEndpoint 创建登录接口
+func (s *LoginEndpointService) CreateLoginEndpoint(domainID uint, req *CreateLoginEndpointRequest) (*models.LoginEndpoint, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &models.LoginEndpoint{
+		DomainID:           domain.ID,
+		Name:               req.Name,
+		Path:               req.Path,
+		Method:             strings.ToUpper(req.Method),
+		UsernameField:      req.UsernameField,
+		FailureStatusCodes: req.FailureStatusCodes,
+		FailureBodyPattern: req.FailureBodyPattern,
+		FailureWindow:      req.FailureWindow,
+		DelayAfter:         3,
+		DelayMs:            req.DelayMs,
+		MaxDelayMs:         req.MaxDelayMs,
+		ChallengeAfter:     5,
+		MaxUserIPFailures:  10,
+		MaxIPFailures:      50,
+		MaxUserFailures:    20,
+		MaxUsernamesPerIP:  10,
+		MaskUsername:       req.MaskUsername,
+		Enabled:            true,
+		TenantID:           domain.TenantID,
+	}
+	if endpoint.Method == "" {
+		endpoint.Method = "POST"
+	}
+	if endpoint.FailureWindow == 0 {
+		endpoint.FailureWindow = 900
+	}
+	if endpoint.DelayMs == 0 {
+		endpoint.DelayMs = 500
+	}
+	if endpoint.MaxDelayMs == 0 {
+		endpoint.MaxDelayMs = 8000
+	}
+	if req.DelayAfter != nil {
+		endpoint.DelayAfter = *req.DelayAfter
+	}
+	if req.ChallengeAfter != nil {
+		endpoint.ChallengeAfter = *req.ChallengeAfter
+	}
+	if req.MaxUserIPFailures != nil {
+		endpoint.MaxUserIPFailures = *req.MaxUserIPFailures
+	}
+	if req.MaxIPFailures != nil {
+		endpoint.MaxIPFailures = *req.MaxIPFailures
+	}
+	if req.MaxUserFailures != nil {
+		endpoint.MaxUserFailures = *req.MaxUserFailures
+	}
+	if req.MaxUsernamesPerIP != nil {
+		endpoint.MaxUsernamesPerIP = *req.MaxUsernamesPerIP
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if err := s.validateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(endpoint).Error; err != nil {
+		return nil, fmt.Errorf("创建登录接口失败: %v", err)
+	}
+	// 阈值和启用字段有默认值，显式设置0或false时需要单独更新
+	defaultUpdates := map[string]interface{}{}
+	for column, value := range map[string]int{
+		"delay_after":          endpoint.DelayAfter,
+		"challenge_after":      endpoint.ChallengeAfter,
+		"max_user_ip_failures": endpoint.MaxUserIPFailures,
+		"max_ip_failures":      endpoint.MaxIPFailures,
+		"max_user_failures":    endpoint.MaxUserFailures,
+		"max_usernames_per_ip": endpoint.MaxUsernamesPerIP,
+	} {
+		if value == 0 {
+			defaultUpdates[column] = 0
+		}
+	}
+	if !endpoint.Enabled {
+		defaultUpdates["enabled"] = false
+	}
+	if len(defaultUpdates) > 0 {
+		if err := s.db.Model(endpoint).Updates(defaultUpdates).Error; err != nil {
+			return nil, fmt.Errorf("创建登录接口失败: %v", err)
+		}
+	}
+	s.domainService.ResetWAFProtection(endpoint.DomainID)
+	return endpoint, nil
+}
+
+// UpdateLoginEndpoint 更新登录接口
+func (s *LoginEndpointService) UpdateLoginEndpoint(domainID, endpointID uint, req *UpdateLoginEndpointRequest) (*models.LoginEndpoint, error) {
+	endpoint, err := s.getEndpoint(domainID, endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		endpoint.Name = *req.Name
+	}
+	if req.Path != nil {
+		endpoint.Path = *req.Path
+	}
+	if req.Method != nil {
+		endpoint.Method = strings.ToUpper(*req.Method)
+	}
+	if req.UsernameField != nil {
+		endpoint.UsernameField = *req.UsernameField
+	}
+	if req.FailureStatusCodes != nil {
+		endpoint.FailureStatusCodes = *req.FailureStatusCodes
+	}
+	if req.FailureBodyPattern != nil {
+		endpoint.FailureBodyPattern = *req.FailureBodyPattern
+	}
+	if req.FailureWindow != nil && *req.FailureWindow > 0 {
+		endpoint.FailureWindow = *req.FailureWindow
+	}
+	if req.DelayAfter != nil {
+		endpoint.DelayAfter = *req.DelayAfter
+	}
+	if req.DelayMs != nil {
+		endpoint.DelayMs = *req.DelayMs
+	}
+	if req.MaxDelayMs != nil {
+		endpoint.MaxDelayMs = *req.MaxDelayMs
+	}
+	if req.ChallengeAfter != nil {
+		endpoint.ChallengeAfter = *req.ChallengeAfter
+	}
+	if req.MaxUserIPFailures != nil {
+		endpoint.MaxUserIPFailures = *req.MaxUserIPFailures
+	}
+	if req.MaxIPFailures != nil {
+		endpoint.MaxIPFailures = *req.MaxIPFailures
+	}
+	if req.MaxUserFailures != nil {
+		endpoint.MaxUserFailures = *req.MaxUserFailures
+	}
+	if req.MaxUsernamesPerIP != nil {
+		endpoint.MaxUsernamesPerIP = *req.MaxUsernamesPerIP
+	}
+	if req.MaskUsername != nil {
+		endpoint.MaskUsername = *req.MaskUsername
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if err := s.validateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(endpoint).Error; err != nil {
+		return nil, fmt.Errorf("更新登录接口失败: %v", err)
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return endpoint, nil
+}
+
+// DeleteLoginEndpoint 删除登录接口，Redis中的失败计数在统计窗口结束后自动过期
+func (s *LoginEndpointService) DeleteLoginEndpoint(domainID, endpointID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", endpointID, domainID).Delete(&models.LoginEndpoint{})
+	if result.Error != nil {
+		return fmt.Errorf("删除登录接口失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("登录接口不存在")
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return nil
+}
+
+// ResetLoginFailures 清除登录接口的失败计数，用于解除被误拦截的用户或IP
+func (s *LoginEndpointService) ResetLoginFailures(domainID, endpointID uint, req *ResetLoginFailuresRequest) error {
+	if req.Username == "" && req.IP == "" {
+		return fmt.Errorf("用户名和IP至少指定一个")
+	}
+	endpoint, err := s.getEndpoint(domainID, endpointID)
+	if err != nil {
+		return err
+	}
+	if err := s.wafEngine.ResetLoginFailures(endpoint, req.Username, req.IP); err != nil {
+		return fmt.Errorf("清除登录失败计数失败: %v", err)
+	}
+	return nil
+}
+
+// getEndpoint 获取域名下的登录接口
+func (s *LoginEndpointService) getEndpoint(domainID, endpointID uint) (*models.LoginEndpoint, error) {
+	var endpoint models.LoginEndpoint
+	if err := s.db.Where("id = ? AND domain_id = ?", endpointID, domainID).First(&endpoint).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("登录接口不存在")
+		}
+		return nil, fmt.Errorf("获取登录接口失败: %v", err)
+	}
+	return &endpoint, nil
+}
+
+// validateEndpoint 校验登录接口配置，同一域名下路径和方法不能重复
+func (s *LoginEndpointService) validateEndpoint(endpoint *models.LoginEndpoint) error {
+	if err := waf.ValidateLoginEndpoint(endpoint); err != nil {
+		return fmt.Errorf("登录接口配置无效: %v", err)
+	}
+	if endpoint.MaxDelayMs < endpoint.DelayMs {
+		return fmt.Errorf("登录接口配置无效: max_delay_ms不能小于delay_ms")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.LoginEndpoint{}).
+		Where("domain_id = ? AND path = ? AND method = ? AND id <> ?", endpoint.DomainID, endpoint.Path, endpoint.Method, endpoint.ID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("检查登录接口失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("登录接口已存在")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"waf-go/internal/models"
+	"waf-go/internal/modsec"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// ModSecImportService ModSecurity规则导入服务，将SecLang规则转换为规则，
+// 放入新建的策略，ctl:ruleRemove*等转换为该策略的规则排除
+type ModSecImportService struct {
+	db        *gorm.DB
+	wafEngine *waf.WAFEngine
+}
+
+func NewModSecImportService(db *gorm.DB, wafEngine *waf.WAFEngine) *ModSecImportService {
+	return &ModSecImportService{
+		db:        db,
+		wafEngine: wafEngine,
+	}
+}
+
+// ModSecImportRequest 导入ModSecurity规则请求
+type ModSecImportRequest struct {
+	Content     string `json:"content" binding:"required"` // SecLang规则文本
+	PolicyName  string `json:"policy_name"`                // 新建策略名称，预览时不需要
+	Description string `json:"description"`                // 策略描述
+	Overwrite   bool   `json:"overwrite"`                  // 同名规则（modsec-<id>）已存在时覆盖，否则跳过
+	DryRun      bool   `json:"dry_run"`                    // 只转换并返回报告，不写入数据库
+	TenantID    uint   `json:"tenant_id"`
+}
+
+// ModSecImportResult 导入结果
+type ModSecImportResult struct {
+	Policy     *models.Policy               `json:"policy,omitempty"` // 新建的策略，预览时为空
+	Rules      []modsec.TranslatedRule      `json:"rules"`            // 导入的规则
+	Exclusions []modsec.TranslatedExclusion `json:"exclusions"`       // 导入的规则排除
+	Report     modsec.Report                `json:"report"`           // 转换报告
+}
+
+// ImportRules 转换并导入ModSecurity规则。规则按文件顺序设置策略内优先级，
+// 被跳过的同名规则和引用未导入规则的排除记录在报告中
+func (s *ModSecImportService) ImportRules(req *ModSecImportRequest) (*ModSecImportResult, error) {
+	translation := modsec.Translate(req.Content)
+	result := &ModSecImportResult{
+		Rules:      translation.Rules,
+		Exclusions: translation.Exclusions,
+		Report:     translation.Report,
+	}
+	for i := range result.Rules {
+		result.Rules[i].Rule.TenantID = req.TenantID
+	}
+	for i := range result.Exclusions {
+		result.Exclusions[i].Exclusion.TenantID = req.TenantID
+	}
+	if req.DryRun {
+		return result, nil
+	}
+
+	if req.PolicyName == "" {
+		return nil, fmt.Errorf("策略名称不能为空")
+	}
+	if len(result.Rules) == 0 && len(result.Exclusions) == 0 {
+		return nil, fmt.Errorf("没有可导入的规则")
+	}
+	description := req.Description
+	if description == "" {
+		description = "从ModSecurity规则导入"
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		policy := &models.Policy{
+			Name:        req.PolicyName,
+			Description: description,
+			Enabled:     true,
+			TenantID:    req.TenantID,
+		}
+		if err := tx.Create(policy).Error; err != nil {
+			return fmt.Errorf("创建策略失败: %v", err)
+		}
+		result.Policy = policy
+
+		rules, ruleIDs, err := s.importRules(tx, policy.ID, req, result)
+		if err != nil {
+			return err
+		}
+		exclusions, err := s.importExclusions(tx, policy.ID, req.TenantID, ruleIDs, result)
+		if err != nil {
+			return err
+		}
+		result.Rules, result.Exclusions = rules, exclusions
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Report.Rules = len(result.Rules)
+	result.Report.Exclusions = len(result.Exclusions)
+
+	// 通知WAF引擎重新加载规则
+	s.wafEngine.LoadRules()
+
+	return result, nil
+}
+
+// importRules 创建或覆盖规则并加入策略，返回导入的规则和ModSecurity规则ID到规则ID的映射
+func (s *ModSecImportService) importRules(tx *gorm.DB, policyID uint, req *ModSecImportRequest, result *ModSecImportResult) ([]modsec.TranslatedRule, map[int]uint, error) {
+	imported := make([]modsec.TranslatedRule, 0, len(result.Rules))
+	ruleIDs := make(map[int]uint)
+
+	for i, translated := range result.Rules {
+		rule := translated.Rule
+		var existing models.Rule
+		err := tx.Where("name = ? AND tenant_id = ?", rule.Name, req.TenantID).First(&existing).Error
+		switch {
+		case err == nil && !req.Overwrite:
+			ruleIDs[translated.ModSecID] = existing.ID
+			result.Report.Untranslated = append(result.Report.Untranslated, modsec.ReportEntry{
+				Line:   translated.Line,
+				RuleID: translated.ModSecID,
+				Reason: fmt.Sprintf("rule %s already exists, skipped", rule.Name),
+			})
+			continue
+		case err == nil:
+			rule.ID, rule.CreatedAt = existing.ID, existing.CreatedAt
+			if err := tx.Save(&rule).Error; err != nil {
+				return nil, nil, fmt.Errorf("更新规则%s失败: %v", rule.Name, err)
+			}
+		case err == gorm.ErrRecordNotFound:
+			if err := tx.Create(&rule).Error; err != nil {
+				return nil, nil, fmt.Errorf("创建规则%s失败: %v", rule.Name, err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("获取规则失败: %v", err)
+		}
+
+		// 策略内按文件顺序执行，越靠前优先级越高
+		policyRule := &models.PolicyRule{
+			PolicyID: policyID,
+			RuleID:   rule.ID,
+			Priority: len(result.Rules) - i,
+			Enabled:  true,
+		}
+		if err := tx.Create(policyRule).Error; err != nil {
+			return nil, nil, fmt.Errorf("创建策略规则关联失败: %v", err)
+		}
+
+		translated.Rule = rule
+		imported = append(imported, translated)
+		ruleIDs[translated.ModSecID] = rule.ID
+	}
+	return imported, ruleIDs, nil
+}
+
+// importExclusions 创建策略级规则排除，按ID跳过的规则须已导入或已存在
+func (s *ModSecImportService) importExclusions(tx *gorm.DB, policyID, tenantID uint, ruleIDs map[int]uint, result *ModSecImportResult) ([]modsec.TranslatedExclusion, error) {
+	imported := make([]modsec.TranslatedExclusion, 0, len(result.Exclusions))
+
+	for _, translated := range result.Exclusions {
+		exclusion := translated.Exclusion
+		exclusion.PolicyID = policyID
+		if translated.ModSecRuleID != 0 {
+			ruleID, ok := ruleIDs[translated.ModSecRuleID]
+			if !ok {
+				var rule models.Rule
+				err := tx.Where("name = ? AND tenant_id IN ?", modsec.RuleName(translated.ModSecRuleID), []uint{0, tenantID}).
+					Order("tenant_id DESC").First(&rule).Error
+				if err == gorm.ErrRecordNotFound {
+					result.Report.Untranslated = append(result.Report.Untranslated, modsec.ReportEntry{
+						Line:      translated.Line,
+						RuleID:    translated.ModSecRuleID,
+						Directive: exclusion.Comment,
+						Reason:    fmt.Sprintf("referenced rule %d was not imported", translated.ModSecRuleID),
+					})
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("获取规则失败: %v", err)
+				}
+				ruleID = rule.ID
+			}
+			exclusion.RuleID = ruleID
+		}
+
+		if err := tx.Create(&exclusion).Error; err != nil {
+			return nil, fmt.Errorf("创建规则排除失败: %v", err)
+		}
+		translated.Exclusion = exclusion
+		imported = append(imported, translated)
+	}
+	return imported, nil
+}
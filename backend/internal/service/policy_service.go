@@ -20,6 +20,7 @@ type CreatePolicyRequest struct {
 	DomainID    *uint  `json:"domain_id"`
 	RuleIDs     []uint `json:"rule_ids"`
 	Enabled     bool   `json:"enabled"`
+	Mode        string `json:"mode" binding:"omitempty,oneof=enforce detect_only off"` // 防护模式，默认enforce
 	TenantID    uint   `json:"tenant_id"`
 }
 
@@ -29,6 +30,7 @@ type UpdatePolicyRequest struct {
 	DomainID    *uint  `json:"domain_id"`
 	RuleIDs     []uint `json:"rule_ids"`
 	Enabled     *bool  `json:"enabled"`
+	Mode        string `json:"mode" binding:"omitempty,oneof=enforce detect_only off"`
 }
 
 type PolicyListRequest struct {
@@ -54,6 +56,7 @@ type PolicyResponse struct {
 	DomainID    *uint     `json:"domain_id,omitempty"`
 	RuleIDs     []uint    `json:"rule_ids"`
 	Enabled     bool      `json:"enabled"`
+	Mode        string    `json:"mode"`
 	TenantID    uint      `json:"tenant_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -94,6 +97,7 @@ func (s *PolicyService) convertToResponse(policy *models.Policy) (*PolicyRespons
 		Description: policy.Description,
 		RuleIDs:     ruleIDs,
 		Enabled:     policy.Enabled,
+		Mode:        policy.Mode,
 		TenantID:    policy.TenantID,
 		CreatedAt:   policy.CreatedAt,
 		UpdatedAt:   policy.UpdatedAt,
@@ -131,6 +135,7 @@ func (s *PolicyService) CreatePolicy(req *CreatePolicyRequest) (*PolicyResponse,
 			Name:        req.Name,
 			Description: req.Description,
 			Enabled:     req.Enabled,
+			Mode:        req.Mode,
 			TenantID:    req.TenantID,
 		}
 
@@ -278,6 +283,7 @@ func (s *PolicyService) GetPolicyWithRules(id uint) (*PolicyWithRules, error) {
 		Description: policy.Description,
 		RuleIDs:     []uint{}, // 将在下面填充
 		Enabled:     policy.Enabled,
+		Mode:        policy.Mode,
 		TenantID:    policy.TenantID,
 		CreatedAt:   policy.CreatedAt,
 		UpdatedAt:   policy.UpdatedAt,
@@ -323,6 +329,9 @@ func (s *PolicyService) UpdatePolicy(id uint, req *UpdatePolicyRequest) (*Policy
 		if req.Enabled != nil {
 			updates["enabled"] = *req.Enabled
 		}
+		if req.Mode != "" {
+			updates["mode"] = req.Mode
+		}
 
 		if len(updates) > 0 {
 			err = tx.Model(&policy).Updates(updates).Error
@@ -400,6 +409,11 @@ func (s *PolicyService) DeletePolicy(id uint) error {
 			return err
 		}
 
+		// 删除策略级规则排除
+		if err := tx.Where("policy_id = ?", id).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return err
+		}
+
 		// 删除策略
 		return tx.Delete(&models.Policy{}, id).Error
 	})
@@ -457,6 +471,11 @@ func (s *PolicyService) BatchDeletePolicies(ids []uint) error {
 			return err
 		}
 
+		// 删除策略级规则排除
+		if err := tx.Where("policy_id IN ?", ids).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return err
+		}
+
 		// 删除策略
 		return tx.Where("id IN ?", ids).Delete(&models.Policy{}).Error
 	})
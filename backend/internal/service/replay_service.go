@@ -0,0 +1,224 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"waf-go/internal/models"
+	"waf-go/internal/replay"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReplayLimit  = 10000 // 默认回放的最大请求数
+	maxReplayHitSamples = 20    // 每条规则保留的命中请求数
+)
+
+// ReplayService 流量回放服务，将历史访问日志或HAR文件中的请求交给WAF引擎试运行，
+// 统计指定策略下的拦截结果和规则命中，用于上线策略变更前评估影响
+type ReplayService struct {
+	db        *gorm.DB
+	wafEngine *waf.WAFEngine
+}
+
+func NewReplayService(db *gorm.DB, wafEngine *waf.WAFEngine) *ReplayService {
+	return &ReplayService{
+		db:        db,
+		wafEngine: wafEngine,
+	}
+}
+
+// ReplayRequest 流量回放请求
+type ReplayRequest struct {
+	Content   string `json:"content" binding:"required"`                              // 日志内容
+	Format    string `json:"format" binding:"omitempty,oneof=auto combined json har"` // 日志格式，默认自动识别
+	DomainID  uint   `json:"domain_id" binding:"required"`                            // 回放到的域名，所有请求的Host替换为该域名
+	PolicyIDs []uint `json:"policy_ids"`                                              // 使用的策略，为空时使用域名当前关联的策略
+	Limit     int    `json:"limit" binding:"omitempty,min=1,max=100000"`              // 回放的最大请求数，默认10000
+}
+
+// ReplayReport 流量回放结果
+type ReplayReport struct {
+	Format      string              `json:"format"`
+	Domain      string              `json:"domain"`
+	DomainID    uint                `json:"domain_id"`
+	PolicyIDs   []uint              `json:"policy_ids"`
+	Total       int                 `json:"total"`        // 回放的请求数
+	Allowed     int                 `json:"allowed"`      // 放行的请求数
+	Blocked     int                 `json:"blocked"`      // 拦截的请求数
+	WouldBlock  int                 `json:"would_block"`  // 检测模式下本应拦截的请求数
+	Challenged  int                 `json:"challenged"`   // 登录防护要求质询的请求数
+	Logged      int                 `json:"logged"`       // 只记录的请求数
+	Failed      int                 `json:"failed"`       // 无法构造请求的条目数
+	Skipped     int                 `json:"skipped"`      // 无法解析的日志行数
+	Truncated   bool                `json:"truncated"`    // 请求数超过限制，超出部分未回放
+	ParseErrors []replay.ParseError `json:"parse_errors"` // 无法解析的日志行和无法构造的请求，最多保留50条
+	Rules       []ReplayRuleHits    `json:"rules"`        // 按命中数降序的规则命中
+}
+
+// ReplayRuleHits 一条规则的命中统计。黑名单、速率限制、协议校验、GraphQL、文件上传和OpenAPI检查的规则ID为0
+type ReplayRuleHits struct {
+	RuleID   uint        `json:"rule_id"`
+	Name     string      `json:"name"`
+	Hits     int         `json:"hits"`     // 命中的请求数，包括被其他规则决定结果的请求
+	Blocks   int         `json:"blocks"`   // 由该规则拦截（含would_block）的请求数
+	Requests []ReplayHit `json:"requests"` // 命中的请求，最多保留maxReplayHitSamples条
+}
+
+// ReplayHit 命中规则的请求
+type ReplayHit struct {
+	Line       int    `json:"line"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	ClientIP   string `json:"client_ip"`
+	Status     int    `json:"status,omitempty"` // 日志记录的原响应状态码
+	Action     string `json:"action"`           // 回放得到的动作
+	MatchValue string `json:"match_value"`
+}
+
+// Replay 解析日志并逐条试运行，试运行不计入速率限制、学习会话和影子策略，不记录攻击日志
+func (s *ReplayService) Replay(req *ReplayRequest) (*ReplayReport, error) {
+	var domain models.Domain
+	if err := s.db.First(&domain, req.DomainID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("域名不存在")
+		}
+		return nil, fmt.Errorf("获取域名失败: %v", err)
+	}
+	if !domain.Enabled {
+		return nil, fmt.Errorf("域名未启用")
+	}
+
+	var policyIDs []uint
+	if len(req.PolicyIDs) > 0 {
+		policyIDs = uniqueIDs(req.PolicyIDs)
+		var count int64
+		if err := s.db.Model(&models.Policy{}).Where("id IN ?", policyIDs).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("获取策略失败: %v", err)
+		}
+		if int(count) != len(policyIDs) {
+			return nil, fmt.Errorf("策略不存在")
+		}
+	}
+
+	parsed, err := replay.Parse(req.Content, req.Format)
+	if err != nil {
+		return nil, fmt.Errorf("解析日志失败: %v", err)
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultReplayLimit
+	}
+	entries := parsed.Entries
+	report := &ReplayReport{
+		Format:      parsed.Format,
+		Domain:      domain.Domain,
+		DomainID:    domain.ID,
+		PolicyIDs:   policyIDs,
+		Skipped:     parsed.Skipped,
+		ParseErrors: parsed.Errors,
+		Rules:       []ReplayRuleHits{},
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		report.Truncated = true
+	}
+
+	rules := make(map[string]*ReplayRuleHits)
+	for _, entry := range entries {
+		// 回放到指定域名，忽略日志中的Host
+		entry.Request.Host = domain.Domain
+		trace, err := s.wafEngine.EvaluateWithPolicies(&entry.Request, policyIDs)
+		if err != nil {
+			report.Failed++
+			if len(report.ParseErrors) < replay.MaxErrors {
+				report.ParseErrors = append(report.ParseErrors, replay.ParseError{Line: entry.Line, Message: err.Error()})
+			}
+			continue
+		}
+		report.Total++
+		report.record(rules, entry, trace)
+	}
+
+	for _, hits := range rules {
+		report.Rules = append(report.Rules, *hits)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Hits != report.Rules[j].Hits {
+			return report.Rules[i].Hits > report.Rules[j].Hits
+		}
+		return report.Rules[i].Name < report.Rules[j].Name
+	})
+	return report, nil
+}
+
+// record 累加一条请求的回放结果
+func (r *ReplayReport) record(rules map[string]*ReplayRuleHits, entry replay.Entry, trace *waf.DecisionTrace) {
+	result := trace.Result
+	switch result.Action {
+	case "block":
+		r.Blocked++
+	case waf.ActionWouldBlock:
+		r.WouldBlock++
+	case waf.ActionChallenge:
+		r.Challenged++
+	case "log":
+		r.Logged++
+	default:
+		r.Allowed++
+	}
+
+	hit := func(ruleID uint, name, matchValue string, decided bool) {
+		key := fmt.Sprintf("%d|%s", ruleID, name)
+		if ruleID != 0 {
+			key = fmt.Sprintf("%d", ruleID)
+		}
+		hits, ok := rules[key]
+		if !ok {
+			hits = &ReplayRuleHits{RuleID: ruleID, Name: name, Requests: []ReplayHit{}}
+			rules[key] = hits
+		}
+		hits.Hits++
+		if decided {
+			hits.Blocks++
+		}
+		if len(hits.Requests) < maxReplayHitSamples {
+			hits.Requests = append(hits.Requests, ReplayHit{
+				Line:       entry.Line,
+				Method:     entry.Request.Method,
+				URL:        entry.Request.URL,
+				ClientIP:   entry.Request.ClientIP,
+				Status:     entry.Status,
+				Action:     result.Action,
+				MatchValue: matchValue,
+			})
+		}
+	}
+
+	blocked := result.Action == "block" || result.Action == waf.ActionWouldBlock || result.Action == waf.ActionChallenge
+	for _, rule := range trace.Rules {
+		if rule.Matched {
+			decided := blocked && result.MatchedRule != nil && result.MatchedRule.ID == rule.RuleID
+			hit(rule.RuleID, rule.Name, rule.MatchValue, decided)
+		}
+	}
+	// 黑名单、速率限制、协议校验、GraphQL、文件上传和OpenAPI检查的命中没有规则ID
+	if result.MatchedRule != nil && result.MatchedRule.ID == 0 {
+		hit(0, result.MatchedRule.Name, result.MatchedRule.MatchValue, blocked)
+	}
+}
+
+// uniqueIDs 去掉重复的ID
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
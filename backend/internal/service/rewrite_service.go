@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"waf-go/internal/models"
+	"waf-go/internal/proxy"
+
+	"gorm.io/gorm"
+)
+
+// RewriteService 重写规则服务，管理代理转发时的请求/响应头修改、URL重写和重定向
+type RewriteService struct {
+	db            *gorm.DB
+	domainService *DomainService
+}
+
+func NewRewriteService(db *gorm.DB, domainService *DomainService) *RewriteService {
+	return &RewriteService{
+		db:            db,
+		domainService: domainService,
+	}
+}
+
+// CreateRewriteRuleRequest 创建重写规则请求
+type CreateRewriteRuleRequest struct {
+	Name       string `json:"name"`
+	Location   string `json:"location"`
+	Type       string `json:"type" binding:"required,oneof=request_header_add request_header_set request_header_remove response_header_add response_header_set response_header_remove url_rewrite redirect"`
+	HeaderName string `json:"header_name"`
+	Pattern    string `json:"pattern"`
+	Value      string `json:"value"`
+	StatusCode int    `json:"status_code" binding:"omitempty,oneof=301 302 303 307 308"`
+	Priority   int    `json:"priority"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+// UpdateRewriteRuleRequest 更新重写规则请求
+type UpdateRewriteRuleRequest struct {
+	Name       *string `json:"name"`
+	Location   *string `json:"location"`
+	Type       string  `json:"type" binding:"omitempty,oneof=request_header_add request_header_set request_header_remove response_header_add response_header_set response_header_remove url_rewrite redirect"`
+	HeaderName *string `json:"header_name"`
+	Pattern    *string `json:"pattern"`
+	Value      *string `json:"value"`
+	StatusCode *int    `json:"status_code" binding:"omitempty,oneof=0 301 302 303 307 308"`
+	Priority   *int    `json:"priority"`
+	Enabled    *bool   `json:"enabled"`
+}
+
+// GetRewriteRules 获取域名的重写规则，按优先级排序
+func (s *RewriteService) GetRewriteRules(domainID uint) ([]models.RewriteRule, error) {
+	var rules []models.RewriteRule
+	if err := s.db.Where("domain_id = ?", domainID).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("获取重写规则失败: %v", err)
+	}
+	return rules, nil
+}
+
+// CreateRewriteRule 创建重写规则并立即生效
+func (s *RewriteService) CreateRewriteRule(domainID uint, req *CreateRewriteRuleRequest) (*models.RewriteRule, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &models.RewriteRule{
+		DomainID:   domain.ID,
+		Name:       req.Name,
+		Location:   req.Location,
+		Type:       req.Type,
+		HeaderName: req.HeaderName,
+		Pattern:    req.Pattern,
+		Value:      req.Value,
+		StatusCode: req.StatusCode,
+		Priority:   req.Priority,
+		Enabled:    true,
+		TenantID:   domain.TenantID,
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := proxy.ValidateRewriteRule(*rule); err != nil {
+		return nil, fmt.Errorf("重写规则无效: %v", err)
+	}
+
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, fmt.Errorf("创建重写规则失败: %v", err)
+	}
+
+	if err := s.domainService.updateProxy(domain); err != nil {
+		return nil, fmt.Errorf("更新代理配置失败: %v", err)
+	}
+	return rule, nil
+}
+
+// UpdateRewriteRule 更新重写规则并立即生效
+func (s *RewriteService) UpdateRewriteRule(domainID, ruleID uint, req *UpdateRewriteRuleRequest) (*models.RewriteRule, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule models.RewriteRule
+	if err := s.db.Where("id = ? AND domain_id = ?", ruleID, domainID).First(&rule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("重写规则不存在")
+		}
+		return nil, fmt.Errorf("获取重写规则失败: %v", err)
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Location != nil {
+		rule.Location = *req.Location
+	}
+	if req.Type != "" {
+		rule.Type = req.Type
+	}
+	if req.HeaderName != nil {
+		rule.HeaderName = *req.HeaderName
+	}
+	if req.Pattern != nil {
+		rule.Pattern = *req.Pattern
+	}
+	if req.Value != nil {
+		rule.Value = *req.Value
+	}
+	if req.StatusCode != nil {
+		rule.StatusCode = *req.StatusCode
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := proxy.ValidateRewriteRule(rule); err != nil {
+		return nil, fmt.Errorf("重写规则无效: %v", err)
+	}
+
+	if err := s.db.Save(&rule).Error; err != nil {
+		return nil, fmt.Errorf("更新重写规则失败: %v", err)
+	}
+
+	if err := s.domainService.updateProxy(domain); err != nil {
+		return nil, fmt.Errorf("更新代理配置失败: %v", err)
+	}
+	return &rule, nil
+}
+
+// DeleteRewriteRule 删除重写规则并立即生效
+func (s *RewriteService) DeleteRewriteRule(domainID, ruleID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", ruleID, domainID).Delete(&models.RewriteRule{})
+	if result.Error != nil {
+		return fmt.Errorf("删除重写规则失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("重写规则不存在")
+	}
+
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return err
+	}
+	return s.domainService.updateProxy(domain)
+}
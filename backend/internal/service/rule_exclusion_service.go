@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// RuleExclusionService 规则排除服务，管理域名级和策略级的规则排除。
+// 排除在路径匹配时跳过指定规则或带有指定标签的规则，可只排除某个检查目标
+type RuleExclusionService struct {
+	db            *gorm.DB
+	domainService *DomainService
+}
+
+func NewRuleExclusionService(db *gorm.DB, domainService *DomainService) *RuleExclusionService {
+	return &RuleExclusionService{
+		db:            db,
+		domainService: domainService,
+	}
+}
+
+// CreateRuleExclusionRequest 创建规则排除请求
+type CreateRuleExclusionRequest struct {
+	Name      string `json:"name"`
+	RuleID    uint   `json:"rule_id"`
+	RuleTag   string `json:"rule_tag"`
+	Target    string `json:"target"`
+	PathMatch string `json:"path_match" binding:"omitempty,oneof=exact prefix regex"`
+	Path      string `json:"path"`
+	Comment   string `json:"comment"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+// UpdateRuleExclusionRequest 更新规则排除请求
+type UpdateRuleExclusionRequest struct {
+	Name      *string `json:"name"`
+	RuleID    *uint   `json:"rule_id"`
+	RuleTag   *string `json:"rule_tag"`
+	Target    *string `json:"target"`
+	PathMatch string  `json:"path_match" binding:"omitempty,oneof=exact prefix regex"`
+	Path      *string `json:"path"`
+	Comment   *string `json:"comment"`
+	Enabled   *bool   `json:"enabled"`
+}
+
+// GetDomainRuleExclusions 获取域名级规则排除
+func (s *RuleExclusionService) GetDomainRuleExclusions(domainID uint) ([]models.RuleExclusion, error) {
+	return s.getExclusions("domain_id", domainID)
+}
+
+// GetPolicyRuleExclusions 获取策略级规则排除
+func (s *RuleExclusionService) GetPolicyRuleExclusions(policyID uint) ([]models.RuleExclusion, error) {
+	return s.getExclusions("policy_id", policyID)
+}
+
+// CreateDomainRuleExclusion 创建域名级规则排除
+func (s *RuleExclusionService) CreateDomainRuleExclusion(domainID uint, req *CreateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+	return s.createExclusion(&models.RuleExclusion{DomainID: domain.ID, TenantID: domain.TenantID}, req)
+}
+
+// CreatePolicyRuleExclusion 创建策略级规则排除，作用于使用该策略的所有域名
+func (s *RuleExclusionService) CreatePolicyRuleExclusion(policyID uint, req *CreateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	var policy models.Policy
+	if err := s.db.First(&policy, policyID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("策略不存在")
+		}
+		return nil, fmt.Errorf("获取策略失败: %v", err)
+	}
+	return s.createExclusion(&models.RuleExclusion{PolicyID: policy.ID, TenantID: policy.TenantID}, req)
+}
+
+// UpdateDomainRuleExclusion 更新域名级规则排除
+func (s *RuleExclusionService) UpdateDomainRuleExclusion(domainID, exclusionID uint, req *UpdateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	return s.updateExclusion("domain_id", domainID, exclusionID, req)
+}
+
+// UpdatePolicyRuleExclusion 更新策略级规则排除
+func (s *RuleExclusionService) UpdatePolicyRuleExclusion(policyID, exclusionID uint, req *UpdateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	return s.updateExclusion("policy_id", policyID, exclusionID, req)
+}
+
+// DeleteDomainRuleExclusion 删除域名级规则排除
+func (s *RuleExclusionService) DeleteDomainRuleExclusion(domainID, exclusionID uint) error {
+	return s.deleteExclusion("domain_id", domainID, exclusionID)
+}
+
+// DeletePolicyRuleExclusion 删除策略级规则排除
+func (s *RuleExclusionService) DeletePolicyRuleExclusion(policyID, exclusionID uint) error {
+	return s.deleteExclusion("policy_id", policyID, exclusionID)
+}
+
+// getExclusions 按域名或策略获取规则排除
+func (s *RuleExclusionService) getExclusions(column string, ownerID uint) ([]models.RuleExclusion, error) {
+	var exclusions []models.RuleExclusion
+	if err := s.db.Where(column+" = ?", ownerID).Order("id ASC").Find(&exclusions).Error; err != nil {
+		return nil, fmt.Errorf("获取规则排除失败: %v", err)
+	}
+	return exclusions, nil
+}
+
+// createExclusion 填充请求字段并创建规则排除
+func (s *RuleExclusionService) createExclusion(exclusion *models.RuleExclusion, req *CreateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	exclusion.Name = req.Name
+	exclusion.RuleID = req.RuleID
+	exclusion.RuleTag = strings.ToLower(strings.TrimSpace(req.RuleTag))
+	exclusion.Target = strings.TrimSpace(req.Target)
+	exclusion.PathMatch = req.PathMatch
+	exclusion.Path = req.Path
+	exclusion.Source = "manual"
+	exclusion.Comment = req.Comment
+	exclusion.Enabled = true
+	if exclusion.PathMatch == "" {
+		exclusion.PathMatch = "prefix"
+	}
+	if req.Enabled != nil {
+		exclusion.Enabled = *req.Enabled
+	}
+	if err := s.validateExclusion(exclusion); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(exclusion).Error; err != nil {
+		return nil, fmt.Errorf("创建规则排除失败: %v", err)
+	}
+	// enabled字段有默认值，显式设置false时需要单独更新
+	if !exclusion.Enabled {
+		if err := s.db.Model(exclusion).Update("enabled", false).Error; err != nil {
+			return nil, fmt.Errorf("创建规则排除失败: %v", err)
+		}
+	}
+	return exclusion, nil
+}
+
+// updateExclusion 更新域名或策略下的规则排除
+func (s *RuleExclusionService) updateExclusion(column string, ownerID, exclusionID uint, req *UpdateRuleExclusionRequest) (*models.RuleExclusion, error) {
+	var exclusion models.RuleExclusion
+	if err := s.db.Where("id = ? AND "+column+" = ?", exclusionID, ownerID).First(&exclusion).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("规则排除不存在")
+		}
+		return nil, fmt.Errorf("获取规则排除失败: %v", err)
+	}
+
+	if req.Name != nil {
+		exclusion.Name = *req.Name
+	}
+	if req.RuleID != nil {
+		exclusion.RuleID = *req.RuleID
+	}
+	if req.RuleTag != nil {
+		exclusion.RuleTag = strings.ToLower(strings.TrimSpace(*req.RuleTag))
+	}
+	if req.Target != nil {
+		exclusion.Target = strings.TrimSpace(*req.Target)
+	}
+	if req.PathMatch != "" {
+		exclusion.PathMatch = req.PathMatch
+	}
+	if req.Path != nil {
+		exclusion.Path = *req.Path
+	}
+	if req.Comment != nil {
+		exclusion.Comment = *req.Comment
+	}
+	if req.Enabled != nil {
+		exclusion.Enabled = *req.Enabled
+	}
+	if err := s.validateExclusion(&exclusion); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&exclusion).Error; err != nil {
+		return nil, fmt.Errorf("更新规则排除失败: %v", err)
+	}
+	return &exclusion, nil
+}
+
+// deleteExclusion 删除域名或策略下的规则排除
+func (s *RuleExclusionService) deleteExclusion(column string, ownerID, exclusionID uint) error {
+	result := s.db.Where("id = ? AND "+column+" = ?", exclusionID, ownerID).Delete(&models.RuleExclusion{})
+	if result.Error != nil {
+		return fmt.Errorf("删除规则排除失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("规则排除不存在")
+	}
+	return nil
+}
+
+// validateExclusion 校验规则排除：规则ID和规则标签二选一，规则须为本租户或全局规则，
+// 检查目标和路径正则须有效
+func (s *RuleExclusionService) validateExclusion(exclusion *models.RuleExclusion) error {
+	switch {
+	case exclusion.RuleID == 0 && exclusion.RuleTag == "":
+		return fmt.Errorf("请指定规则ID或规则标签")
+	case exclusion.RuleID != 0 && exclusion.RuleTag != "":
+		return fmt.Errorf("规则ID和规则标签只能指定一个")
+	}
+
+	if exclusion.RuleID != 0 {
+		var rule models.Rule
+		if err := s.db.First(&rule, exclusion.RuleID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("规则不存在")
+			}
+			return fmt.Errorf("获取规则失败: %v", err)
+		}
+		if rule.TenantID != 0 && rule.TenantID != exclusion.TenantID {
+			return fmt.Errorf("规则不属于当前租户")
+		}
+	}
+
+	if !waf.ValidExclusionTarget(exclusion.Target) {
+		return fmt.Errorf("无效的排除目标: %s，支持规则匹配类型、body:参数名 和 header:名称", exclusion.Target)
+	}
+	if exclusion.PathMatch == "regex" {
+		if _, err := waf.CompileRegex(exclusion.Path); err != nil {
+			return fmt.Errorf("无效的路径正则表达式: %v", err)
+		}
+	} else if exclusion.Path != "" && !strings.HasPrefix(exclusion.Path, "/") {
+		return fmt.Errorf("排除路径必须以/开头")
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"waf-go/internal/models"
 	"waf-go/internal/waf"
 
@@ -22,27 +24,33 @@ func NewRuleService(db *gorm.DB, wafEngine *waf.WAFEngine) *RuleService {
 
 // CreateRuleRequest 创建规则请求
 type CreateRuleRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	MatchType   string `json:"match_type" binding:"required,oneof=uri ip header body user_agent"`
-	Pattern     string `json:"pattern" binding:"required"`
-	MatchMode   string `json:"match_mode" binding:"required,oneof=exact regex contains"`
-	Action      string `json:"action" binding:"required,oneof=block log allow"`
-	Priority    int    `json:"priority" binding:"required,min=1,max=1000"`
-	Enabled     bool   `json:"enabled"`
-	TenantID    uint   `json:"tenant_id"`
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	MatchType   string             `json:"match_type" binding:"required,oneof=uri ip header body user_agent client_cert_subject client_cert_san client_cert_fingerprint ws_message grpc_service grpc_method grpc_message graphql_operation_name graphql_operation_type file_name file_size file_type compound"`
+	Pattern     string             `json:"pattern"`
+	Conditions  *waf.RuleCondition `json:"conditions"`
+	MatchMode   string             `json:"match_mode" binding:"omitempty,oneof=exact regex contains cel"`
+	Action      string             `json:"action" binding:"required,oneof=block log allow drop"`
+	Priority    int                `json:"priority" binding:"required,min=1,max=1000"`
+	Enabled     bool               `json:"enabled"`
+	Tags        string             `json:"tags"`
+	TestCases   []waf.RuleTestCase `json:"test_cases"`
+	TenantID    uint               `json:"tenant_id"`
 }
 
 // UpdateRuleRequest 更新规则请求
 type UpdateRuleRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	MatchType   string `json:"match_type" binding:"omitempty,oneof=uri ip header body user_agent"`
-	Pattern     string `json:"pattern"`
-	MatchMode   string `json:"match_mode" binding:"omitempty,oneof=exact regex contains"`
-	Action      string `json:"action" binding:"omitempty,oneof=block log allow"`
-	Priority    *int   `json:"priority" binding:"omitempty,min=1,max=1000"`
-	Enabled     *bool  `json:"enabled"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	MatchType   string             `json:"match_type" binding:"omitempty,oneof=uri ip header body user_agent client_cert_subject client_cert_san client_cert_fingerprint ws_message grpc_service grpc_method grpc_message graphql_operation_name graphql_operation_type file_name file_size file_type compound"`
+	Pattern     string             `json:"pattern"`
+	Conditions  *waf.RuleCondition `json:"conditions"`
+	MatchMode   string             `json:"match_mode" binding:"omitempty,oneof=exact regex contains cel"`
+	Action      string             `json:"action" binding:"omitempty,oneof=block log allow drop"`
+	Priority    *int               `json:"priority" binding:"omitempty,min=1,max=1000"`
+	Enabled     *bool              `json:"enabled"`
+	Tags        *string            `json:"tags"`
+	TestCases   []waf.RuleTestCase `json:"test_cases"` // 为空数组时清除测试用例，不传时保持不变
 }
 
 // RuleListRequest 规则列表请求
@@ -53,19 +61,35 @@ type RuleListRequest struct {
 	Action    string `form:"action"`
 	Enabled   *bool  `form:"enabled"`
 	MatchType string `form:"match_type"`
+	Tag       string `form:"tag"`
 	TenantID  uint   `form:"tenant_id"`
 }
 
 // CreateRule 创建规则
 func (s *RuleService) CreateRule(req *CreateRuleRequest) (*models.Rule, error) {
+	if err := validateRuleAction(req.MatchType, req.Action); err != nil {
+		return nil, err
+	}
+	conditions, err := s.validateRuleMatch(req.MatchType, req.Pattern, req.MatchMode, req.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	testCases, err := encodeRuleTestCases(req.TestCases)
+	if err != nil {
+		return nil, err
+	}
+
 	rule := &models.Rule{
 		Name:        req.Name,
 		Description: req.Description,
 		MatchType:   req.MatchType,
 		Pattern:     req.Pattern,
+		Conditions:  conditions,
 		MatchMode:   req.MatchMode,
 		Action:      req.Action,
 		Enabled:     req.Enabled,
+		Tags:        normalizeRuleTags(req.Tags),
+		TestCases:   testCases,
 		TenantID:    req.TenantID,
 	}
 
@@ -99,6 +123,9 @@ func (s *RuleService) GetRuleList(req *RuleListRequest) ([]models.Rule, int64, e
 	if req.MatchType != "" {
 		query = query.Where("match_type = ?", req.MatchType)
 	}
+	if req.Tag != "" {
+		query = query.Where("FIND_IN_SET(?, tags)", strings.ToLower(strings.TrimSpace(req.Tag)))
+	}
 	if req.TenantID > 0 {
 		query = query.Where("tenant_id = ?", req.TenantID)
 	}
@@ -141,6 +168,36 @@ func (s *RuleService) UpdateRule(id uint, req *UpdateRuleRequest) (*models.Rule,
 		return nil, err
 	}
 
+	matchType, action := rule.MatchType, rule.Action
+	if req.MatchType != "" {
+		matchType = req.MatchType
+	}
+	if req.Action != "" {
+		action = req.Action
+	}
+	if err := validateRuleAction(matchType, action); err != nil {
+		return nil, err
+	}
+
+	// 未修改的匹配字段沿用原值后校验，组合规则的条件树可单独更新
+	pattern, matchMode, conditions := rule.Pattern, rule.MatchMode, req.Conditions
+	if req.Pattern != "" {
+		pattern = req.Pattern
+	}
+	if req.MatchMode != "" {
+		matchMode = req.MatchMode
+	}
+	var err error
+	if conditions == nil && matchType == "compound" && rule.Conditions != "" {
+		if conditions, err = waf.ParseRuleConditions(rule.Conditions); err != nil {
+			return nil, err
+		}
+	}
+	conditionsJSON, err := s.validateRuleMatch(matchType, pattern, matchMode, conditions)
+	if err != nil {
+		return nil, err
+	}
+
 	updates := make(map[string]interface{})
 	if req.Name != "" {
 		updates["name"] = req.Name
@@ -163,6 +220,19 @@ func (s *RuleService) UpdateRule(id uint, req *UpdateRuleRequest) (*models.Rule,
 	if req.Enabled != nil {
 		updates["enabled"] = *req.Enabled
 	}
+	if req.Tags != nil {
+		updates["tags"] = normalizeRuleTags(*req.Tags)
+	}
+	if conditionsJSON != rule.Conditions {
+		updates["conditions"] = conditionsJSON
+	}
+	if req.TestCases != nil {
+		testCases, err := encodeRuleTestCases(req.TestCases)
+		if err != nil {
+			return nil, err
+		}
+		updates["test_cases"] = testCases
+	}
 
 	if err := s.db.Model(&rule).Updates(updates).Error; err != nil {
 		return nil, err
@@ -183,6 +253,11 @@ func (s *RuleService) DeleteRule(id uint) error {
 			return fmt.Errorf("删除策略规则关联失败: %v", err)
 		}
 
+		// 删除规则排除
+		if err := tx.Where("rule_id = ?", id).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return fmt.Errorf("删除规则排除失败: %v", err)
+		}
+
 		// 删除规则
 		if err := tx.Delete(&models.Rule{}, id).Error; err != nil {
 			return fmt.Errorf("删除规则失败: %v", err)
@@ -221,6 +296,11 @@ func (s *RuleService) BatchDeleteRules(ids []uint) error {
 			return fmt.Errorf("删除策略规则关联失败: %v", err)
 		}
 
+		// 删除规则排除
+		if err := tx.Where("rule_id IN ?", ids).Delete(&models.RuleExclusion{}).Error; err != nil {
+			return fmt.Errorf("删除规则排除失败: %v", err)
+		}
+
 		// 删除规则
 		if err := tx.Where("id IN ?", ids).Delete(&models.Rule{}).Error; err != nil {
 			return fmt.Errorf("删除规则失败: %v", err)
@@ -232,3 +312,190 @@ func (s *RuleService) BatchDeleteRules(ids []uint) error {
 		return nil
 	})
 }
+
+// validateRuleAction 校验规则动作，drop（丢弃消息）仅适用于WebSocket消息规则
+func validateRuleAction(matchType, action string) error {
+	if action == "drop" && matchType != "ws_message" {
+		return fmt.Errorf("drop动作仅适用于ws_message类型的规则")
+	}
+	return nil
+}
+
+// validateRuleMatch 校验规则的匹配方式。组合规则需要有效的条件树，返回其JSON；
+// 表达式规则在保存时编译并缓存；其他规则需要匹配模式和匹配方式，不保存条件树
+func (s *RuleService) validateRuleMatch(matchType, pattern, matchMode string, conditions *waf.RuleCondition) (string, error) {
+	if matchType != "compound" {
+		if pattern == "" {
+			return "", fmt.Errorf("匹配模式不能为空")
+		}
+		if matchMode == "" {
+			return "", fmt.Errorf("匹配方式不能为空")
+		}
+		if matchMode == "cel" {
+			if matchType == "ws_message" {
+				return "", fmt.Errorf("cel匹配方式不适用于ws_message类型的规则")
+			}
+			if err := s.wafEngine.PrepareCELProgram(pattern); err != nil {
+				return "", fmt.Errorf("表达式无效: %v", err)
+			}
+		}
+		if matchMode == "regex" {
+			if err := s.wafEngine.PrepareRegex(rulePatternValue(matchType, pattern)); err != nil {
+				return "", fmt.Errorf("正则表达式无效: %v", err)
+			}
+		}
+		return "", nil
+	}
+
+	if conditions == nil {
+		return "", fmt.Errorf("组合规则需要指定条件")
+	}
+	if err := s.wafEngine.PrepareRuleConditions(conditions); err != nil {
+		return "", fmt.Errorf("组合条件无效: %v", err)
+	}
+	data, err := json.Marshal(conditions)
+	if err != nil {
+		return "", fmt.Errorf("组合条件无效: %v", err)
+	}
+	return string(data), nil
+}
+
+// rulePatternValue 返回规则模式中参与匹配的部分，header和grpc_message规则的"名称:值"格式只匹配值
+func rulePatternValue(matchType, pattern string) string {
+	if matchType == "header" || matchType == "grpc_message" {
+		if _, value, ok := strings.Cut(pattern, ":"); ok {
+			return value
+		}
+	}
+	return pattern
+}
+
+// encodeRuleTestCases 校验测试用例的模拟请求并转为JSON，没有测试用例时返回空字符串
+func encodeRuleTestCases(cases []waf.RuleTestCase) (string, error) {
+	if len(cases) == 0 {
+		return "", nil
+	}
+	for i := range cases {
+		if err := cases[i].Request.Validate(); err != nil {
+			return "", fmt.Errorf("测试用例%d无效: %v", i+1, err)
+		}
+	}
+	data, err := json.Marshal(cases)
+	if err != nil {
+		return "", fmt.Errorf("测试用例无效: %v", err)
+	}
+	return string(data), nil
+}
+
+// TestRuleRequest 执行规则测试用例请求
+type TestRuleRequest struct {
+	TestCases []waf.RuleTestCase `json:"test_cases"` // 不为空时执行这些用例，否则执行规则保存的用例
+}
+
+// RuleTestReport 规则测试结果
+type RuleTestReport struct {
+	RuleID  uint                 `json:"rule_id"`
+	Total   int                  `json:"total"`
+	Passed  int                  `json:"passed"`
+	Failed  int                  `json:"failed"`
+	Results []waf.RuleTestResult `json:"results"`
+}
+
+// TestRule 执行规则的测试用例，用例的模拟请求必须或不得命中规则
+func (s *RuleService) TestRule(id uint, req *TestRuleRequest) (*RuleTestReport, error) {
+	rule, err := s.GetRule(id)
+	if err != nil {
+		return nil, fmt.Errorf("规则不存在")
+	}
+
+	cases := req.TestCases
+	if len(cases) == 0 {
+		if cases, err = waf.ParseRuleTestCases(rule.TestCases); err != nil {
+			return nil, fmt.Errorf("解析测试用例失败: %v", err)
+		}
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("规则没有测试用例")
+	}
+
+	report := &RuleTestReport{
+		RuleID:  rule.ID,
+		Total:   len(cases),
+		Results: s.wafEngine.TestRule(*rule, cases),
+	}
+	for _, result := range report.Results {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// RuleEvaluationStat 规则计算耗时统计
+type RuleEvaluationStat struct {
+	waf.RuleEvaluationStat
+	Name      string `json:"name"`
+	MatchType string `json:"match_type"`
+	MatchMode string `json:"match_mode"`
+}
+
+// GetRuleEvaluationStats 获取WAF引擎启动以来各规则的计算耗时，按总耗时降序，limit大于0时只返回前limit条
+func (s *RuleService) GetRuleEvaluationStats(tenantID uint, limit int) ([]RuleEvaluationStat, error) {
+	timings := s.wafEngine.RuleEvaluationStats()
+	if len(timings) == 0 {
+		return []RuleEvaluationStat{}, nil
+	}
+
+	ids := make([]uint, len(timings))
+	for i, timing := range timings {
+		ids[i] = timing.RuleID
+	}
+	query := s.db.Where("id IN ?", ids)
+	if tenantID > 0 {
+		query = query.Where("tenant_id IN ?", []uint{0, tenantID})
+	}
+	var rules []models.Rule
+	if err := query.Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("获取规则失败: %v", err)
+	}
+	ruleMap := make(map[uint]models.Rule, len(rules))
+	for _, rule := range rules {
+		ruleMap[rule.ID] = rule
+	}
+
+	// 已删除或不属于当前租户的规则不返回
+	stats := make([]RuleEvaluationStat, 0, len(timings))
+	for _, timing := range timings {
+		rule, ok := ruleMap[timing.RuleID]
+		if !ok {
+			continue
+		}
+		stats = append(stats, RuleEvaluationStat{
+			RuleEvaluationStat: timing,
+			Name:               rule.Name,
+			MatchType:          rule.MatchType,
+			MatchMode:          rule.MatchMode,
+		})
+		if limit > 0 && len(stats) >= limit {
+			break
+		}
+	}
+	return stats, nil
+}
+
+// normalizeRuleTags 规范化规则标签：去掉空白、转为小写并去重，以逗号分隔
+func normalizeRuleTags(tags string) string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return strings.Join(result, ",")
+}
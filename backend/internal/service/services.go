@@ -1,6 +1,11 @@
 package service
 
 import (
+	"context"
+	"log"
+	"time"
+
+	"waf-go/internal/certs"
 	"waf-go/internal/config"
 	"waf-go/internal/proxy"
 	"waf-go/internal/waf"
@@ -23,18 +28,51 @@ type Services struct {
 	blackListService      *BlackListService
 	configService         *ConfigService
 	tenantSecurityService *TenantSecurityService
+	webhookService        *WebhookService
+	certificateService    *CertificateService
+	rewriteService        *RewriteService
+	grpcService           *GRPCService
+	graphqlService        *GraphQLService
+	uploadPolicyService   *UploadPolicyService
+	loginEndpointService  *LoginEndpointService
+	apiSpecService        *APISpecService
+	learningService       *LearningService
+	ruleExclusionService  *RuleExclusionService
+	modSecImportService   *ModSecImportService
+	shadowService         *ShadowService
+	evaluationService     *EvaluationService
+	replayService         *ReplayService
 	wafEngine             *waf.WAFEngine
+	certStore             *certs.Store
+	acmeManager           *certs.ACMEManager
 }
 
 // NewServices 创建服务集合
 func NewServices(db *gorm.DB, rdb *redis.Client, cfg *config.Config) *Services {
 	proxyManager := proxy.NewProxyManager()
 	wafEngine := waf.NewWAFEngine(db, rdb)
+	if cfg.WAF.GeoIPDatabase != "" {
+		if err := wafEngine.LoadGeoIP(cfg.WAF.GeoIPDatabase); err != nil {
+			log.Printf("加载GeoIP数据库失败: %v", err)
+		}
+	}
+	if cfg.WAF.ClamAVAddress != "" {
+		if err := wafEngine.SetClamAV(cfg.WAF.ClamAVAddress, time.Duration(cfg.WAF.ClamAVTimeout)*time.Second); err != nil {
+			log.Printf("配置ClamAV失败: %v", err)
+		}
+	}
+	proxyManager.SetWebSocketInspector(wafEngine)
+	proxyManager.SetResponseInspector(wafEngine)
+	certStore := certs.NewStore(cfg.TLS)
+	acmeManager := certs.NewACMEManager(db, cfg.ACME, certStore)
+	domainService := NewDomainService(db, proxyManager, certStore, acmeManager)
+	webhookService := NewWebhookService(db)
+	apiSpecService := NewAPISpecService(db, domainService, wafEngine)
 	return &Services{
 		authService:           NewAuthService(db),
 		userService:           NewUserService(db),
 		tenantService:         NewTenantService(db),
-		domainService:         NewDomainService(db, proxyManager),
+		domainService:         domainService,
 		policyService:         NewPolicyService(db),
 		ruleService:           NewRuleService(db, wafEngine),
 		logService:            NewLogService(db),
@@ -43,10 +81,35 @@ func NewServices(db *gorm.DB, rdb *redis.Client, cfg *config.Config) *Services {
 		blackListService:      NewBlackListService(db),
 		configService:         NewConfigService(db, rdb, cfg),
 		tenantSecurityService: NewTenantSecurityService(db),
+		webhookService:        webhookService,
+		certificateService:    NewCertificateService(db, rdb, cfg.TLS, certStore, acmeManager, domainService, webhookService),
+		rewriteService:        NewRewriteService(db, domainService),
+		grpcService:           NewGRPCService(db, domainService, wafEngine),
+		graphqlService:        NewGraphQLService(db, domainService),
+		uploadPolicyService:   NewUploadPolicyService(db, domainService),
+		loginEndpointService:  NewLoginEndpointService(db, domainService, wafEngine),
+		apiSpecService:        apiSpecService,
+		learningService:       NewLearningService(db, domainService, apiSpecService, wafEngine),
+		ruleExclusionService:  NewRuleExclusionService(db, domainService),
+		modSecImportService:   NewModSecImportService(db, wafEngine),
+		shadowService:         NewShadowService(db, wafEngine),
+		evaluationService:     NewEvaluationService(wafEngine),
+		replayService:         NewReplayService(db, wafEngine),
 		wafEngine:             wafEngine,
+		certStore:             certStore,
+		acmeManager:           acmeManager,
 	}
 }
 
+// StartBackgroundTasks 启动后台任务（证书续期、OCSP装订、证书到期监控、学习数据写入、影子策略评估等）
+func (s *Services) StartBackgroundTasks(ctx context.Context) {
+	s.certStore.StartOCSPStapling(ctx)
+	s.certificateService.StartExpiryMonitor(ctx)
+	s.acmeManager.Start(ctx)
+	s.wafEngine.StartLearningFlusher(ctx)
+	s.wafEngine.StartShadowEvaluator(ctx)
+}
+
 // GetUserService 获取用户服务
 func (s *Services) GetUserService() *UserService {
 	return s.userService
@@ -105,3 +168,67 @@ func (s *Services) GetWAFEngine() *waf.WAFEngine {
 func (s *Services) GetAuthService() *AuthService {
 	return s.authService
 }
+
+func (s *Services) GetWebhookService() *WebhookService {
+	return s.webhookService
+}
+
+func (s *Services) GetCertificateService() *CertificateService {
+	return s.certificateService
+}
+
+func (s *Services) GetRewriteService() *RewriteService {
+	return s.rewriteService
+}
+
+func (s *Services) GetGRPCService() *GRPCService {
+	return s.grpcService
+}
+
+func (s *Services) GetGraphQLService() *GraphQLService {
+	return s.graphqlService
+}
+
+func (s *Services) GetUploadPolicyService() *UploadPolicyService {
+	return s.uploadPolicyService
+}
+
+func (s *Services) GetLoginEndpointService() *LoginEndpointService {
+	return s.loginEndpointService
+}
+
+func (s *Services) GetAPISpecService() *APISpecService {
+	return s.apiSpecService
+}
+
+func (s *Services) GetLearningService() *LearningService {
+	return s.learningService
+}
+
+func (s *Services) GetRuleExclusionService() *RuleExclusionService {
+	return s.ruleExclusionService
+}
+
+func (s *Services) GetModSecImportService() *ModSecImportService {
+	return s.modSecImportService
+}
+
+func (s *Services) GetShadowService() *ShadowService {
+	return s.shadowService
+}
+
+func (s *Services) GetEvaluationService() *EvaluationService {
+	return s.evaluationService
+}
+
+func (s *Services) GetReplayService() *ReplayService {
+	return s.replayService
+}
+
+func (s *Services) GetCertificateStore() *certs.Store {
+	return s.certStore
+}
+
+func (s *Services) GetACMEManager() *certs.ACMEManager {
+	return s.acmeManager
+}
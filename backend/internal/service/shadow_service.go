@@ -0,0 +1,149 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// ShadowService 影子策略服务，查看影子策略与生效策略的差异并将影子策略转为生效
+type ShadowService struct {
+	db        *gorm.DB
+	wafEngine *waf.WAFEngine
+}
+
+func NewShadowService(db *gorm.DB, wafEngine *waf.WAFEngine) *ShadowService {
+	return &ShadowService{
+		db:        db,
+		wafEngine: wafEngine,
+	}
+}
+
+// ShadowReport 影子策略差异报告
+type ShadowReport struct {
+	Policies []DomainPolicyResponse `json:"policies"` // 域名的影子策略
+	Stat     models.ShadowStat      `json:"stat"`     // 评估汇总，评估结果每30秒写入一次
+	Rules    []ShadowRuleDiff       `json:"rules"`    // 按规则统计的差异，差异请求数多的在前
+}
+
+// ShadowRuleDiff 单条规则的差异
+type ShadowRuleDiff struct {
+	RuleID        uint               `json:"rule_id"`
+	RuleName      string             `json:"rule_name"`
+	ShadowBlocks  int64              `json:"shadow_blocks"`  // 该影子规则拦截、生效策略放行的请求数
+	LiveBlocks    int64              `json:"live_blocks"`    // 该生效规则拦截、影子策略放行的请求数
+	ShadowSamples []waf.ShadowSample `json:"shadow_samples"` // 影子拦截的样本请求
+	LiveSamples   []waf.ShadowSample `json:"live_samples"`   // 生效拦截的样本请求
+	LastSeen      time.Time          `json:"last_seen"`
+}
+
+// GetShadowReport 获取域名的影子策略差异报告
+func (s *ShadowService) GetShadowReport(domainID uint) (*ShadowReport, error) {
+	var domainPolicies []models.DomainPolicy
+	if err := s.db.Where("domain_id = ? AND shadow = ?", domainID, true).
+		Preload("Policy").Order("priority DESC").Find(&domainPolicies).Error; err != nil {
+		return nil, fmt.Errorf("获取影子策略失败: %v", err)
+	}
+
+	report := &ShadowReport{
+		Policies: make([]DomainPolicyResponse, 0, len(domainPolicies)),
+		Stat:     models.ShadowStat{DomainID: domainID},
+		Rules:    []ShadowRuleDiff{},
+	}
+	for _, dp := range domainPolicies {
+		report.Policies = append(report.Policies, DomainPolicyResponse{
+			ID:       dp.ID,
+			DomainID: dp.DomainID,
+			PolicyID: dp.PolicyID,
+			Priority: dp.Priority,
+			Enabled:  dp.Enabled,
+			Mode:     dp.Mode,
+			Shadow:   dp.Shadow,
+			Policy:   dp.Policy,
+		})
+	}
+
+	if err := s.db.Where("domain_id = ?", domainID).First(&report.Stat).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("获取影子策略统计失败: %v", err)
+	}
+
+	var diffs []models.ShadowDiff
+	if err := s.db.Where("domain_id = ?", domainID).Find(&diffs).Error; err != nil {
+		return nil, fmt.Errorf("获取影子策略差异失败: %v", err)
+	}
+
+	// 同一规则的两个方向合并为一项
+	rules := make(map[uint]*ShadowRuleDiff)
+	for _, diff := range diffs {
+		rule, ok := rules[diff.RuleID]
+		if !ok {
+			rule = &ShadowRuleDiff{RuleID: diff.RuleID, RuleName: diff.RuleName}
+			rules[diff.RuleID] = rule
+		}
+		if diff.Direction == waf.ShadowBlock {
+			rule.ShadowBlocks = diff.Count
+			rule.ShadowSamples = waf.DecodeShadowSamples(diff.Samples)
+		} else {
+			rule.LiveBlocks = diff.Count
+			rule.LiveSamples = waf.DecodeShadowSamples(diff.Samples)
+		}
+		if diff.LastSeen.After(rule.LastSeen) {
+			rule.LastSeen = diff.LastSeen
+		}
+	}
+	for _, rule := range rules {
+		report.Rules = append(report.Rules, *rule)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		ti := report.Rules[i].ShadowBlocks + report.Rules[i].LiveBlocks
+		tj := report.Rules[j].ShadowBlocks + report.Rules[j].LiveBlocks
+		if ti != tj {
+			return ti > tj
+		}
+		return report.Rules[i].RuleID < report.Rules[j].RuleID
+	})
+
+	return report, nil
+}
+
+// ResetShadowReport 清空域名的影子策略统计，重新开始比较
+func (s *ShadowService) ResetShadowReport(domainID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("domain_id = ?", domainID).Delete(&models.ShadowDiff{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略差异失败: %v", err)
+		}
+		if err := tx.Where("domain_id = ?", domainID).Delete(&models.ShadowStat{}).Error; err != nil {
+			return fmt.Errorf("删除影子策略统计失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.wafEngine.ResetShadowStats(domainID)
+	return nil
+}
+
+// PromoteShadowPolicy 将域名的影子策略转为生效策略
+func (s *ShadowService) PromoteShadowPolicy(domainID, policyID uint) (*models.DomainPolicy, error) {
+	var domainPolicy models.DomainPolicy
+	if err := s.db.Where("domain_id = ? AND policy_id = ?", domainID, policyID).First(&domainPolicy).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("域名未关联该策略")
+		}
+		return nil, fmt.Errorf("获取策略关联失败: %v", err)
+	}
+	if !domainPolicy.Shadow {
+		return nil, fmt.Errorf("该策略不是影子策略")
+	}
+
+	if err := s.db.Model(&domainPolicy).Update("shadow", false).Error; err != nil {
+		return nil, fmt.Errorf("更新策略关联失败: %v", err)
+	}
+	return &domainPolicy, nil
+}
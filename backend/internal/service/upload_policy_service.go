@@ -0,0 +1,207 @@
+package service
+
+import (
+	"fmt"
+	"waf-go/internal/models"
+	"waf-go/internal/waf"
+
+	"gorm.io/gorm"
+)
+
+// UploadPolicyService 文件上传策略服务，管理域名下multipart上传文件的大小、数量、类型和内容检查
+type UploadPolicyService struct {
+	db            *gorm.DB
+	domainService *DomainService
+}
+
+func NewUploadPolicyService(db *gorm.DB, domainService *DomainService) *UploadPolicyService {
+	return &UploadPolicyService{
+		db:            db,
+		domainService: domainService,
+	}
+}
+
+// CreateUploadPolicyRequest 创建文件上传策略请求
+type CreateUploadPolicyRequest struct {
+	Name                  string `json:"name"`
+	Path                  string `json:"path"`
+	MaxFileSize           int64  `json:"max_file_size" binding:"min=0"`
+	MaxFileCount          int    `json:"max_file_count" binding:"min=0"`
+	AllowedExtensions     string `json:"allowed_extensions"`
+	AllowedMIMETypes      string `json:"allowed_mime_types"`
+	BlockDoubleExtensions *bool  `json:"block_double_extensions"`
+	BlockPolyglots        *bool  `json:"block_polyglots"`
+	ScanMalware           bool   `json:"scan_malware"`
+	Action                string `json:"action" binding:"omitempty,oneof=block log"`
+	Enabled               *bool  `json:"enabled"`
+}
+
+// UpdateUploadPolicyRequest 更新文件上传策略请求
+type UpdateUploadPolicyRequest struct {
+	Name                  *string `json:"name"`
+	Path                  *string `json:"path"`
+	MaxFileSize           *int64  `json:"max_file_size" binding:"omitempty,min=0"`
+	MaxFileCount          *int    `json:"max_file_count" binding:"omitempty,min=0"`
+	AllowedExtensions     *string `json:"allowed_extensions"`
+	AllowedMIMETypes      *string `json:"allowed_mime_types"`
+	BlockDoubleExtensions *bool   `json:"block_double_extensions"`
+	BlockPolyglots        *bool   `json:"block_polyglots"`
+	ScanMalware           *bool   `json:"scan_malware"`
+	Action                string  `json:"action" binding:"omitempty,oneof=block log"`
+	Enabled               *bool   `json:"enabled"`
+}
+
+// GetUploadPolicies 获取域名的文件上传策略
+func (s *UploadPolicyService) GetUploadPolicies(domainID uint) ([]models.UploadPolicy, error) {
+	var policies []models.UploadPolicy
+	if err := s.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("获取文件上传策略失败: %v", err)
+	}
+	return policies, nil
+}
+
+// CreateUploadPolicy 创建文件上传策略，双扩展名和多态文件检查默认开启
+func (s *UploadPolicyService) CreateUploadPolicy(domainID uint, req *CreateUploadPolicyRequest) (*models.UploadPolicy, error) {
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &models.UploadPolicy{
+		DomainID:              domain.ID,
+		Name:                  req.Name,
+		Path:                  req.Path,
+		MaxFileSize:           req.MaxFileSize,
+		MaxFileCount:          req.MaxFileCount,
+		AllowedExtensions:     req.AllowedExtensions,
+		AllowedMIMETypes:      req.AllowedMIMETypes,
+		BlockDoubleExtensions: true,
+		BlockPolyglots:        true,
+		ScanMalware:           req.ScanMalware,
+		Action:                req.Action,
+		Enabled:               true,
+		TenantID:              domain.TenantID,
+	}
+	if policy.Action == "" {
+		policy.Action = "block"
+	}
+	if req.BlockDoubleExtensions != nil {
+		policy.BlockDoubleExtensions = *req.BlockDoubleExtensions
+	}
+	if req.BlockPolyglots != nil {
+		policy.BlockPolyglots = *req.BlockPolyglots
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if err := s.validatePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(policy).Error; err != nil {
+		return nil, fmt.Errorf("创建文件上传策略失败: %v", err)
+	}
+	// 布尔字段有默认值，显式设置false时需要单独更新
+	defaultUpdates := map[string]interface{}{}
+	if !policy.BlockDoubleExtensions {
+		defaultUpdates["block_double_extensions"] = false
+	}
+	if !policy.BlockPolyglots {
+		defaultUpdates["block_polyglots"] = false
+	}
+	if !policy.Enabled {
+		defaultUpdates["enabled"] = false
+	}
+	if len(defaultUpdates) > 0 {
+		if err := s.db.Model(policy).Updates(defaultUpdates).Error; err != nil {
+			return nil, fmt.Errorf("创建文件上传策略失败: %v", err)
+		}
+	}
+	s.domainService.ResetWAFProtection(policy.DomainID)
+	return policy, nil
+}
+
+// UpdateUploadPolicy 更新文件上传策略
+func (s *UploadPolicyService) UpdateUploadPolicy(domainID, policyID uint, req *UpdateUploadPolicyRequest) (*models.UploadPolicy, error) {
+	var policy models.UploadPolicy
+	if err := s.db.Where("id = ? AND domain_id = ?", policyID, domainID).First(&policy).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("文件上传策略不存在")
+		}
+		return nil, fmt.Errorf("获取文件上传策略失败: %v", err)
+	}
+
+	if req.Name != nil {
+		policy.Name = *req.Name
+	}
+	if req.Path != nil {
+		policy.Path = *req.Path
+	}
+	if req.MaxFileSize != nil {
+		policy.MaxFileSize = *req.MaxFileSize
+	}
+	if req.MaxFileCount != nil {
+		policy.MaxFileCount = *req.MaxFileCount
+	}
+	if req.AllowedExtensions != nil {
+		policy.AllowedExtensions = *req.AllowedExtensions
+	}
+	if req.AllowedMIMETypes != nil {
+		policy.AllowedMIMETypes = *req.AllowedMIMETypes
+	}
+	if req.BlockDoubleExtensions != nil {
+		policy.BlockDoubleExtensions = *req.BlockDoubleExtensions
+	}
+	if req.BlockPolyglots != nil {
+		policy.BlockPolyglots = *req.BlockPolyglots
+	}
+	if req.ScanMalware != nil {
+		policy.ScanMalware = *req.ScanMalware
+	}
+	if req.Action != "" {
+		policy.Action = req.Action
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if err := s.validatePolicy(&policy); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&policy).Error; err != nil {
+		return nil, fmt.Errorf("更新文件上传策略失败: %v", err)
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return &policy, nil
+}
+
+// DeleteUploadPolicy 删除文件上传策略
+func (s *UploadPolicyService) DeleteUploadPolicy(domainID, policyID uint) error {
+	result := s.db.Where("id = ? AND domain_id = ?", policyID, domainID).Delete(&models.UploadPolicy{})
+	if result.Error != nil {
+		return fmt.Errorf("删除文件上传策略失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("文件上传策略不存在")
+	}
+	s.domainService.ResetWAFProtection(domainID)
+	return nil
+}
+
+// validatePolicy 校验路径前缀和允许列表，同一域名下路径前缀不能重复
+func (s *UploadPolicyService) validatePolicy(policy *models.UploadPolicy) error {
+	if err := waf.ValidateUploadPolicy(policy); err != nil {
+		return fmt.Errorf("文件上传策略配置无效: %v", err)
+	}
+
+	var count int64
+	if err := s.db.Model(&models.UploadPolicy{}).
+		Where("domain_id = ? AND path = ? AND id <> ?", policy.DomainID, policy.Path, policy.ID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("检查文件上传策略失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("文件上传策略路径已存在")
+	}
+	return nil
+}
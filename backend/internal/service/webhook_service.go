@@ -1,17 +1,33 @@
 package service
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
 	"waf-go/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// Webhook事件类型
+const (
+	WebhookEventCertificateExpiring = "certificate_expiring"
+)
+
 type WebhookService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	client *http.Client
 }
 
 func NewWebhookService(db *gorm.DB) *WebhookService {
-	return &WebhookService{db: db}
+	return &WebhookService{
+		db:     db,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
 }
 
 func (s *WebhookService) GetWebhookList(tenantID uint) ([]models.Webhook, error) {
@@ -23,3 +39,97 @@ func (s *WebhookService) GetWebhookList(tenantID uint) ([]models.Webhook, error)
 	err := query.Find(&webhooks).Error
 	return webhooks, err
 }
+
+// Notify 向订阅了事件的Webhook（租户自己的和全局的）发送通知，返回成功发送的数量
+func (s *WebhookService) Notify(tenantID uint, event string, data map[string]interface{}) (int, error) {
+	var webhooks []models.Webhook
+	if err := s.db.Where("enabled = ? AND (tenant_id = ? OR tenant_id = ?)", true, tenantID, 0).
+		Find(&webhooks).Error; err != nil {
+		return 0, fmt.Errorf("获取Webhook失败: %v", err)
+	}
+
+	sent := 0
+	for _, webhook := range webhooks {
+		if !subscribes(webhook.Events, event) {
+			continue
+		}
+		if err := s.send(&webhook, event, data); err != nil {
+			log.Printf("Webhook %s send failed: %v", webhook.Name, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// send 发送单个Webhook请求
+func (s *WebhookService) send(webhook *models.Webhook, event string, data map[string]interface{}) error {
+	body, err := renderWebhookBody(webhook.Template, event, data)
+	if err != nil {
+		return err
+	}
+
+	method := webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(webhook.Headers), &headers); err != nil {
+			return fmt.Errorf("invalid headers: %v", err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// subscribes 检查Webhook是否订阅了事件，未配置事件列表时订阅全部事件
+func subscribes(events, event string) bool {
+	if strings.TrimSpace(events) == "" {
+		return true
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(events), &list); err != nil {
+		return false
+	}
+	for _, e := range list {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderWebhookBody 生成请求体，配置了模板时替换 {{变量}}，否则发送JSON
+func renderWebhookBody(template, event string, data map[string]interface{}) ([]byte, error) {
+	if template == "" {
+		return json.Marshal(map[string]interface{}{
+			"event":     event,
+			"timestamp": time.Now().Unix(),
+			"data":      data,
+		})
+	}
+
+	body := strings.ReplaceAll(template, "{{event}}", event)
+	for k, v := range data {
+		body = strings.ReplaceAll(body, "{{"+k+"}}", fmt.Sprint(v))
+	}
+	return []byte(body), nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC状态码
+const (
+	GRPCUnknown           = 2
+	GRPCInvalidArgument   = 3
+	GRPCPermissionDenied  = 7
+	GRPCResourceExhausted = 8
+	GRPCUnimplemented     = 12
+	GRPCUnavailable       = 14
+	GRPCUnauthenticated   = 16
+)
+
+// IsGRPCRequest 是否为gRPC请求
+func IsGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// GRPCStatus 将HTTP状态码映射为gRPC状态码
+func GRPCStatus(httpStatus int) int {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return GRPCInvalidArgument
+	case http.StatusUnauthorized:
+		return GRPCUnauthenticated
+	case http.StatusForbidden:
+		return GRPCPermissionDenied
+	case http.StatusNotFound:
+		return GRPCUnimplemented
+	case http.StatusTooManyRequests:
+		return GRPCResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GRPCUnavailable
+	default:
+		return GRPCUnknown
+	}
+}
+
+// WriteGRPCError 以Trailers-Only形式返回gRPC错误，HTTP状态码固定为200
+func WriteGRPCError(w http.ResponseWriter, httpStatus int, message string) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(GRPCStatus(httpStatus)))
+	header.Set("Grpc-Message", encodeGRPCMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage 按gRPC协议对grpc-message进行百分号编码
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
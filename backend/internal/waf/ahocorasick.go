@@ -0,0 +1,86 @@
+package waf
+
+// ahoCorasick 多模式字符串匹配自动机，一次扫描文本即可找出所有出现的模式。
+// 按字节匹配，大小写不敏感的匹配由调用方事先把模式和文本转为小写
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next   map[byte]int32 // 转移边
+	fail   int32          // 失配时跳转的节点
+	output []int32        // 在该节点结束的模式序号，包括失配链上的模式
+}
+
+// newAhoCorasick 构建自动机，模式序号为其在patterns中的下标。空模式不会被匹配，需由调用方单独处理
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{}}}
+	for i, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		node := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			next, ok := ac.nodes[node].next[pattern[j]]
+			if !ok {
+				ac.nodes = append(ac.nodes, acNode{})
+				next = int32(len(ac.nodes) - 1)
+				if ac.nodes[node].next == nil {
+					ac.nodes[node].next = make(map[byte]int32)
+				}
+				ac.nodes[node].next[pattern[j]] = next
+			}
+			node = next
+		}
+		ac.nodes[node].output = append(ac.nodes[node].output, int32(i))
+	}
+
+	// 按层次遍历计算失配节点，并合并失配链上的输出
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[node].next {
+			queue = append(queue, child)
+			fail := ac.nodes[node].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			if inherited := ac.nodes[ac.nodes[child].fail].output; len(inherited) > 0 {
+				ac.nodes[child].output = append(ac.nodes[child].output, inherited...)
+			}
+		}
+	}
+	return ac
+}
+
+// match 扫描文本，对每次出现的模式调用fn，同一模式可能多次回调
+func (ac *ahoCorasick) match(text string, fn func(pattern int)) {
+	node := int32(0)
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		for {
+			if next, ok := ac.nodes[node].next[b]; ok {
+				node = next
+				break
+			}
+			if node == 0 {
+				break
+			}
+			node = ac.nodes[node].fail
+		}
+		for _, pattern := range ac.nodes[node].output {
+			fn(int(pattern))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package waf
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// overlappingCount 统计模式在文本中出现的次数，包括重叠的出现
+func overlappingCount(text, pattern string) int {
+	count := 0
+	for i := 0; i+len(pattern) <= len(text); i++ {
+		if text[i:i+len(pattern)] == pattern {
+			count++
+		}
+	}
+	return count
+}
+
+// checkAhoCorasick 比较自动机和strings.Contains的结果，以及每个模式的出现次数
+func checkAhoCorasick(t *testing.T, patterns []string, text string) {
+	t.Helper()
+	counts := make([]int, len(patterns))
+	newAhoCorasick(patterns).match(text, func(pattern int) { counts[pattern]++ })
+
+	for i, pattern := range patterns {
+		want := 0
+		if pattern != "" {
+			want = overlappingCount(text, pattern)
+		}
+		if (counts[i] > 0) != (pattern != "" && strings.Contains(text, pattern)) || counts[i] != want {
+			t.Errorf("patterns %q, text %q: pattern %q matched %d times, want %d", patterns, text, pattern, counts[i], want)
+		}
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		text     string
+	}{
+		{[]string{"he", "she", "his", "hers"}, "ushers"},
+		{[]string{"a", "aa", "aaa"}, "aaaa"},
+		{[]string{"abcd", "bc", "c"}, "abcabcd"},
+		{[]string{"union select", "select", "sleep("}, "1 union select sleep(5)"},
+		{[]string{"<script", "script>", "javascript:"}, "<a href=\"javascript:alert(1)\"><script>"},
+		{[]string{"../", "..\\", "/etc/passwd"}, "/../../etc/passwd"},
+		{[]string{"abab", "bab", "ab"}, "abababab"},
+		{[]string{"x", "y"}, ""},
+		{[]string{"", "a"}, "aaa"},
+		{[]string{"dup", "dup"}, "dupdup"},
+		{[]string{"longer than text"}, "short"},
+		{[]string{"\x00", "\xff\xfe"}, "a\x00b\xff\xfe"},
+	}
+	for _, tt := range tests {
+		checkAhoCorasick(t, tt.patterns, tt.text)
+	}
+}
+
+// TestAhoCorasickRandom 用小字母表随机生成模式和文本，覆盖大量失配跳转的情况
+func TestAhoCorasickRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomString := func(maxLen int) string {
+		b := make([]byte, rng.Intn(maxLen)+1)
+		for i := range b {
+			b[i] = "abc"[rng.Intn(3)]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 500; i++ {
+		patterns := make([]string, rng.Intn(10)+1)
+		for j := range patterns {
+			patterns[j] = randomString(5)
+		}
+		checkAhoCorasick(t, patterns, randomString(60))
+	}
+}
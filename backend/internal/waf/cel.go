@@ -0,0 +1,288 @@
+package waf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"github.com/oschwald/geoip2-golang"
+)
+
+const (
+	// celCostLimit 单次表达式计算的代价上限，超出时计算中止并视为不匹配
+	celCostLimit = 100000
+	// maxCELPrograms 编译结果缓存的最大条数，超出时清空重建
+	maxCELPrograms = 1000
+	// celRequestKey 请求上下文中缓存表达式请求对象的键
+	celRequestKey = "waf_cel_request"
+	// celRateKey 请求上下文中缓存访问频率计数的键
+	celRateKey = "waf_cel_rate"
+	// celRateWindow 表达式访问频率计数的时间窗口（秒）
+	celRateWindow = 60
+)
+
+// celEnv 规则表达式的环境：
+//
+//	request  请求对象：method, path, uri, host, scheme, query, content_type, user_agent, size,
+//	         headers（小写名称）, args（查询参数）, cookies, body, fields（表单或JSON请求体字段）,
+//	         files（上传文件列表：field, name, extension, size, declared_type, type）
+//	ip       客户端IP，支持 ip.inCidr("10.0.0.0/8")
+//	geo      客户端IP的地理位置：country, country_name, continent, subdivision, city，未配置GeoIP数据库时为空
+//	rate     访问频率计数：ip（客户端IP在当前60秒固定窗口内访问域名的次数）, ip_path（客户端IP在当前60秒固定窗口内访问当前路径的次数）
+var celEnv = mustCELEnv()
+
+func mustCELEnv() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("ip", cel.StringType),
+		cel.Variable("geo", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("rate", cel.MapType(cel.StringType, cel.IntType)),
+		ext.Strings(),
+		cel.Function("inCidr",
+			cel.MemberOverload("string_in_cidr", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(celInCIDR))),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create CEL environment: %v", err)
+	}
+	return env
+}
+
+// celInCIDR 检查IP是否在CIDR范围内，也支持单个IP
+func celInCIDR(ipVal, cidrVal ref.Val) ref.Val {
+	ip := net.ParseIP(string(ipVal.(types.String)))
+	if ip == nil {
+		return types.False
+	}
+	cidr := string(cidrVal.(types.String))
+	if !strings.Contains(cidr, "/") {
+		other := net.ParseIP(cidr)
+		return types.Bool(other != nil && other.Equal(ip))
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return types.NewErr("invalid CIDR: %s", cidr)
+	}
+	return types.Bool(network.Contains(ip))
+}
+
+// CompileCELExpression 编译规则表达式，表达式结果必须为布尔值
+func CompileCELExpression(expr string) (cel.Program, error) {
+	ast, issues := celEnv.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid CEL expression: %v", issues.Err())
+	}
+	if out := ast.OutputType(); !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("CEL expression must return bool, got %s", out)
+	}
+	program, err := celEnv.Program(ast, cel.CostLimit(celCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CEL expression: %v", err)
+	}
+	return program, nil
+}
+
+// PrepareCELProgram 编译表达式并放入缓存，保存规则时调用
+func (e *WAFEngine) PrepareCELProgram(expr string) error {
+	_, err := e.celProgram(expr)
+	return err
+}
+
+// celProgram 获取表达式的编译结果，按表达式文本缓存
+func (e *WAFEngine) celProgram(expr string) (cel.Program, error) {
+	e.celMu.RLock()
+	program, ok := e.celPrograms[expr]
+	e.celMu.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	program, err := CompileCELExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	e.celMu.Lock()
+	if len(e.celPrograms) >= maxCELPrograms {
+		e.celPrograms = make(map[string]cel.Program)
+	}
+	e.celPrograms[expr] = program
+	e.celMu.Unlock()
+	return program, nil
+}
+
+// LoadGeoIP 加载MaxMind GeoIP2/GeoLite2 City数据库，供表达式中的geo变量使用
+func (e *WAFEngine) LoadGeoIP(path string) error {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open GeoIP database: %v", err)
+	}
+	e.geoIP = reader
+	return nil
+}
+
+// matchCEL 计算规则表达式，计算出错或超出代价上限时视为不匹配
+func (e *WAFEngine) matchCEL(expr string, c *gin.Context, domainID uint, targets *excludedTargets) (bool, string) {
+	program, err := e.celProgram(expr)
+	if err != nil {
+		log.Printf("Failed to compile CEL expression: %v", err)
+		return false, ""
+	}
+
+	clientIP := c.ClientIP()
+	vars := map[string]any{
+		"request": e.celRequest(c, domainID, targets),
+		"ip":      clientIP,
+		"geo":     func() any { return e.celGeo(clientIP) },
+		"rate":    func() any { return e.celRate(c, domainID, clientIP) },
+	}
+	out, _, err := program.ContextEval(context.Background(), vars)
+	if err != nil {
+		return false, ""
+	}
+	matched, ok := out.Value().(bool)
+	if !ok || !matched {
+		return false, ""
+	}
+	return true, truncateSample(expr)
+}
+
+// celRequest 构造表达式中的request对象，没有排除目标时缓存到请求上下文
+func (e *WAFEngine) celRequest(c *gin.Context, domainID uint, targets *excludedTargets) map[string]any {
+	if targets == nil {
+		if cached, ok := c.Get(celRequestKey); ok {
+			return cached.(map[string]any)
+		}
+	}
+
+	headers := make(map[string]string, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		if targets.excludesHeader(name) {
+			continue
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	args := make(map[string]string)
+	for name, values := range c.Request.URL.Query() {
+		args[name] = values[0]
+	}
+	cookies := make(map[string]string)
+	for _, cookie := range c.Request.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	body := inspectedBody(c, targets)
+	request := map[string]any{
+		"method":       c.Request.Method,
+		"path":         c.Request.URL.Path,
+		"uri":          c.Request.RequestURI,
+		"host":         c.Request.Host,
+		"scheme":       scheme,
+		"query":        c.Request.URL.RawQuery,
+		"content_type": c.ContentType(),
+		"user_agent":   headers["user-agent"],
+		"size":         c.Request.ContentLength,
+		"headers":      headers,
+		"args":         args,
+		"cookies":      cookies,
+		"body":         body,
+		"fields":       celBodyFields(c, body),
+		"files":        e.celFiles(c, domainID),
+	}
+	if targets == nil {
+		c.Set(celRequestKey, request)
+	}
+	return request
+}
+
+// celBodyFields 解析表单或JSON对象请求体的字段，JSON字段保留原始类型
+func celBodyFields(c *gin.Context, body string) map[string]any {
+	fields := make(map[string]any)
+	if body == "" {
+		return fields
+	}
+	if strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return fields
+		}
+		for name, value := range values {
+			fields[name] = value[0]
+		}
+		return fields
+	}
+	json.Unmarshal([]byte(body), &fields)
+	return fields
+}
+
+// celGeo 查询客户端IP的地理位置
+func (e *WAFEngine) celGeo(clientIP string) map[string]string {
+	// 所有字段都有默认值，表达式可直接比较 geo.country != "CN"
+	geo := map[string]string{"country": "", "country_name": "", "continent": "", "subdivision": "", "city": ""}
+	ip := net.ParseIP(clientIP)
+	if e.geoIP == nil || ip == nil {
+		return geo
+	}
+	city, err := e.geoIP.City(ip)
+	if err != nil {
+		return geo
+	}
+	geo["country"] = city.Country.IsoCode
+	geo["country_name"] = city.Country.Names["en"]
+	geo["continent"] = city.Continent.Code
+	geo["city"] = city.City.Names["en"]
+	if len(city.Subdivisions) > 0 {
+		geo["subdivision"] = city.Subdivisions[0].IsoCode
+	}
+	return geo
+}
+
+// celRate 读取访问频率计数。计数只在表达式引用rate时递增，每个请求只计数一次，试运行不计数。
+// 按固定窗口计数，键中包含窗口序号，持续访问时计数也会在下一个窗口重新开始
+func (e *WAFEngine) celRate(c *gin.Context, domainID uint, clientIP string) map[string]int64 {
+	if cached, ok := c.Get(celRateKey); ok {
+		return cached.(map[string]int64)
+	}
+
+	rate := map[string]int64{"ip": 0, "ip_path": 0}
+	if e.redisClient != nil {
+		ctx := context.Background()
+		window := time.Now().Unix() / celRateWindow
+		ipKey := fmt.Sprintf("cel_rate:%d:%d:%s", domainID, window, clientIP)
+		pathKey := fmt.Sprintf("cel_rate:%d:%d:%s:%s", domainID, window, clientIP, c.Request.URL.Path)
+
+		if isDryRun(c) {
+			// 试运行不增加计数，返回计入本次请求后的值
+			ipCount, _ := e.redisClient.Get(ctx, ipKey).Int64()
+			pathCount, _ := e.redisClient.Get(ctx, pathKey).Int64()
+			rate["ip"], rate["ip_path"] = ipCount+1, pathCount+1
+		} else {
+			pipe := e.redisClient.Pipeline()
+			ipCount := pipe.Incr(ctx, ipKey)
+			pathCount := pipe.Incr(ctx, pathKey)
+			pipe.Expire(ctx, ipKey, celRateWindow*time.Second)
+			pipe.Expire(ctx, pathKey, celRateWindow*time.Second)
+			if _, err := pipe.Exec(ctx); err != nil {
+				log.Printf("Redis pipeline error: %v", err)
+			}
+			rate["ip"], rate["ip_path"] = ipCount.Val(), pathCount.Val()
+		}
+	}
+
+	c.Set(celRateKey, rate)
+	return rate
+}
@@ -0,0 +1,106 @@
+package waf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdClient 通过clamd的INSTREAM命令扫描上传文件，每个文件使用一个连接
+type clamdClient struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// SetClamAV 配置clamd地址，address为unix socket路径或host:port，timeout为扫描单个文件的超时时间
+func (e *WAFEngine) SetClamAV(address string, timeout time.Duration) error {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+	case strings.HasPrefix(address, "tcp:"):
+		address = strings.TrimPrefix(address, "tcp:")
+	case strings.HasPrefix(address, "/"):
+		network = "unix"
+	}
+	if network == "tcp" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid clamd address: %v", err)
+		}
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	e.clamd = &clamdClient{network: network, address: address, timeout: timeout}
+	return nil
+}
+
+// clamdStream 一次INSTREAM扫描，文件内容按块写入
+type clamdStream struct {
+	conn net.Conn
+	err  error
+}
+
+// open 连接clamd并开始INSTREAM扫描，连接的超时时间覆盖整个扫描过程
+func (c *clamdClient) open() (*clamdStream, error) {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send INSTREAM to clamd: %v", err)
+	}
+	return &clamdStream{conn: conn}, nil
+}
+
+// Write 发送一个数据块：4字节大端长度加数据。出错后不再发送，错误在result中返回
+func (s *clamdStream) Write(p []byte) (int, error) {
+	if s.err != nil || len(p) == 0 {
+		return len(p), nil
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(p)))
+	if _, err := s.conn.Write(size[:]); err != nil {
+		s.err = err
+	} else if _, err := s.conn.Write(p); err != nil {
+		s.err = err
+	}
+	return len(p), nil
+}
+
+// result 结束数据流并读取扫描结果，返回发现的病毒名，文件无病毒时返回空字符串。
+// clamd超过StreamMaxLength时会回复错误并关闭连接，因此发送出错后仍尝试读取回复
+func (s *clamdStream) result() (string, error) {
+	defer s.conn.Close()
+	if s.err == nil {
+		if _, err := s.conn.Write([]byte{0, 0, 0, 0}); err != nil {
+			s.err = err
+		}
+	}
+
+	reply, err := bufio.NewReader(s.conn).ReadString(0)
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	if reply == "" {
+		if s.err != nil {
+			return "", fmt.Errorf("failed to send file to clamd: %v", s.err)
+		}
+		return "", fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+
+	// 回复格式：stream: OK、stream: <病毒名> FOUND 或 <原因> ERROR
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	case reply == "OK":
+		return "", nil
+	default:
+		return "", fmt.Errorf("clamd: %s", reply)
+	}
+}
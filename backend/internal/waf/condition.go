@@ -0,0 +1,397 @@
+package waf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"waf-go/internal/certs"
+	"waf-go/internal/models"
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 组合条件的限制
+const (
+	maxConditionDepth  = 10   // 条件树最大嵌套深度
+	maxConditionLeaves = 50   // 条件树最多叶子条件数
+	maxConditionTrees  = 1000 // 解析结果缓存的最大条数，超出时清空重建
+)
+
+// ConditionTargets 叶子条件支持的匹配目标，需要名称的目标见conditionNamedTargets
+var ConditionTargets = []string{
+	"uri", "request_uri", "ip", "method", "host", "query", "header", "cookie", "body", "content_type", "user_agent",
+	"client_cert_subject", "client_cert_san", "client_cert_fingerprint",
+	"grpc_service", "grpc_method", "grpc_message",
+	"graphql_operation_name", "graphql_operation_type",
+	"file_name", "file_size", "file_type",
+}
+
+// ConditionOperators 叶子条件支持的运算符
+var ConditionOperators = []string{"exact", "contains", "regex", "prefix", "suffix", "exists", "cidr"}
+
+// conditionNamedTargets 必须指定名称的目标
+var conditionNamedTargets = []string{"header", "cookie"}
+
+// RuleCondition 组合规则的条件树节点。Op为and/or/not时是组合节点（not只有一个子条件），
+// 为空时是叶子条件，按Operator比较Target（及Name）对应的请求值和Value
+type RuleCondition struct {
+	Op         string          `json:"op,omitempty"`         // 组合方式：and, or, not；为空表示叶子条件
+	Conditions []RuleCondition `json:"conditions,omitempty"` // 子条件
+	Target     string          `json:"target,omitempty"`     // 匹配目标：uri（路径）, request_uri（路径和查询字符串）, method, header, query, cookie, body等
+	Name       string          `json:"name,omitempty"`       // 目标名称：请求头名、Cookie名、查询参数名、请求体参数名（JSON字段用.分隔）或gRPC字段路径
+	Operator   string          `json:"operator,omitempty"`   // 运算符：exact, contains, regex, prefix, suffix, exists, cidr
+	Value      string          `json:"value,omitempty"`      // 比较值，exists不需要
+}
+
+// regexCompiler 校验条件树时编译正则表达式的函数，引擎中使用带缓存的e.regex
+type regexCompiler func(pattern string) (*regexp.Regexp, error)
+
+// ParseRuleConditions 解析并校验JSON格式的条件树
+func ParseRuleConditions(data string) (*RuleCondition, error) {
+	return parseRuleConditions(data, CompileRegex)
+}
+
+func parseRuleConditions(data string, compile regexCompiler) (*RuleCondition, error) {
+	var condition RuleCondition
+	if err := json.Unmarshal([]byte(data), &condition); err != nil {
+		return nil, fmt.Errorf("invalid rule conditions: %v", err)
+	}
+	leaves := 0
+	if err := validateConditionNode(&condition, 1, &leaves, compile); err != nil {
+		return nil, err
+	}
+	return &condition, nil
+}
+
+// ValidateRuleCondition 校验条件树的结构、目标、运算符、正则表达式以及深度和叶子数限制
+func ValidateRuleCondition(condition *RuleCondition) error {
+	leaves := 0
+	return validateConditionNode(condition, 1, &leaves, CompileRegex)
+}
+
+// PrepareRuleConditions 校验条件树并将其中的正则表达式放入缓存，保存规则时调用
+func (e *WAFEngine) PrepareRuleConditions(condition *RuleCondition) error {
+	leaves := 0
+	return validateConditionNode(condition, 1, &leaves, e.regex)
+}
+
+// ruleConditions 获取组合规则条件树的解析结果，按JSON文本缓存，避免每个请求重复解析和校验
+func (e *WAFEngine) ruleConditions(data string) (*RuleCondition, error) {
+	e.conditionMu.RLock()
+	condition, ok := e.conditionTrees[data]
+	e.conditionMu.RUnlock()
+	if ok {
+		return condition, nil
+	}
+
+	condition, err := parseRuleConditions(data, e.regex)
+	if err != nil {
+		return nil, err
+	}
+
+	e.conditionMu.Lock()
+	if len(e.conditionTrees) >= maxConditionTrees {
+		e.conditionTrees = make(map[string]*RuleCondition)
+	}
+	e.conditionTrees[data] = condition
+	e.conditionMu.Unlock()
+	return condition, nil
+}
+
+func validateConditionNode(condition *RuleCondition, depth int, leaves *int, compile regexCompiler) error {
+	if depth > maxConditionDepth {
+		return fmt.Errorf("condition tree exceeds max depth %d", maxConditionDepth)
+	}
+
+	switch condition.Op {
+	case "and", "or":
+		if len(condition.Conditions) == 0 {
+			return fmt.Errorf("%s condition requires sub-conditions", condition.Op)
+		}
+	case "not":
+		if len(condition.Conditions) != 1 {
+			return errors.New("not condition requires exactly one sub-condition")
+		}
+	case "":
+		*leaves++
+		if *leaves > maxConditionLeaves {
+			return fmt.Errorf("condition tree exceeds max %d leaf conditions", maxConditionLeaves)
+		}
+		return validateConditionLeaf(condition, compile)
+	default:
+		return fmt.Errorf("unsupported condition op: %s", condition.Op)
+	}
+
+	for i := range condition.Conditions {
+		if err := validateConditionNode(&condition.Conditions[i], depth+1, leaves, compile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateConditionLeaf(condition *RuleCondition, compile regexCompiler) error {
+	if len(condition.Conditions) > 0 {
+		return errors.New("leaf condition cannot have sub-conditions")
+	}
+	if !containsString(ConditionTargets, condition.Target) {
+		return fmt.Errorf("unsupported condition target: %s", condition.Target)
+	}
+	if containsString(conditionNamedTargets, condition.Target) && condition.Name == "" {
+		return fmt.Errorf("condition target %s requires a name", condition.Target)
+	}
+	if !containsString(ConditionOperators, condition.Operator) {
+		return fmt.Errorf("unsupported condition operator: %s", condition.Operator)
+	}
+
+	switch condition.Operator {
+	case "regex":
+		if _, err := compile(condition.Value); err != nil {
+			return fmt.Errorf("invalid condition regex %q: %v", condition.Value, err)
+		}
+	case "cidr":
+		if condition.Target != "ip" {
+			return errors.New("cidr operator only applies to ip target")
+		}
+	case "exists":
+	default:
+		if condition.Value == "" {
+			return fmt.Errorf("condition %s %s requires a value", condition.Target, condition.Operator)
+		}
+	}
+	return nil
+}
+
+// matchConditions 计算组合规则的条件树，命中时返回导致命中的叶子条件说明。
+// 条件树的解析结果和叶子条件中的正则表达式都使用缓存
+func (e *WAFEngine) matchConditions(rule models.Rule, c *gin.Context, domainID uint, targets *excludedTargets) (bool, string) {
+	condition, err := e.ruleConditions(rule.Conditions)
+	if err != nil {
+		log.Printf("Invalid conditions in rule %d: %v", rule.ID, err)
+		return false, ""
+	}
+	matched, leaves := e.evalCondition(condition, c, domainID, targets)
+	if !matched {
+		return false, ""
+	}
+	return true, strings.Join(leaves, "; ")
+}
+
+// evalCondition 计算条件节点，返回结果和决定该结果的叶子条件说明
+func (e *WAFEngine) evalCondition(condition *RuleCondition, c *gin.Context, domainID uint, targets *excludedTargets) (bool, []string) {
+	switch condition.Op {
+	case "and":
+		var leaves []string
+		for i := range condition.Conditions {
+			matched, childLeaves := e.evalCondition(&condition.Conditions[i], c, domainID, targets)
+			if !matched {
+				return false, childLeaves
+			}
+			leaves = append(leaves, childLeaves...)
+		}
+		return true, leaves
+	case "or":
+		var leaves []string
+		for i := range condition.Conditions {
+			matched, childLeaves := e.evalCondition(&condition.Conditions[i], c, domainID, targets)
+			if matched {
+				return true, childLeaves
+			}
+			leaves = append(leaves, childLeaves...)
+		}
+		return false, leaves
+	case "not":
+		matched, childLeaves := e.evalCondition(&condition.Conditions[0], c, domainID, targets)
+		leaves := make([]string, len(childLeaves))
+		for i, leaf := range childLeaves {
+			leaves[i] = "NOT " + leaf
+		}
+		return !matched, leaves
+	}
+
+	values, present := e.conditionValues(condition, c, domainID, targets)
+	matched, actual := false, ""
+	for _, value := range values {
+		if e.matchConditionValue(condition, value) {
+			matched, actual = true, value
+			break
+		}
+	}
+	if condition.Operator == "exists" {
+		matched = present
+	}
+	if !matched && len(values) > 0 {
+		actual = values[0]
+	}
+	return matched, []string{describeCondition(condition, actual, present)}
+}
+
+// matchConditionValue 按运算符比较单个值
+func (e *WAFEngine) matchConditionValue(condition *RuleCondition, value string) bool {
+	switch condition.Operator {
+	case "prefix":
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(condition.Value))
+	case "suffix":
+		return strings.HasSuffix(strings.ToLower(value), strings.ToLower(condition.Value))
+	case "cidr":
+		return e.matchIP(condition.Value, value)
+	case "exists":
+		return true
+	default:
+		return e.performMatch(condition.Operator, condition.Value, value)
+	}
+}
+
+// describeCondition 生成叶子条件的说明，如 header[Referer] exists (absent)
+func describeCondition(condition *RuleCondition, actual string, present bool) string {
+	target := condition.Target
+	if condition.Name != "" {
+		target += "[" + condition.Name + "]"
+	}
+	desc := target + " " + condition.Operator
+	if condition.Operator != "exists" {
+		desc += fmt.Sprintf(" %q", condition.Value)
+	}
+	if !present {
+		return desc + " (absent)"
+	}
+	return fmt.Sprintf("%s (value: %s)", desc, truncateSample(actual))
+}
+
+// conditionValues 获取叶子条件目标对应的请求值，present表示目标在请求中存在
+func (e *WAFEngine) conditionValues(condition *RuleCondition, c *gin.Context, domainID uint, targets *excludedTargets) ([]string, bool) {
+	single := func(value string) ([]string, bool) {
+		return []string{value}, value != ""
+	}
+
+	switch condition.Target {
+	case "uri":
+		return single(c.Request.URL.Path)
+	case "request_uri":
+		return single(decodedRequestURI(c.Request.URL))
+	case "ip":
+		return single(c.ClientIP())
+	case "method":
+		return single(c.Request.Method)
+	case "host":
+		return single(c.Request.Host)
+	case "content_type":
+		return single(c.GetHeader("Content-Type"))
+	case "query":
+		if condition.Name == "" {
+			return single(c.Request.URL.RawQuery)
+		}
+		values, ok := c.Request.URL.Query()[condition.Name]
+		return values, ok
+	case "header", "user_agent":
+		name := condition.Name
+		if condition.Target == "user_agent" {
+			name = "User-Agent"
+		}
+		if targets.excludesHeader(name) {
+			return nil, false
+		}
+		values := c.Request.Header.Values(name)
+		return values, len(values) > 0
+	case "cookie":
+		cookie, err := c.Request.Cookie(condition.Name)
+		if err != nil {
+			return nil, false
+		}
+		return []string{cookie.Value}, true
+	case "body":
+		body := inspectedBody(c, targets)
+		if condition.Name == "" {
+			return single(body)
+		}
+		return bodyArgument(c, body, condition.Name)
+	case "client_cert_subject", "client_cert_san", "client_cert_fingerprint":
+		clientCert := certs.ClientCertificate(c.Request.TLS)
+		if clientCert == nil {
+			return nil, false
+		}
+		switch condition.Target {
+		case "client_cert_subject":
+			return single(clientCert.Subject)
+		case "client_cert_san":
+			return clientCert.SANs, len(clientCert.SANs) > 0
+		default:
+			return single(clientCert.Fingerprint)
+		}
+	case "grpc_service", "grpc_method":
+		if !utils.IsGRPCRequest(c.Request) {
+			return nil, false
+		}
+		service, method, ok := GRPCMethod(c.Request.URL.Path)
+		if !ok {
+			return nil, false
+		}
+		if condition.Target == "grpc_method" {
+			return single(service + "/" + method)
+		}
+		return single(service)
+	case "grpc_message":
+		if !utils.IsGRPCRequest(c.Request) {
+			return nil, false
+		}
+		fields, err := e.grpcMessage(c, domainID)
+		if err != nil {
+			return nil, false
+		}
+		if condition.Name == "" {
+			return single(jsonString(fields))
+		}
+		value, ok := grpcFieldValue(fields, condition.Name)
+		if !ok {
+			return nil, false
+		}
+		return []string{value}, true
+	case "graphql_operation_name", "graphql_operation_type":
+		values := e.graphqlRuleValues(c, domainID, condition.Target)
+		return values, len(values) > 0
+	case "file_name", "file_size", "file_type":
+		values := e.uploadRuleValues(c, domainID, condition.Target)
+		return values, len(values) > 0
+	}
+	return nil, false
+}
+
+// decodedRequestURI 返回URL解码后的路径和查询字符串，对应ModSecurity的REQUEST_URI经过t:urlDecode后的值
+func decodedRequestURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query, err := url.QueryUnescape(u.RawQuery)
+	if err != nil {
+		query = u.RawQuery
+	}
+	return u.Path + "?" + query
+}
+
+// bodyArgument 获取表单请求体参数或JSON请求体字段的值
+func bodyArgument(c *gin.Context, body, name string) ([]string, bool) {
+	if strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return nil, false
+		}
+		args, ok := values[name]
+		return args, ok
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return nil, false
+	}
+	value, ok := grpcFieldValue(fields, name)
+	if !ok {
+		return nil, false
+	}
+	return []string{value}, true
+}
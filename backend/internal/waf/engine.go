@@ -2,17 +2,24 @@ package waf
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"waf-go/internal/certs"
 	"waf-go/internal/models"
+	"waf-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/cel-go/cel"
+	"github.com/oschwald/geoip2-golang"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"gorm.io/gorm"
 )
 
@@ -24,6 +31,47 @@ type WAFEngine struct {
 	blackList   []models.BlackList
 	whiteList   []models.WhiteList
 	lastUpdate  time.Time
+
+	grpcMu    sync.RWMutex
+	grpcFiles map[uint]*protoregistry.Files // 域名ID -> gRPC描述文件注册表
+
+	apiMu    sync.RWMutex
+	apiSpecs map[uint][]*compiledAPISpec // 域名ID -> 启用的OpenAPI规范
+
+	apiObsMu        sync.Mutex                            // 保护apiObservations
+	apiObservations map[string]*models.APISpecObservation // 规范ID|方法|路径|参数|约束 -> 尚未写入数据库的learn模式违规
+
+	learnMu  sync.RWMutex
+	learning map[uint]*learningRecorder // 域名ID -> 正在记录的学习会话
+
+	celMu       sync.RWMutex
+	celPrograms map[string]cel.Program // 规则表达式 -> 编译结果
+	geoIP       *geoip2.Reader         // GeoIP数据库，未配置时为nil
+	clamd       *clamdClient           // ClamAV扫描客户端，未配置时为nil
+
+	challengeOnce   sync.Once
+	challengeSecret []byte // 登录质询cookie的签名密钥
+
+	matchMu           sync.RWMutex
+	ruleMatchers      map[uint]*ruleMatcher // 域名ID -> 规则多模式匹配器
+	whiteListMatchers map[uint]*listMatcher // 域名ID -> 白名单匹配器
+	blackListMatchers map[uint]*listMatcher // 域名ID -> 黑名单匹配器
+	shadowMatchers    map[uint]*ruleMatcher // 域名ID -> 影子规则多模式匹配器
+
+	regexMu sync.RWMutex
+	regexes map[string]*regexp.Regexp // 正则表达式 -> 编译结果
+
+	conditionMu    sync.RWMutex
+	conditionTrees map[string]*RuleCondition // 组合规则条件树JSON -> 解析结果
+
+	timingMu    sync.RWMutex
+	ruleTimings map[uint]*ruleTiming // 规则ID -> 计算耗时统计
+
+	shadowQueue chan *shadowJob           // 等待影子评估的请求
+	shadowMu    sync.Mutex                // 保护shadowStats
+	shadowStats map[uint]*shadowAggregate // 域名ID -> 尚未写入数据库的影子评估结果
+
+	evaluationRouter *gin.Engine // 处理试运行和规则测试的模拟请求
 }
 
 type RequestInfo struct {
@@ -56,11 +104,34 @@ func NewWAFEngine(db *gorm.DB, redisClient *redis.Client) *WAFEngine {
 		blackList:   []models.BlackList{},
 		whiteList:   []models.WhiteList{},
 		lastUpdate:  time.Time{},
+		grpcFiles:   make(map[uint]*protoregistry.Files),
+		apiSpecs:    make(map[uint][]*compiledAPISpec),
+		learning:    make(map[uint]*learningRecorder),
+		celPrograms: make(map[string]cel.Program),
+
+		ruleMatchers:      make(map[uint]*ruleMatcher),
+		whiteListMatchers: make(map[uint]*listMatcher),
+		blackListMatchers: make(map[uint]*listMatcher),
+		shadowMatchers:    make(map[uint]*ruleMatcher),
+
+		regexes:        make(map[string]*regexp.Regexp),
+		conditionTrees: make(map[string]*RuleCondition),
+		ruleTimings:    make(map[uint]*ruleTiming),
+
+		shadowQueue: make(chan *shadowJob, shadowQueueSize),
+		shadowStats: make(map[uint]*shadowAggregate),
+
+		apiObservations: make(map[string]*models.APISpecObservation),
+
+		evaluationRouter: newEvaluationRouter(),
 	}
 
 	// 初始化时加载所有规则
 	engine.LoadRules()
 
+	// 恢复记录中的学习会话
+	engine.loadLearningSessions()
+
 	return engine
 }
 
@@ -112,27 +183,13 @@ func (e *WAFEngine) GetDomainByHost(host string) (*models.Domain, error) {
 	return nil, fmt.Errorf("domain not found: %s", hostWithoutPort)
 }
 
-// GetDomainRules 获取域名对应的所有规则（通过域名->策略->规则的关联）
+// GetDomainRules 获取域名对应的所有规则（通过域名->策略->规则的关联），不包括模式为off的策略和影子策略
 func (e *WAFEngine) GetDomainRules(domainID uint) ([]models.Rule, error) {
-	var rules []models.Rule
-
-	// 通过多对多关联获取域名对应的规则
-	// 查询路径：domains -> domain_policies -> policies -> policy_rules -> rules
-	err := e.db.Table("rules").
-		Select("DISTINCT rules.*").
-		Joins("JOIN policy_rules ON rules.id = policy_rules.rule_id").
-		Joins("JOIN policies ON policy_rules.policy_id = policies.id").
-		Joins("JOIN domain_policies ON policies.id = domain_policies.policy_id").
-		Where("domain_policies.domain_id = ? AND domain_policies.enabled = ? AND policy_rules.enabled = ? AND policies.enabled = ? AND rules.enabled = ?",
-			domainID, true, true, true, true).
-		Order("policy_rules.priority DESC, rules.priority DESC").
-		Find(&rules).Error
-
+	set, err := e.domainRules(domainID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get domain rules: %v", err)
+		return nil, err
 	}
-
-	return rules, nil
+	return set.rules, nil
 }
 
 // GetDomainBlackList 获取域名对应的黑名单（通过多对多关联）
@@ -179,8 +236,10 @@ func (e *WAFEngine) GetDomainWhiteList(domainID uint) ([]models.WhiteList, error
 func (e *WAFEngine) CheckRequest(c *gin.Context) (*CheckResult, error) {
 	// 获取域名配置
 	host := c.Request.Host
+	trace := evaluationTrace(c)
 	domain, err := e.GetDomainByHost(host)
 	if err != nil {
+		trace.step("domain", TraceSkipped, fmt.Sprintf("domain not configured: %s", host))
 		return &CheckResult{
 			Action:     "allow",
 			StatusCode: 200,
@@ -198,47 +257,81 @@ func (e *WAFEngine) CheckRequest(c *gin.Context) (*CheckResult, error) {
 		TenantID:   domain.TenantID,
 	}
 
+	if trace != nil {
+		trace.Domain, trace.DomainID, trace.DomainMode = domain.Domain, domain.ID, RelaxedMode(domain.Mode)
+	}
+	if domain.Mode == ModeOff {
+		trace.step("domain", TraceSkipped, "WAF disabled for domain")
+		result.Message = "WAF disabled for domain"
+		return result, nil
+	}
+	trace.step("domain", TracePass, domain.Domain)
+
+	e.checkRequest(c, domain, result)
+
+	// 域名为检测模式时拦截结果转为would_block，请求照常转发
+	if domain.Mode == ModeDetectOnly && (result.Action == "block" || result.Action == ActionChallenge) {
+		wouldBlock(result)
+	}
+	return result, nil
+}
+
+// checkRequest 依次执行白名单、黑名单、速率限制、协议校验、登录防护、GraphQL、文件上传、OpenAPI和规则检查，结果写入result。
+// 试运行时每个阶段和每条规则的计算结果记录到trace中
+func (e *WAFEngine) checkRequest(c *gin.Context, domain *models.Domain, result *CheckResult) {
+	trace := evaluationTrace(c)
 	clientIP := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 	uri := c.Request.URL.Path
+	var certFingerprint string
+	if clientCert := certs.ClientCertificate(c.Request.TLS); clientCert != nil {
+		certFingerprint = clientCert.Fingerprint
+	}
 
 	// 1. 首先检查白名单（优先级最高）
 	whiteList, err := e.GetDomainWhiteList(domain.ID)
 	if err != nil {
 		log.Printf("Failed to get domain whitelist: %v", err)
+		trace.step("whitelist", TraceError, err.Error())
+	} else if i := e.whiteListMatcher(domain.ID, whiteList).first(clientIP, uri, userAgent, certFingerprint); i >= 0 {
+		result.Action = "allow"
+		result.Message = fmt.Sprintf("Whitelisted: %s", whiteList[i].Comment)
+		trace.step("whitelist", TraceMatch, fmt.Sprintf("%s %s", whiteList[i].Type, whiteList[i].Value))
+		return
 	} else {
-		for _, item := range whiteList {
-			if e.matchWhiteList(item, clientIP, uri, userAgent) {
-				result.Action = "allow"
-				result.Message = fmt.Sprintf("Whitelisted: %s", item.Comment)
-				return result, nil
-			}
-		}
+		trace.step("whitelist", TracePass, fmt.Sprintf("%d entries", len(whiteList)))
 	}
 
 	// 2. 检查黑名单
 	blackList, err := e.GetDomainBlackList(domain.ID)
 	if err != nil {
 		log.Printf("Failed to get domain blacklist: %v", err)
-	} else {
-		for _, item := range blackList {
-			if e.matchBlackList(item, clientIP, uri, userAgent) {
-				result.Action = "block"
-				result.StatusCode = 403
-				result.Message = fmt.Sprintf("Blacklisted: %s", item.Comment)
-				result.MatchedRule = &MatchedRule{
-					ID:         0, // 黑名单没有规则ID
-					Name:       fmt.Sprintf("黑名单-%s", item.Type),
-					MatchField: item.Type,
-					MatchValue: item.Value,
-				}
-				return result, nil
-			}
+		trace.step("blacklist", TraceError, err.Error())
+	} else if i := e.blackListMatcher(domain.ID, blackList).first(clientIP, uri, userAgent, certFingerprint); i >= 0 {
+		item := blackList[i]
+		result.Action = "block"
+		result.StatusCode = 403
+		result.Message = fmt.Sprintf("Blacklisted: %s", item.Comment)
+		result.MatchedRule = &MatchedRule{
+			ID:         0, // 黑名单没有规则ID
+			Name:       fmt.Sprintf("黑名单-%s", item.Type),
+			MatchField: item.Type,
+			MatchValue: item.Value,
 		}
+		trace.step("blacklist", TraceMatch, fmt.Sprintf("%s %s", item.Type, item.Value))
+		return
+	} else {
+		trace.step("blacklist", TracePass, fmt.Sprintf("%d entries", len(blackList)))
 	}
 
-	// 3. 检查速率限制
-	if e.checkRateLimit(clientIP, domain.TenantID) {
+	// 3. 检查速率限制，试运行只读取计数
+	var limited bool
+	if trace != nil {
+		limited = e.rateLimitReached(clientIP, domain.TenantID)
+	} else {
+		limited = e.checkRateLimit(clientIP, domain.TenantID)
+	}
+	if limited {
 		result.Action = "block"
 		result.StatusCode = 429
 		result.Message = "Rate limit exceeded"
@@ -248,73 +341,215 @@ func (e *WAFEngine) CheckRequest(c *gin.Context) (*CheckResult, error) {
 			MatchField: "rate_limit",
 			MatchValue: clientIP,
 		}
-		return result, nil
+		trace.step("rate_limit", TraceMatch, clientIP)
+		return
+	}
+	trace.step("rate_limit", TracePass, clientIP)
+
+	// 4. 校验HTTP协议
+	if !domain.ProtocolValidation {
+		trace.step("protocol", TraceSkipped, "protocol validation disabled")
+	} else if violation := e.checkProtocol(c, domain); violation != nil {
+		result.Action = "block"
+		result.StatusCode = violation.Status
+		result.Message = fmt.Sprintf("Protocol violation: %s", violation.Type)
+		result.MatchedRule = violation.rule()
+		trace.step("protocol", TraceMatch, fmt.Sprintf("%s: %s", violation.Type, violation.Value))
+		return
+	} else {
+		trace.step("protocol", TracePass, "")
+	}
+
+	// 5. 登录接口防护暴力破解和撞库，试运行只读取计数
+	if attempt, violation := e.checkLogin(c, domain.ID, trace != nil); violation != nil {
+		result.Username = attempt.loggedUsername()
+		result.MatchedRule = violation.rule()
+		trace.step("login", TraceMatch, fmt.Sprintf("%s: %s", violation.Action, violation.Reason))
+		switch violation.Action {
+		case loginBlock:
+			result.Action = "block"
+			result.StatusCode = 429
+			result.Message = fmt.Sprintf("Too many failed login attempts: %s", violation.Type)
+			return
+		case loginChallenge:
+			result.Action = ActionChallenge
+			result.StatusCode = 403
+			result.Message = fmt.Sprintf("Login challenge required: %s", violation.Type)
+			return
+		default:
+			// 延迟后照常转发，检测模式和试运行不延迟
+			result.Action = "log"
+			result.Message = fmt.Sprintf("Login delayed %s: %s", violation.Delay, violation.Type)
+			if trace == nil && domain.Mode != ModeDetectOnly {
+				delayLogin(c, violation.Delay)
+			}
+		}
+	} else if attempt != nil {
+		result.Username = attempt.loggedUsername()
+		trace.step("login", TracePass, attempt.loggedUsername())
+	} else {
+		trace.step("login", TracePass, "")
+	}
+
+	// 6. 检查GraphQL查询限制
+	if endpoint, violation, reason := e.checkGraphQL(c, domain.ID); violation != nil {
+		result.MatchedRule = violation
+		trace.step("graphql", TraceMatch, fmt.Sprintf("%s: %s", endpoint.Action, reason))
+		if endpoint.Action == "log" {
+			result.Action = "log"
+			result.Message = fmt.Sprintf("GraphQL query logged: %s", reason)
+		} else {
+			result.Action = "block"
+			result.StatusCode = 403
+			result.Message = fmt.Sprintf("GraphQL query rejected: %s", reason)
+			return
+		}
+	} else {
+		trace.step("graphql", TracePass, "")
+	}
+
+	// 7. 按上传策略检查multipart请求中的文件
+	if policy, violation := e.checkUploads(c, domain.ID); violation != nil {
+		result.MatchedRule = violation.rule()
+		trace.step("upload", TraceMatch, fmt.Sprintf("%s: %s", policy.Action, violation.Reason))
+		if policy.Action == "log" {
+			result.Action = "log"
+			result.Message = fmt.Sprintf("File upload logged: %s", violation.Type)
+		} else {
+			result.Action = "block"
+			result.StatusCode = violation.Status
+			result.Message = fmt.Sprintf("File upload rejected: %s", violation.Type)
+			return
+		}
+	} else {
+		trace.step("upload", TracePass, "")
+	}
+
+	// 8. 按OpenAPI规范校验请求
+	if spec, violation := e.checkAPISpec(c, domain.ID); violation != nil {
+		trace.step("openapi", TraceMatch, fmt.Sprintf("%s: %s %s violates %s", spec.Mode, violation.Method, violation.Parameter, violation.Constraint))
+		switch spec.Mode {
+		case APISpecEnforce:
+			result.Action = "block"
+			result.StatusCode = apiViolationStatus(violation)
+			result.Message = fmt.Sprintf("Request violates API spec: %s %s", violation.Parameter, violation.Constraint)
+			result.MatchedRule = apiViolationRule(spec, violation)
+			return
+		case APISpecLogOnly:
+			result.Action = "log"
+			result.Message = fmt.Sprintf("Logged by API spec: %s %s", violation.Parameter, violation.Constraint)
+			result.MatchedRule = apiViolationRule(spec, violation)
+		case APISpecLearn:
+			if trace == nil {
+				e.recordAPIObservation(spec, violation)
+			}
+		}
+	} else {
+		trace.step("openapi", TracePass, "")
 	}
 
-	// 4. 检查WAF规则
-	rules, err := e.GetDomainRules(domain.ID)
+	// 9. 检查WAF规则，试运行指定了策略时用这些策略替换域名关联的策略
+	var ruleSet *domainRuleSet
+	if trace != nil && trace.Policies != nil {
+		ruleSet, err = e.policyRules(trace.Policies)
+	} else {
+		ruleSet, err = e.domainRules(domain.ID)
+	}
 	if err != nil {
 		log.Printf("Failed to get domain rules: %v", err)
+		trace.step("rules", TraceError, err.Error())
 		// 如果获取规则失败，默认允许通过
-		return result, nil
+		return
 	}
+	rules, ruleModes := ruleSet.rules, ruleSet.modes
+	trace.step("rules", TracePass, fmt.Sprintf("%d rules", len(rules)))
 
+	exclusions, err := e.GetDomainExclusions(domain.ID)
+	if err != nil {
+		log.Printf("Failed to get domain exclusions: %v", err)
+	}
+
+	// 有影子策略时，在规则检查结束后将请求交给后台评估；试运行不评估影子策略
+	if trace != nil {
+		trace.ShadowRules = len(ruleSet.shadow)
+	} else if len(ruleSet.shadow) > 0 {
+		defer e.enqueueShadow(c, domain, ruleSet.shadow, exclusions, result)
+	}
+
+	// contains和exact规则按匹配目标一次扫描得到所有命中
+	hits := e.newLiteralHits(e.ruleMatchers, domain.ID, rules)
 	for _, rule := range rules {
-		matched, matchValue := e.matchRule(rule, c)
-		if matched {
-			result.MatchedRule = &MatchedRule{
-				ID:         rule.ID,
-				Name:       rule.Name,
-				MatchField: rule.MatchType,
-				MatchValue: matchValue,
+		ruleTrace := newRuleTrace(rule, ruleModes[rule.ID])
+
+		// 规则排除在匹配前生效，被排除的规则仍然检查，命中时记录到攻击日志中
+		skip, targets, via := e.ruleExclusions(exclusions, rule, uri)
+		if skip != nil {
+			ruleTrace.Exclusion = skip.Name
+			if matched, matchValue := e.evaluateRule(hits, rule, c, domain.ID, nil); matched {
+				result.Suppressed = append(result.Suppressed, suppressedHit(rule, skip, matchValue))
+				ruleTrace.Suppressed, ruleTrace.MatchValue = true, matchValue
+			}
+			trace.rule(ruleTrace)
+			continue
+		}
+		matched, matchValue := e.evaluateRule(hits, rule, c, domain.ID, targets)
+		if !matched && targets != nil {
+			if hit, hitValue := e.evaluateRule(hits, rule, c, domain.ID, nil); hit {
+				result.Suppressed = append(result.Suppressed, suppressedHit(rule, via, hitValue))
+				ruleTrace.Exclusion, ruleTrace.Suppressed, ruleTrace.MatchValue = via.Name, true, hitValue
 			}
+		}
+		if !matched {
+			trace.rule(ruleTrace)
+			continue
+		}
+		ruleTrace.Matched, ruleTrace.MatchValue = true, matchValue
+		trace.rule(ruleTrace)
+		e.recordLearningHit(c, domain.ID, rule, matchValue)
+		matchedRule := &MatchedRule{
+			ID:         rule.ID,
+			Name:       rule.Name,
+			MatchField: rule.MatchType,
+			MatchValue: matchValue,
+		}
 
-			switch rule.Action {
-			case "block":
-				result.Action = "block"
-				result.StatusCode = rule.ResponseCode
-				if rule.ResponseMsg != "" {
-					result.Message = rule.ResponseMsg
-				} else {
-					result.Message = fmt.Sprintf("Blocked by rule: %s", rule.Name)
-				}
-				return result, nil
-			case "log":
+		switch rule.Action {
+		case "block":
+			result.Action = "block"
+			result.MatchedRule = matchedRule
+			result.StatusCode = rule.ResponseCode
+			if rule.ResponseMsg != "" {
+				result.Message = rule.ResponseMsg
+			} else {
+				result.Message = fmt.Sprintf("Blocked by rule: %s", rule.Name)
+			}
+			if ruleModes[rule.ID] != ModeDetectOnly {
+				return
+			}
+			// 检测模式策略的规则只记录would_block，继续检查其他策略的规则
+			wouldBlock(result)
+		case "log":
+			// 已有would_block时保留其记录
+			if result.Action != ActionWouldBlock {
 				result.Action = "log"
+				result.MatchedRule = matchedRule
 				result.Message = fmt.Sprintf("Logged by rule: %s", rule.Name)
-				// 继续检查其他规则
-			case "allow":
+			}
+			// 继续检查其他规则
+		case "allow":
+			// 拦截模式下请求在此之前已被拦截，保留would_block
+			if result.Action != ActionWouldBlock {
 				result.Action = "allow"
+				result.MatchedRule = matchedRule
 				result.Message = fmt.Sprintf("Allowed by rule: %s", rule.Name)
-				return result, nil
 			}
+			e.recordLearningProfile(c, domain.ID)
+			return
 		}
 	}
 
-	return result, nil
-}
-
-// matchWhiteList 检查是否匹配白名单
-func (e *WAFEngine) matchWhiteList(item models.WhiteList, clientIP, uri, userAgent string) bool {
-	return e.matchListItem(item.Type, item.Value, clientIP, uri, userAgent)
-}
-
-// matchBlackList 检查是否匹配黑名单
-func (e *WAFEngine) matchBlackList(item models.BlackList, clientIP, uri, userAgent string) bool {
-	return e.matchListItem(item.Type, item.Value, clientIP, uri, userAgent)
-}
-
-// matchListItem 通用的列表项匹配函数
-func (e *WAFEngine) matchListItem(itemType, value, clientIP, uri, userAgent string) bool {
-	switch itemType {
-	case "ip":
-		return e.matchIP(value, clientIP)
-	case "uri":
-		return strings.Contains(uri, value)
-	case "user_agent":
-		return strings.Contains(strings.ToLower(userAgent), strings.ToLower(value))
-	}
-	return false
+	// 学习会话只记录未被拦截的请求
+	e.recordLearningProfile(c, domain.ID)
 }
 
 // matchIP 检查IP是否匹配（支持CIDR）
@@ -333,31 +568,27 @@ func (e *WAFEngine) matchIP(pattern, clientIP string) bool {
 	return pattern == clientIP
 }
 
-// checkRateLimit 检查速率限制
+// 速率限制：每个租户下的客户端IP在窗口内的最大请求数
+const (
+	rateLimitWindow      = 60  // 60秒窗口
+	rateLimitMaxRequests = 100 // 最大请求数
+)
+
+// checkRateLimit 检查速率限制，未超过限制时计数加一
 func (e *WAFEngine) checkRateLimit(clientIP string, tenantID uint) bool {
+	if e.rateLimitReached(clientIP, tenantID) {
+		return true
+	}
+
 	// 使用Redis实现滑动窗口速率限制
 	key := fmt.Sprintf("rate_limit:%d:%s", tenantID, clientIP)
-	window := 60       // 60秒窗口
-	maxRequests := 100 // 最大请求数
-
 	ctx := context.Background()
 
-	// 获取当前计数
-	count, err := e.redisClient.Get(ctx, key).Int()
-	if err != nil && err.Error() != "redis: nil" {
-		log.Printf("Redis error: %v", err)
-		return false
-	}
-
-	if count >= maxRequests {
-		return true
-	}
-
 	// 增加计数
 	pipe := e.redisClient.Pipeline()
 	pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, time.Duration(window)*time.Second)
-	_, err = pipe.Exec(ctx)
+	pipe.Expire(ctx, key, time.Duration(rateLimitWindow)*time.Second)
+	_, err := pipe.Exec(ctx)
 	if err != nil {
 		log.Printf("Redis pipeline error: %v", err)
 	}
@@ -365,8 +596,27 @@ func (e *WAFEngine) checkRateLimit(clientIP string, tenantID uint) bool {
 	return false
 }
 
-// matchRule 检查请求是否匹配规则
-func (e *WAFEngine) matchRule(rule models.Rule, c *gin.Context) (bool, string) {
+// rateLimitReached 读取当前计数，判断是否已达到速率限制，不增加计数
+func (e *WAFEngine) rateLimitReached(clientIP string, tenantID uint) bool {
+	key := fmt.Sprintf("rate_limit:%d:%s", tenantID, clientIP)
+
+	// 获取当前计数
+	count, err := e.redisClient.Get(context.Background(), key).Int()
+	if err != nil && err.Error() != "redis: nil" {
+		log.Printf("Redis error: %v", err)
+		return false
+	}
+
+	return count >= rateLimitMaxRequests
+}
+
+// matchRule 检查请求是否匹配规则，targets为规则排除去掉的请求体参数和请求头
+func (e *WAFEngine) matchRule(rule models.Rule, c *gin.Context, domainID uint, targets *excludedTargets) (bool, string) {
+	// 表达式规则基于整个请求计算，匹配类型只用于记录
+	if rule.MatchMode == "cel" {
+		return e.matchCEL(rule.Pattern, c, domainID, targets)
+	}
+
 	var value string
 
 	switch rule.MatchType {
@@ -379,21 +629,92 @@ func (e *WAFEngine) matchRule(rule models.Rule, c *gin.Context) (bool, string) {
 		if strings.Contains(rule.Pattern, ":") {
 			parts := strings.SplitN(rule.Pattern, ":", 2)
 			headerName, expectedValue := parts[0], parts[1]
+			if targets.excludesHeader(headerName) {
+				return false, ""
+			}
 			actualValue := c.GetHeader(headerName)
 			return e.performMatch(rule.MatchMode, expectedValue, actualValue), actualValue
 		} else {
+			if targets.excludesHeader(rule.Pattern) {
+				return false, ""
+			}
 			value = c.GetHeader(rule.Pattern)
 		}
 	case "body":
-		// 读取请求体
-		if c.Request.Body != nil {
-			bodyBytes, err := c.GetRawData()
-			if err == nil {
-				value = string(bodyBytes)
-			}
-		}
+		// 读取请求体（读取后会恢复，转发给后端的请求体不受影响）
+		value = inspectedBody(c, targets)
 	case "user_agent":
+		if targets.excludesHeader("User-Agent") {
+			return false, ""
+		}
 		value = c.GetHeader("User-Agent")
+	case "client_cert_subject", "client_cert_san", "client_cert_fingerprint":
+		// 未提供客户端证书时不匹配
+		clientCert := certs.ClientCertificate(c.Request.TLS)
+		if clientCert == nil {
+			return false, ""
+		}
+		switch rule.MatchType {
+		case "client_cert_subject":
+			value = clientCert.Subject
+		case "client_cert_san":
+			value = strings.Join(clientCert.SANs, ",")
+		case "client_cert_fingerprint":
+			value = clientCert.Fingerprint
+			if rule.MatchMode == "exact" {
+				return certs.NormalizeFingerprint(rule.Pattern) == value, value
+			}
+		}
+	case "grpc_service", "grpc_method":
+		if !utils.IsGRPCRequest(c.Request) {
+			return false, ""
+		}
+		service, method, ok := GRPCMethod(c.Request.URL.Path)
+		if !ok {
+			return false, ""
+		}
+		value = service
+		if rule.MatchType == "grpc_method" {
+			value = service + "/" + method
+		}
+	case "grpc_message":
+		// pattern格式: "field.path:value" 匹配指定字段，否则匹配整个消息的JSON
+		if !utils.IsGRPCRequest(c.Request) {
+			return false, ""
+		}
+		fields, err := e.grpcMessage(c, domainID)
+		if err != nil {
+			log.Printf("Failed to decode gRPC message: %v", err)
+			return false, ""
+		}
+		if strings.Contains(rule.Pattern, ":") {
+			parts := strings.SplitN(rule.Pattern, ":", 2)
+			fieldValue, ok := grpcFieldValue(fields, parts[0])
+			if !ok {
+				return false, ""
+			}
+			return e.performMatch(rule.MatchMode, parts[1], fieldValue), fieldValue
+		}
+		value = jsonString(fields)
+	case "graphql_operation_name", "graphql_operation_type":
+		// 批量请求或多操作文档中任一操作匹配即命中
+		for _, value := range e.graphqlRuleValues(c, domainID, rule.MatchType) {
+			if e.performMatch(rule.MatchMode, rule.Pattern, value) {
+				return true, value
+			}
+		}
+		return false, ""
+	case "file_name", "file_size", "file_type":
+		// 任一上传文件匹配即命中
+		for _, value := range e.uploadRuleValues(c, domainID, rule.MatchType) {
+			if e.performMatch(rule.MatchMode, rule.Pattern, value) {
+				return true, value
+			}
+		}
+		return false, ""
+	case "compound":
+		// 组合规则按条件树计算，匹配值为导致命中的叶子条件
+		return e.matchConditions(rule, c, domainID, targets)
 	default:
 		return false, ""
 	}
@@ -410,12 +731,7 @@ func (e *WAFEngine) performMatch(matchMode, pattern, value string) bool {
 	case "contains":
 		return strings.Contains(strings.ToLower(value), strings.ToLower(pattern))
 	case "regex":
-		matched, err := regexp.MatchString(pattern, value)
-		if err != nil {
-			log.Printf("Regex error: %v", err)
-			return false
-		}
-		return matched
+		return e.matchRegex(pattern, value)
 	default:
 		return false
 	}
@@ -423,16 +739,34 @@ func (e *WAFEngine) performMatch(matchMode, pattern, value string) bool {
 
 // LogAttack 记录攻击日志
 func (e *WAFEngine) LogAttack(c *gin.Context, result *CheckResult) {
-	if result.MatchedRule == nil {
+	if result.MatchedRule == nil && len(result.Suppressed) == 0 {
 		return
 	}
 
-	// 读取请求体
-	var requestBody string
-	if c.Request.Body != nil {
-		if bodyBytes, err := c.GetRawData(); err == nil {
-			requestBody = string(bodyBytes)
+	// 请求被放行但有命中被规则排除跳过时，记录第一条被跳过的命中
+	matchedRule, action := result.MatchedRule, result.Action
+	if matchedRule == nil || action == "allow" {
+		hit := result.Suppressed[0]
+		matchedRule = &MatchedRule{
+			ID:         hit.RuleID,
+			Name:       hit.RuleName,
+			MatchField: hit.MatchField,
+			MatchValue: hit.MatchValue,
 		}
+		action = "excluded"
+	}
+
+	var suppressedHits string
+	if len(result.Suppressed) > 0 {
+		if data, err := json.Marshal(result.Suppressed); err == nil {
+			suppressedHits = string(data)
+		}
+	}
+
+	// 读取请求体，登录请求只保留脱敏后的用户名
+	requestBody := string(requestBody(c))
+	if cached, ok := c.Get(loginKey); ok && cached.(*loginAttempt) != nil {
+		requestBody = redactedLoginBody(c, cached.(*loginAttempt), requestBody)
 	}
 
 	// 获取请求头
@@ -472,12 +806,14 @@ func (e *WAFEngine) LogAttack(c *gin.Context, result *CheckResult) {
 		RequestBody:    requestBody,
 		DomainID:       result.DomainID,
 		Domain:         domain,
-		RuleID:         result.MatchedRule.ID,
-		RuleName:       result.MatchedRule.Name,
-		MatchField:     result.MatchedRule.MatchField,
-		MatchValue:     result.MatchedRule.MatchValue,
-		Action:         result.Action,
+		RuleID:         matchedRule.ID,
+		RuleName:       matchedRule.Name,
+		MatchField:     matchedRule.MatchField,
+		MatchValue:     matchedRule.MatchValue,
+		Username:       result.Username,
+		Action:         action,
 		ResponseCode:   result.StatusCode,
+		SuppressedHits: suppressedHits,
 		TenantID:       result.TenantID,
 		CreatedAt:      time.Now(),
 	}
@@ -494,13 +830,15 @@ func generateRequestID() string {
 
 // CheckResult WAF检查结果
 type CheckResult struct {
-	Action      string       `json:"action"`       // allow, block, log
-	StatusCode  int          `json:"status_code"`  // HTTP状态码
-	Message     string       `json:"message"`      // 响应消息
-	Domain      string       `json:"domain"`       // 匹配的域名
-	DomainID    uint         `json:"domain_id"`    // 域名ID
-	TenantID    uint         `json:"tenant_id"`    // 租户ID
-	MatchedRule *MatchedRule `json:"matched_rule"` // 匹配的规则
+	Action      string          `json:"action"`               // allow, block, log, would_block, challenge
+	StatusCode  int             `json:"status_code"`          // HTTP状态码，would_block时为本应返回的状态码
+	Message     string          `json:"message"`              // 响应消息
+	Domain      string          `json:"domain"`               // 匹配的域名
+	DomainID    uint            `json:"domain_id"`            // 域名ID
+	TenantID    uint            `json:"tenant_id"`            // 租户ID
+	MatchedRule *MatchedRule    `json:"matched_rule"`         // 匹配的规则
+	Username    string          `json:"username,omitempty"`   // 登录接口请求的用户名，按登录接口配置脱敏
+	Suppressed  []SuppressedHit `json:"suppressed,omitempty"` // 被规则排除跳过的命中
 }
 
 // MatchedRule 匹配的规则信息
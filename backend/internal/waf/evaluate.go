@@ -0,0 +1,301 @@
+package waf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// evaluationTraceKey 请求上下文中保存试运行记录的键，存在时为试运行请求
+const evaluationTraceKey = "waf_evaluation_trace"
+
+// defaultEvaluationIP 模拟请求未指定客户端IP时使用的地址
+const defaultEvaluationIP = "127.0.0.1"
+
+// 检查阶段的结果
+const (
+	TracePass    = "pass"    // 未命中
+	TraceMatch   = "match"   // 命中
+	TraceError   = "error"   // 检查失败，按未命中处理
+	TraceSkipped = "skipped" // 未检查
+)
+
+// EvaluationRequest 模拟请求，用于试运行WAF检查和规则测试用例
+type EvaluationRequest struct {
+	Method   string            `json:"method"`                 // 请求方法，默认GET
+	URL      string            `json:"url" binding:"required"` // 请求URL，可以是完整URL或以/开头的路径
+	Host     string            `json:"host"`                   // 域名，为空时取URL或Host请求头中的主机；规则测试用例可不指定
+	Headers  map[string]string `json:"headers"`                // 请求头
+	Body     string            `json:"body"`                   // 请求体
+	ClientIP string            `json:"client_ip"`              // 客户端IP，默认127.0.0.1，不读取X-Forwarded-For
+}
+
+// TraceStep 一个检查阶段的结果
+type TraceStep struct {
+	Stage  string `json:"stage"`            // 阶段：domain, whitelist, blacklist, rate_limit, protocol, login, graphql, upload, openapi, rules
+	Result string `json:"result"`           // 结果：pass, match, error, skipped
+	Detail string `json:"detail,omitempty"` // 说明
+}
+
+// RuleTrace 一条规则的计算结果
+type RuleTrace struct {
+	RuleID     uint   `json:"rule_id"`
+	Name       string `json:"name"`
+	MatchType  string `json:"match_type"`
+	MatchMode  string `json:"match_mode"`
+	Action     string `json:"action"`
+	Mode       string `json:"mode"`                  // 规则所在策略的模式：enforce, detect_only
+	Matched    bool   `json:"matched"`               // 去掉规则排除后是否命中
+	MatchValue string `json:"match_value,omitempty"` // 命中时的匹配值
+	Exclusion  string `json:"exclusion,omitempty"`   // 生效的规则排除名称
+	Suppressed bool   `json:"suppressed"`            // 命中被规则排除跳过
+}
+
+// DecisionTrace 试运行的检查过程和最终结果
+type DecisionTrace struct {
+	Domain      string       `json:"domain"`
+	DomainID    uint         `json:"domain_id"`
+	DomainMode  string       `json:"domain_mode"`
+	Steps       []TraceStep  `json:"steps"`              // 按检查顺序排列的阶段，检查在某阶段结束时后续阶段不出现
+	Rules       []RuleTrace  `json:"rules"`              // 按计算顺序排列的规则
+	Policies    []uint       `json:"policies,omitempty"` // 替换域名关联策略的策略ID，为空时使用域名关联的策略
+	ShadowRules int          `json:"shadow_rules"`       // 影子策略的规则数，试运行不评估影子策略
+	Result      *CheckResult `json:"result"`             // 最终结果
+}
+
+// step 记录一个检查阶段，非试运行时trace为nil
+func (t *DecisionTrace) step(stage, result, detail string) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, TraceStep{Stage: stage, Result: result, Detail: detail})
+}
+
+// rule 记录一条规则的计算结果，非试运行时trace为nil
+func (t *DecisionTrace) rule(trace RuleTrace) {
+	if t == nil {
+		return
+	}
+	t.Rules = append(t.Rules, trace)
+}
+
+// evaluationTrace 获取试运行记录，非试运行请求返回nil
+func evaluationTrace(c *gin.Context) *DecisionTrace {
+	if value, ok := c.Get(evaluationTraceKey); ok {
+		return value.(*DecisionTrace)
+	}
+	return nil
+}
+
+// isDryRun 请求是否为试运行。试运行不计入速率限制、学习会话、OpenAPI学习和影子策略
+func isDryRun(c *gin.Context) bool {
+	_, ok := c.Get(evaluationTraceKey)
+	return ok
+}
+
+// newRuleTrace 根据规则创建计算记录
+func newRuleTrace(rule models.Rule, mode string) RuleTrace {
+	if mode == "" {
+		mode = ModeEnforce
+	}
+	return RuleTrace{
+		RuleID:    rule.ID,
+		Name:      rule.Name,
+		MatchType: rule.MatchType,
+		MatchMode: rule.MatchMode,
+		Action:    rule.Action,
+		Mode:      mode,
+	}
+}
+
+// httpRequest 将模拟请求转换为HTTP请求
+func (r *EvaluationRequest) httpRequest() (*http.Request, error) {
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	target, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if target.Path == "" {
+		target.Path = "/"
+	}
+	if !strings.HasPrefix(target.Path, "/") {
+		return nil, fmt.Errorf("invalid url: path must start with /")
+	}
+
+	clientIP := r.ClientIP
+	if clientIP == "" {
+		clientIP = defaultEvaluationIP
+	}
+	if net.ParseIP(clientIP) == nil {
+		return nil, fmt.Errorf("invalid client ip: %s", clientIP)
+	}
+
+	req, err := http.NewRequest(method, target.RequestURI(), strings.NewReader(r.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	for name, value := range r.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if target.Host != "" {
+		req.Host = target.Host
+	}
+	if r.Host != "" {
+		req.Host = r.Host
+	}
+	req.RemoteAddr = net.JoinHostPort(clientIP, "0")
+	return req, nil
+}
+
+// Validate 检查模拟请求能否转换为HTTP请求
+func (r *EvaluationRequest) Validate() error {
+	_, err := r.httpRequest()
+	return err
+}
+
+// evaluationHandlerKey 内部gin引擎从请求的context中取出处理函数的键
+type evaluationHandlerKey struct{}
+
+// newEvaluationRouter 创建处理模拟请求的内部gin引擎，客户端IP只取模拟请求指定的地址
+func newEvaluationRouter() *gin.Engine {
+	router := gin.New()
+	router.ForwardedByClientIP = false
+	router.NoRoute(func(c *gin.Context) {
+		if handle, ok := c.Request.Context().Value(evaluationHandlerKey{}).(func(*gin.Context)); ok {
+			handle(c)
+		}
+	})
+	return router
+}
+
+// runEvaluation 将模拟请求交给内部gin引擎，在得到的请求上下文中以试运行方式调用handle
+func (e *WAFEngine) runEvaluation(r *EvaluationRequest, trace *DecisionTrace, handle func(c *gin.Context)) error {
+	req, err := r.httpRequest()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.WithValue(req.Context(), evaluationHandlerKey{}, func(c *gin.Context) {
+		c.Set(evaluationTraceKey, trace)
+		handle(c)
+	})
+	e.evaluationRouter.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+	return nil
+}
+
+// EvaluationDomain 获取模拟请求按哪个域名检查，与线上请求一样未配置的域名使用通配符域名，都未配置时返回nil
+func (e *WAFEngine) EvaluationDomain(r *EvaluationRequest) (*models.Domain, error) {
+	req, err := r.httpRequest()
+	if err != nil {
+		return nil, err
+	}
+	domain, err := e.GetDomainByHost(req.Host)
+	if err != nil {
+		return nil, nil
+	}
+	return domain, nil
+}
+
+// Evaluate 试运行：对模拟请求执行与线上相同的检查，返回各检查阶段、每条规则的计算结果和最终结果。
+// 试运行不计入速率限制计数、学习会话和影子策略统计，也不记录攻击日志
+func (e *WAFEngine) Evaluate(r *EvaluationRequest) (*DecisionTrace, error) {
+	return e.EvaluateWithPolicies(r, nil)
+}
+
+// EvaluateWithPolicies 试运行，policyIDs不为nil时用这些策略的规则替换域名关联的策略，
+// 域名的黑白名单、OpenAPI规范和规则排除照常生效
+func (e *WAFEngine) EvaluateWithPolicies(r *EvaluationRequest, policyIDs []uint) (*DecisionTrace, error) {
+	trace := &DecisionTrace{Steps: []TraceStep{}, Rules: []RuleTrace{}, Policies: policyIDs}
+	err := e.runEvaluation(r, trace, func(c *gin.Context) {
+		trace.Result, _ = e.CheckRequest(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// RuleTestCase 规则测试用例：模拟请求及其是否应命中规则
+type RuleTestCase struct {
+	Name        string            `json:"name"`
+	Request     EvaluationRequest `json:"request"`
+	ExpectMatch bool              `json:"expect_match"` // true表示必须命中，false表示不得命中
+}
+
+// RuleTestResult 规则测试用例的执行结果
+type RuleTestResult struct {
+	Name        string `json:"name"`
+	ExpectMatch bool   `json:"expect_match"`
+	Matched     bool   `json:"matched"`
+	MatchValue  string `json:"match_value,omitempty"`
+	Passed      bool   `json:"passed"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ParseRuleTestCases 解析规则保存的测试用例
+func ParseRuleTestCases(data string) ([]RuleTestCase, error) {
+	var cases []RuleTestCase
+	if data == "" {
+		return cases, nil
+	}
+	if err := json.Unmarshal([]byte(data), &cases); err != nil {
+		return nil, fmt.Errorf("invalid test cases: %v", err)
+	}
+	return cases, nil
+}
+
+// TestRule 用模拟请求单独计算规则，不考虑规则所在策略、规则排除和规则的启用状态。
+// 模拟请求的域名已配置时使用该域名的gRPC描述文件等配置
+func (e *WAFEngine) TestRule(rule models.Rule, cases []RuleTestCase) []RuleTestResult {
+	results := make([]RuleTestResult, 0, len(cases))
+	for i := range cases {
+		testCase := &cases[i]
+		result := RuleTestResult{Name: testCase.Name, ExpectMatch: testCase.ExpectMatch}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("case %d", i+1)
+		}
+
+		err := e.runEvaluation(&testCase.Request, &DecisionTrace{}, func(c *gin.Context) {
+			var domainID uint
+			if domain, err := e.GetDomainByHost(c.Request.Host); err == nil {
+				domainID = domain.ID
+			}
+			if result.Matched, result.MatchValue = e.testRuleMatch(rule, c, domainID); !result.Matched {
+				result.MatchValue = ""
+			}
+		})
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Passed = result.Matched == testCase.ExpectMatch
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// testRuleMatch 计算规则是否命中，ws_message规则以请求体作为WebSocket消息
+func (e *WAFEngine) testRuleMatch(rule models.Rule, c *gin.Context, domainID uint) (bool, string) {
+	if rule.MatchType == "ws_message" {
+		message := string(requestBody(c))
+		return e.performMatch(rule.MatchMode, rule.Pattern, message), message
+	}
+	return e.evaluateRule(nil, rule, c, domainID, nil)
+}
@@ -0,0 +1,213 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExclusionMatchTypes 可作为排除目标的规则匹配类型
+var ExclusionMatchTypes = []string{
+	"uri", "ip", "header", "body", "user_agent",
+	"client_cert_subject", "client_cert_san", "client_cert_fingerprint",
+	"grpc_service", "grpc_method", "grpc_message",
+	"graphql_operation_name", "graphql_operation_type",
+	"file_name", "file_size", "file_type", "compound",
+}
+
+// SuppressedHit 被规则排除跳过的命中
+type SuppressedHit struct {
+	RuleID        uint   `json:"rule_id"`          // 规则ID
+	RuleName      string `json:"rule_name"`        // 规则名称
+	ExclusionID   uint   `json:"exclusion_id"`     // 规则排除ID
+	ExclusionName string `json:"exclusion_name"`   // 规则排除名称
+	Target        string `json:"target,omitempty"` // 排除的检查目标
+	MatchField    string `json:"match_field"`      // 匹配字段
+	MatchValue    string `json:"match_value"`      // 不排除时的匹配值
+}
+
+// excludedTargets 规则检查时排除的请求体参数和请求头
+type excludedTargets struct {
+	params  []string // 请求体参数名，嵌套JSON字段用.分隔
+	headers []string // 请求头名称
+}
+
+// GetDomainExclusions 获取域名启用的规则排除，包括域名级排除和域名所用策略的排除
+func (e *WAFEngine) GetDomainExclusions(domainID uint) ([]models.RuleExclusion, error) {
+	var exclusions []models.RuleExclusion
+	policyIDs := e.db.Table("domain_policies").Select("policy_id").Where("domain_id = ? AND enabled = ?", domainID, true)
+	err := e.db.Where("enabled = ? AND (domain_id = ? OR (policy_id > 0 AND policy_id IN (?)))", true, domainID, policyIDs).
+		Order("id ASC").Find(&exclusions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain exclusions: %v", err)
+	}
+	return exclusions, nil
+}
+
+// ValidExclusionTarget 检查排除目标格式：空、规则匹配类型、body:参数名 或 header:名称
+func ValidExclusionTarget(target string) bool {
+	if target == "" {
+		return true
+	}
+	if kind, name, ok := strings.Cut(target, ":"); ok {
+		return (kind == "body" || kind == "header") && strings.TrimSpace(name) != ""
+	}
+	return containsString(ExclusionMatchTypes, target)
+}
+
+// RuleHasTag 检查规则是否带有指定标签，标签不区分大小写
+func RuleHasTag(rule models.Rule, tag string) bool {
+	for _, t := range strings.Split(rule.Tags, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleExclusions 返回作用于规则且路径匹配的排除。skip非空表示跳过整条规则，
+// 否则targets为检查时需要去掉的请求体参数和请求头，via为去掉目标的排除
+func (e *WAFEngine) ruleExclusions(exclusions []models.RuleExclusion, rule models.Rule, path string) (skip *models.RuleExclusion, targets *excludedTargets, via *models.RuleExclusion) {
+	for i := range exclusions {
+		exclusion := &exclusions[i]
+		if exclusion.RuleID != 0 && exclusion.RuleID != rule.ID {
+			continue
+		}
+		if exclusion.RuleID == 0 && (exclusion.RuleTag == "" || !RuleHasTag(rule, exclusion.RuleTag)) {
+			continue
+		}
+		if !e.matchExclusionPath(exclusion.PathMatch, exclusion.Path, path) {
+			continue
+		}
+
+		kind, name, hasName := strings.Cut(exclusion.Target, ":")
+		switch {
+		case exclusion.Target == "" || (!hasName && kind == rule.MatchType):
+			return exclusion, nil, nil
+		case hasName && kind == "body" && (rule.MatchType == "body" || inspectsRequest(rule)):
+			if targets == nil {
+				targets, via = &excludedTargets{}, exclusion
+			}
+			targets.params = append(targets.params, strings.TrimSpace(name))
+		case hasName && kind == "header" && (rule.MatchType == "header" || rule.MatchType == "user_agent" || inspectsRequest(rule)):
+			if targets == nil {
+				targets, via = &excludedTargets{}, exclusion
+			}
+			targets.headers = append(targets.headers, strings.TrimSpace(name))
+		}
+	}
+	return nil, targets, via
+}
+
+// inspectsRequest 组合规则和表达式规则检查整个请求，请求体参数和请求头排除都对其生效
+func inspectsRequest(rule models.Rule) bool {
+	return rule.MatchType == "compound" || rule.MatchMode == "cel"
+}
+
+// matchExclusionPath 按匹配方式检查路径，排除路径为空时匹配所有路径
+func (e *WAFEngine) matchExclusionPath(pathMatch, pattern, path string) bool {
+	if pattern == "" {
+		return true
+	}
+	switch pathMatch {
+	case "exact":
+		return path == pattern
+	case "regex":
+		re, err := e.regex(pattern)
+		if err != nil {
+			log.Printf("Invalid exclusion path pattern %q: %v", pattern, err)
+			return false
+		}
+		return re.MatchString(path)
+	default:
+		return strings.HasPrefix(path, pattern)
+	}
+}
+
+// excludesHeader 检查请求头是否被排除
+func (t *excludedTargets) excludesHeader(name string) bool {
+	if t == nil {
+		return false
+	}
+	for _, header := range t.headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// inspectedBody 返回去掉排除参数后的请求体，支持JSON和表单请求体，其他格式原样返回
+func inspectedBody(c *gin.Context, targets *excludedTargets) string {
+	body := requestBody(c)
+	if targets == nil || len(targets.params) == 0 || len(body) == 0 {
+		return string(body)
+	}
+
+	switch {
+	case strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		for _, param := range targets.params {
+			values.Del(param)
+		}
+		return values.Encode()
+	case json.Valid(body):
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return string(body)
+		}
+		for _, param := range targets.params {
+			deleteJSONField(data, strings.Split(param, "."))
+		}
+		// 不转义HTML字符，保证<script等特征仍能被规则匹配
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(data); err != nil {
+			return string(body)
+		}
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+	return string(body)
+}
+
+// deleteJSONField 按字段路径删除JSON字段，路径经过数组时对每个元素删除
+func deleteJSONField(data interface{}, path []string) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		if child, ok := v[path[0]]; ok {
+			deleteJSONField(child, path[1:])
+		}
+	case []interface{}:
+		for _, item := range v {
+			deleteJSONField(item, path)
+		}
+	}
+}
+
+// suppressedHit 构造被排除跳过的命中
+func suppressedHit(rule models.Rule, exclusion *models.RuleExclusion, matchValue string) SuppressedHit {
+	return SuppressedHit{
+		RuleID:        rule.ID,
+		RuleName:      rule.Name,
+		ExclusionID:   exclusion.ID,
+		ExclusionName: exclusion.Name,
+		Target:        exclusion.Target,
+		MatchField:    rule.MatchType,
+		MatchValue:    truncateSample(matchValue),
+	}
+}
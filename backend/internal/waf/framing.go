@@ -0,0 +1,304 @@
+package waf
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// net/http解析请求时会合并相同的重复Content-Length、在有Transfer-Encoding时删除Content-Length、
+// 并把折行请求头（obs-fold）拼接为一行，处理器看不到这些请求走私特征。
+// framingConn在连接读取的原始数据中按请求记录这些问题，WAF检查时从请求context中取出。
+
+const (
+	maxFramingLine    = 1 << 20 // 原始请求头单行的最大长度，与net/http默认的请求头上限一致
+	maxFramingPending = 64      // 连接上尚未被处理器取走的请求数上限
+)
+
+// framingConnKey 请求context中保存连接的键
+type framingConnKey struct{}
+
+// framingViolationsKey 请求context中保存原始请求头违规类型的键
+type framingViolationsKey struct{}
+
+// framingState 连接读取位置所处的请求部分
+type framingState int
+
+const (
+	framingHeader    framingState = iota // 请求行和请求头
+	framingBody                          // Content-Length请求体
+	framingChunkSize                     // chunk大小行
+	framingChunkData                     // chunk数据
+	framingChunkEnd                      // chunk数据后的CRLF
+	framingTrailer                       // chunked请求体后的trailer
+	framingOpaque                        // 不再检查：HTTP/2、协议升级或无法确定请求边界
+)
+
+// framingListener 返回记录原始请求头的连接
+type framingListener struct {
+	net.Listener
+}
+
+func (l *framingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &framingConn{Conn: conn}, nil
+}
+
+// framingConn 按net/http的规则跟踪请求边界，记录每个请求原始请求头中的违规
+type framingConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	state     framingState
+	line      []byte
+	remaining int64
+
+	// 当前请求
+	requestLine       string
+	contentLengths    []string
+	transferEncodings []string
+	obsFold           bool
+	upgrade           bool
+
+	pending [][]string // 按请求顺序排列的违规类型，处理器依次取走
+}
+
+func (c *framingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		c.scan(p[:n])
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// next 取出下一个请求的违规类型
+func (c *framingConn) next() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	violations := c.pending[0]
+	c.pending = c.pending[1:]
+	return violations
+}
+
+// scan 处理读取到的数据，请求体只跳过不保存
+func (c *framingConn) scan(data []byte) {
+	for len(data) > 0 && c.state != framingOpaque {
+		if c.state == framingBody || c.state == framingChunkData {
+			n := int64(len(data))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			data = data[n:]
+			c.remaining -= n
+			if c.remaining == 0 {
+				if c.state == framingBody {
+					c.state = framingHeader
+				} else {
+					c.state = framingChunkEnd
+				}
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			c.appendLine(data)
+			return
+		}
+		c.appendLine(data[:i])
+		data = data[i+1:]
+		if c.state == framingOpaque {
+			return
+		}
+		line := string(bytes.TrimSuffix(c.line, []byte("\r")))
+		c.line = c.line[:0]
+		c.handleLine(line)
+	}
+}
+
+// appendLine 保存不完整的行，超过长度上限时不再检查该连接
+func (c *framingConn) appendLine(data []byte) {
+	if len(c.line)+len(data) > maxFramingLine {
+		c.state = framingOpaque
+		c.line = nil
+		return
+	}
+	c.line = append(c.line, data...)
+}
+
+func (c *framingConn) handleLine(line string) {
+	switch c.state {
+	case framingHeader:
+		c.headerLine(line)
+	case framingChunkSize:
+		size := line
+		if i := strings.IndexByte(size, ';'); i >= 0 {
+			size = size[:i]
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		switch {
+		case err != nil || n < 0:
+			c.state = framingOpaque
+		case n == 0:
+			c.state = framingTrailer
+		default:
+			c.remaining = n
+			c.state = framingChunkData
+		}
+	case framingChunkEnd:
+		if line != "" {
+			c.state = framingOpaque
+			return
+		}
+		c.state = framingChunkSize
+	case framingTrailer:
+		if line == "" {
+			c.state = framingHeader
+		}
+	}
+}
+
+func (c *framingConn) headerLine(line string) {
+	if c.requestLine == "" {
+		// 请求之间多余的空行
+		if line == "" {
+			return
+		}
+		// HTTP/2明文连接的前言
+		if strings.HasPrefix(line, "PRI * HTTP/2") {
+			c.state = framingOpaque
+			return
+		}
+		c.requestLine = line
+		return
+	}
+	if line == "" {
+		c.endHeader()
+		return
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		c.obsFold = true
+		return
+	}
+
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "content-length":
+		c.contentLengths = append(c.contentLengths, value)
+	case "transfer-encoding":
+		c.transferEncodings = append(c.transferEncodings, value)
+	case "upgrade":
+		c.upgrade = true
+	}
+}
+
+// endHeader 记录请求的违规，并按net/http的规则确定请求体长度：
+// HTTP/1.1的Transfer-Encoding优先于Content-Length，HTTP/1.0忽略Transfer-Encoding
+func (c *framingConn) endHeader() {
+	var violations []string
+	if len(c.contentLengths) > 0 && len(c.transferEncodings) > 0 {
+		violations = append(violations, protocolLengthConflict)
+	}
+	if len(c.contentLengths) > 1 {
+		violations = append(violations, protocolDuplicateLength)
+	}
+	if c.obsFold {
+		violations = append(violations, protocolObsFold)
+	}
+	if len(c.pending) >= maxFramingPending {
+		c.state = framingOpaque
+		return
+	}
+	c.pending = append(c.pending, violations)
+
+	http10 := strings.HasSuffix(c.requestLine, "HTTP/1.0")
+	contentLengths, transferEncodings, upgrade := c.contentLengths, c.transferEncodings, c.upgrade
+	c.requestLine, c.contentLengths, c.transferEncodings, c.obsFold, c.upgrade = "", nil, nil, false, false
+
+	switch {
+	case upgrade:
+		// 协议升级后连接上不再是HTTP/1请求
+		c.state = framingOpaque
+	case len(transferEncodings) > 0 && !http10:
+		// net/http只接受单个chunked编码，其他情况拒绝请求并关闭连接
+		if len(transferEncodings) == 1 && strings.EqualFold(transferEncodings[0], "chunked") {
+			c.state = framingChunkSize
+		} else {
+			c.state = framingOpaque
+		}
+	case len(contentLengths) > 0:
+		n, err := strconv.ParseInt(contentLengths[0], 10, 64)
+		switch {
+		case err != nil || n < 0:
+			c.state = framingOpaque
+		case n > 0:
+			c.remaining = n
+			c.state = framingBody
+		}
+	}
+}
+
+// ListenFraming 监听srv.Addr，返回记录原始请求头的监听器，并包装srv的ConnContext和Handler，
+// 使WAF的协议校验能检查到重复的Content-Length、同时出现的Content-Length和Transfer-Encoding以及折行请求头。
+// 只用于明文HTTP服务器：TLS连接读取到的是密文，HTTPS请求只检查net/http解析后的结果
+func ListenFraming(srv *http.Server) (net.Listener, error) {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, conn)
+		}
+		if fc, ok := conn.(*framingConn); ok {
+			ctx = context.WithValue(ctx, framingConnKey{}, fc)
+		}
+		return ctx
+	}
+	handler := srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	srv.Handler = framingHandler(handler)
+	return &framingListener{Listener: listener}, nil
+}
+
+// framingHandler 每个HTTP/1请求按顺序取出连接记录的违规，保存到请求context中
+func framingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := r.Context().Value(framingConnKey{}).(*framingConn); ok && r.ProtoMajor == 1 {
+			if violations := conn.next(); len(violations) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), framingViolationsKey{}, violations))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// framingViolations 获取请求原始请求头中的违规类型
+func framingViolations(r *http.Request) []string {
+	violations, _ := r.Context().Value(framingViolationsKey{}).([]string)
+	return violations
+}
@@ -0,0 +1,169 @@
+package waf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFramingConnScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		pending [][]string
+		opaque  bool
+	}{
+		{
+			name:    "simple request",
+			data:    "GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+			pending: [][]string{nil},
+		},
+		{
+			name: "pipelined requests",
+			data: "GET /1 HTTP/1.1\r\nHost: a\r\n\r\n" +
+				"POST /2 HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello" +
+				"GET /3 HTTP/1.1\r\nHost: a\r\n\r\n",
+			pending: [][]string{nil, nil, nil},
+		},
+		{
+			name:    "blank lines between requests",
+			data:    "GET /1 HTTP/1.1\r\n\r\n\r\n\r\nGET /2 HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil, nil},
+		},
+		{
+			name: "content-length and transfer-encoding",
+			data: "POST / HTTP/1.1\r\nContent-Length: 30\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" +
+				"GET /smuggled HTTP/1.1\r\n\r\n",
+			pending: [][]string{{protocolLengthConflict}, nil},
+		},
+		{
+			name: "duplicate content-length",
+			data: "POST / HTTP/1.1\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\nabc" +
+				"GET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{{protocolDuplicateLength}, nil},
+		},
+		{
+			name:    "duplicate content-length with transfer-encoding",
+			data:    "POST / HTTP/1.1\r\nContent-Length: 3\r\ncontent-length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			pending: [][]string{{protocolLengthConflict, protocolDuplicateLength}},
+		},
+		{
+			name:    "obs-fold",
+			data:    "GET / HTTP/1.1\r\nX-Test: a\r\n\tb\r\n\r\nGET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{{protocolObsFold}, nil},
+		},
+		{
+			name: "chunk extensions and trailer",
+			data: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5;name=value\r\nhello\r\n" +
+				"a ; ext\r\n0123456789\r\n" +
+				"0;last\r\nX-Trailer: v\r\n\r\n" +
+				"GET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil, nil},
+		},
+		{
+			name: "chunk data that looks like a request",
+			data: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"1d\r\nGET /inner HTTP/1.1\r\nA: b\r\n\r\n\r\n0\r\n\r\n",
+			pending: [][]string{nil},
+		},
+		{
+			name: "content-length body that looks like a request",
+			data: "POST / HTTP/1.1\r\nContent-Length: 42\r\n\r\n" +
+				"GET /inner HTTP/1.1\r\nContent-Length: 1\r\n\r\n" +
+				"GET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil, nil},
+		},
+		{
+			name: "http/1.0 ignores transfer-encoding",
+			data: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\nabc" +
+				"GET /next HTTP/1.0\r\n\r\n",
+			pending: [][]string{{protocolLengthConflict}, nil},
+		},
+		{
+			name:    "unsupported transfer-encoding",
+			data:    "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\nGET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil},
+			opaque:  true,
+		},
+		{
+			name:    "invalid chunk size",
+			data:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nGET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil},
+			opaque:  true,
+		},
+		{
+			name:    "missing CRLF after chunk data",
+			data:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcGET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil},
+			opaque:  true,
+		},
+		{
+			name:    "invalid content-length",
+			data:    "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\nGET /next HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil},
+			opaque:  true,
+		},
+		{
+			name:    "protocol upgrade",
+			data:    "GET /ws HTTP/1.1\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\nGET /frame HTTP/1.1\r\n\r\n",
+			pending: [][]string{nil},
+			opaque:  true,
+		},
+		{
+			name:   "http/2 preface",
+			data:   "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+			opaque: true,
+		},
+	}
+
+	for _, tt := range tests {
+		// 同一份数据按不同大小分块读取，结果应与一次读取相同
+		for _, size := range []int{len(tt.data), 1, 2, 7} {
+			conn := &framingConn{}
+			for data := tt.data; len(data) > 0; {
+				n := min(size, len(data))
+				conn.scan([]byte(data[:n]))
+				data = data[n:]
+			}
+
+			if !reflect.DeepEqual(conn.pending, tt.pending) {
+				t.Errorf("%s (read size %d): pending = %q, want %q", tt.name, size, conn.pending, tt.pending)
+			}
+			if opaque := conn.state == framingOpaque; opaque != tt.opaque {
+				t.Errorf("%s (read size %d): opaque = %v, want %v", tt.name, size, opaque, tt.opaque)
+			}
+		}
+	}
+}
+
+func TestFramingConnNext(t *testing.T) {
+	conn := &framingConn{}
+	conn.scan([]byte("GET / HTTP/1.1\r\nA: b\r\n c\r\n\r\nGET / HTTP/1.1\r\n\r\n"))
+
+	if got := conn.next(); !reflect.DeepEqual(got, []string{protocolObsFold}) {
+		t.Errorf("first request violations = %q, want %q", got, []string{protocolObsFold})
+	}
+	if got := conn.next(); got != nil {
+		t.Errorf("second request violations = %q, want none", got)
+	}
+	if got := conn.next(); got != nil {
+		t.Errorf("violations after last request = %q, want none", got)
+	}
+}
+
+func TestFramingConnLimits(t *testing.T) {
+	// 超长的行不再检查
+	conn := &framingConn{}
+	conn.scan([]byte("GET /" + strings.Repeat("a", maxFramingLine) + " HTTP/1.1\r\n\r\n"))
+	if conn.state != framingOpaque || len(conn.pending) != 0 {
+		t.Errorf("long line: state = %v, pending = %d, want opaque with no requests", conn.state, len(conn.pending))
+	}
+
+	// 未被处理器取走的请求过多时不再检查
+	conn = &framingConn{}
+	conn.scan([]byte(strings.Repeat("GET / HTTP/1.1\r\n\r\n", maxFramingPending+1)))
+	if conn.state != framingOpaque || len(conn.pending) != maxFramingPending {
+		t.Errorf("pipelined: state = %v, pending = %d, want opaque with %d requests", conn.state, len(conn.pending), maxFramingPending)
+	}
+}
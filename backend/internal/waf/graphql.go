@@ -0,0 +1,336 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// graphqlKey 请求上下文中缓存GraphQL解析结果的键
+const graphqlKey = "waf_graphql"
+
+// graphqlLogLimit 攻击日志中记录的GraphQL查询最大长度
+const graphqlLogLimit = 4096
+
+// maxGraphQLNodes 展开片段时最多遍历的字段数，防止片段嵌套引用导致的指数级展开
+const maxGraphQLNodes = 100000
+
+// graphqlListArguments 作为复杂度乘数的列表分页参数
+var graphqlListArguments = []string{"first", "last", "limit", "size", "count", "pageSize", "perPage", "page_size", "per_page"}
+
+// GraphQLOperation 解析后的GraphQL操作及其统计信息
+type GraphQLOperation struct {
+	Name          string // 操作名称，匿名操作为空
+	Type          string // 操作类型：query, mutation, subscription
+	Query         string // 操作所在的查询文本
+	Depth         int    // 最大嵌套深度
+	Aliases       int    // 别名数
+	Fields        int    // 字段数（展开片段后）
+	Complexity    int    // 复杂度
+	Introspection bool   // 是否包含__schema/__type内省字段
+}
+
+// graphqlRequest GraphQL请求参数，批量请求为数组
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlResult GraphQL请求的解析结果
+type graphqlResult struct {
+	endpoint   *models.GraphQLEndpoint
+	batchSize  int
+	operations []GraphQLOperation
+	parseError error // 请求体或查询无法解析，此时操作未经检查
+}
+
+// GetGraphQLEndpoint 获取域名下与请求路径匹配的GraphQL端点配置
+func (e *WAFEngine) GetGraphQLEndpoint(domainID uint, path string) (*models.GraphQLEndpoint, error) {
+	var endpoint models.GraphQLEndpoint
+	err := e.db.Where("domain_id = ? AND path = ? AND enabled = ?", domainID, path, true).First(&endpoint).Error
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// graphqlOperations 解析配置路径上的GraphQL请求，非GraphQL端点返回nil
+func (e *WAFEngine) graphqlOperations(c *gin.Context, domainID uint) *graphqlResult {
+	if cached, ok := c.Get(graphqlKey); ok {
+		return cached.(*graphqlResult)
+	}
+
+	var result *graphqlResult
+	if endpoint, err := e.GetGraphQLEndpoint(domainID, c.Request.URL.Path); err == nil {
+		requests, err := graphqlRequests(c)
+		result = &graphqlResult{endpoint: endpoint, batchSize: len(requests), parseError: err}
+		for _, req := range requests {
+			operations, err := AnalyzeGraphQL(req.Query, req.OperationName, req.Variables)
+			if err != nil {
+				result.parseError = err
+				break
+			}
+			result.operations = append(result.operations, operations...)
+		}
+	}
+
+	c.Set(graphqlKey, result)
+	return result
+}
+
+// graphqlRequests 从请求中提取GraphQL查询：GET请求读取query参数，
+// POST请求支持application/json（含批量数组）和application/graphql。
+// 请求体超过检查上限或不是合法JSON时返回错误；没有query的请求（如持久化查询只发送哈希）不检查
+func graphqlRequests(c *gin.Context) ([]graphqlRequest, error) {
+	if c.Request.Method == http.MethodGet {
+		query := c.Query("query")
+		if query == "" {
+			return nil, nil
+		}
+		req := graphqlRequest{Query: query, OperationName: c.Query("operationName")}
+		if variables := c.Query("variables"); variables != "" {
+			json.Unmarshal([]byte(variables), &req.Variables)
+		}
+		return []graphqlRequest{req}, nil
+	}
+
+	raw := requestBody(c)
+	if len(raw) >= maxInspectBodySize {
+		return nil, fmt.Errorf("request body exceeds inspection limit %d", maxInspectBodySize)
+	}
+	body := bytes.TrimSpace(raw)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if strings.HasPrefix(c.ContentType(), "application/graphql") {
+		return []graphqlRequest{{Query: string(body), OperationName: c.Query("operationName")}}, nil
+	}
+
+	if body[0] == '[' {
+		var batch []graphqlRequest
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("invalid batch request: %v", err)
+		}
+		return batch, nil
+	}
+	var req graphqlRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	if req.Query == "" {
+		return nil, nil
+	}
+	return []graphqlRequest{req}, nil
+}
+
+// AnalyzeGraphQL 解析查询并统计深度、别名、字段数、复杂度和内省字段。
+// 指定operationName时只分析将被执行的操作，否则分析文档中的全部操作；空查询返回nil，无法解析的查询返回错误
+func AnalyzeGraphQL(query, operationName string, variables map[string]interface{}) ([]GraphQLOperation, error) {
+	if query == "" {
+		return nil, nil
+	}
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	var operations []GraphQLOperation
+	for _, op := range doc.Operations {
+		if operationName != "" && op.Name != operationName {
+			continue
+		}
+		a := &graphqlAnalyzer{
+			fragments: doc.Fragments,
+			variables: variables,
+			visiting:  make(map[string]bool),
+		}
+		depth, complexity := a.selectionSet(op.SelectionSet, 0)
+		operations = append(operations, GraphQLOperation{
+			Name:          op.Name,
+			Type:          string(op.Operation),
+			Query:         query,
+			Depth:         depth,
+			Aliases:       a.aliases,
+			Fields:        a.fields,
+			Complexity:    complexity,
+			Introspection: a.introspection,
+		})
+	}
+	return operations, nil
+}
+
+// graphqlAnalyzer 遍历一个操作的选择集
+type graphqlAnalyzer struct {
+	fragments     ast.FragmentDefinitionList
+	variables     map[string]interface{}
+	visiting      map[string]bool // 正在展开的片段，防止循环引用
+	fields        int
+	aliases       int
+	introspection bool
+}
+
+// selectionSet 返回选择集的最大深度和复杂度。每个字段复杂度为1，
+// 带分页参数的字段其子字段复杂度乘以分页数量
+func (a *graphqlAnalyzer) selectionSet(set ast.SelectionSet, depth int) (int, int) {
+	maxDepth, complexity := depth, 0
+	for _, selection := range set {
+		if a.fields >= maxGraphQLNodes {
+			break
+		}
+
+		var childDepth, childComplexity int
+		switch sel := selection.(type) {
+		case *ast.Field:
+			a.fields++
+			if sel.Alias != "" && sel.Alias != sel.Name {
+				a.aliases++
+			}
+			if sel.Name == "__schema" || sel.Name == "__type" {
+				a.introspection = true
+			}
+			childDepth, childComplexity = a.selectionSet(sel.SelectionSet, depth+1)
+			childComplexity = saturatingAdd(1, saturatingMul(a.multiplier(sel), childComplexity))
+		case *ast.InlineFragment:
+			childDepth, childComplexity = a.selectionSet(sel.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			fragment := a.fragments.ForName(sel.Name)
+			if fragment == nil || a.visiting[sel.Name] {
+				continue
+			}
+			a.visiting[sel.Name] = true
+			childDepth, childComplexity = a.selectionSet(fragment.SelectionSet, depth)
+			delete(a.visiting, sel.Name)
+		}
+
+		if childDepth > maxDepth {
+			maxDepth = childDepth
+		}
+		complexity = saturatingAdd(complexity, childComplexity)
+	}
+	return maxDepth, complexity
+}
+
+// multiplier 读取字段的分页参数作为子字段复杂度乘数，支持字面量和变量
+func (a *graphqlAnalyzer) multiplier(field *ast.Field) int {
+	for _, name := range graphqlListArguments {
+		arg := field.Arguments.ForName(name)
+		if arg == nil || arg.Value == nil {
+			continue
+		}
+
+		var n int
+		switch arg.Value.Kind {
+		case ast.IntValue:
+			n, _ = strconv.Atoi(arg.Value.Raw)
+		case ast.Variable:
+			if value, ok := a.variables[arg.Value.Raw].(float64); ok && value < math.MaxInt32 {
+				n = int(value)
+			}
+		}
+		if n > 1 {
+			return n
+		}
+	}
+	return 1
+}
+
+// checkGraphQL 检查GraphQL请求是否超出端点限制，返回端点配置、违规信息和原因
+func (e *WAFEngine) checkGraphQL(c *gin.Context, domainID uint) (*models.GraphQLEndpoint, *MatchedRule, string) {
+	result := e.graphqlOperations(c, domainID)
+	if result == nil {
+		return nil, nil, ""
+	}
+	endpoint := result.endpoint
+
+	// 无法解析的请求不能检查深度、别名、复杂度等限制，按违规处理，避免构造畸形请求绕过检查
+	if result.parseError != nil {
+		value := string(requestBody(c))
+		if c.Request.Method == http.MethodGet {
+			value = c.Query("query")
+		}
+		return endpoint, graphqlViolation("graphql_parse_error", value), result.parseError.Error()
+	}
+
+	if endpoint.MaxBatchSize > 0 && result.batchSize > endpoint.MaxBatchSize {
+		reason := fmt.Sprintf("batch size %d exceeds limit %d", result.batchSize, endpoint.MaxBatchSize)
+		return endpoint, graphqlViolation("graphql_batch_size", string(requestBody(c))), reason
+	}
+
+	for _, op := range result.operations {
+		var field, reason string
+		switch {
+		case endpoint.BlockIntrospection && op.Introspection:
+			field, reason = "graphql_introspection", "introspection query is not allowed"
+		case endpoint.MaxDepth > 0 && op.Depth > endpoint.MaxDepth:
+			field, reason = "graphql_depth", fmt.Sprintf("depth %d exceeds limit %d", op.Depth, endpoint.MaxDepth)
+		case endpoint.MaxAliases > 0 && op.Aliases > endpoint.MaxAliases:
+			field, reason = "graphql_aliases", fmt.Sprintf("alias count %d exceeds limit %d", op.Aliases, endpoint.MaxAliases)
+		case endpoint.MaxFields > 0 && op.Fields > endpoint.MaxFields:
+			field, reason = "graphql_fields", fmt.Sprintf("field count %d exceeds limit %d", op.Fields, endpoint.MaxFields)
+		case endpoint.MaxComplexity > 0 && op.Complexity > endpoint.MaxComplexity:
+			field, reason = "graphql_complexity", fmt.Sprintf("complexity %d exceeds limit %d", op.Complexity, endpoint.MaxComplexity)
+		default:
+			continue
+		}
+		return endpoint, graphqlViolation(field, op.Query), reason
+	}
+	return endpoint, nil, ""
+}
+
+// graphqlViolation 构造GraphQL违规信息，匹配值记录违规的查询
+func graphqlViolation(field, query string) *MatchedRule {
+	if len(query) > graphqlLogLimit {
+		query = query[:graphqlLogLimit]
+	}
+	return &MatchedRule{
+		ID:         0,
+		Name:       "GraphQL限制",
+		MatchField: field,
+		MatchValue: query,
+	}
+}
+
+// graphqlRuleValues 返回GraphQL请求中全部操作的名称或类型，供规则匹配
+func (e *WAFEngine) graphqlRuleValues(c *gin.Context, domainID uint, matchType string) []string {
+	result := e.graphqlOperations(c, domainID)
+	if result == nil {
+		return nil
+	}
+
+	values := make([]string, 0, len(result.operations))
+	for _, op := range result.operations {
+		if matchType == "graphql_operation_name" {
+			values = append(values, op.Name)
+		} else {
+			values = append(values, op.Type)
+		}
+	}
+	return values
+}
+
+// saturatingAdd 饱和加法，避免复杂度溢出
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+// saturatingMul 饱和乘法，避免复杂度溢出
+func saturatingMul(a, b int) int {
+	if a != 0 && b > math.MaxInt32/a {
+		return math.MaxInt32
+	}
+	return a * b
+}
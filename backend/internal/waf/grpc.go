@@ -0,0 +1,207 @@
+package waf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcMessageKey 请求上下文中缓存解码后消息的键
+const grpcMessageKey = "waf_grpc_message"
+
+// ParseDescriptorSet 解析FileDescriptorSet，返回其中定义的服务全名。
+// 描述文件需要包含全部依赖（protoc --include_imports）
+func ParseDescriptorSet(content []byte) ([]string, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+
+	services := []string{}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		for i := 0; i < file.Services().Len(); i++ {
+			services = append(services, string(file.Services().Get(i).FullName()))
+		}
+		return true
+	})
+	if len(services) == 0 {
+		return nil, errors.New("descriptor set contains no services")
+	}
+	return services, nil
+}
+
+// GRPCMethod 从请求路径 /package.Service/Method 中解析服务和方法名
+func GRPCMethod(path string) (service, method string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ResetGRPCDescriptors 清除域名的描述文件缓存，上传或删除描述文件后调用
+func (e *WAFEngine) ResetGRPCDescriptors(domainID uint) {
+	e.grpcMu.Lock()
+	delete(e.grpcFiles, domainID)
+	e.grpcMu.Unlock()
+}
+
+// domainDescriptors 获取域名的描述文件注册表，合并域名上传的全部描述文件
+func (e *WAFEngine) domainDescriptors(domainID uint) (*protoregistry.Files, error) {
+	e.grpcMu.RLock()
+	files, ok := e.grpcFiles[domainID]
+	e.grpcMu.RUnlock()
+	if ok {
+		return files, nil
+	}
+
+	var sets []models.GRPCDescriptorSet
+	if err := e.db.Where("domain_id = ?", domainID).Order("id ASC").Find(&sets).Error; err != nil {
+		return nil, err
+	}
+
+	// 按文件名去重，先上传的优先
+	merged := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, item := range sets {
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(item.Content, &set); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %d: %v", item.ID, err)
+		}
+		for _, file := range set.File {
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			merged.File = append(merged.File, file)
+		}
+	}
+
+	files, err := protodesc.NewFiles(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	e.grpcMu.Lock()
+	e.grpcFiles[domainID] = files
+	e.grpcMu.Unlock()
+	return files, nil
+}
+
+// grpcMessage 使用域名的描述文件解码请求的第一条消息，结果为protojson转换后的对象
+func (e *WAFEngine) grpcMessage(c *gin.Context, domainID uint) (map[string]interface{}, error) {
+	if cached, ok := c.Get(grpcMessageKey); ok {
+		return cached.(map[string]interface{}), nil
+	}
+
+	service, method, ok := GRPCMethod(c.Request.URL.Path)
+	if !ok {
+		return nil, errors.New("invalid gRPC path")
+	}
+	files, err := e.domainDescriptors(domainID)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown gRPC service %s", service)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("unknown gRPC method %s/%s", service, method)
+	}
+
+	payload, err := grpcPayload(requestBody(c), c.GetHeader("Grpc-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(methodDesc.Input())
+	if err := proto.Unmarshal(payload, message); err != nil {
+		return nil, fmt.Errorf("failed to decode gRPC message: %v", err)
+	}
+
+	data, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	c.Set(grpcMessageKey, fields)
+	return fields, nil
+}
+
+// grpcPayload 去除5字节消息前缀，按grpc-encoding解压
+func grpcPayload(frame []byte, encoding string) ([]byte, error) {
+	if len(frame) < 5 {
+		return nil, errors.New("incomplete gRPC message")
+	}
+	length := binary.BigEndian.Uint32(frame[1:5])
+	payload := frame[5:]
+	if uint32(len(payload)) != length {
+		return nil, errors.New("gRPC message exceeds inspection limit")
+	}
+	if frame[0] == 0 {
+		return payload, nil
+	}
+
+	if encoding != "gzip" {
+		return nil, fmt.Errorf("unsupported gRPC encoding %q", encoding)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxInspectBodySize))
+}
+
+// grpcFieldValue 按点分隔的字段路径（如 user.name）取值，字符串原样返回，其他类型返回JSON
+func grpcFieldValue(fields map[string]interface{}, path string) (string, bool) {
+	var value interface{} = fields
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[name]; !ok {
+			return "", false
+		}
+	}
+	return jsonString(value), true
+}
+
+// jsonString 将protojson的值转换为用于匹配的字符串
+func jsonString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
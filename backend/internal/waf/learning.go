@@ -0,0 +1,663 @@
+package waf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"waf-go/internal/models"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 学习会话状态
+const (
+	LearningRecording = "recording"
+	LearningStopped   = "stopped"
+	LearningApplied   = "applied"
+)
+
+const (
+	learningFlushInterval  = 30 * time.Second // 内存中的学习数据写入数据库的间隔
+	maxLearningEndpoints   = 2000             // 每个会话最多记录的接口数
+	maxLearningParameters  = 100              // 每个接口最多记录的参数数
+	learningSampleLimit    = 512              // 规则命中记录的匹配值最大长度
+	minLearnedStringLength = 64               // 生成规范时字符串参数maxLength的下限
+)
+
+// learningMethods 记录的请求方法，与OpenAPI支持的操作一致
+var learningMethods = map[string]bool{
+	"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true,
+}
+
+var (
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// LearnedParameter 学习到的参数特征
+type LearnedParameter struct {
+	Name      string   `json:"name"`       // 参数名
+	In        string   `json:"in"`         // 位置：query, body
+	Types     []string `json:"types"`      // 出现过的值类型：integer, number, boolean, string, object, array
+	MinLength int      `json:"min_length"` // 最短值长度
+	MaxLength int      `json:"max_length"` // 最长值长度
+	Count     int64    `json:"count"`      // 出现次数
+}
+
+// learnedEndpoint 内存中聚合的接口特征
+type learnedEndpoint struct {
+	method       string
+	path         string
+	count        int64
+	contentTypes map[string]bool
+	parameters   map[string]*LearnedParameter // 位置:名称 -> 参数
+}
+
+// learningRecorder 一个学习会话的内存聚合数据，定期写入数据库
+type learningRecorder struct {
+	session   models.LearningSession
+	mu        sync.Mutex
+	requests  int64
+	endpoints map[string]*learnedEndpoint        // 方法 路径 -> 接口
+	hits      map[string]*models.LearningRuleHit // 规则ID|方法 路径 -> 命中
+}
+
+func newLearningRecorder(session models.LearningSession) *learningRecorder {
+	return &learningRecorder{
+		session:   session,
+		endpoints: make(map[string]*learnedEndpoint),
+		hits:      make(map[string]*models.LearningRuleHit),
+	}
+}
+
+// loadLearningSessions 加载记录中的学习会话，服务重启后继续记录
+func (e *WAFEngine) loadLearningSessions() {
+	var sessions []models.LearningSession
+	if err := e.db.Where("status = ?", LearningRecording).Find(&sessions).Error; err != nil {
+		log.Printf("Failed to load learning sessions: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		e.StartLearning(session)
+	}
+}
+
+// StartLearning 开始记录域名的学习会话，同一域名同时只有一个会话
+func (e *WAFEngine) StartLearning(session models.LearningSession) {
+	e.learnMu.Lock()
+	e.learning[session.DomainID] = newLearningRecorder(session)
+	e.learnMu.Unlock()
+}
+
+// StopLearning 停止记录域名的学习会话，并写入尚未保存的数据
+func (e *WAFEngine) StopLearning(domainID uint) {
+	e.learnMu.Lock()
+	recorder := e.learning[domainID]
+	delete(e.learning, domainID)
+	e.learnMu.Unlock()
+
+	if recorder != nil {
+		e.flushRecorder(recorder)
+	}
+}
+
+// StartLearningFlusher 定期写入学习数据和OpenAPI规范learn模式的违规，并停止已到期的学习会话
+func (e *WAFEngine) StartLearningFlusher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(learningFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				e.FlushLearning()
+				e.FlushAPIObservations()
+				return
+			case <-ticker.C:
+				e.FlushLearning()
+				e.FlushAPIObservations()
+				e.expireLearningSessions()
+			}
+		}
+	}()
+}
+
+// FlushLearning 将所有学习会话的内存数据写入数据库
+func (e *WAFEngine) FlushLearning() {
+	e.learnMu.RLock()
+	recorders := make([]*learningRecorder, 0, len(e.learning))
+	for _, recorder := range e.learning {
+		recorders = append(recorders, recorder)
+	}
+	e.learnMu.RUnlock()
+
+	for _, recorder := range recorders {
+		e.flushRecorder(recorder)
+	}
+}
+
+// expireLearningSessions 停止已到计划结束时间的学习会话
+func (e *WAFEngine) expireLearningSessions() {
+	now := time.Now()
+	e.learnMu.RLock()
+	var expired []models.LearningSession
+	for _, recorder := range e.learning {
+		if now.After(recorder.session.EndsAt) {
+			expired = append(expired, recorder.session)
+		}
+	}
+	e.learnMu.RUnlock()
+
+	for _, session := range expired {
+		e.StopLearning(session.DomainID)
+		err := e.db.Model(&models.LearningSession{}).
+			Where("id = ? AND status = ?", session.ID, LearningRecording).
+			Updates(map[string]interface{}{"status": LearningStopped, "stopped_at": now}).Error
+		if err != nil {
+			log.Printf("Failed to stop learning session %d: %v", session.ID, err)
+		}
+	}
+}
+
+// learningRecorderFor 获取域名正在记录的学习会话
+func (e *WAFEngine) learningRecorderFor(domainID uint) *learningRecorder {
+	e.learnMu.RLock()
+	recorder := e.learning[domainID]
+	e.learnMu.RUnlock()
+	if recorder == nil || time.Now().After(recorder.session.EndsAt) {
+		return nil
+	}
+	return recorder
+}
+
+// recordLearningProfile 记录未被拦截请求的方法、路径、Content-Type和参数特征
+func (e *WAFEngine) recordLearningProfile(c *gin.Context, domainID uint) {
+	recorder := e.learningRecorderFor(domainID)
+	if recorder == nil || !learningMethods[c.Request.Method] || isDryRun(c) {
+		return
+	}
+
+	path := NormalizePath(c.Request.URL.Path)
+	contentType := c.ContentType()
+	params := requestParameters(c, contentType)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.requests++
+	key := c.Request.Method + " " + path
+	endpoint, ok := recorder.endpoints[key]
+	if !ok {
+		if len(recorder.endpoints) >= maxLearningEndpoints {
+			return
+		}
+		endpoint = &learnedEndpoint{
+			method:       c.Request.Method,
+			path:         path,
+			contentTypes: make(map[string]bool),
+			parameters:   make(map[string]*LearnedParameter),
+		}
+		recorder.endpoints[key] = endpoint
+	}
+
+	endpoint.count++
+	if contentType != "" {
+		endpoint.contentTypes[contentType] = true
+	}
+	for _, param := range params {
+		mergeLearnedParameter(endpoint.parameters, param)
+	}
+}
+
+// recordLearningHit 记录学习期间命中的规则，供运维标记是否为正常流量
+func (e *WAFEngine) recordLearningHit(c *gin.Context, domainID uint, rule models.Rule, matchValue string) {
+	recorder := e.learningRecorderFor(domainID)
+	if recorder == nil || isDryRun(c) {
+		return
+	}
+
+	path := NormalizePath(c.Request.URL.Path)
+	if len(matchValue) > learningSampleLimit {
+		matchValue = matchValue[:learningSampleLimit]
+	}
+	now := time.Now()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	key := fmt.Sprintf("%d|%s %s", rule.ID, c.Request.Method, path)
+	hit, ok := recorder.hits[key]
+	if !ok {
+		hit = &models.LearningRuleHit{
+			SessionID:  recorder.session.ID,
+			DomainID:   domainID,
+			RuleID:     rule.ID,
+			RuleName:   rule.Name,
+			Method:     c.Request.Method,
+			Path:       path,
+			MatchField: rule.MatchType,
+			FirstSeen:  now,
+			TenantID:   recorder.session.TenantID,
+		}
+		recorder.hits[key] = hit
+	}
+	hit.Count++
+	hit.Sample = matchValue
+	hit.LastSeen = now
+}
+
+// flushRecorder 将会话的内存数据合并写入数据库
+func (e *WAFEngine) flushRecorder(recorder *learningRecorder) {
+	recorder.mu.Lock()
+	requests := recorder.requests
+	endpoints := recorder.endpoints
+	hits := recorder.hits
+	recorder.requests = 0
+	recorder.endpoints = make(map[string]*learnedEndpoint)
+	recorder.hits = make(map[string]*models.LearningRuleHit)
+	recorder.mu.Unlock()
+
+	session := recorder.session
+	if requests > 0 {
+		err := e.db.Model(&models.LearningSession{}).Where("id = ?", session.ID).
+			Update("requests", gorm.Expr("requests + ?", requests)).Error
+		if err != nil {
+			log.Printf("Failed to update learning session %d: %v", session.ID, err)
+		}
+	}
+	for _, endpoint := range endpoints {
+		if err := e.saveLearnedEndpoint(session, endpoint); err != nil {
+			log.Printf("Failed to save learned endpoint %s %s: %v", endpoint.method, endpoint.path, err)
+		}
+	}
+	for _, hit := range hits {
+		if err := e.saveLearningHit(hit); err != nil {
+			log.Printf("Failed to save learning rule hit: %v", err)
+		}
+	}
+}
+
+// saveLearnedEndpoint 合并接口特征到数据库记录
+func (e *WAFEngine) saveLearnedEndpoint(session models.LearningSession, endpoint *learnedEndpoint) error {
+	var row models.LearningEndpoint
+	err := e.db.Where("session_id = ? AND method = ? AND path = ?", session.ID, endpoint.method, endpoint.path).First(&row).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	if err == gorm.ErrRecordNotFound {
+		row = models.LearningEndpoint{
+			SessionID: session.ID,
+			DomainID:  session.DomainID,
+			Method:    endpoint.method,
+			Path:      endpoint.path,
+			TenantID:  session.TenantID,
+		}
+	}
+
+	contentTypes := make(map[string]bool)
+	for _, contentType := range DecodeStringList(row.ContentTypes) {
+		contentTypes[contentType] = true
+	}
+	for contentType := range endpoint.contentTypes {
+		contentTypes[contentType] = true
+	}
+
+	parameters := make(map[string]*LearnedParameter)
+	for _, param := range DecodeLearnedParameters(row.Parameters) {
+		param := param
+		parameters[param.In+":"+param.Name] = &param
+	}
+	for _, param := range endpoint.parameters {
+		mergeLearnedParameter(parameters, *param)
+	}
+
+	row.Count += endpoint.count
+	row.ContentTypes = encodeStringSet(contentTypes)
+	row.Parameters = encodeLearnedParameters(parameters)
+	return e.db.Save(&row).Error
+}
+
+// saveLearningHit 累加规则命中到数据库记录
+func (e *WAFEngine) saveLearningHit(hit *models.LearningRuleHit) error {
+	var row models.LearningRuleHit
+	err := e.db.Where("session_id = ? AND rule_id = ? AND method = ? AND path = ?",
+		hit.SessionID, hit.RuleID, hit.Method, hit.Path).First(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		return e.db.Create(hit).Error
+	}
+	if err != nil {
+		return err
+	}
+	return e.db.Model(&row).Updates(map[string]interface{}{
+		"count":     gorm.Expr("count + ?", hit.Count),
+		"sample":    hit.Sample,
+		"last_seen": hit.LastSeen,
+	}).Error
+}
+
+// NormalizePath 将路径中的数字、UUID和长十六进制段替换为占位符，如 /users/42 -> /users/{id}
+func NormalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+		case isDigits(segment):
+			segments[i] = "{id}"
+		case uuidSegment.MatchString(segment):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(segment):
+			segments[i] = "{hash}"
+		case strings.ContainsAny(segment, "{}"):
+			segments[i] = "{value}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// PathPattern 将归一化路径转换为匹配原始路径的正则表达式
+func PathPattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = "[^/]+"
+		} else {
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+	return "^" + strings.Join(segments, "/") + "$"
+}
+
+// requestParameters 提取查询参数和请求体顶层字段（JSON、表单）的特征
+func requestParameters(c *gin.Context, contentType string) []LearnedParameter {
+	var params []LearnedParameter
+	for name, values := range c.Request.URL.Query() {
+		for _, value := range values {
+			params = append(params, newLearnedParameter(name, "query", inferValueType(value), len(value)))
+		}
+	}
+
+	switch contentType {
+	case "application/json":
+		var fields map[string]interface{}
+		if err := json.Unmarshal(requestBody(c), &fields); err != nil {
+			break
+		}
+		for name, value := range fields {
+			if value == nil {
+				continue
+			}
+			params = append(params, newLearnedParameter(name, "body", jsonValueType(value), len(jsonString(value))))
+		}
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(requestBody(c)))
+		if err != nil {
+			break
+		}
+		for name, values := range form {
+			for _, value := range values {
+				params = append(params, newLearnedParameter(name, "body", inferValueType(value), len(value)))
+			}
+		}
+	}
+	return params
+}
+
+func newLearnedParameter(name, in, valueType string, length int) LearnedParameter {
+	return LearnedParameter{Name: name, In: in, Types: []string{valueType}, MinLength: length, MaxLength: length, Count: 1}
+}
+
+// mergeLearnedParameter 合并参数特征，超过参数数上限的新参数被忽略
+func mergeLearnedParameter(parameters map[string]*LearnedParameter, param LearnedParameter) {
+	key := param.In + ":" + param.Name
+	existing, ok := parameters[key]
+	if !ok {
+		if len(parameters) >= maxLearningParameters {
+			return
+		}
+		param.Types = append([]string(nil), param.Types...)
+		parameters[key] = &param
+		return
+	}
+
+	for _, valueType := range param.Types {
+		if !containsString(existing.Types, valueType) {
+			existing.Types = append(existing.Types, valueType)
+		}
+	}
+	if param.MinLength < existing.MinLength {
+		existing.MinLength = param.MinLength
+	}
+	if param.MaxLength > existing.MaxLength {
+		existing.MaxLength = param.MaxLength
+	}
+	existing.Count += param.Count
+}
+
+// inferValueType 推断查询参数或表单值的类型
+func inferValueType(value string) string {
+	if isDigits(strings.TrimPrefix(value, "-")) {
+		return "integer"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil && value != "" {
+		return "number"
+	}
+	if value == "true" || value == "false" {
+		return "boolean"
+	}
+	return "string"
+}
+
+// jsonValueType JSON值的类型
+func jsonValueType(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeStringList 解析JSON字符串数组，无效内容返回空
+func DecodeStringList(data string) []string {
+	var list []string
+	if data != "" {
+		json.Unmarshal([]byte(data), &list)
+	}
+	return list
+}
+
+// DecodeLearnedParameters 解析学习到的参数特征
+func DecodeLearnedParameters(data string) []LearnedParameter {
+	var params []LearnedParameter
+	if data != "" {
+		json.Unmarshal([]byte(data), &params)
+	}
+	return params
+}
+
+func encodeStringSet(set map[string]bool) string {
+	list := make([]string, 0, len(set))
+	for item := range set {
+		list = append(list, item)
+	}
+	sort.Strings(list)
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+func encodeLearnedParameters(parameters map[string]*LearnedParameter) string {
+	list := make([]LearnedParameter, 0, len(parameters))
+	for _, param := range parameters {
+		list = append(list, *param)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].In != list[j].In {
+			return list[i].In < list[j].In
+		}
+		return list[i].Name < list[j].Name
+	})
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+// LearnedSpec 根据学习到的接口生成OpenAPI 3规范（JSON）。
+// 路径占位符成为路径参数，查询参数和JSON请求体字段按观察到的类型和长度生成schema
+func LearnedSpec(title string, endpoints []models.LearningEndpoint) ([]byte, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: title, Version: time.Now().Format("20060102150405")},
+		Paths:   openapi3.Paths{},
+	}
+
+	for _, endpoint := range endpoints {
+		if !learningMethods[endpoint.Method] {
+			continue
+		}
+		path, pathParams := openAPIPath(endpoint.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = &openapi3.PathItem{}
+			doc.Paths[path] = item
+		}
+
+		operation := openapi3.NewOperation()
+		operation.Responses = openapi3.Responses{
+			"default": &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("learned response")},
+		}
+		for name, placeholder := range pathParams {
+			schema := openapi3.NewStringSchema()
+			switch placeholder {
+			case "id":
+				schema = openapi3.NewIntegerSchema()
+			case "uuid":
+				schema = openapi3.NewUUIDSchema()
+			}
+			operation.AddParameter(openapi3.NewPathParameter(name).WithSchema(schema))
+		}
+
+		body := openapi3.NewObjectSchema()
+		for _, param := range DecodeLearnedParameters(endpoint.Parameters) {
+			if param.In == "query" {
+				operation.AddParameter(openapi3.NewQueryParameter(param.Name).WithSchema(learnedSchema(param, true)))
+			} else {
+				body.WithProperty(param.Name, learnedSchema(param, false))
+			}
+		}
+
+		contentTypes := DecodeStringList(endpoint.ContentTypes)
+		if len(contentTypes) > 0 {
+			content := openapi3.Content{}
+			for _, contentType := range contentTypes {
+				switch contentType {
+				case "application/json", "application/x-www-form-urlencoded":
+					content[contentType] = openapi3.NewMediaType().WithSchema(body)
+				default:
+					content[contentType] = openapi3.NewMediaType()
+				}
+			}
+			operation.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(content)}
+		}
+
+		item.SetOperation(endpoint.Method, operation)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// openAPIPath 为归一化路径中的占位符生成唯一的参数名，如 /a/{id}/b/{id} -> /a/{id}/b/{id2}
+func openAPIPath(path string) (string, map[string]string) {
+	params := make(map[string]string)
+	seen := make(map[string]int)
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		placeholder := strings.Trim(segment, "{}")
+		seen[placeholder]++
+		name := placeholder
+		if seen[placeholder] > 1 {
+			name = fmt.Sprintf("%s%d", placeholder, seen[placeholder])
+		}
+		segments[i] = "{" + name + "}"
+		params[name] = placeholder
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// learnedSchema 根据参数出现过的类型生成schema，字符串长度上限为观察值的两倍。
+// 类型不一致时查询参数退化为字符串，请求体字段不限制类型
+func learnedSchema(param LearnedParameter, query bool) *openapi3.Schema {
+	types := param.Types
+	if len(types) == 2 && containsString(types, "integer") && containsString(types, "number") {
+		types = []string{"number"}
+	}
+	if len(types) != 1 {
+		if !query {
+			return openapi3.NewSchema()
+		}
+		types = []string{"string"}
+	}
+
+	switch types[0] {
+	case "integer":
+		return openapi3.NewIntegerSchema()
+	case "number":
+		return openapi3.NewFloat64Schema()
+	case "boolean":
+		return openapi3.NewBoolSchema()
+	case "object":
+		return openapi3.NewObjectSchema()
+	case "array":
+		return openapi3.NewArraySchema().WithItems(openapi3.NewSchema())
+	default:
+		maxLength := param.MaxLength * 2
+		if maxLength < minLearnedStringLength {
+			maxLength = minLearnedStringLength
+		}
+		return openapi3.NewStringSchema().WithMaxLength(int64(maxLength))
+	}
+}
@@ -0,0 +1,349 @@
+package waf
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"strings"
+	"time"
+
+	"waf-go/internal/certs"
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// literalPatterns 一组字面量模式：exact按哈希表查找，contains编译为Aho-Corasick自动机，
+// 每个模式对应若干ID（规则ID或列表项序号）
+type literalPatterns struct {
+	foldCase  bool              // contains模式大小写不敏感
+	exact     map[string][]uint // 精确匹配值 -> ID
+	always    []uint            // 空contains模式，总是匹配
+	patterns  []string          // 去重后的contains模式
+	ids       [][]uint          // contains模式序号 -> ID
+	index     map[string]int    // 构建时使用：contains模式 -> 序号
+	automaton *ahoCorasick
+}
+
+func newLiteralPatterns(foldCase bool) *literalPatterns {
+	return &literalPatterns{
+		foldCase: foldCase,
+		exact:    make(map[string][]uint),
+		index:    make(map[string]int),
+	}
+}
+
+func (p *literalPatterns) addExact(value string, id uint) {
+	p.exact[value] = append(p.exact[value], id)
+}
+
+func (p *literalPatterns) addContains(pattern string, id uint) {
+	if p.foldCase {
+		pattern = strings.ToLower(pattern)
+	}
+	if pattern == "" {
+		p.always = append(p.always, id)
+		return
+	}
+	i, ok := p.index[pattern]
+	if !ok {
+		i = len(p.patterns)
+		p.index[pattern] = i
+		p.patterns = append(p.patterns, pattern)
+		p.ids = append(p.ids, nil)
+	}
+	p.ids[i] = append(p.ids[i], id)
+}
+
+// build 编译contains模式，之后不能再添加模式
+func (p *literalPatterns) build() {
+	if len(p.patterns) > 0 {
+		p.automaton = newAhoCorasick(p.patterns)
+	}
+	p.index = nil
+}
+
+// matches 对值命中的每个ID调用fn，同一ID可能多次回调
+func (p *literalPatterns) matches(value string, fn func(id uint)) {
+	for _, id := range p.exact[value] {
+		fn(id)
+	}
+	for _, id := range p.always {
+		fn(id)
+	}
+	if p.automaton == nil {
+		return
+	}
+	if p.foldCase {
+		value = strings.ToLower(value)
+	}
+	p.automaton.match(value, func(pattern int) {
+		for _, id := range p.ids[pattern] {
+			fn(id)
+		}
+	})
+}
+
+// ruleMatcher 域名规则中contains和exact规则的多模式匹配器，按匹配目标分组
+type ruleMatcher struct {
+	fingerprint uint64
+	targets     map[string]*literalPatterns // 匹配目标 -> 规则模式
+}
+
+func newRuleMatcher(rules []models.Rule, fingerprint uint64) *ruleMatcher {
+	m := &ruleMatcher{fingerprint: fingerprint, targets: make(map[string]*literalPatterns)}
+	for _, rule := range rules {
+		target, literal, ok := literalRuleTarget(rule)
+		if !ok {
+			continue
+		}
+		patterns, ok := m.targets[target]
+		if !ok {
+			// 与performMatch一致：contains大小写不敏感，exact区分大小写
+			patterns = newLiteralPatterns(true)
+			m.targets[target] = patterns
+		}
+		if rule.MatchMode == "exact" {
+			patterns.addExact(literal, rule.ID)
+		} else {
+			patterns.addContains(literal, rule.ID)
+		}
+	}
+	for _, patterns := range m.targets {
+		patterns.build()
+	}
+	return m
+}
+
+// literalRuleTarget 返回可用多模式匹配的规则的匹配目标和字面量，
+// 只有uri、ip、user_agent、body和name:value格式的header规则的contains/exact匹配适用
+func literalRuleTarget(rule models.Rule) (string, string, bool) {
+	if rule.MatchMode != "contains" && rule.MatchMode != "exact" {
+		return "", "", false
+	}
+	switch rule.MatchType {
+	case "uri", "ip", "user_agent", "body":
+		return rule.MatchType, rule.Pattern, true
+	case "header":
+		name, value, ok := strings.Cut(rule.Pattern, ":")
+		if !ok {
+			return "", "", false
+		}
+		return "header:" + name, value, true
+	}
+	return "", "", false
+}
+
+// literalTargetValue 获取匹配目标对应的请求值，与matchRule取值一致
+func literalTargetValue(c *gin.Context, target string) string {
+	switch target {
+	case "uri":
+		return c.Request.URL.Path
+	case "ip":
+		return c.ClientIP()
+	case "user_agent":
+		return c.GetHeader("User-Agent")
+	case "body":
+		return inspectedBody(c, nil)
+	}
+	return c.GetHeader(strings.TrimPrefix(target, "header:"))
+}
+
+// literalHits 单个请求的多模式匹配结果，每个匹配目标在首次用到时扫描一次，得到该目标命中的所有规则
+type literalHits struct {
+	matcher *ruleMatcher
+	hits    map[string]map[uint]bool // 匹配目标 -> 命中的规则ID
+	values  map[string]string        // 匹配目标 -> 请求值
+}
+
+// newLiteralHits 创建请求的多模式匹配结果，域名规则未变化时复用cache中已编译的匹配器
+func (e *WAFEngine) newLiteralHits(cache map[uint]*ruleMatcher, domainID uint, rules []models.Rule) *literalHits {
+	fingerprint := rulesFingerprint(rules)
+
+	e.matchMu.RLock()
+	matcher, ok := cache[domainID]
+	e.matchMu.RUnlock()
+	if !ok || matcher.fingerprint != fingerprint {
+		matcher = newRuleMatcher(rules, fingerprint)
+		e.matchMu.Lock()
+		cache[domainID] = matcher
+		e.matchMu.Unlock()
+	}
+
+	return &literalHits{
+		matcher: matcher,
+		hits:    make(map[string]map[uint]bool),
+		values:  make(map[string]string),
+	}
+}
+
+// match 返回规则是否命中及匹配值，ok为false表示规则不适用多模式匹配
+func (h *literalHits) match(rule models.Rule, c *gin.Context) (matched bool, value string, ok bool) {
+	target, _, ok := literalRuleTarget(rule)
+	if !ok {
+		return false, "", false
+	}
+	hits, scanned := h.hits[target]
+	if !scanned {
+		hits = make(map[uint]bool)
+		value := literalTargetValue(c, target)
+		if patterns, ok := h.matcher.targets[target]; ok {
+			patterns.matches(value, func(id uint) { hits[id] = true })
+		}
+		h.hits[target], h.values[target] = hits, value
+	}
+	return hits[rule.ID], h.values[target], true
+}
+
+// evaluateRule 检查规则是否匹配并记录计算耗时。没有排除目标时contains和exact规则使用多模式匹配结果，其他规则逐条匹配
+func (e *WAFEngine) evaluateRule(hits *literalHits, rule models.Rule, c *gin.Context, domainID uint, targets *excludedTargets) (matched bool, value string) {
+	start := time.Now()
+	defer func() { e.recordRuleTiming(rule.ID, matched, time.Since(start)) }()
+
+	if targets == nil && hits != nil {
+		if matched, value, ok := hits.match(rule, c); ok {
+			return matched, value
+		}
+	}
+	return e.matchRule(rule, c, domainID, targets)
+}
+
+// listEntry 黑白名单项
+type listEntry struct {
+	ID        uint
+	Type      string
+	Value     string
+	UpdatedAt time.Time
+}
+
+// listNetwork CIDR格式的IP名单项
+type listNetwork struct {
+	index   int
+	network *net.IPNet
+}
+
+// listMatcher 域名黑名单或白名单的匹配器，一次匹配返回第一个（优先级最高的）命中项
+type listMatcher struct {
+	fingerprint uint64
+	ips         *literalPatterns // 精确IP
+	networks    []listNetwork    // CIDR网段
+	uris        *literalPatterns // URI包含匹配，区分大小写
+	userAgents  *literalPatterns // User-Agent包含匹配，大小写不敏感
+	certs       *literalPatterns // 客户端证书指纹
+}
+
+func newListMatcher(entries []listEntry, fingerprint uint64) *listMatcher {
+	m := &listMatcher{
+		fingerprint: fingerprint,
+		ips:         newLiteralPatterns(false),
+		uris:        newLiteralPatterns(false),
+		userAgents:  newLiteralPatterns(true),
+		certs:       newLiteralPatterns(false),
+	}
+	for i, entry := range entries {
+		switch entry.Type {
+		case "ip":
+			if !strings.Contains(entry.Value, "/") {
+				m.ips.addExact(entry.Value, uint(i))
+				continue
+			}
+			if _, network, err := net.ParseCIDR(entry.Value); err == nil {
+				m.networks = append(m.networks, listNetwork{index: i, network: network})
+			}
+		case "uri":
+			m.uris.addContains(entry.Value, uint(i))
+		case "user_agent":
+			m.userAgents.addContains(entry.Value, uint(i))
+		case "client_cert":
+			m.certs.addExact(certs.NormalizeFingerprint(entry.Value), uint(i))
+		}
+	}
+	m.ips.build()
+	m.uris.build()
+	m.userAgents.build()
+	m.certs.build()
+	return m
+}
+
+// first 返回命中的名单项中序号最小的一个，没有命中时返回-1
+func (m *listMatcher) first(clientIP, uri, userAgent, certFingerprint string) int {
+	best := -1
+	consider := func(id uint) {
+		if best < 0 || int(id) < best {
+			best = int(id)
+		}
+	}
+
+	m.ips.matches(clientIP, consider)
+	if ip := net.ParseIP(clientIP); ip != nil {
+		for _, network := range m.networks {
+			if (best < 0 || network.index < best) && network.network.Contains(ip) {
+				best = network.index
+			}
+		}
+	}
+	m.uris.matches(uri, consider)
+	m.userAgents.matches(userAgent, consider)
+	if certFingerprint != "" {
+		m.certs.matches(certFingerprint, consider)
+	}
+	return best
+}
+
+// whiteListMatcher 获取域名白名单的匹配器
+func (e *WAFEngine) whiteListMatcher(domainID uint, items []models.WhiteList) *listMatcher {
+	entries := make([]listEntry, len(items))
+	for i, item := range items {
+		entries[i] = listEntry{ID: item.ID, Type: item.Type, Value: item.Value, UpdatedAt: item.UpdatedAt}
+	}
+	return e.listMatcher(e.whiteListMatchers, domainID, entries)
+}
+
+// blackListMatcher 获取域名黑名单的匹配器
+func (e *WAFEngine) blackListMatcher(domainID uint, items []models.BlackList) *listMatcher {
+	entries := make([]listEntry, len(items))
+	for i, item := range items {
+		entries[i] = listEntry{ID: item.ID, Type: item.Type, Value: item.Value, UpdatedAt: item.UpdatedAt}
+	}
+	return e.listMatcher(e.blackListMatchers, domainID, entries)
+}
+
+// listMatcher 名单未变化时复用已编译的匹配器
+func (e *WAFEngine) listMatcher(cache map[uint]*listMatcher, domainID uint, entries []listEntry) *listMatcher {
+	fingerprint := itemsFingerprint(len(entries), func(i int) (uint, time.Time) {
+		return entries[i].ID, entries[i].UpdatedAt
+	})
+
+	e.matchMu.RLock()
+	matcher, ok := cache[domainID]
+	e.matchMu.RUnlock()
+	if ok && matcher.fingerprint == fingerprint {
+		return matcher
+	}
+
+	matcher = newListMatcher(entries, fingerprint)
+	e.matchMu.Lock()
+	cache[domainID] = matcher
+	e.matchMu.Unlock()
+	return matcher
+}
+
+// rulesFingerprint 根据规则ID、顺序和更新时间计算指纹，规则增删改或策略调整后指纹变化
+func rulesFingerprint(rules []models.Rule) uint64 {
+	return itemsFingerprint(len(rules), func(i int) (uint, time.Time) {
+		return rules[i].ID, rules[i].UpdatedAt
+	})
+}
+
+// itemsFingerprint 根据各项的ID和更新时间计算指纹
+func itemsFingerprint(n int, item func(i int) (uint, time.Time)) uint64 {
+	h := fnv.New64a()
+	var buf [16]byte
+	for i := 0; i < n; i++ {
+		id, updatedAt := item(i)
+		binary.LittleEndian.PutUint64(buf[:8], uint64(id))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(updatedAt.UnixNano()))
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,252 @@
+package waf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaskUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"", ""},
+		{"a", "a***"},
+		{"ab", "a***"},
+		{"abc", "a***c"},
+		{"admin", "a***n"},
+		{"alice@example.com", "a***e@example.com"},
+		{"a@example.com", "a***@example.com"},
+		{"a.b@c@example.com", "a***c@example.com"},
+		{"@example.com", "@***m"},
+		{"张三丰", "张***丰"},
+	}
+	for _, tt := range tests {
+		if got := maskUsername(tt.username); got != tt.want {
+			t.Errorf("maskUsername(%q) = %q, want %q", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestLoginDelayDuration(t *testing.T) {
+	endpoint := &models.LoginEndpoint{DelayAfter: 3, DelayMs: 500, MaxDelayMs: 8000}
+	tests := []struct {
+		endpoint *models.LoginEndpoint
+		failures int64
+		want     time.Duration
+	}{
+		{endpoint, 3, 500 * time.Millisecond},
+		{endpoint, 4, time.Second},
+		{endpoint, 5, 2 * time.Second},
+		{endpoint, 7, 8 * time.Second},
+		{endpoint, 8, 8 * time.Second},
+		{endpoint, 1000, 8 * time.Second},
+		// 未配置或超过上限的最大延迟按maxLoginDelay计算
+		{&models.LoginEndpoint{DelayAfter: 1, DelayMs: 1000}, 20, maxLoginDelay},
+		{&models.LoginEndpoint{DelayAfter: 1, DelayMs: 1000, MaxDelayMs: 600000}, 20, maxLoginDelay},
+		// 首次延迟超过最大延迟时也不超过上限
+		{&models.LoginEndpoint{DelayAfter: 1, DelayMs: 3000, MaxDelayMs: 2000}, 1, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := loginDelayDuration(tt.endpoint, tt.failures); got != tt.want {
+			t.Errorf("loginDelayDuration(%+v, %d) = %s, want %s", *tt.endpoint, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginEscalation(t *testing.T) {
+	endpoint := &models.LoginEndpoint{
+		DelayAfter:        3,
+		DelayMs:           500,
+		MaxDelayMs:        8000,
+		ChallengeAfter:    5,
+		MaxUserIPFailures: 10,
+		MaxIPFailures:     50,
+		MaxUserFailures:   20,
+		MaxUsernamesPerIP: 10,
+	}
+
+	tests := []struct {
+		name     string
+		endpoint *models.LoginEndpoint
+		username string
+		counts   loginCounts
+		passed   bool
+		want     string // 事件类型/处置方式，没有违规时为空
+		delay    time.Duration
+	}{
+		{name: "no failures", username: "alice"},
+		{name: "below delay threshold", username: "alice", counts: loginCounts{userIP: 2, ip: 2, user: 2}},
+		{name: "delay", username: "alice", counts: loginCounts{userIP: 3}, want: "user_ip_failures/delay", delay: 500 * time.Millisecond},
+		{name: "challenge", username: "alice", counts: loginCounts{userIP: 5}, want: "user_ip_failures/challenge"},
+		{name: "challenge passed falls back to delay", username: "alice", counts: loginCounts{userIP: 5}, passed: true, want: "user_ip_failures/delay", delay: 2 * time.Second},
+		{name: "user ip block", username: "alice", counts: loginCounts{userIP: 10}, want: "user_ip_failures/block"},
+		{name: "block ignores passed challenge", username: "alice", counts: loginCounts{userIP: 10}, passed: true, want: "user_ip_failures/block"},
+		{name: "user failures across ips", username: "alice", counts: loginCounts{user: 20}, want: "user_failures/challenge"},
+		{name: "user failures with passed challenge", username: "alice", counts: loginCounts{user: 20}, passed: true},
+		{name: "ip block before user ip block", username: "alice", counts: loginCounts{userIP: 10, ip: 50}, want: "ip_failures/block"},
+		{name: "username spray first", username: "alice", counts: loginCounts{userIP: 10, ip: 50, usernames: 10}, want: "username_spray/block"},
+		{name: "no username only counts ip", counts: loginCounts{userIP: 10, user: 20}},
+		{name: "no username ip block", counts: loginCounts{ip: 50}, want: "ip_failures/block"},
+		{name: "thresholds disabled", endpoint: &models.LoginEndpoint{}, username: "alice", counts: loginCounts{userIP: 1000, ip: 1000, user: 1000, usernames: 1000}},
+	}
+
+	for _, tt := range tests {
+		attempt := &loginAttempt{endpoint: endpoint, username: tt.username, clientIP: "192.0.2.1"}
+		if tt.endpoint != nil {
+			attempt.endpoint = tt.endpoint
+		}
+		counts := tt.counts
+
+		got, delay := "", time.Duration(0)
+		if v := loginEscalation(attempt, &counts, tt.passed); v != nil {
+			got, delay = v.Type+"/"+v.Action, v.Delay
+		}
+		if got != tt.want || delay != tt.delay {
+			t.Errorf("%s: violation = %q (delay %s), want %q (delay %s)", tt.name, got, delay, tt.want, tt.delay)
+		}
+	}
+}
+
+func TestRedactedLoginBody(t *testing.T) {
+	masked := &loginAttempt{endpoint: &models.LoginEndpoint{UsernameField: "username", MaskUsername: true}, username: "alice@example.com"}
+	nested := &loginAttempt{endpoint: &models.LoginEndpoint{UsernameField: "user.email"}, username: "bob@example.com"}
+
+	tests := []struct {
+		name        string
+		attempt     *loginAttempt
+		contentType string
+		body        string
+		form        url.Values // 表单请求体的期望值
+		json        string     // JSON请求体的期望值
+		want        string     // 无法解析时的期望值
+	}{
+		{name: "empty body", attempt: masked, contentType: "application/json", body: ""},
+		{
+			name: "form", attempt: masked, contentType: "application/x-www-form-urlencoded",
+			body: "username=alice%40example.com&password=secret&remember=1&remember=2",
+			form: url.Values{"username": {"a***e@example.com"}, "password": {loginRedacted}, "remember": {loginRedacted, loginRedacted}},
+		},
+		{name: "invalid form", attempt: masked, contentType: "application/x-www-form-urlencoded", body: "username=%zz", want: loginRedacted},
+		{
+			name: "nested json", attempt: nested, contentType: "application/json",
+			body: `{"user":{"email":"bob@example.com","password":"p"},"otp":123456,"tags":["a",{"k":"v"}],"email":"x"}`,
+			json: `{"user":{"email":"bob@example.com","password":"[redacted]"},"otp":"[redacted]","tags":["[redacted]",{"k":"[redacted]"}],"email":"[redacted]"}`,
+		},
+		{name: "json with masked username", attempt: masked, contentType: "application/json", body: `{"username":"alice@example.com","password":"p"}`, json: `{"username":"a***e@example.com","password":"[redacted]"}`},
+		{name: "invalid json", attempt: masked, contentType: "application/json", body: `{"username":`, want: loginRedacted},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body))
+		c.Request.Header.Set("Content-Type", tt.contentType)
+		got := redactedLoginBody(c, tt.attempt, tt.body)
+
+		switch {
+		case tt.form != nil:
+			values, err := url.ParseQuery(got)
+			if err != nil || !reflect.DeepEqual(values, tt.form) {
+				t.Errorf("%s: body = %q, want %v", tt.name, got, tt.form)
+			}
+		case tt.json != "":
+			var gotValue, wantValue interface{}
+			json.Unmarshal([]byte(tt.json), &wantValue)
+			if err := json.Unmarshal([]byte(got), &gotValue); err != nil || !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("%s: body = %s, want %s", tt.name, got, tt.json)
+			}
+		default:
+			if got != tt.want {
+				t.Errorf("%s: body = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+// solveChallenge 计算质询的工作量证明，返回完整的cookie值
+func solveChallenge(challenge string) string {
+	for counter := 0; ; counter++ {
+		if cookie := challenge + "." + strconv.Itoa(counter); proofOfWorkValid(cookie, loginChallengeBits) {
+			return cookie
+		}
+	}
+}
+
+func TestProofOfWorkValid(t *testing.T) {
+	for i := 0; i < 5000; i++ {
+		solution := "challenge." + strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(solution))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		for _, n := range []int{0, 1, 4, 8, 12} {
+			if got := proofOfWorkValid(solution, n); got != (zeros >= n) {
+				t.Fatalf("proofOfWorkValid(%q, %d) = %v, leading zero bits %d", solution, n, got, zeros)
+			}
+		}
+	}
+}
+
+func TestLoginChallengePassed(t *testing.T) {
+	e := &WAFEngine{}
+	attempt := &loginAttempt{endpoint: &models.LoginEndpoint{ID: 1}, username: "alice", clientIP: "192.0.2.1"}
+	otherIP := &loginAttempt{endpoint: attempt.endpoint, username: "alice", clientIP: "192.0.2.2"}
+	otherEndpoint := &loginAttempt{endpoint: &models.LoginEndpoint{ID: 2}, username: "alice", clientIP: "192.0.2.1"}
+	expires := time.Now().Unix() + 60
+
+	challenge := e.challengeToken(attempt, expires, "nonce")
+	valid := solveChallenge(challenge)
+	unsolved := challenge + ".0"
+	for counter := 1; proofOfWorkValid(unsolved, loginChallengeBits); counter++ {
+		unsolved = challenge + "." + strconv.Itoa(counter)
+	}
+	parts := strings.Split(challenge, ".")
+	forged := parts[0] + "." + parts[1] + "." + strings.Repeat("0", len(parts[2]))
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   bool
+	}{
+		{name: "valid", cookie: valid, want: true},
+		{name: "no cookie"},
+		{name: "challenge without proof of work", cookie: challenge},
+		{name: "proof of work not solved", cookie: unsolved},
+		{name: "non-numeric counter", cookie: challenge + ".x"},
+		{name: "expired", cookie: solveChallenge(e.challengeToken(attempt, time.Now().Unix()-1, "nonce"))},
+		{name: "forged signature", cookie: solveChallenge(forged)},
+		{name: "extended expiry", cookie: solveChallenge(strconv.FormatInt(expires+3600, 10) + "." + parts[1] + "." + parts[2])},
+		{name: "other nonce", cookie: solveChallenge(parts[0] + ".other." + parts[2])},
+		{name: "other client ip", cookie: solveChallenge(e.challengeToken(otherIP, expires, "nonce"))},
+		{name: "other login endpoint", cookie: solveChallenge(e.challengeToken(otherEndpoint, expires, "nonce"))},
+		{name: "garbage", cookie: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+		if tt.cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: loginChallengeCookie, Value: tt.cookie})
+		}
+		if got := e.loginChallengePassed(c, attempt); got != tt.want {
+			t.Errorf("%s: loginChallengePassed(%q) = %v, want %v", tt.name, tt.cookie, got, tt.want)
+		}
+	}
+}
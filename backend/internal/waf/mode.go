@@ -0,0 +1,157 @@
+package waf
+
+import (
+	"fmt"
+	"strings"
+
+	"waf-go/internal/models"
+)
+
+// 防护模式，可设置在域名、策略和域名策略关联上
+const (
+	ModeEnforce    = "enforce"     // 拦截
+	ModeDetectOnly = "detect_only" // 只记录would_block，请求照常转发
+	ModeOff        = "off"         // 不检查
+)
+
+// ActionWouldBlock 检测模式下本应拦截的请求的动作，请求照常转发并记录攻击日志
+const ActionWouldBlock = "would_block"
+
+// Modes 支持的防护模式
+var Modes = []string{ModeEnforce, ModeDetectOnly, ModeOff}
+
+// modeLevel 模式的宽松程度，空值视为enforce
+func modeLevel(mode string) int {
+	switch mode {
+	case ModeDetectOnly:
+		return 1
+	case ModeOff:
+		return 2
+	}
+	return 0
+}
+
+// RelaxedMode 返回各模式中最宽松的一个：off > detect_only > enforce
+func RelaxedMode(modes ...string) string {
+	result := ModeEnforce
+	for _, mode := range modes {
+		if modeLevel(mode) > modeLevel(result) {
+			result = mode
+		}
+	}
+	return result
+}
+
+// domainRuleRow 域名规则及其所属策略和域名策略关联的模式
+type domainRuleRow struct {
+	models.Rule
+	PolicyMode       string `gorm:"column:policy_mode"`
+	DomainPolicyMode string `gorm:"column:domain_policy_mode"`
+	Shadow           bool   `gorm:"column:shadow"`
+}
+
+// domainRuleSet 域名的生效规则和影子规则
+type domainRuleSet struct {
+	rules  []models.Rule   // 生效策略的规则，按优先级排序
+	modes  map[uint]string // 规则ID -> 模式，只包含检测模式的规则
+	shadow []models.Rule   // 影子策略的规则，按优先级排序
+}
+
+// domainRules 获取域名对应的生效规则和影子规则。模式为off的策略不加载；
+// 规则属于多个生效策略时取最严格的模式
+func (e *WAFEngine) domainRules(domainID uint) (*domainRuleSet, error) {
+	var rows []domainRuleRow
+
+	// 查询路径：domains -> domain_policies -> policies -> policy_rules -> rules
+	err := e.db.Table("rules").
+		Select("rules.*, policies.mode AS policy_mode, domain_policies.mode AS domain_policy_mode, domain_policies.shadow AS shadow").
+		Joins("JOIN policy_rules ON rules.id = policy_rules.rule_id").
+		Joins("JOIN policies ON policy_rules.policy_id = policies.id").
+		Joins("JOIN domain_policies ON policies.id = domain_policies.policy_id").
+		Where("domain_policies.domain_id = ? AND domain_policies.enabled = ? AND policy_rules.enabled = ? AND policies.enabled = ? AND rules.enabled = ?",
+			domainID, true, true, true, true).
+		Where("policies.mode <> ? AND domain_policies.mode <> ?", ModeOff, ModeOff).
+		Order("policy_rules.priority DESC, rules.priority DESC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain rules: %v", err)
+	}
+
+	set := &domainRuleSet{modes: make(map[uint]string)}
+	seen := make(map[uint]bool)
+	seenShadow := make(map[uint]bool)
+	for _, row := range rows {
+		if row.Shadow {
+			if !seenShadow[row.ID] {
+				seenShadow[row.ID] = true
+				set.shadow = append(set.shadow, row.Rule)
+			}
+			continue
+		}
+
+		mode := RelaxedMode(row.PolicyMode, row.DomainPolicyMode)
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			set.rules = append(set.rules, row.Rule)
+			if mode == ModeDetectOnly {
+				set.modes[row.ID] = mode
+			}
+			continue
+		}
+		// 任一策略拦截时规则即拦截
+		if mode == ModeEnforce {
+			delete(set.modes, row.ID)
+		}
+	}
+	return set, nil
+}
+
+// policyRuleRow 策略规则及策略的模式
+type policyRuleRow struct {
+	models.Rule
+	PolicyMode string `gorm:"column:policy_mode"`
+}
+
+// policyRules 获取指定策略的规则，用于回放流量时替换域名关联的策略。
+// 模式为off的策略不加载；规则属于多个策略时取最严格的模式
+func (e *WAFEngine) policyRules(policyIDs []uint) (*domainRuleSet, error) {
+	var rows []policyRuleRow
+	err := e.db.Table("rules").
+		Select("rules.*, policies.mode AS policy_mode").
+		Joins("JOIN policy_rules ON rules.id = policy_rules.rule_id").
+		Joins("JOIN policies ON policy_rules.policy_id = policies.id").
+		Where("policies.id IN ? AND policy_rules.enabled = ? AND policies.enabled = ? AND rules.enabled = ?",
+			policyIDs, true, true, true).
+		Where("policies.mode <> ?", ModeOff).
+		Order("policy_rules.priority DESC, rules.priority DESC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy rules: %v", err)
+	}
+
+	set := &domainRuleSet{modes: make(map[uint]string)}
+	seen := make(map[uint]bool)
+	for _, row := range rows {
+		mode := RelaxedMode(row.PolicyMode)
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			set.rules = append(set.rules, row.Rule)
+			if mode == ModeDetectOnly {
+				set.modes[row.ID] = mode
+			}
+			continue
+		}
+		if mode == ModeEnforce {
+			delete(set.modes, row.ID)
+		}
+	}
+	return set, nil
+}
+
+// wouldBlock 将拦截结果转为检测模式的would_block，请求照常转发
+func wouldBlock(result *CheckResult) {
+	result.Action = ActionWouldBlock
+	if !strings.HasPrefix(result.Message, "Would block: ") {
+		result.Message = "Would block: " + result.Message
+	}
+}
@@ -0,0 +1,398 @@
+package waf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"waf-go/internal/models"
+	"waf-go/internal/utils"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OpenAPI规范模式
+const (
+	APISpecEnforce = "enforce"
+	APISpecLogOnly = "log_only"
+	APISpecLearn   = "learn"
+)
+
+const (
+	apiSampleLimit     = 256  // 违规说明中记录的参数值最大长度
+	maxAPIObservations = 5000 // 内存中最多聚合的learn模式违规数，超过后到下次写入前不再记录新的违规
+)
+
+// apiBodyTooLarge 请求体超过检查上限时违反的约束
+const apiBodyTooLarge = "body_too_large"
+
+// compiledAPISpec 解析后的OpenAPI规范及其路由
+type compiledAPISpec struct {
+	spec   models.APISpec
+	router routers.Router
+}
+
+// APIViolation 请求违反OpenAPI规范的详情
+type APIViolation struct {
+	Method     string // 请求方法
+	Path       string // 规范中的路径模板，未匹配时为请求路径
+	Parameter  string // 违规的参数，如 query.limit, header.X-Token, body/user/email, path, method
+	Constraint string // 违反的约束，如 paths, operation, required, type, maxLength, content_type, body_too_large
+	Reason     string // 违规说明
+	Value      string // 违规的值
+}
+
+// ParseAPISpec 解析并校验OpenAPI 3规范（JSON或YAML），不允许引用外部文件
+func ParseAPISpec(content []byte) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = false
+	doc, err := loader.LoadFromData(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %v", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %v", err)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("OpenAPI spec defines no paths")
+	}
+	return doc, nil
+}
+
+// CountAPIOperations 统计规范定义的操作数
+func CountAPIOperations(doc *openapi3.T) int {
+	count := 0
+	for _, item := range doc.Paths {
+		count += len(item.Operations())
+	}
+	return count
+}
+
+// compileAPISpec 解析规范并创建路由。servers只保留路径部分，规范对任意Host生效
+func compileAPISpec(spec models.APISpec) (*compiledAPISpec, error) {
+	doc, err := ParseAPISpec([]byte(spec.Content))
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range doc.Servers {
+		server.URL = relativeServerURL(server.URL)
+	}
+	for _, item := range doc.Paths {
+		for _, server := range item.Servers {
+			server.URL = relativeServerURL(server.URL)
+		}
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %v", err)
+	}
+	spec.Content = ""
+	return &compiledAPISpec{spec: spec, router: router}, nil
+}
+
+// relativeServerURL 去掉server URL中的协议和主机，如 https://api.example.com/v1 -> /v1
+func relativeServerURL(serverURL string) string {
+	if idx := strings.Index(serverURL, "://"); idx != -1 {
+		rest := serverURL[idx+3:]
+		if slash := strings.Index(rest, "/"); slash != -1 {
+			return rest[slash:]
+		}
+		return "/"
+	}
+	return serverURL
+}
+
+// ResetAPISpecs 清除域名的OpenAPI规范缓存，规范变更后调用
+func (e *WAFEngine) ResetAPISpecs(domainID uint) {
+	e.apiMu.Lock()
+	delete(e.apiSpecs, domainID)
+	e.apiMu.Unlock()
+
+	// 尚未写入的learn模式违规可能属于已删除或已修改的规范
+	e.apiObsMu.Lock()
+	for key, observation := range e.apiObservations {
+		if observation.DomainID == domainID {
+			delete(e.apiObservations, key)
+		}
+	}
+	e.apiObsMu.Unlock()
+}
+
+// domainAPISpecs 获取域名启用的OpenAPI规范，按路径前缀从长到短排序
+func (e *WAFEngine) domainAPISpecs(domainID uint) []*compiledAPISpec {
+	e.apiMu.RLock()
+	specs, ok := e.apiSpecs[domainID]
+	e.apiMu.RUnlock()
+	if ok {
+		return specs
+	}
+
+	var items []models.APISpec
+	if err := e.db.Where("domain_id = ? AND enabled = ?", domainID, true).Find(&items).Error; err != nil {
+		log.Printf("Failed to load API specs: %v", err)
+		return nil
+	}
+
+	specs = make([]*compiledAPISpec, 0, len(items))
+	for _, item := range items {
+		compiled, err := compileAPISpec(item)
+		if err != nil {
+			log.Printf("Failed to compile API spec %d: %v", item.ID, err)
+			continue
+		}
+		specs = append(specs, compiled)
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		return len(specs[i].spec.Location) > len(specs[j].spec.Location)
+	})
+
+	e.apiMu.Lock()
+	e.apiSpecs[domainID] = specs
+	e.apiMu.Unlock()
+	return specs
+}
+
+// checkAPISpec 使用路径前缀匹配的OpenAPI规范校验请求，返回规范和违规详情
+func (e *WAFEngine) checkAPISpec(c *gin.Context, domainID uint) (*models.APISpec, *APIViolation) {
+	// gRPC请求的消息体不是OpenAPI可以描述的格式
+	if utils.IsGRPCRequest(c.Request) {
+		return nil, nil
+	}
+
+	path := c.Request.URL.Path
+	for _, compiled := range e.domainAPISpecs(domainID) {
+		location := strings.TrimSuffix(compiled.spec.Location, "/")
+		if location != "" && path != location && !strings.HasPrefix(path, location+"/") {
+			continue
+		}
+		return &compiled.spec, validateAPIRequest(c, compiled.router, location)
+	}
+	return nil, nil
+}
+
+// validateAPIRequest 校验请求的路径、方法、参数、Content-Type和请求体。
+// 校验使用请求的副本，去掉路径前缀后匹配规范中的路径，不影响转发给后端的请求
+func validateAPIRequest(c *gin.Context, router routers.Router, location string) *APIViolation {
+	body := requestBody(c)
+
+	req := c.Request.Clone(c.Request.Context())
+	req.URL.Path = strings.TrimPrefix(req.URL.Path, location)
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	req.URL.RawPath = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = nil
+
+	violation := &APIViolation{Method: req.Method, Path: c.Request.URL.Path}
+	route, pathParams, err := router.FindRoute(req)
+	if err != nil {
+		violation.Parameter, violation.Constraint = "path", "paths"
+		if errors.Is(err, routers.ErrMethodNotAllowed) {
+			violation.Parameter, violation.Constraint = "method", "operation"
+		}
+		violation.Reason = err.Error()
+		return violation
+	}
+	violation.Path = location + route.Path
+	if route.Server != nil {
+		violation.Path = location + strings.TrimSuffix(route.Server.URL, "/") + route.Path
+	}
+
+	// 超过检查上限的请求体被截断，无法完整校验，跳过校验会让超大请求体绕过规范
+	if route.Operation.RequestBody != nil && (c.Request.ContentLength > maxInspectBodySize || len(body) >= maxInspectBodySize) {
+		violation.Parameter, violation.Constraint = "body", apiBodyTooLarge
+		violation.Reason = fmt.Sprintf("request body exceeds inspection limit %d", maxInspectBodySize)
+		return violation
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			SkipSettingDefaults: true,
+			AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+		describeAPIError(err, violation)
+		return violation
+	}
+	return nil
+}
+
+// describeAPIError 从校验错误中提取违规的参数和约束
+func describeAPIError(err error, violation *APIViolation) {
+	violation.Reason = err.Error()
+
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		violation.Parameter, violation.Constraint = "request", "unknown"
+		return
+	}
+
+	switch {
+	case requestErr.Parameter != nil:
+		violation.Parameter = requestErr.Parameter.In + "." + requestErr.Parameter.Name
+	case requestErr.RequestBody != nil:
+		violation.Parameter = "body"
+	default:
+		violation.Parameter = "request"
+	}
+
+	var schemaErr *openapi3.SchemaError
+	var parseErr *openapi3filter.ParseError
+	switch {
+	case errors.As(err, &schemaErr):
+		violation.Constraint = schemaErr.SchemaField
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 && requestErr.RequestBody != nil {
+			violation.Parameter = "body/" + strings.Join(pointer, "/")
+		}
+		violation.Reason = schemaErr.Reason
+		switch schemaErr.Value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+		default:
+			violation.Value = truncateSample(fmt.Sprintf("%v", schemaErr.Value))
+		}
+	case errors.As(err, &parseErr):
+		violation.Constraint = "type"
+		violation.Reason = parseErr.Error()
+	case errors.Is(err, openapi3filter.ErrInvalidRequired):
+		violation.Constraint = "required"
+		violation.Reason = err.Error()
+	case errors.Is(err, openapi3filter.ErrInvalidEmptyValue):
+		violation.Constraint = "allowEmptyValue"
+		violation.Reason = err.Error()
+	case requestErr.RequestBody != nil && strings.Contains(requestErr.Reason, "Content-Type"):
+		violation.Constraint = "content_type"
+		violation.Parameter = "header.Content-Type"
+		violation.Reason = requestErr.Reason
+	default:
+		violation.Constraint = "format"
+		violation.Reason = requestErr.Error()
+	}
+}
+
+// truncateSample 截断记录的参数值
+func truncateSample(value string) string {
+	if len(value) > apiSampleLimit {
+		return value[:apiSampleLimit]
+	}
+	return value
+}
+
+// apiViolationRule 将违规转换为攻击日志中的匹配信息，匹配字段为参数，匹配值说明违反的约束
+func apiViolationRule(spec *models.APISpec, violation *APIViolation) *MatchedRule {
+	value := fmt.Sprintf("%s %s: %s violates %s: %s", violation.Method, violation.Path, violation.Parameter, violation.Constraint, violation.Reason)
+	if violation.Value != "" {
+		value += fmt.Sprintf(" (value: %s)", violation.Value)
+	}
+	return &MatchedRule{
+		ID:         0,
+		Name:       fmt.Sprintf("OpenAPI规范-%s", spec.Name),
+		MatchField: violation.Parameter,
+		MatchValue: value,
+	}
+}
+
+// apiViolationStatus 违规对应的响应状态码
+func apiViolationStatus(violation *APIViolation) int {
+	switch violation.Constraint {
+	case "paths":
+		return http.StatusNotFound
+	case "operation":
+		return http.StatusMethodNotAllowed
+	case "content_type":
+		return http.StatusUnsupportedMediaType
+	case apiBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// recordAPIObservation learn模式下按方法、路径、参数和约束在内存中聚合违规次数，由StartLearningFlusher定期写入数据库。
+// 未匹配规范的请求路径先归一化，避免每个ID生成一条记录
+func (e *WAFEngine) recordAPIObservation(spec *models.APISpec, violation *APIViolation) {
+	now := time.Now()
+	sample := violation.Reason
+	if violation.Value != "" {
+		sample += fmt.Sprintf(" (value: %s)", violation.Value)
+	}
+	path := violation.Path
+	if violation.Constraint == "paths" || violation.Constraint == "operation" {
+		path = NormalizePath(path)
+	}
+
+	key := fmt.Sprintf("%d|%s|%s|%s|%s", spec.ID, violation.Method, path, violation.Parameter, violation.Constraint)
+	e.apiObsMu.Lock()
+	defer e.apiObsMu.Unlock()
+
+	observation, ok := e.apiObservations[key]
+	if !ok {
+		if len(e.apiObservations) >= maxAPIObservations {
+			return
+		}
+		observation = &models.APISpecObservation{
+			SpecID:     spec.ID,
+			DomainID:   spec.DomainID,
+			Method:     violation.Method,
+			Path:       path,
+			Parameter:  violation.Parameter,
+			Constraint: violation.Constraint,
+			FirstSeen:  now,
+			TenantID:   spec.TenantID,
+		}
+		e.apiObservations[key] = observation
+	}
+	observation.Count++
+	observation.Sample = sample
+	observation.LastSeen = now
+}
+
+// FlushAPIObservations 将内存中的learn模式违规写入数据库
+func (e *WAFEngine) FlushAPIObservations() {
+	e.apiObsMu.Lock()
+	observations := e.apiObservations
+	e.apiObservations = make(map[string]*models.APISpecObservation)
+	e.apiObsMu.Unlock()
+
+	for _, observation := range observations {
+		if err := e.saveAPIObservation(observation); err != nil {
+			log.Printf("Failed to save API spec observation %s %s: %v", observation.Method, observation.Path, err)
+		}
+	}
+}
+
+// saveAPIObservation 累加违规次数到数据库记录
+func (e *WAFEngine) saveAPIObservation(observation *models.APISpecObservation) error {
+	var row models.APISpecObservation
+	err := e.db.Where("spec_id = ? AND method = ? AND path = ? AND parameter = ? AND constraint_name = ?",
+		observation.SpecID, observation.Method, observation.Path, observation.Parameter, observation.Constraint).
+		First(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		return e.db.Create(observation).Error
+	}
+	if err != nil {
+		return err
+	}
+	return e.db.Model(&row).Updates(map[string]interface{}{
+		"count":     gorm.Expr("count + ?", observation.Count),
+		"sample":    observation.Sample,
+		"last_seen": observation.LastSeen,
+	}).Error
+}
@@ -0,0 +1,363 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 协议校验的违规类型，每种类型作为一条独立的规则记录到攻击日志中
+const (
+	protocolLengthConflict     = "content_length_conflict"  // 同时有Content-Length和Transfer-Encoding
+	protocolDuplicateLength    = "duplicate_content_length" // 重复的Content-Length
+	protocolObsFold            = "obs_fold"                 // 折行请求头
+	protocolNullByte           = "null_byte"                // URI、请求头或请求体中的NUL字节
+	protocolInvalidEncoding    = "invalid_percent_encoding" // 无效的百分号编码
+	protocolMethodNotAllowed   = "method_not_allowed"       // 请求方法不在允许列表中
+	protocolInvalidHost        = "invalid_host"             // 无效的Host请求头
+	protocolURLTooLong         = "url_too_long"             // 请求URI过长
+	protocolTooManyHeaders     = "too_many_headers"         // 请求头个数超过限制
+	protocolHeadersTooLarge    = "headers_too_large"        // 请求头总字节数超过限制
+	protocolTooManyArgs        = "too_many_args"            // 参数个数超过限制
+	protocolContentTypeBlocked = "content_type_not_allowed" // Content-Type不在允许列表中
+)
+
+// protocolViolation 协议校验发现的违规
+type protocolViolation struct {
+	Type   string // 违规类型
+	Field  string // 违规的请求部分
+	Value  string // 违规的值
+	Status int    // 拦截时的响应状态码
+}
+
+// rule 违规对应的规则，规则ID为0，名称按违规类型区分
+func (v *protocolViolation) rule() *MatchedRule {
+	return &MatchedRule{
+		ID:         0,
+		Name:       fmt.Sprintf("协议校验-%s", v.Type),
+		MatchField: v.Field,
+		MatchValue: v.Value,
+	}
+}
+
+// framingViolationFields 原始请求头违规对应的请求部分
+var framingViolationFields = map[string]string{
+	protocolLengthConflict:  "transfer_encoding",
+	protocolDuplicateLength: "content_length",
+	protocolObsFold:         "headers",
+}
+
+// checkProtocol 在规则检查前校验HTTP协议，返回第一个违规。
+// 请求走私特征始终检查，请求方法、请求头、URI、参数个数和Content-Type按域名配置检查
+func (e *WAFEngine) checkProtocol(c *gin.Context, domain *models.Domain) *protocolViolation {
+	req := c.Request
+
+	// 1. 请求走私：net/http解析前的原始请求头中的问题
+	if violations := framingViolations(req); len(violations) > 0 {
+		return &protocolViolation{
+			Type:   violations[0],
+			Field:  framingViolationFields[violations[0]],
+			Value:  strings.Join(violations, ", "),
+			Status: http.StatusBadRequest,
+		}
+	}
+
+	// 2. 编码和NUL字节
+	if v := checkEncoding(c); v != nil {
+		return v
+	}
+
+	// 3. 请求方法
+	methods, _ := parseProtocolList(domain.AllowedMethods)
+	if len(methods) > 0 && !containsFold(methods, req.Method) {
+		return &protocolViolation{
+			Type:   protocolMethodNotAllowed,
+			Field:  "method",
+			Value:  req.Method,
+			Status: http.StatusMethodNotAllowed,
+		}
+	}
+
+	// 4. Host请求头
+	if !validHost(req.Host) {
+		return &protocolViolation{
+			Type:   protocolInvalidHost,
+			Field:  "host",
+			Value:  truncateSample(req.Host),
+			Status: http.StatusBadRequest,
+		}
+	}
+
+	// 5. 请求URI长度
+	if domain.MaxURLLength > 0 && len(req.RequestURI) > domain.MaxURLLength {
+		return &protocolViolation{
+			Type:   protocolURLTooLong,
+			Field:  "uri",
+			Value:  fmt.Sprintf("%d bytes exceeds %d", len(req.RequestURI), domain.MaxURLLength),
+			Status: http.StatusRequestURITooLong,
+		}
+	}
+
+	// 6. 请求头个数和总字节数
+	count, size := 0, 0
+	for name, values := range req.Header {
+		for _, value := range values {
+			count++
+			size += len(name) + len(value) + 4 // ": "和CRLF
+		}
+	}
+	if domain.MaxHeaderCount > 0 && count > domain.MaxHeaderCount {
+		return &protocolViolation{
+			Type:   protocolTooManyHeaders,
+			Field:  "headers",
+			Value:  fmt.Sprintf("%d headers exceeds %d", count, domain.MaxHeaderCount),
+			Status: http.StatusRequestHeaderFieldsTooLarge,
+		}
+	}
+	if domain.MaxHeaderSize > 0 && size > domain.MaxHeaderSize {
+		return &protocolViolation{
+			Type:   protocolHeadersTooLarge,
+			Field:  "headers",
+			Value:  fmt.Sprintf("%d bytes exceeds %d", size, domain.MaxHeaderSize),
+			Status: http.StatusRequestHeaderFieldsTooLarge,
+		}
+	}
+
+	// 7. 查询参数和表单参数个数
+	if domain.MaxArgCount > 0 {
+		args := countArgs(req.URL.RawQuery)
+		if isFormContentType(req.Header.Get("Content-Type")) {
+			args += countArgs(string(requestBody(c)))
+		}
+		if args > domain.MaxArgCount {
+			return &protocolViolation{
+				Type:   protocolTooManyArgs,
+				Field:  "args",
+				Value:  fmt.Sprintf("%d arguments exceeds %d", args, domain.MaxArgCount),
+				Status: http.StatusBadRequest,
+			}
+		}
+	}
+
+	// 8. 有请求体时检查Content-Type
+	contentTypes, _ := parseProtocolList(domain.AllowedContentTypes)
+	if len(contentTypes) > 0 && hasRequestBody(req) {
+		contentType := req.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !contentTypeAllowed(contentTypes, mediaType) {
+			value := truncateSample(contentType)
+			if contentType == "" {
+				value = "missing Content-Type"
+			}
+			return &protocolViolation{
+				Type:   protocolContentTypeBlocked,
+				Field:  "content_type",
+				Value:  value,
+				Status: http.StatusUnsupportedMediaType,
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkEncoding 检查URI和表单请求体中的百分号编码，以及URI、请求头和文本请求体中的NUL字节
+func checkEncoding(c *gin.Context) *protocolViolation {
+	req := c.Request
+	nullByte := func(field, value string) *protocolViolation {
+		return &protocolViolation{Type: protocolNullByte, Field: field, Value: truncateSample(value), Status: http.StatusBadRequest}
+	}
+
+	// 路径中的无效编码由net/http拒绝，查询串需要单独校验
+	if invalidPercentEncoding(req.URL.RawQuery) {
+		return &protocolViolation{Type: protocolInvalidEncoding, Field: "query", Value: truncateSample(req.URL.RawQuery), Status: http.StatusBadRequest}
+	}
+	if strings.Contains(req.URL.Path, "\x00") {
+		return nullByte("path", req.URL.EscapedPath())
+	}
+	if query, err := url.QueryUnescape(req.URL.RawQuery); err == nil && strings.Contains(query, "\x00") {
+		return nullByte("query", req.URL.RawQuery)
+	}
+	for name, values := range req.Header {
+		for _, value := range values {
+			if strings.Contains(value, "\x00") {
+				return nullByte("header", name)
+			}
+		}
+	}
+
+	// 上传文件、gRPC等二进制请求体可以包含NUL字节，只检查文本请求体
+	contentType := req.Header.Get("Content-Type")
+	if !hasRequestBody(req) || !isTextContentType(contentType) {
+		return nil
+	}
+	body := requestBody(c)
+	if isFormContentType(contentType) {
+		if invalidPercentEncoding(string(body)) {
+			return &protocolViolation{Type: protocolInvalidEncoding, Field: "body", Value: truncateSample(string(body)), Status: http.StatusBadRequest}
+		}
+		if form, err := url.QueryUnescape(string(body)); err == nil {
+			body = []byte(form)
+		}
+	}
+	if bytes.IndexByte(body, 0) >= 0 {
+		return nullByte("body", string(body))
+	}
+	return nil
+}
+
+// invalidPercentEncoding %后不是两位十六进制数字
+func invalidPercentEncoding(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return true
+		}
+		i += 2
+	}
+	return false
+}
+
+func isHex(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+// validHost Host为主机名或IP地址，可带端口
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return net.ParseIP(host[1:len(host)-1]) != nil
+	}
+	hostname := host
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		h, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return false
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return false
+		}
+		hostname = h
+	}
+	if net.ParseIP(hostname) != nil {
+		return true
+	}
+	if len(hostname) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(hostname, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			b := label[i]
+			if !('a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '-' || b == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// countArgs 统计查询串或表单中的参数个数
+func countArgs(query string) int {
+	count := 0
+	for _, part := range strings.Split(query, "&") {
+		if part != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// hasRequestBody 请求是否带有请求体
+func hasRequestBody(req *http.Request) bool {
+	return req.ContentLength > 0 || len(req.TransferEncoding) > 0
+}
+
+func isFormContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// isTextContentType 表单、JSON、XML和text/*请求体
+func isTextContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded" ||
+		strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// contentTypeAllowed 媒体类型是否在允许列表中，列表项支持 type/* 通配
+func contentTypeAllowed(allowed []string, mediaType string) bool {
+	for _, item := range allowed {
+		item = strings.ToLower(item)
+		if item == mediaType || item == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(item, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(items []string, value string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProtocolList 解析JSON数组格式的允许列表，为空表示不限制
+func parseProtocolList(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var items []string
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ValidateProtocolConfig 校验域名的允许请求方法和允许Content-Type列表
+func ValidateProtocolConfig(domain *models.Domain) error {
+	methods, err := parseProtocolList(domain.AllowedMethods)
+	if err != nil {
+		return fmt.Errorf("allowed_methods must be a JSON array of strings: %v", err)
+	}
+	for _, method := range methods {
+		if method == "" || strings.IndexFunc(method, func(r rune) bool { return (r < 'A' || r > 'Z') && r != '-' && r != '_' }) >= 0 {
+			return fmt.Errorf("invalid method: %q", method)
+		}
+	}
+
+	contentTypes, err := parseProtocolList(domain.AllowedContentTypes)
+	if err != nil {
+		return fmt.Errorf("allowed_content_types must be a JSON array of strings: %v", err)
+	}
+	for _, contentType := range contentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil || !strings.Contains(contentType, "/") {
+			return fmt.Errorf("invalid content type: %q", contentType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package waf
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckProtocol(t *testing.T) {
+	domain := &models.Domain{
+		AllowedMethods:      `["GET","POST"]`,
+		MaxHeaderCount:      5,
+		MaxHeaderSize:       200,
+		MaxURLLength:        64,
+		MaxArgCount:         3,
+		AllowedContentTypes: `["application/json","multipart/*"]`,
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		host        string
+		contentType string
+		body        string
+		headers     map[string]string
+		want        string
+	}{
+		{name: "clean request", method: "GET", target: "/a?b=1"},
+		{name: "clean json body", method: "POST", target: "/a", contentType: "application/json", body: `{"a":1}`},
+		{name: "invalid query encoding", method: "GET", target: "/a?b=%zz", want: protocolInvalidEncoding},
+		{name: "truncated query encoding", method: "GET", target: "/a?b=%4", want: protocolInvalidEncoding},
+		{name: "nul byte in query", method: "GET", target: "/a?b=%00", want: protocolNullByte},
+		{name: "nul byte in path", method: "GET", target: "/a%00b", want: protocolNullByte},
+		{name: "nul byte in json body", method: "POST", target: "/a", contentType: "application/json", body: "{\"a\":\"\x00\"}", want: protocolNullByte},
+		{name: "nul byte in form body", method: "POST", target: "/a", contentType: "application/x-www-form-urlencoded", body: "a=%00", want: protocolNullByte},
+		{name: "nul byte in upload", method: "POST", target: "/a", contentType: "multipart/form-data; boundary=x", body: "--x\r\n\x00"},
+		{name: "method not allowed", method: "PUT", target: "/a", want: protocolMethodNotAllowed},
+		{name: "invalid host", method: "GET", target: "/a", host: "bad host", want: protocolInvalidHost},
+		{name: "invalid host port", method: "GET", target: "/a", host: "example.com:99999", want: protocolInvalidHost},
+		{name: "url too long", method: "GET", target: "/" + strings.Repeat("a", 64), want: protocolURLTooLong},
+		{name: "too many headers", method: "GET", target: "/a", headers: map[string]string{"A": "1", "B": "2", "C": "3", "D": "4", "E": "5", "F": "6"}, want: protocolTooManyHeaders},
+		{name: "headers too large", method: "GET", target: "/a", headers: map[string]string{"A": strings.Repeat("x", 200)}, want: protocolHeadersTooLarge},
+		{name: "too many query args", method: "GET", target: "/a?a=1&b=2&c=3&d=4", want: protocolTooManyArgs},
+		{name: "missing content type", method: "POST", target: "/a", body: "x", want: protocolContentTypeBlocked},
+		{name: "content type not allowed", method: "POST", target: "/a", contentType: "text/plain", body: "x", want: protocolContentTypeBlocked},
+	}
+
+	e := &WAFEngine{}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.body == "" {
+			req.Body, req.ContentLength = http.NoBody, 0
+		}
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+
+		got := ""
+		if v := e.checkProtocol(c, domain); v != nil {
+			got = v.Type
+		}
+		if got != tt.want {
+			t.Errorf("%s: violation = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"example.com.", true},
+		{"sub_domain.example.com", true},
+		{"example.com:8080", true},
+		{"127.0.0.1", true},
+		{"127.0.0.1:80", true},
+		{"[::1]", true},
+		{"[::1]:443", true},
+		{"", false},
+		{"example.com:0", false},
+		{"example.com:http", false},
+		{"-example.com", false},
+		{"example..com", false},
+		{"exa mple.com", false},
+		{"[::1", false},
+		{"example.com:80:80", false},
+		{strings.Repeat("a", 64) + ".com", false},
+	}
+	for _, tt := range tests {
+		if got := validHost(tt.host); got != tt.want {
+			t.Errorf("validHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestListenFraming 通过真实连接发送net/http会接受的走私请求，检查处理器能按请求顺序取到原始请求头中的违规
+func TestListenFraming(t *testing.T) {
+	srv := &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			io.WriteString(w, strings.Join(framingViolations(r), ","))
+		}),
+	}
+	listener, err := ListenFraming(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	requests := []struct {
+		raw  string
+		want string
+	}{
+		{"GET /1 HTTP/1.1\r\nHost: a\r\n\r\n", ""},
+		{"POST /2 HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n3;ext\r\nabc\r\n0\r\n\r\n", protocolLengthConflict},
+		{"POST /3 HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nab", protocolDuplicateLength},
+		{"GET /4 HTTP/1.1\r\nHost: a\r\nX-Test: a\r\n b\r\n\r\n", protocolObsFold},
+		{"GET /5 HTTP/1.1\r\nHost: a\r\n\r\n", ""},
+	}
+	var raw strings.Builder
+	for _, req := range requests {
+		raw.WriteString(req.raw)
+	}
+	if _, err := io.WriteString(conn, raw.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for i, req := range requests {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != req.want {
+			t.Errorf("request %d: violations = %q, want %q", i+1, body, req.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package waf
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxRegexLength 正则表达式的最大长度
+	maxRegexLength = 4096
+	// maxRegexProgramSize 正则表达式编译后的最大指令数，限制嵌套重复等展开后过大的表达式
+	maxRegexProgramSize = 20000
+	// maxRegexInput 正则匹配时扫描的最大字节数，超出部分不检查
+	maxRegexInput = 64 << 10
+	// maxRegexPrograms 编译结果缓存的最大条数，超出时清空重建
+	maxRegexPrograms = 5000
+	// slowRuleThreshold 单次规则计算超过该时间时记录日志
+	slowRuleThreshold = 50 * time.Millisecond
+)
+
+// CompileRegex 编译正则表达式，并检查长度和编译后的程序大小
+func CompileRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxRegexLength {
+		return nil, fmt.Errorf("regex is too long: %d bytes, limit %d", len(pattern), maxRegexLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	if len(prog.Inst) > maxRegexProgramSize {
+		return nil, fmt.Errorf("regex is too complex: %d instructions, limit %d", len(prog.Inst), maxRegexProgramSize)
+	}
+	return regexp.Compile(pattern)
+}
+
+// PrepareRegex 编译正则表达式并放入缓存，保存规则时调用
+func (e *WAFEngine) PrepareRegex(pattern string) error {
+	_, err := e.regex(pattern)
+	return err
+}
+
+// regex 获取正则表达式的编译结果，按表达式文本缓存
+func (e *WAFEngine) regex(pattern string) (*regexp.Regexp, error) {
+	e.regexMu.RLock()
+	re, ok := e.regexes[pattern]
+	e.regexMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := CompileRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	e.regexMu.Lock()
+	if len(e.regexes) >= maxRegexPrograms {
+		e.regexes = make(map[string]*regexp.Regexp)
+	}
+	e.regexes[pattern] = re
+	e.regexMu.Unlock()
+	return re, nil
+}
+
+// matchRegex 使用缓存的编译结果匹配，只扫描值的前maxRegexInput字节
+func (e *WAFEngine) matchRegex(pattern, value string) bool {
+	re, err := e.regex(pattern)
+	if err != nil {
+		log.Printf("Regex error: %v", err)
+		return false
+	}
+	if len(value) > maxRegexInput {
+		value = value[:maxRegexInput]
+	}
+	return re.MatchString(value)
+}
+
+// ruleTiming 单条规则的计算耗时统计
+type ruleTiming struct {
+	evaluations int64 // 计算次数
+	matches     int64 // 命中次数
+	totalNanos  int64 // 总耗时
+	maxNanos    int64 // 单次最长耗时
+}
+
+// RuleEvaluationStat 规则计算耗时统计，用于找出开销大的规则
+type RuleEvaluationStat struct {
+	RuleID      uint    `json:"rule_id"`
+	Evaluations int64   `json:"evaluations"`
+	Matches     int64   `json:"matches"`
+	TotalMs     float64 `json:"total_ms"`
+	AverageUs   float64 `json:"average_us"`
+	MaxUs       float64 `json:"max_us"`
+}
+
+// recordRuleTiming 记录一次规则计算的耗时，耗时过长时记录日志
+func (e *WAFEngine) recordRuleTiming(ruleID uint, matched bool, elapsed time.Duration) {
+	e.timingMu.RLock()
+	timing, ok := e.ruleTimings[ruleID]
+	e.timingMu.RUnlock()
+	if !ok {
+		e.timingMu.Lock()
+		if timing, ok = e.ruleTimings[ruleID]; !ok {
+			timing = &ruleTiming{}
+			e.ruleTimings[ruleID] = timing
+		}
+		e.timingMu.Unlock()
+	}
+
+	nanos := elapsed.Nanoseconds()
+	atomic.AddInt64(&timing.evaluations, 1)
+	atomic.AddInt64(&timing.totalNanos, nanos)
+	if matched {
+		atomic.AddInt64(&timing.matches, 1)
+	}
+	for {
+		current := atomic.LoadInt64(&timing.maxNanos)
+		if nanos <= current || atomic.CompareAndSwapInt64(&timing.maxNanos, current, nanos) {
+			break
+		}
+	}
+
+	if elapsed > slowRuleThreshold {
+		log.Printf("Slow rule evaluation: rule %d took %v", ruleID, elapsed)
+	}
+}
+
+// RuleEvaluationStats 返回引擎启动以来各规则的计算耗时，按总耗时降序
+func (e *WAFEngine) RuleEvaluationStats() []RuleEvaluationStat {
+	e.timingMu.RLock()
+	stats := make([]RuleEvaluationStat, 0, len(e.ruleTimings))
+	for ruleID, timing := range e.ruleTimings {
+		evaluations := atomic.LoadInt64(&timing.evaluations)
+		totalNanos := atomic.LoadInt64(&timing.totalNanos)
+		stat := RuleEvaluationStat{
+			RuleID:      ruleID,
+			Evaluations: evaluations,
+			Matches:     atomic.LoadInt64(&timing.matches),
+			TotalMs:     float64(totalNanos) / 1e6,
+			MaxUs:       float64(atomic.LoadInt64(&timing.maxNanos)) / 1e3,
+		}
+		if evaluations > 0 {
+			stat.AverageUs = float64(totalNanos) / float64(evaluations) / 1e3
+		}
+		stats = append(stats, stat)
+	}
+	e.timingMu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalMs != stats[j].TotalMs {
+			return stats[i].TotalMs > stats[j].TotalMs
+		}
+		return stats[i].RuleID < stats[j].RuleID
+	})
+	return stats
+}
@@ -0,0 +1,64 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+
+	"waf-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxInspectBodySize 检查请求体时读取的最大字节数
+const maxInspectBodySize = 1 << 20
+
+// requestBodyKey 请求上下文中缓存请求体的键
+const requestBodyKey = "waf_request_body"
+
+// readCloser 组合读取器和原请求体的Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// requestBody 读取并缓存请求体，读取后恢复c.Request.Body，保证转发给后端的请求体完整。
+// 普通请求最多读取maxInspectBodySize字节；gRPC请求只读取第一条消息（含5字节前缀），避免流式调用阻塞
+func requestBody(c *gin.Context) []byte {
+	if cached, ok := c.Get(requestBodyKey); ok {
+		return cached.([]byte)
+	}
+
+	var body []byte
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		if utils.IsGRPCRequest(c.Request) {
+			body = readGRPCFrame(c.Request.Body)
+		} else {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxInspectBodySize))
+		}
+		c.Request.Body = &readCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), c.Request.Body),
+			Closer: c.Request.Body,
+		}
+	}
+
+	c.Set(requestBodyKey, body)
+	return body
+}
+
+// readGRPCFrame 读取第一条gRPC消息，超过maxInspectBodySize时只读取前缀部分
+func readGRPCFrame(r io.Reader) []byte {
+	frame := make([]byte, 5)
+	n, err := io.ReadFull(r, frame)
+	if err != nil {
+		return frame[:n]
+	}
+
+	length := int64(binary.BigEndian.Uint32(frame[1:5]))
+	if length > maxInspectBodySize {
+		length = maxInspectBodySize
+	}
+	message, _ := io.ReadAll(io.LimitReader(r, length))
+	return append(frame, message...)
+}
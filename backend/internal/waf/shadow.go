@@ -0,0 +1,339 @@
+package waf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"waf-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 影子策略差异方向
+const (
+	ShadowBlock = "shadow_block" // 影子策略拦截，生效策略放行
+	LiveBlock   = "live_block"   // 生效策略拦截，影子策略放行
+)
+
+const (
+	shadowQueueSize     = 1000             // 等待评估的请求队列长度，队列已满时丢弃
+	shadowWorkers       = 2                // 评估影子策略的后台协程数
+	shadowFlushInterval = 30 * time.Second // 内存中的评估结果写入数据库的间隔
+	maxShadowSamples    = 5                // 每条差异保留的样本请求数
+	shadowSampleLimit   = 512              // 样本中匹配值和User-Agent的最大长度
+)
+
+// ShadowSample 影子策略差异的样本请求
+type ShadowSample struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+	MatchField string    `json:"match_field"` // 导致拦截的规则的匹配字段
+	MatchValue string    `json:"match_value"` // 导致拦截的匹配值
+}
+
+// shadowJob 一个等待影子评估的请求，c为请求的副本
+type shadowJob struct {
+	c           *gin.Context
+	domainID    uint
+	tenantID    uint
+	rules       []models.Rule
+	exclusions  []models.RuleExclusion
+	liveBlocked bool
+	liveRule    *MatchedRule
+}
+
+// shadowDiff 内存中聚合的规则差异
+type shadowDiff struct {
+	row     models.ShadowDiff
+	samples []ShadowSample
+}
+
+// shadowAggregate 一个域名内存中聚合的评估结果，定期写入数据库
+type shadowAggregate struct {
+	tenantID     uint
+	requests     int64
+	agreed       int64
+	shadowBlocks int64
+	liveBlocks   int64
+	dropped      int64
+	diffs        map[string]*shadowDiff // 规则ID|方向 -> 差异
+}
+
+func newShadowAggregate(tenantID uint) *shadowAggregate {
+	return &shadowAggregate{tenantID: tenantID, diffs: make(map[string]*shadowDiff)}
+}
+
+// enqueueShadow 复制请求并放入影子评估队列，不等待评估结果。
+// 生效策略的决定以规则检查结束时的结果为准，would_block视为拦截
+func (e *WAFEngine) enqueueShadow(c *gin.Context, domain *models.Domain, rules []models.Rule, exclusions []models.RuleExclusion, result *CheckResult) {
+	job := &shadowJob{
+		c:           copyRequestContext(c),
+		domainID:    domain.ID,
+		tenantID:    domain.TenantID,
+		rules:       rules,
+		exclusions:  exclusions,
+		liveBlocked: result.Action == "block" || result.Action == ActionWouldBlock || result.Action == ActionChallenge,
+	}
+	if job.liveBlocked {
+		job.liveRule = result.MatchedRule
+	}
+
+	select {
+	case e.shadowQueue <- job:
+	default:
+		e.shadowMu.Lock()
+		e.shadowAggregateFor(domain.ID, domain.TenantID).dropped++
+		e.shadowMu.Unlock()
+	}
+}
+
+// copyRequestContext 复制请求上下文供后台协程使用。请求头和已读取的请求体被复制，
+// 原请求转发给后端时的修改不影响副本
+func copyRequestContext(c *gin.Context) *gin.Context {
+	body := requestBody(c)
+	cp := c.Copy()
+	cp.Request = c.Request.Clone(context.Background())
+	cp.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return cp
+}
+
+// StartShadowEvaluator 启动影子策略评估协程，并定期写入评估结果
+func (e *WAFEngine) StartShadowEvaluator(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < shadowWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-e.shadowQueue:
+					e.evaluateShadow(job)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(shadowFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				e.FlushShadowStats()
+				return
+			case <-ticker.C:
+				e.FlushShadowStats()
+			}
+		}
+	}()
+}
+
+// evaluateShadow 按影子策略的规则检查请求，与生效策略的决定比较。
+// 规则排除同样生效，log动作继续检查，block或allow结束检查
+func (e *WAFEngine) evaluateShadow(job *shadowJob) {
+	c := job.c
+	hits := e.newLiteralHits(e.shadowMatchers, job.domainID, job.rules)
+
+	var shadowRule *models.Rule
+	var shadowValue string
+	for i := range job.rules {
+		rule := job.rules[i]
+		skip, targets, _ := e.ruleExclusions(job.exclusions, rule, c.Request.URL.Path)
+		if skip != nil {
+			continue
+		}
+		matched, value := e.evaluateRule(hits, rule, c, job.domainID, targets)
+		if !matched {
+			continue
+		}
+		if rule.Action == "block" {
+			shadowRule, shadowValue = &rule, value
+			break
+		}
+		if rule.Action == "allow" {
+			break
+		}
+	}
+
+	e.shadowMu.Lock()
+	defer e.shadowMu.Unlock()
+
+	aggregate := e.shadowAggregateFor(job.domainID, job.tenantID)
+	aggregate.requests++
+	switch {
+	case (shadowRule != nil) == job.liveBlocked:
+		aggregate.agreed++
+	case shadowRule != nil:
+		aggregate.shadowBlocks++
+		aggregate.recordDiff(c, ShadowBlock, shadowRule.ID, shadowRule.Name, shadowRule.MatchType, shadowValue)
+	default:
+		aggregate.liveBlocks++
+		rule := job.liveRule
+		if rule == nil {
+			rule = &MatchedRule{}
+		}
+		aggregate.recordDiff(c, LiveBlock, rule.ID, rule.Name, rule.MatchField, rule.MatchValue)
+	}
+}
+
+// shadowAggregateFor 获取域名的内存评估结果，调用方需持有shadowMu
+func (e *WAFEngine) shadowAggregateFor(domainID, tenantID uint) *shadowAggregate {
+	aggregate, ok := e.shadowStats[domainID]
+	if !ok {
+		aggregate = newShadowAggregate(tenantID)
+		e.shadowStats[domainID] = aggregate
+	}
+	return aggregate
+}
+
+// recordDiff 累加规则差异并保留最近的样本请求
+func (a *shadowAggregate) recordDiff(c *gin.Context, direction string, ruleID uint, ruleName, matchField, matchValue string) {
+	now := time.Now()
+	key := fmt.Sprintf("%d|%s", ruleID, direction)
+	diff, ok := a.diffs[key]
+	if !ok {
+		diff = &shadowDiff{row: models.ShadowDiff{
+			RuleID:    ruleID,
+			RuleName:  ruleName,
+			Direction: direction,
+			FirstSeen: now,
+			TenantID:  a.tenantID,
+		}}
+		a.diffs[key] = diff
+	}
+	diff.row.Count++
+	diff.row.LastSeen = now
+	diff.samples = appendShadowSample(diff.samples, ShadowSample{
+		Time:       now,
+		Method:     c.Request.Method,
+		URI:        c.Request.URL.RequestURI(),
+		ClientIP:   c.ClientIP(),
+		UserAgent:  truncateShadowSample(c.GetHeader("User-Agent")),
+		MatchField: matchField,
+		MatchValue: truncateShadowSample(matchValue),
+	})
+}
+
+// appendShadowSample 追加样本，只保留最近的maxShadowSamples条
+func appendShadowSample(samples []ShadowSample, sample ShadowSample) []ShadowSample {
+	samples = append(samples, sample)
+	if len(samples) > maxShadowSamples {
+		samples = samples[len(samples)-maxShadowSamples:]
+	}
+	return samples
+}
+
+// truncateShadowSample 截断样本中过长的值
+func truncateShadowSample(value string) string {
+	if len(value) > shadowSampleLimit {
+		return value[:shadowSampleLimit]
+	}
+	return value
+}
+
+// DecodeShadowSamples 解析差异记录中的样本请求
+func DecodeShadowSamples(data string) []ShadowSample {
+	var samples []ShadowSample
+	if data != "" {
+		_ = json.Unmarshal([]byte(data), &samples)
+	}
+	return samples
+}
+
+// FlushShadowStats 将所有域名的内存评估结果合并写入数据库
+func (e *WAFEngine) FlushShadowStats() {
+	e.shadowMu.Lock()
+	stats := e.shadowStats
+	e.shadowStats = make(map[uint]*shadowAggregate)
+	e.shadowMu.Unlock()
+
+	for domainID, aggregate := range stats {
+		if err := e.saveShadowStat(domainID, aggregate); err != nil {
+			log.Printf("Failed to save shadow stats for domain %d: %v", domainID, err)
+		}
+		for _, diff := range aggregate.diffs {
+			diff.row.DomainID = domainID
+			if err := e.saveShadowDiff(diff); err != nil {
+				log.Printf("Failed to save shadow diff for domain %d: %v", domainID, err)
+			}
+		}
+	}
+}
+
+// ResetShadowStats 丢弃域名尚未写入数据库的评估结果
+func (e *WAFEngine) ResetShadowStats(domainID uint) {
+	e.shadowMu.Lock()
+	delete(e.shadowStats, domainID)
+	e.shadowMu.Unlock()
+}
+
+// saveShadowStat 累加域名的评估汇总
+func (e *WAFEngine) saveShadowStat(domainID uint, aggregate *shadowAggregate) error {
+	var row models.ShadowStat
+	err := e.db.Where("domain_id = ?", domainID).First(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		return e.db.Create(&models.ShadowStat{
+			DomainID:     domainID,
+			Requests:     aggregate.requests,
+			Agreed:       aggregate.agreed,
+			ShadowBlocks: aggregate.shadowBlocks,
+			LiveBlocks:   aggregate.liveBlocks,
+			Dropped:      aggregate.dropped,
+			Since:        time.Now(),
+			TenantID:     aggregate.tenantID,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return e.db.Model(&row).Updates(map[string]interface{}{
+		"requests":      gorm.Expr("requests + ?", aggregate.requests),
+		"agreed":        gorm.Expr("agreed + ?", aggregate.agreed),
+		"shadow_blocks": gorm.Expr("shadow_blocks + ?", aggregate.shadowBlocks),
+		"live_blocks":   gorm.Expr("live_blocks + ?", aggregate.liveBlocks),
+		"dropped":       gorm.Expr("dropped + ?", aggregate.dropped),
+	}).Error
+}
+
+// saveShadowDiff 累加规则差异，样本与已保存的样本合并后保留最近的几条
+func (e *WAFEngine) saveShadowDiff(diff *shadowDiff) error {
+	var row models.ShadowDiff
+	err := e.db.Where("domain_id = ? AND rule_id = ? AND direction = ?",
+		diff.row.DomainID, diff.row.RuleID, diff.row.Direction).First(&row).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	samples := DecodeShadowSamples(row.Samples)
+	for _, sample := range diff.samples {
+		samples = appendShadowSample(samples, sample)
+	}
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return err
+	}
+
+	if row.ID == 0 {
+		diff.row.Samples = string(data)
+		return e.db.Create(&diff.row).Error
+	}
+	return e.db.Model(&row).Updates(map[string]interface{}{
+		"count":     gorm.Expr("count + ?", diff.row.Count),
+		"rule_name": diff.row.RuleName,
+		"samples":   string(data),
+		"last_seen": diff.row.LastSeen,
+	}).Error
+}
@@ -0,0 +1,650 @@
+package waf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"waf-go/internal/models"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+// uploadKey 请求上下文中缓存上传文件检查结果的键
+const uploadKey = "waf_upload"
+
+const (
+	uploadMemoryLimit    = 8 << 20   // 检查上传文件时内存中保存的请求体字节数，超出部分写入临时文件
+	maxUploadInspectSize = 256 << 20 // 匹配上传策略时检查的最大请求体字节数，超出时拦截
+	uploadSniffSize      = 3072      // 识别文件类型读取的文件头字节数，与mimetype的默认值一致
+)
+
+// 文件上传检查的违规类型，每种类型作为一条独立的规则记录到攻击日志中
+const (
+	uploadFileCount       = "file_count"            // 文件数超过限制
+	uploadFileSize        = "file_size"             // 文件大小超过限制
+	uploadExtensionDenied = "extension_not_allowed" // 扩展名不在允许列表中
+	uploadTypeDenied      = "type_not_allowed"      // 按内容识别的类型不在允许列表中
+	uploadDoubleExtension = "double_extension"      // 文件名中间有可执行扩展名
+	uploadPolyglot        = "polyglot"              // 文件中嵌入了脚本或其他文件格式
+	uploadMalware         = "malware"               // ClamAV发现病毒
+	uploadMalformed       = "malformed_body"        // multipart请求体格式错误，后面的文件无法检查
+	uploadBodyTooLarge    = "body_too_large"        // 请求体超过检查上限，后面的文件无法检查
+)
+
+// executableExtensions 双扩展名检查中视为可执行的扩展名
+var executableExtensions = map[string]bool{
+	".php": true, ".php3": true, ".php4": true, ".php5": true, ".php7": true, ".pht": true, ".phtml": true, ".phar": true,
+	".asp": true, ".aspx": true, ".ashx": true, ".asmx": true, ".asa": true, ".cer": true,
+	".jsp": true, ".jspx": true, ".jsw": true, ".jsv": true, ".jar": true, ".war": true,
+	".cgi": true, ".pl": true, ".py": true, ".rb": true, ".sh": true, ".bash": true,
+	".exe": true, ".dll": true, ".com": true, ".bat": true, ".cmd": true, ".msi": true, ".scr": true,
+	".ps1": true, ".vbs": true, ".js": true, ".hta": true, ".htaccess": true,
+	".html": true, ".htm": true, ".shtml": true, ".svg": true,
+}
+
+// embeddedMarkers 嵌入在其他格式文件中时视为多态文件的标记，按小写匹配
+var embeddedMarkers = []struct {
+	name   string
+	marker string
+	script bool // 脚本标记只在二进制文件中检查，文本文件中可能是正常内容
+}{
+	{"php", "<?php", true},
+	{"php", "<?=", true},
+	{"script", "<script", true},
+	{"jsp/asp", "<%@", true},
+	{"jsp/asp", "<%=", true},
+	{"zip", "pk\x03\x04", false},
+	{"pdf", "%pdf-", false},
+	{"elf", "\x7felf", false},
+	{"pe", "this program cannot be run in dos mode", false},
+}
+
+// maxMarkerLen 最长标记的长度，分块扫描时保留上一块末尾的字节
+var maxMarkerLen = func() int {
+	n := 0
+	for _, m := range embeddedMarkers {
+		if len(m.marker) > n {
+			n = len(m.marker)
+		}
+	}
+	return n
+}()
+
+// UploadFile 上传文件的检查结果，文件名、字节数和识别的类型可作为规则的匹配目标
+type UploadFile struct {
+	Field        string `json:"field"`                // 表单字段名
+	Name         string `json:"name"`                 // 请求中的原始文件名
+	Extension    string `json:"extension"`            // 小写的扩展名，含.
+	Size         int64  `json:"size"`                 // 字节数，请求体超过检查上限时为已读取的字节数
+	DeclaredType string `json:"declared_type"`        // 请求中声明的Content-Type
+	DetectedType string `json:"detected_type"`        // 按文件头识别的类型
+	Embedded     string `json:"embedded,omitempty"`   // 文件中嵌入的脚本或其他文件格式
+	Malware      string `json:"malware,omitempty"`    // ClamAV发现的病毒名
+	ScanError    string `json:"scan_error,omitempty"` // ClamAV扫描失败的原因，扫描失败时放行
+
+	detected *mimetype.MIME
+}
+
+// uploadInspection multipart请求中上传文件的检查结果
+type uploadInspection struct {
+	policy    *models.UploadPolicy // 匹配的上传策略，没有时为nil
+	files     []UploadFile
+	truncated bool // 请求体格式错误或读取失败，后面的文件未检查
+	oversized bool // 请求体超过检查上限，后面的文件未检查
+}
+
+// uploadViolation 上传文件检查发现的违规
+type uploadViolation struct {
+	Type   string      // 违规类型
+	File   *UploadFile // 违规的文件，文件数超过限制时为nil
+	Reason string      // 违规原因
+	Status int         // 拦截时的响应状态码
+}
+
+// rule 违规对应的规则，规则ID为0，名称按违规类型区分，匹配字段为表单字段名
+func (v *uploadViolation) rule() *MatchedRule {
+	field, value := "files", v.Reason
+	if v.File != nil {
+		field, value = v.File.Field, fmt.Sprintf("%s: %s", v.File.Name, v.Reason)
+	}
+	return &MatchedRule{
+		ID:         0,
+		Name:       fmt.Sprintf("文件上传-%s", v.Type),
+		MatchField: field,
+		MatchValue: truncateSample(value),
+	}
+}
+
+// GetUploadPolicy 获取域名下与请求路径匹配的上传策略，多个策略匹配时使用路径前缀最长的
+func (e *WAFEngine) GetUploadPolicy(domainID uint, requestPath string) (*models.UploadPolicy, error) {
+	var policies []models.UploadPolicy
+	if err := e.db.Where("domain_id = ? AND enabled = ?", domainID, true).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	var matched *models.UploadPolicy
+	for i := range policies {
+		if !strings.HasPrefix(requestPath, policies[i].Path) {
+			continue
+		}
+		if matched == nil || len(policies[i].Path) > len(matched.Path) {
+			matched = &policies[i]
+		}
+	}
+	return matched, nil
+}
+
+// uploads 解析multipart/form-data请求中的上传文件，非multipart请求返回nil。
+// 匹配上传策略时最多检查maxUploadInspectSize字节，否则与其他检查目标一样只检查maxInspectBodySize字节
+func (e *WAFEngine) uploads(c *gin.Context, domainID uint) *uploadInspection {
+	if cached, ok := c.Get(uploadKey); ok {
+		return cached.(*uploadInspection)
+	}
+
+	var result *uploadInspection
+	if boundary, ok := multipartBoundary(c.Request); ok {
+		policy, err := e.GetUploadPolicy(domainID, c.Request.URL.Path)
+		if err != nil {
+			log.Printf("Failed to get upload policy: %v", err)
+		}
+		result = &uploadInspection{policy: policy}
+		e.inspectUploads(c, boundary, result)
+	}
+
+	c.Set(uploadKey, result)
+	return result
+}
+
+// multipartBoundary 获取multipart/form-data请求的分隔符
+func multipartBoundary(req *http.Request) (string, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", false
+	}
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
+
+// inspectUploads 流式解析请求体中的文件，读取的请求体保存在bodySpool中，
+// 解析后恢复c.Request.Body，保证转发给后端的请求体完整
+func (e *WAFEngine) inspectUploads(c *gin.Context, boundary string, result *uploadInspection) {
+	limit := int64(maxInspectBodySize)
+	scan := false
+	if result.policy != nil {
+		limit = maxUploadInspectSize
+		scan = result.policy.ScanMalware && e.clamd != nil
+	}
+
+	body := c.Request.Body
+	spool := &bodySpool{}
+	limited := &io.LimitedReader{R: body, N: limit}
+	reader := multipart.NewReader(io.TeeReader(limited, spool), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.truncated = true
+			break
+		}
+		name, ok := uploadFileName(part)
+		if !ok {
+			continue
+		}
+		file, err := e.inspectFile(part, name, scan)
+		result.files = append(result.files, file)
+		if err != nil {
+			result.truncated = true
+			break
+		}
+	}
+
+	// 读满检查上限后解析失败，说明请求体超过上限而不是格式错误
+	if result.truncated && limited.N <= 0 {
+		result.truncated, result.oversized = false, true
+	}
+
+	c.Request.Body = &spooledBody{
+		Reader: io.MultiReader(spool.reader(), body),
+		spool:  spool,
+		body:   body,
+	}
+}
+
+// uploadFileName 获取part的原始文件名，不是文件或文件名为空时返回false。
+// 不使用Part.FileName，它会去掉目录部分，而目录和分隔符也是需要检查的内容
+func uploadFileName(part *multipart.Part) (string, bool) {
+	disposition := part.Header.Get("Content-Disposition")
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name, ok := params["filename"]
+		return name, ok && name != ""
+	}
+
+	// 格式错误的Content-Disposition仍可能被后端接受，按宽松规则提取文件名
+	i := strings.Index(strings.ToLower(disposition), "filename")
+	if i < 0 {
+		return "", false
+	}
+	_, value, ok := strings.Cut(disposition[i:], "=")
+	if !ok {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		value = value[1:]
+		if end := strings.IndexByte(value, '"'); end >= 0 {
+			value = value[:end]
+		}
+	} else if end := strings.IndexByte(value, ';'); end >= 0 {
+		value = value[:end]
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+// inspectFile 读取文件内容，统计字节数、识别类型、查找嵌入的标记，开启扫描时同时发送给clamd。
+// 返回的错误表示请求体读取失败，文件只检查了已读取的部分
+func (e *WAFEngine) inspectFile(part *multipart.Part, name string, scan bool) (UploadFile, error) {
+	file := UploadFile{
+		Field:        part.FormName(),
+		Name:         name,
+		Extension:    fileExtension(name),
+		DeclaredType: part.Header.Get("Content-Type"),
+	}
+
+	var stream *clamdStream
+	if scan {
+		var err error
+		if stream, err = e.clamd.open(); err != nil {
+			file.ScanError = err.Error()
+			log.Printf("ClamAV scan failed for %s: %v", name, err)
+		}
+	}
+
+	head := make([]byte, 0, uploadSniffSize)
+	scanner := &embeddedScanner{}
+	buf := make([]byte, 32*1024)
+	var readErr error
+	for {
+		n, err := part.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			file.Size += int64(n)
+			if rest := uploadSniffSize - len(head); rest > 0 {
+				head = append(head, chunk[:min(n, rest)]...)
+			}
+			scanner.write(chunk)
+			if stream != nil {
+				stream.Write(chunk)
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+	}
+
+	file.detected = mimetype.Detect(head)
+	file.DetectedType, _, _ = strings.Cut(file.detected.String(), ";")
+	file.Embedded = scanner.embedded(file.detected)
+
+	if stream != nil {
+		malware, err := stream.result()
+		if err != nil {
+			file.ScanError = err.Error()
+			log.Printf("ClamAV scan failed for %s: %v", name, err)
+		}
+		file.Malware = malware
+	}
+	return file, readErr
+}
+
+// fileExtension 文件名的小写扩展名，去掉Windows会忽略的末尾点和空格
+func fileExtension(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return strings.ToLower(path.Ext(strings.TrimRight(base, ". ")))
+}
+
+// doubleExtension 返回文件名中间的可执行扩展名，如 shell.php.jpg、shell.php;.jpg、shell.php%00.jpg 中的.php
+func doubleExtension(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	parts := strings.Split(strings.TrimLeft(base, "."), ".")
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		// ;和NUL之后的部分在部分服务器上被截断，最后一部分是真正的扩展名
+		if cut := cutExtension(part); cut != part {
+			part = cut
+		} else if i == len(parts)-1 {
+			continue
+		}
+		if ext := "." + strings.ToLower(strings.TrimSpace(part)); executableExtensions[ext] {
+			return ext
+		}
+	}
+	return ""
+}
+
+// cutExtension 去掉扩展名中;、NUL或%00及之后的部分
+func cutExtension(part string) string {
+	for _, sep := range []string{";", "\x00", "%00"} {
+		if i := strings.Index(part, sep); i >= 0 {
+			part = part[:i]
+		}
+	}
+	return part
+}
+
+// embeddedScanner 分块查找文件中嵌入的标记，只记录不在文件开头的标记
+type embeddedScanner struct {
+	tail   []byte
+	offset int64
+	found  map[string]bool
+}
+
+func (s *embeddedScanner) write(chunk []byte) {
+	data := append(s.tail, bytes.ToLower(chunk)...)
+	base := s.offset - int64(len(s.tail))
+	for _, m := range embeddedMarkers {
+		if s.found[m.marker] {
+			continue
+		}
+		for from := 0; ; {
+			i := bytes.Index(data[from:], []byte(m.marker))
+			if i < 0 {
+				break
+			}
+			if base+int64(from+i) > 0 {
+				if s.found == nil {
+					s.found = make(map[string]bool)
+				}
+				s.found[m.marker] = true
+				break
+			}
+			from += i + 1
+		}
+	}
+	s.offset += int64(len(chunk))
+	if keep := maxMarkerLen - 1; len(data) > keep {
+		data = data[len(data)-keep:]
+	}
+	s.tail = append([]byte(nil), data...)
+}
+
+// embedded 按识别的文件类型判断嵌入的标记：二进制文件中的脚本，以及与文件本身格式不同的压缩包、PDF和可执行文件
+func (s *embeddedScanner) embedded(detected *mimetype.MIME) string {
+	for _, m := range embeddedMarkers {
+		if !s.found[m.marker] {
+			continue
+		}
+		switch m.name {
+		case "zip":
+			if mimeIn(detected, "application/zip") {
+				continue
+			}
+		case "pdf":
+			if mimeIn(detected, "application/pdf") {
+				continue
+			}
+		case "elf":
+			if mimeIn(detected, "application/x-elf") {
+				continue
+			}
+		case "pe":
+			if mimeIn(detected, "application/vnd.microsoft.portable-executable") {
+				continue
+			}
+		}
+		if m.script && mimeIn(detected, "text/plain") {
+			continue
+		}
+		return m.name
+	}
+	return ""
+}
+
+// mimeIn 类型是否为指定类型或其子类型，如docx属于application/zip
+func mimeIn(m *mimetype.MIME, family string) bool {
+	for ; m != nil; m = m.Parent() {
+		if m.Is(family) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUploads 按匹配的上传策略检查请求中的文件，返回策略和第一个违规
+func (e *WAFEngine) checkUploads(c *gin.Context, domainID uint) (*models.UploadPolicy, *uploadViolation) {
+	result := e.uploads(c, domainID)
+	if result == nil || result.policy == nil {
+		return nil, nil
+	}
+	policy := result.policy
+
+	// 无法检查全部文件时拦截，否则格式错误或超大请求体之后的文件可以绕过检查
+	if result.oversized {
+		return policy, &uploadViolation{
+			Type:   uploadBodyTooLarge,
+			Reason: fmt.Sprintf("request body exceeds inspection limit %d", int64(maxUploadInspectSize)),
+			Status: http.StatusRequestEntityTooLarge,
+		}
+	}
+	if result.truncated {
+		return policy, &uploadViolation{
+			Type:   uploadMalformed,
+			Reason: "malformed multipart body",
+			Status: http.StatusBadRequest,
+		}
+	}
+
+	if policy.MaxFileCount > 0 && len(result.files) > policy.MaxFileCount {
+		return policy, &uploadViolation{
+			Type:   uploadFileCount,
+			Reason: fmt.Sprintf("file count %d exceeds limit %d", len(result.files), policy.MaxFileCount),
+			Status: http.StatusRequestEntityTooLarge,
+		}
+	}
+
+	// 保存策略时已校验列表格式
+	extensions, _ := parseProtocolList(policy.AllowedExtensions)
+	types, _ := parseProtocolList(policy.AllowedMIMETypes)
+	for i := range result.files {
+		file := &result.files[i]
+		violation := func(violationType string, status int, format string, args ...interface{}) *uploadViolation {
+			return &uploadViolation{Type: violationType, File: file, Reason: fmt.Sprintf(format, args...), Status: status}
+		}
+		if policy.BlockDoubleExtensions {
+			if ext := doubleExtension(file.Name); ext != "" {
+				return policy, violation(uploadDoubleExtension, http.StatusForbidden, "double extension %s", ext)
+			}
+		}
+		if len(extensions) > 0 && !extensionAllowed(extensions, file.Extension) {
+			return policy, violation(uploadExtensionDenied, http.StatusUnsupportedMediaType, "extension %q is not allowed", file.Extension)
+		}
+		if policy.MaxFileSize > 0 && file.Size > policy.MaxFileSize {
+			return policy, violation(uploadFileSize, http.StatusRequestEntityTooLarge, "size %d exceeds limit %d", file.Size, policy.MaxFileSize)
+		}
+		if len(types) > 0 && !fileTypeAllowed(types, file) {
+			return policy, violation(uploadTypeDenied, http.StatusUnsupportedMediaType, "detected type %s (declared %q) is not allowed", file.DetectedType, file.DeclaredType)
+		}
+		if policy.BlockPolyglots && file.Embedded != "" {
+			return policy, violation(uploadPolyglot, http.StatusForbidden, "%s file contains embedded %s content", file.DetectedType, file.Embedded)
+		}
+		if file.Malware != "" {
+			return policy, violation(uploadMalware, http.StatusForbidden, "malware found: %s", file.Malware)
+		}
+	}
+	return policy, nil
+}
+
+// extensionAllowed 扩展名是否在允许列表中，列表项可省略开头的.
+func extensionAllowed(allowed []string, ext string) bool {
+	for _, item := range allowed {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if !strings.HasPrefix(item, ".") {
+			item = "." + item
+		}
+		if item == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// fileTypeAllowed 按内容识别的类型是否在允许列表中，列表项可以是类型的别名
+func fileTypeAllowed(allowed []string, file *UploadFile) bool {
+	if contentTypeAllowed(allowed, file.DetectedType) {
+		return true
+	}
+	for _, item := range allowed {
+		if file.detected != nil && file.detected.Is(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadRuleValues 返回请求中全部上传文件的文件名、字节数或识别的类型，供规则匹配
+func (e *WAFEngine) uploadRuleValues(c *gin.Context, domainID uint, matchType string) []string {
+	result := e.uploads(c, domainID)
+	if result == nil {
+		return nil
+	}
+
+	values := make([]string, 0, len(result.files))
+	for _, file := range result.files {
+		switch matchType {
+		case "file_name":
+			values = append(values, file.Name)
+		case "file_size":
+			values = append(values, strconv.FormatInt(file.Size, 10))
+		case "file_type":
+			values = append(values, file.DetectedType)
+		}
+	}
+	return values
+}
+
+// celFiles 表达式中的request.files，每个文件为field, name, extension, size, declared_type, type
+func (e *WAFEngine) celFiles(c *gin.Context, domainID uint) []map[string]any {
+	files := []map[string]any{}
+	result := e.uploads(c, domainID)
+	if result == nil {
+		return files
+	}
+	for _, file := range result.files {
+		files = append(files, map[string]any{
+			"field":         file.Field,
+			"name":          file.Name,
+			"extension":     file.Extension,
+			"size":          file.Size,
+			"declared_type": file.DeclaredType,
+			"type":          file.DetectedType,
+		})
+	}
+	return files
+}
+
+// ValidateUploadPolicy 校验上传策略的路径前缀和允许列表
+func ValidateUploadPolicy(policy *models.UploadPolicy) error {
+	if policy.Path != "" && !strings.HasPrefix(policy.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	extensions, err := parseProtocolList(policy.AllowedExtensions)
+	if err != nil {
+		return fmt.Errorf("allowed_extensions must be a JSON array of strings: %v", err)
+	}
+	for _, ext := range extensions {
+		if strings.Trim(ext, ". ") == "" || strings.ContainsAny(ext, "/\\") {
+			return fmt.Errorf("invalid extension: %q", ext)
+		}
+	}
+	types, err := parseProtocolList(policy.AllowedMIMETypes)
+	if err != nil {
+		return fmt.Errorf("allowed_mime_types must be a JSON array of strings: %v", err)
+	}
+	for _, fileType := range types {
+		if _, _, err := mime.ParseMediaType(fileType); err != nil || !strings.Contains(fileType, "/") {
+			return fmt.Errorf("invalid MIME type: %q", fileType)
+		}
+	}
+	return nil
+}
+
+// bodySpool 保存检查上传文件时读取的请求体，超过uploadMemoryLimit的部分写入临时文件。
+// 临时文件创建后立即删除，关闭时释放；写入失败时其余部分保存在内存中
+type bodySpool struct {
+	mem      bytes.Buffer
+	file     *os.File
+	fileSize int64
+	failed   bool
+	tail     bytes.Buffer
+}
+
+func (s *bodySpool) Write(p []byte) (int, error) {
+	if s.failed {
+		return s.tail.Write(p)
+	}
+	if s.file == nil && s.mem.Len()+len(p) > uploadMemoryLimit {
+		file, err := os.CreateTemp("", "waf-upload-*")
+		if err != nil {
+			log.Printf("Failed to create upload spool file, keeping body in memory: %v", err)
+			s.failed = true
+			return s.tail.Write(p)
+		}
+		os.Remove(file.Name())
+		s.file = file
+	}
+	if s.file == nil {
+		return s.mem.Write(p)
+	}
+	n, err := s.file.Write(p)
+	s.fileSize += int64(n)
+	if err != nil {
+		log.Printf("Failed to write upload spool file, keeping body in memory: %v", err)
+		s.failed = true
+		s.tail.Write(p[n:])
+	}
+	return len(p), nil
+}
+
+// reader 按写入顺序读取保存的请求体
+func (s *bodySpool) reader() io.Reader {
+	readers := []io.Reader{&s.mem}
+	if s.file != nil {
+		readers = append(readers, io.NewSectionReader(s.file, 0, s.fileSize))
+	}
+	return io.MultiReader(append(readers, &s.tail)...)
+}
+
+func (s *bodySpool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// spooledBody 检查上传文件后恢复的请求体，关闭时同时关闭临时文件和原请求体
+type spooledBody struct {
+	io.Reader
+	spool *bodySpool
+	body  io.Closer
+}
+
+func (b *spooledBody) Close() error {
+	b.spool.Close()
+	return b.body.Close()
+}
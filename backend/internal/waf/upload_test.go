@@ -0,0 +1,206 @@
+package waf
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"waf-go/internal/models"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+func TestFileExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.JPG", ".jpg"},
+		{"archive.tar.gz", ".gz"},
+		{"noext", ""},
+		{"shell.php.", ".php"},
+		{"shell.php . .", ".php"},
+		{"c:\\uploads\\shell.asp", ".asp"},
+		{"../../etc/.htaccess", ".htaccess"},
+		{"dir.php/photo.jpg", ".jpg"},
+	}
+	for _, tt := range tests {
+		if got := fileExtension(tt.name); got != tt.want {
+			t.Errorf("fileExtension(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDoubleExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.jpg", ""},
+		{"shell.php", ""},
+		{"archive.tar.gz", ""},
+		{"shell.php.jpg", ".php"},
+		{"shell.PHP5.png", ".php5"},
+		{"report.2024.aspx.pdf", ".aspx"},
+		{"shell.php;.jpg", ".php"},
+		{"shell.php%00.jpg", ".php"},
+		{"shell.php\x00.jpg", ".php"},
+		{"shell.php;", ".php"},
+		{"shell.asp .jpg", ".asp"},
+		{"c:\\uploads\\shell.jsp.gif", ".jsp"},
+		{"shell.php/photo.jpg", ""},
+		{"shell.jpg;.png", ""},
+		{".htaccess.jpg", ""},
+		{"..php.jpg", ""},
+		{"a..php.jpg", ".php"},
+	}
+	for _, tt := range tests {
+		if got := doubleExtension(tt.name); got != tt.want {
+			t.Errorf("doubleExtension(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedScanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		found []string
+	}{
+		{name: "clean", data: "GIF89a" + strings.Repeat("\x00\x01", 100)},
+		{name: "marker at file start", data: "<?php echo 1;"},
+		{name: "marker at start and later", data: "<?php echo 1; <?php", found: []string{"<?php"}},
+		{name: "php in image", data: "GIF89a\x00\x00<?php system($_GET[0]); ?>", found: []string{"<?php"}},
+		{name: "case insensitive", data: "\x89PNG\r\n\x1a\n<ScRiPt>alert(1)</script>", found: []string{"<script"}},
+		{name: "several markers", data: "x<%@ page %>PK\x03\x04%PDF-1.7", found: []string{"<%@", "pk\x03\x04", "%pdf-"}},
+		{name: "pe stub", data: "MZ\x90\x00This program cannot be run in DOS mode.", found: []string{"this program cannot be run in dos mode"}},
+		{name: "marker at end", data: strings.Repeat("a", 100) + "\x7fELF", found: []string{"\x7felf"}},
+	}
+
+	for _, tt := range tests {
+		// 标记可能被拆分到任意两个分块中
+		for _, size := range []int{len(tt.data), 1, 2, 3, 5, maxMarkerLen - 1} {
+			scanner := &embeddedScanner{}
+			for data := tt.data; len(data) > 0; {
+				n := min(size, len(data))
+				scanner.write([]byte(data[:n]))
+				data = data[n:]
+			}
+
+			var found []string
+			for marker := range scanner.found {
+				found = append(found, marker)
+			}
+			sort.Strings(found)
+			want := append([]string(nil), tt.found...)
+			sort.Strings(want)
+			if strings.Join(found, "|") != strings.Join(want, "|") {
+				t.Errorf("%s (chunk size %d): found = %q, want %q", tt.name, size, found, want)
+			}
+		}
+	}
+}
+
+func TestEmbeddedScannerType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "php in image", data: "GIF89a\x00\x00<?php system($_GET[0]);", want: "php"},
+		{name: "script in text", data: "hello <script>alert(1)</script>"},
+		{name: "zip in image", data: "GIF89a\x00\x00PK\x03\x04", want: "zip"},
+		{name: "pdf in pdf", data: "%PDF-1.4\n%PDF-1.4"},
+		{name: "pdf in image", data: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR%PDF-1.4", want: "pdf"},
+	}
+	for _, tt := range tests {
+		scanner := &embeddedScanner{}
+		scanner.write([]byte(tt.data))
+		if got := scanner.embedded(mimetype.Detect([]byte(tt.data))); got != tt.want {
+			t.Errorf("%s: embedded = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// multipartFile 单个文件的multipart请求体，closed为false时缺少结束分隔符
+func multipartFile(name, content string, closed bool) string {
+	body := "--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"" + name + "\"\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\n" + content
+	if closed {
+		body += "\r\n--x--\r\n"
+	}
+	return body
+}
+
+func TestInspectUploads(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		files     int
+		truncated bool
+		oversized bool
+	}{
+		{name: "complete", body: multipartFile("a.txt", "hello", true), files: 1},
+		{name: "not multipart", body: "just some text", truncated: true},
+		{name: "missing closing boundary", body: multipartFile("a.txt", "hello", false), files: 1, truncated: true},
+		{name: "bad part header", body: "--x\r\nContent-Disposition\r\n\r\nabc\r\n--x--\r\n", truncated: true},
+		{name: "body over inspection limit", body: multipartFile("a.txt", strings.Repeat("a", maxInspectBodySize), true), files: 1, oversized: true},
+	}
+
+	e := &WAFEngine{}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.body))
+		result := &uploadInspection{}
+		e.inspectUploads(c, "x", result)
+
+		if len(result.files) != tt.files || result.truncated != tt.truncated || result.oversized != tt.oversized {
+			t.Errorf("%s: files = %d, truncated = %v, oversized = %v, want %d, %v, %v",
+				tt.name, len(result.files), result.truncated, result.oversized, tt.files, tt.truncated, tt.oversized)
+		}
+		// 无论检查结果如何，转发给后端的请求体都应完整
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		if string(body) != tt.body {
+			t.Errorf("%s: forwarded body has %d bytes, want %d", tt.name, len(body), len(tt.body))
+		}
+	}
+}
+
+func TestCheckUploads(t *testing.T) {
+	policy := &models.UploadPolicy{BlockDoubleExtensions: true, MaxFileCount: 1}
+	doubleExt := UploadFile{Field: "file", Name: "shell.php.jpg", Extension: ".jpg"}
+
+	tests := []struct {
+		name       string
+		inspection *uploadInspection
+		want       string
+		status     int
+	}{
+		{name: "no policy", inspection: &uploadInspection{files: []UploadFile{doubleExt}, truncated: true}},
+		{name: "clean", inspection: &uploadInspection{policy: policy, files: []UploadFile{{Name: "a.jpg", Extension: ".jpg"}}}},
+		{name: "oversized", inspection: &uploadInspection{policy: policy, files: []UploadFile{doubleExt}, oversized: true}, want: uploadBodyTooLarge, status: http.StatusRequestEntityTooLarge},
+		{name: "malformed", inspection: &uploadInspection{policy: policy, truncated: true}, want: uploadMalformed, status: http.StatusBadRequest},
+		{name: "too many files", inspection: &uploadInspection{policy: policy, files: []UploadFile{{}, {}}}, want: uploadFileCount, status: http.StatusRequestEntityTooLarge},
+		{name: "double extension", inspection: &uploadInspection{policy: policy, files: []UploadFile{doubleExt}}, want: uploadDoubleExtension, status: http.StatusForbidden},
+	}
+
+	e := &WAFEngine{}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/upload", nil)
+		c.Set(uploadKey, tt.inspection)
+
+		got, status := "", 0
+		if _, violation := e.checkUploads(c, 1); violation != nil {
+			got, status = violation.Type, violation.Status
+		}
+		if got != tt.want || status != tt.status {
+			t.Errorf("%s: violation = %q (%d), want %q (%d)", tt.name, got, status, tt.want, tt.status)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package waf
+
+import (
+	"log"
+	"time"
+
+	"waf-go/internal/models"
+)
+
+// wsLogLimit 攻击日志中记录的WebSocket消息最大长度
+const wsLogLimit = 4096
+
+// StartSession 加载域名的ws_message规则，返回WebSocket文本消息检查函数。
+// 检测模式下本应关闭连接或丢弃的消息记录为would_block并照常转发
+func (e *WAFEngine) StartSession(session *models.WebSocketSession) func(message []byte) string {
+	var domain models.Domain
+	if err := e.db.Select("id", "mode").First(&domain, session.DomainID).Error; err != nil {
+		log.Printf("Failed to get domain for websocket session: %v", err)
+		return nil
+	}
+	if domain.Mode == ModeOff {
+		return nil
+	}
+
+	ruleSet, err := e.domainRules(session.DomainID)
+	if err != nil {
+		log.Printf("Failed to get domain rules for websocket session: %v", err)
+		return nil
+	}
+	ruleModes := ruleSet.modes
+
+	var wsRules []models.Rule
+	for _, rule := range ruleSet.rules {
+		if rule.MatchType == "ws_message" {
+			wsRules = append(wsRules, rule)
+		}
+	}
+	if len(wsRules) == 0 {
+		return nil
+	}
+
+	return func(message []byte) string {
+		value := string(message)
+		action := "allow"
+		for _, rule := range wsRules {
+			if !e.performMatch(rule.MatchMode, rule.Pattern, value) {
+				continue
+			}
+			switch rule.Action {
+			case "allow":
+				return "allow"
+			case "log":
+				e.logWebSocketViolation(session, rule, rule.Action, value)
+				action = "log"
+				// 继续检查其他规则
+			case "drop", "block":
+				if domain.Mode == ModeDetectOnly || ruleModes[rule.ID] == ModeDetectOnly {
+					e.logWebSocketViolation(session, rule, ActionWouldBlock, value)
+					action = "log"
+					continue
+				}
+				e.logWebSocketViolation(session, rule, rule.Action, value)
+				return rule.Action
+			}
+		}
+		return action
+	}
+}
+
+// EndSession 记录WebSocket会话
+func (e *WAFEngine) EndSession(session *models.WebSocketSession) {
+	if err := e.db.Create(session).Error; err != nil {
+		log.Printf("Failed to log websocket session: %v", err)
+	}
+}
+
+// logWebSocketViolation 将命中规则的WebSocket消息记录到攻击日志，request_id为会话ID
+func (e *WAFEngine) logWebSocketViolation(session *models.WebSocketSession, rule models.Rule, action, message string) {
+	session.Violations++
+
+	if len(message) > wsLogLimit {
+		message = message[:wsLogLimit]
+	}
+	responseCode := 0
+	if rule.Action == "block" {
+		// 检测模式下记录本应使用的关闭码
+		responseCode = 1008 // WebSocket关闭码：策略违规
+	}
+
+	attackLog := models.AttackLog{
+		RequestID:      session.SessionID,
+		ClientIP:       session.ClientIP,
+		UserAgent:      session.UserAgent,
+		RequestMethod:  "WS",
+		RequestURI:     session.RequestURI,
+		RequestHeaders: "{}",
+		RequestBody:    message,
+		DomainID:       session.DomainID,
+		Domain:         session.Domain,
+		RuleID:         rule.ID,
+		RuleName:       rule.Name,
+		MatchField:     "ws_message",
+		MatchValue:     message,
+		Action:         action,
+		ResponseCode:   responseCode,
+		TenantID:       session.TenantID,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := e.db.Create(&attackLog).Error; err != nil {
+		log.Printf("Failed to log websocket violation: %v", err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"waf-go/internal/logger"
 	"waf-go/internal/router"
 	"waf-go/internal/service"
+	"waf-go/internal/waf"
 	// "github.com/gin-gonic/gin"
 )
 
@@ -57,16 +58,27 @@ func main() {
 	// 初始化路由
 	r := router.Init(services)
 
+	// 启动后台任务（ACME证书签发与续期）
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	services.StartBackgroundTasks(bgCtx)
+
 	// 启动HTTP服务器
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("0.0.0.0:%d", cfg.Server.HTTPPort),
 		Handler: r,
 	}
 
+	// 监听器记录原始请求头，供WAF检查请求走私特征
+	listener, err := waf.ListenFraming(srv)
+	if err != nil {
+		log.Fatalf("启动服务器失败: %v", err)
+	}
+
 	// 优雅关闭
 	go func() {
 		log.Printf("HTTP服务器启动在端口 %d", cfg.Server.HTTPPort)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("启动服务器失败: %v", err)
 		}
 	}()
@@ -22,6 +22,23 @@ START TRANSACTION;
 -- =============================================================================
 
 -- 删除所有表（按依赖关系倒序）
+DROP TABLE IF EXISTS `login_endpoints`;
+DROP TABLE IF EXISTS `upload_policies`;
+DROP TABLE IF EXISTS `shadow_diffs`;
+DROP TABLE IF EXISTS `shadow_stats`;
+DROP TABLE IF EXISTS `rule_exclusions`;
+DROP TABLE IF EXISTS `learning_rule_hits`;
+DROP TABLE IF EXISTS `learning_endpoints`;
+DROP TABLE IF EXISTS `learning_sessions`;
+DROP TABLE IF EXISTS `api_spec_observations`;
+DROP TABLE IF EXISTS `api_specs`;
+DROP TABLE IF EXISTS `graphql_endpoints`;
+DROP TABLE IF EXISTS `grpc_descriptor_sets`;
+DROP TABLE IF EXISTS `websocket_sessions`;
+DROP TABLE IF EXISTS `rewrite_rules`;
+DROP TABLE IF EXISTS `domain_certificates`;
+DROP TABLE IF EXISTS `acme_certificates`;
+DROP TABLE IF EXISTS `acme_accounts`;
 DROP TABLE IF EXISTS `webhooks`;
 DROP TABLE IF EXISTS `rate_limits`;
 DROP TABLE IF EXISTS `attack_logs`;
@@ -82,7 +99,38 @@ CREATE TABLE `domains` (
   `port` int NOT NULL DEFAULT '80' COMMENT '端口号',
   `ssl_certificate` text COMMENT 'SSL证书内容',
   `ssl_private_key` text COMMENT 'SSL私钥内容',
+  `cert_source` varchar(20) NOT NULL DEFAULT 'manual' COMMENT '证书来源：manual, acme',
+  `acme_challenge` varchar(20) NOT NULL DEFAULT 'http-01' COMMENT 'ACME验证方式：http-01, tls-alpn-01',
+  `client_auth_mode` varchar(20) NOT NULL DEFAULT 'none' COMMENT '客户端证书认证模式：none, optional, required, verify_if_given',
+  `client_ca_certs` text COMMENT '校验客户端证书的CA证书包（PEM格式）',
   `backend_url` varchar(500) NOT NULL COMMENT '后端服务地址',
+  `upstream_tls_insecure_skip_verify` tinyint(1) NOT NULL DEFAULT '0' COMMENT '跳过后端证书校验',
+  `upstream_ca_certs` text COMMENT '校验后端证书的CA证书包（PEM格式）',
+  `upstream_server_name` varchar(255) DEFAULT NULL COMMENT '连接后端时使用的SNI',
+  `upstream_client_cert` text COMMENT '向后端出示的客户端证书（PEM格式）',
+  `upstream_client_key` text COMMENT '向后端出示的客户端证书私钥（PEM格式）',
+  `upstream_http2` tinyint(1) NOT NULL DEFAULT '0' COMMENT '使用HTTP/2连接后端，http后端为h2c',
+  `force_https` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否将HTTP请求重定向到HTTPS',
+  `https_redirect_code` int NOT NULL DEFAULT '301' COMMENT 'HTTPS重定向状态码：301, 308',
+  `hsts_enabled` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否添加HSTS头',
+  `hsts_max_age` int NOT NULL DEFAULT '31536000' COMMENT 'HSTS max-age（秒）',
+  `hsts_include_subdomains` tinyint(1) NOT NULL DEFAULT '0' COMMENT 'HSTS是否包含子域名',
+  `hsts_preload` tinyint(1) NOT NULL DEFAULT '0' COMMENT 'HSTS是否声明preload',
+  `security_headers` text COMMENT '注入或覆盖的响应头（JSON对象）',
+  `strip_response_headers` text COMMENT '移除的后端响应头（JSON数组）',
+  `preserve_host` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否将客户端Host头转发给后端',
+  `mode` varchar(20) NOT NULL DEFAULT 'enforce' COMMENT '防护模式：enforce, detect_only, off',
+  `websocket_enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否允许WebSocket连接',
+  `websocket_idle_timeout` int NOT NULL DEFAULT '300' COMMENT 'WebSocket空闲超时（秒）',
+  `websocket_max_duration` int NOT NULL DEFAULT '0' COMMENT 'WebSocket最长连接时间（秒）',
+  `websocket_max_message_size` int NOT NULL DEFAULT '1048576' COMMENT 'WebSocket客户端单条消息最大字节数',
+  `protocol_validation` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否在规则检查前校验HTTP协议，开启后域名的所有请求都经过WAF检查',
+  `allowed_methods` text COMMENT '允许的请求方法（JSON数组），为空表示不限制',
+  `max_header_count` int NOT NULL DEFAULT '100' COMMENT '最大请求头个数，0表示不限制',
+  `max_header_size` int NOT NULL DEFAULT '32768' COMMENT '请求头总字节数上限，0表示不限制',
+  `max_url_length` int NOT NULL DEFAULT '8192' COMMENT '请求URI最大长度，0表示不限制',
+  `max_arg_count` int NOT NULL DEFAULT '256' COMMENT '查询参数和表单参数最大个数，0表示不限制',
+  `allowed_content_types` text COMMENT '允许的请求体Content-Type（JSON数组），为空表示不限制',
   `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
   `enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否启用',
   `created_at` datetime(3) DEFAULT NULL,
@@ -101,6 +149,7 @@ CREATE TABLE `policies` (
   `description` text COMMENT '策略描述',
   `tenant_id` bigint unsigned NOT NULL COMMENT '所属租户ID',
   `enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否启用',
+  `mode` varchar(20) NOT NULL DEFAULT 'enforce' COMMENT '防护模式：enforce, detect_only, off',
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
@@ -114,15 +163,18 @@ CREATE TABLE `rules` (
   `id` bigint unsigned NOT NULL AUTO_INCREMENT,
   `name` varchar(255) NOT NULL COMMENT '规则名称',
   `description` text COMMENT '规则描述',
-  `match_type` varchar(50) NOT NULL COMMENT '匹配类型：uri, ip, header, body, user_agent',
+  `match_type` varchar(50) NOT NULL COMMENT '匹配类型：uri, ip, header, body, user_agent, client_cert_subject, client_cert_san, client_cert_fingerprint, ws_message, grpc_service, grpc_method, grpc_message, graphql_operation_name, graphql_operation_type, compound',
   `pattern` text NOT NULL COMMENT '匹配模式，具体的匹配规则内容',
-  `match_mode` varchar(50) NOT NULL COMMENT '匹配模式：exact, regex, contains',
-  `action` varchar(50) NOT NULL COMMENT '动作：block, allow, log',
+  `conditions` text COMMENT '组合条件，JSON格式的AND/OR/NOT条件树，仅compound类型使用',
+  `match_mode` varchar(50) NOT NULL COMMENT '匹配模式：exact, regex, contains, cel',
+  `action` varchar(50) NOT NULL COMMENT '动作：block, allow, log, drop',
   `response_code` int NOT NULL DEFAULT '403' COMMENT '阻断时返回的HTTP状态码',
   `response_msg` text COMMENT '阻断时返回的消息内容',
   `priority` int NOT NULL DEFAULT '1' COMMENT '规则优先级',
   `tenant_id` bigint unsigned NOT NULL COMMENT '所属租户ID',
   `enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否启用',
+  `tags` varchar(500) DEFAULT NULL COMMENT '规则标签，多个以逗号分隔',
+  `test_cases` text COMMENT '测试用例，JSON数组，每项为模拟请求及是否应命中',
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
@@ -138,7 +190,7 @@ CREATE TABLE `rules` (
 -- 黑名单表
 CREATE TABLE `black_lists` (
   `id` bigint unsigned NOT NULL AUTO_INCREMENT,
-  `type` varchar(50) NOT NULL COMMENT '类型：ip, uri, user_agent',
+  `type` varchar(50) NOT NULL COMMENT '类型：ip, uri, user_agent, client_cert',
   `value` varchar(500) NOT NULL COMMENT '值',
   `comment` text COMMENT '备注',
   `tenant_id` bigint unsigned NOT NULL COMMENT '所属租户ID',
@@ -155,7 +207,7 @@ CREATE TABLE `black_lists` (
 -- 白名单表
 CREATE TABLE `white_lists` (
   `id` bigint unsigned NOT NULL AUTO_INCREMENT,
-  `type` varchar(50) NOT NULL COMMENT '类型：ip, uri, user_agent',
+  `type` varchar(50) NOT NULL COMMENT '类型：ip, uri, user_agent, client_cert',
   `value` varchar(500) NOT NULL COMMENT '值',
   `comment` text COMMENT '备注',
   `tenant_id` bigint unsigned NOT NULL COMMENT '所属租户ID',
@@ -176,6 +228,8 @@ CREATE TABLE IF NOT EXISTS `domain_policies` (
     `policy_id` bigint unsigned NOT NULL COMMENT '策略ID',
     `priority` int NOT NULL DEFAULT '1' COMMENT '策略在该域名下的优先级，数字越大优先级越高',
     `enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否启用此关联',
+    `mode` varchar(20) NOT NULL DEFAULT 'enforce' COMMENT '该域名下策略的防护模式：enforce, detect_only, off',
+    `shadow` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否为影子策略，只在旁路评估，不影响请求处理结果',
     `created_at` timestamp NULL DEFAULT NULL COMMENT '创建时间',
     `updated_at` timestamp NULL DEFAULT NULL COMMENT '更新时间',
     PRIMARY KEY (`id`),
@@ -221,8 +275,10 @@ CREATE TABLE `attack_logs` (
   `match_type` varchar(50) NOT NULL COMMENT '匹配类型',
   `match_field` varchar(100) DEFAULT NULL COMMENT '匹配的字段名称',
   `match_value` text NOT NULL COMMENT '匹配值',
-  `action` varchar(50) NOT NULL COMMENT '执行动作',
+  `username` varchar(255) DEFAULT NULL COMMENT '登录接口请求的用户名，配置了脱敏时为脱敏后的值',
+  `action` varchar(50) NOT NULL COMMENT '执行动作，would_block表示检测模式下本应拦截',
   `response_code` int NOT NULL COMMENT '响应状态码',
+  `suppressed_hits` text COMMENT '被规则排除跳过的命中，JSON格式',
   `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
   `created_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
@@ -233,6 +289,7 @@ CREATE TABLE `attack_logs` (
   KEY `idx_rule_id` (`rule_id`),
   KEY `idx_rule_name` (`rule_name`),
   KEY `idx_domain` (`domain`),
+  KEY `idx_username` (`username`),
   CONSTRAINT `fk_attack_logs_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE SET NULL,
   CONSTRAINT `fk_attack_logs_rule` FOREIGN KEY (`rule_id`) REFERENCES `rules` (`id`) ON DELETE SET NULL,
   CONSTRAINT `fk_attack_logs_tenant` FOREIGN KEY (`tenant_id`) REFERENCES `tenants` (`id`) ON DELETE CASCADE
@@ -271,6 +328,373 @@ CREATE TABLE `webhooks` (
   CONSTRAINT `fk_webhooks_tenant` FOREIGN KEY (`tenant_id`) REFERENCES `tenants` (`id`) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Webhook配置表';
 
+-- ACME账户表
+CREATE TABLE `acme_accounts` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `directory_url` varchar(500) NOT NULL COMMENT 'ACME目录地址',
+  `email` varchar(255) DEFAULT NULL COMMENT '联系邮箱',
+  `account_url` varchar(500) DEFAULT NULL COMMENT '账户地址',
+  `private_key` text COMMENT '账户私钥（加密）',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_acme_accounts_directory_url` (`directory_url`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='ACME账户表';
+
+-- ACME证书表
+CREATE TABLE `acme_certificates` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `domain` varchar(255) DEFAULT NULL COMMENT '域名',
+  `certificate` text COMMENT '证书链（加密）',
+  `private_key` text COMMENT '证书私钥（加密）',
+  `issuer` varchar(500) DEFAULT NULL COMMENT '签发者',
+  `serial_number` varchar(100) DEFAULT NULL COMMENT '证书序列号',
+  `not_before` datetime(3) DEFAULT NULL COMMENT '生效时间',
+  `not_after` datetime(3) DEFAULT NULL COMMENT '过期时间',
+  `status` varchar(20) NOT NULL DEFAULT 'pending' COMMENT '状态：pending, issuing, valid, failed',
+  `last_error` text COMMENT '最近一次失败原因',
+  `failure_count` int NOT NULL DEFAULT '0' COMMENT '连续失败次数',
+  `last_attempt_at` datetime(3) DEFAULT NULL COMMENT '最近一次尝试时间',
+  `renewed_at` datetime(3) DEFAULT NULL COMMENT '最近一次成功签发时间',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_acme_certificates_domain_id` (`domain_id`),
+  KEY `idx_domain` (`domain`),
+  KEY `idx_not_after` (`not_after`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_acme_certificates_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='ACME证书表';
+
+-- 域名附加证书表
+CREATE TABLE `domain_certificates` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '证书名称',
+  `certificate` text NOT NULL COMMENT '证书链（PEM格式）',
+  `private_key` text NOT NULL COMMENT '私钥（PEM格式）',
+  `key_type` varchar(50) DEFAULT NULL COMMENT '密钥类型',
+  `issuer` varchar(500) DEFAULT NULL COMMENT '签发者',
+  `not_after` datetime(3) DEFAULT NULL COMMENT '过期时间',
+  `enabled` tinyint(1) DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_domain_certificates_domain_id` (`domain_id`),
+  KEY `idx_not_after` (`not_after`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_domain_certificates_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='域名附加证书表';
+
+-- 重写规则表
+CREATE TABLE `rewrite_rules` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '规则名称',
+  `location` varchar(500) DEFAULT NULL COMMENT '生效路径前缀',
+  `type` varchar(30) NOT NULL COMMENT '规则类型：request_header_add/set/remove, response_header_add/set/remove, url_rewrite, redirect',
+  `header_name` varchar(255) DEFAULT NULL COMMENT '头部名称',
+  `pattern` varchar(1000) DEFAULT NULL COMMENT '匹配请求URI的正则表达式',
+  `value` text COMMENT '头部值或替换目标',
+  `status_code` int NOT NULL DEFAULT '0' COMMENT '重定向状态码',
+  `priority` int NOT NULL DEFAULT '0' COMMENT '优先级',
+  `enabled` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_rewrite_rules_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_rewrite_rules_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='重写规则表';
+
+-- WebSocket会话记录表
+CREATE TABLE `websocket_sessions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `session_id` varchar(255) DEFAULT NULL COMMENT '会话唯一标识符',
+  `domain_id` bigint unsigned DEFAULT NULL COMMENT '域名ID',
+  `domain` varchar(255) DEFAULT NULL COMMENT '域名',
+  `client_ip` varchar(45) DEFAULT NULL COMMENT '客户端IP地址',
+  `user_agent` longtext COMMENT '用户代理字符串',
+  `request_uri` varchar(500) DEFAULT NULL COMMENT '握手请求URI',
+  `messages_in` bigint NOT NULL DEFAULT '0' COMMENT '客户端发送的消息数',
+  `messages_out` bigint NOT NULL DEFAULT '0' COMMENT '后端发送的消息数',
+  `bytes_in` bigint NOT NULL DEFAULT '0' COMMENT '客户端发送的负载字节数',
+  `bytes_out` bigint NOT NULL DEFAULT '0' COMMENT '后端发送的负载字节数',
+  `violations` int NOT NULL DEFAULT '0' COMMENT '命中WAF规则的消息数',
+  `close_reason` varchar(50) DEFAULT NULL COMMENT '关闭原因',
+  `started_at` datetime(3) DEFAULT NULL COMMENT '连接建立时间',
+  `ended_at` datetime(3) DEFAULT NULL COMMENT '连接关闭时间',
+  `tenant_id` bigint unsigned DEFAULT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_websocket_sessions_session_id` (`session_id`),
+  KEY `idx_websocket_sessions_domain_id` (`domain_id`),
+  KEY `idx_websocket_sessions_domain` (`domain`),
+  KEY `idx_websocket_sessions_client_ip` (`client_ip`),
+  KEY `idx_websocket_sessions_started_at` (`started_at`),
+  KEY `idx_tenant_id` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='WebSocket会话记录表';
+
+-- gRPC描述文件表
+CREATE TABLE `grpc_descriptor_sets` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `content` longblob COMMENT 'FileDescriptorSet二进制内容',
+  `services` text COMMENT '包含的服务全名，JSON数组',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_grpc_descriptor_sets_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_grpc_descriptor_sets_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='gRPC描述文件表';
+
+-- GraphQL端点表
+CREATE TABLE `graphql_endpoints` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `path` varchar(500) NOT NULL COMMENT 'GraphQL请求路径',
+  `max_depth` bigint DEFAULT '0' COMMENT '最大查询深度，0表示不限制',
+  `max_aliases` bigint DEFAULT '0' COMMENT '最大别名数，0表示不限制',
+  `max_fields` bigint DEFAULT '0' COMMENT '最大字段数，0表示不限制',
+  `max_complexity` bigint DEFAULT '0' COMMENT '最大复杂度，0表示不限制',
+  `max_batch_size` bigint DEFAULT '0' COMMENT '批量请求最大查询数，0表示不限制',
+  `block_introspection` tinyint(1) DEFAULT '0' COMMENT '是否禁止内省查询',
+  `action` varchar(20) DEFAULT 'block' COMMENT '超出限制时的动作：block, log',
+  `enabled` tinyint(1) DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_graphql_endpoints_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_graphql_endpoints_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='GraphQL端点表';
+
+-- OpenAPI规范表
+CREATE TABLE `api_specs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `location` varchar(500) DEFAULT NULL COMMENT '生效路径前缀，为空表示整个域名',
+  `mode` varchar(20) DEFAULT 'log_only' COMMENT '模式：enforce, log_only, learn',
+  `content` longtext COMMENT 'OpenAPI 3规范内容，JSON或YAML',
+  `version` varchar(100) DEFAULT NULL COMMENT '规范版本',
+  `operations` bigint DEFAULT '0' COMMENT '规范定义的操作数',
+  `enabled` tinyint(1) DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_api_specs_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_api_specs_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='OpenAPI规范表';
+
+-- OpenAPI学习记录表
+CREATE TABLE `api_spec_observations` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `spec_id` bigint unsigned NOT NULL COMMENT '规范ID',
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `method` varchar(10) DEFAULT NULL COMMENT '请求方法',
+  `path` varchar(500) DEFAULT NULL COMMENT '路径模板或请求路径',
+  `parameter` varchar(255) DEFAULT NULL COMMENT '违规的参数',
+  `constraint_name` varchar(100) DEFAULT NULL COMMENT '违反的约束',
+  `sample` text COMMENT '最近一次违规的说明和值',
+  `count` bigint DEFAULT '0' COMMENT '出现次数',
+  `first_seen` datetime(3) DEFAULT NULL COMMENT '首次出现时间',
+  `last_seen` datetime(3) DEFAULT NULL COMMENT '最近出现时间',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  PRIMARY KEY (`id`),
+  KEY `idx_api_spec_observations_spec_id` (`spec_id`),
+  KEY `idx_api_spec_observations_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_api_spec_observations_spec` FOREIGN KEY (`spec_id`) REFERENCES `api_specs` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='OpenAPI学习记录表';
+
+-- 学习会话表
+CREATE TABLE `learning_sessions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `status` varchar(20) DEFAULT 'recording' COMMENT '状态：recording, stopped, applied',
+  `requests` bigint DEFAULT '0' COMMENT '记录的请求数',
+  `started_at` datetime(3) DEFAULT NULL COMMENT '开始时间',
+  `ends_at` datetime(3) DEFAULT NULL COMMENT '计划结束时间',
+  `stopped_at` datetime(3) DEFAULT NULL COMMENT '实际停止时间',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_learning_sessions_domain_id` (`domain_id`),
+  KEY `idx_learning_sessions_status` (`status`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_learning_sessions_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='学习会话表';
+
+-- 学习到的接口表
+CREATE TABLE `learning_endpoints` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `session_id` bigint unsigned NOT NULL COMMENT '学习会话ID',
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `method` varchar(10) DEFAULT NULL COMMENT '请求方法',
+  `path` varchar(500) DEFAULT NULL COMMENT '归一化路径',
+  `content_types` text COMMENT '请求Content-Type，JSON数组',
+  `parameters` mediumtext COMMENT '参数特征，JSON数组',
+  `count` bigint DEFAULT '0' COMMENT '请求数',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_learning_endpoint` (`session_id`,`method`,`path`),
+  KEY `idx_learning_endpoints_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_learning_endpoints_session` FOREIGN KEY (`session_id`) REFERENCES `learning_sessions` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='学习到的接口表';
+
+-- 学习期间的规则命中表
+CREATE TABLE `learning_rule_hits` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `session_id` bigint unsigned NOT NULL COMMENT '学习会话ID',
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `rule_id` bigint unsigned DEFAULT NULL COMMENT '命中的规则ID',
+  `rule_name` varchar(255) DEFAULT NULL COMMENT '命中的规则名称',
+  `method` varchar(10) DEFAULT NULL COMMENT '请求方法',
+  `path` varchar(500) DEFAULT NULL COMMENT '归一化路径',
+  `match_field` varchar(100) DEFAULT NULL COMMENT '匹配字段',
+  `sample` text COMMENT '最近一次命中的匹配值',
+  `count` bigint DEFAULT '0' COMMENT '命中次数',
+  `legitimate` tinyint(1) DEFAULT '0' COMMENT '是否被标记为正常流量',
+  `first_seen` datetime(3) DEFAULT NULL COMMENT '首次命中时间',
+  `last_seen` datetime(3) DEFAULT NULL COMMENT '最近命中时间',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  PRIMARY KEY (`id`),
+  KEY `idx_learning_rule_hits_session_id` (`session_id`),
+  KEY `idx_learning_rule_hits_domain_id` (`domain_id`),
+  KEY `idx_learning_rule_hits_rule_id` (`rule_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_learning_rule_hits_session` FOREIGN KEY (`session_id`) REFERENCES `learning_sessions` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='学习期间的规则命中表';
+
+-- 规则排除表
+CREATE TABLE `rule_exclusions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL DEFAULT '0' COMMENT '域名ID，0表示策略级排除',
+  `policy_id` bigint unsigned NOT NULL DEFAULT '0' COMMENT '策略ID，0表示域名级排除',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `rule_id` bigint unsigned NOT NULL DEFAULT '0' COMMENT '跳过的规则ID，0表示按规则标签匹配',
+  `rule_tag` varchar(100) DEFAULT NULL COMMENT '跳过带有该标签的规则',
+  `target` varchar(255) DEFAULT NULL COMMENT '排除的检查目标：为空表示整条规则，匹配类型，body:参数名，header:名称',
+  `path_match` varchar(20) DEFAULT 'prefix' COMMENT '路径匹配方式：exact, prefix, regex',
+  `path` varchar(500) DEFAULT NULL COMMENT '路径，为空表示所有路径',
+  `source` varchar(20) DEFAULT 'manual' COMMENT '来源：manual, learning, modsec',
+  `comment` varchar(500) DEFAULT NULL COMMENT '备注',
+  `enabled` tinyint(1) DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_rule_exclusions_domain_id` (`domain_id`),
+  KEY `idx_rule_exclusions_policy_id` (`policy_id`),
+  KEY `idx_rule_exclusions_rule_id` (`rule_id`),
+  KEY `idx_rule_exclusions_enabled` (`enabled`),
+  KEY `idx_tenant_id` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='规则排除表';
+
+-- 影子策略评估汇总表
+CREATE TABLE `shadow_stats` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `requests` bigint DEFAULT '0' COMMENT '评估的请求数',
+  `agreed` bigint DEFAULT '0' COMMENT '影子策略与生效策略结果一致的请求数',
+  `shadow_blocks` bigint DEFAULT '0' COMMENT '影子策略拦截、生效策略放行的请求数',
+  `live_blocks` bigint DEFAULT '0' COMMENT '生效策略拦截、影子策略放行的请求数',
+  `dropped` bigint DEFAULT '0' COMMENT '评估队列已满未评估的请求数',
+  `since` datetime(3) DEFAULT NULL COMMENT '开始统计时间',
+  `updated_at` datetime(3) DEFAULT NULL,
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_shadow_stats_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='影子策略评估汇总表';
+
+-- 影子策略差异表
+CREATE TABLE `shadow_diffs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `rule_id` bigint unsigned NOT NULL COMMENT '导致拦截的规则ID',
+  `rule_name` varchar(255) DEFAULT NULL COMMENT '规则名称',
+  `direction` varchar(20) NOT NULL COMMENT '差异方向：shadow_block, live_block',
+  `count` bigint DEFAULT '0' COMMENT '请求数',
+  `samples` text COMMENT '最近的样本请求，JSON数组',
+  `first_seen` datetime(3) DEFAULT NULL COMMENT '首次出现时间',
+  `last_seen` datetime(3) DEFAULT NULL COMMENT '最近出现时间',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_shadow_diff` (`domain_id`,`rule_id`,`direction`),
+  KEY `idx_tenant_id` (`tenant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='影子策略差异表';
+
+-- 文件上传策略表
+CREATE TABLE `upload_policies` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `path` varchar(500) DEFAULT NULL COMMENT '生效路径前缀，为空表示整个域名',
+  `max_file_size` bigint DEFAULT '0' COMMENT '单个文件最大字节数，0表示不限制',
+  `max_file_count` bigint DEFAULT '0' COMMENT '单个请求最多文件数，0表示不限制',
+  `allowed_extensions` text COMMENT '允许的扩展名（JSON数组），为空表示不限制',
+  `allowed_mime_types` text COMMENT '允许的文件类型（JSON数组，按文件内容识别），为空表示不限制',
+  `block_double_extensions` tinyint(1) DEFAULT '1' COMMENT '是否拦截双扩展名',
+  `block_polyglots` tinyint(1) DEFAULT '1' COMMENT '是否拦截嵌入脚本或其他格式的文件',
+  `scan_malware` tinyint(1) DEFAULT '0' COMMENT '是否通过ClamAV扫描文件内容',
+  `action` varchar(20) DEFAULT 'block' COMMENT '违规时的动作：block, log',
+  `enabled` tinyint(1) DEFAULT '1' COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_upload_policies_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_upload_policies_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='文件上传策略表';
+
+-- 登录接口表
+CREATE TABLE `login_endpoints` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `domain_id` bigint unsigned NOT NULL COMMENT '域名ID',
+  `name` varchar(255) DEFAULT NULL COMMENT '名称',
+  `path` varchar(500) NOT NULL COMMENT '登录接口路径，精确匹配',
+  `method` varchar(10) DEFAULT 'POST' COMMENT '请求方法',
+  `username_field` varchar(255) NOT NULL COMMENT '用户名字段：表单字段名或JSON字段路径',
+  `failure_status_codes` text COMMENT '表示登录失败的响应状态码，JSON数组格式',
+  `failure_body_pattern` text COMMENT '表示登录失败的响应体正则表达式',
+  `failure_window` int DEFAULT 900 COMMENT '失败次数的统计窗口（秒）',
+  `delay_after` int DEFAULT 3 COMMENT '用户名+IP失败次数达到该值后延迟转发，0表示不延迟',
+  `delay_ms` int DEFAULT 500 COMMENT '首次延迟的毫秒数，之后每次失败翻倍',
+  `max_delay_ms` int DEFAULT 8000 COMMENT '最大延迟毫秒数',
+  `challenge_after` int DEFAULT 5 COMMENT '用户名+IP失败次数达到该值后要求通过JS质询，0表示不质询',
+  `max_user_ip_failures` int DEFAULT 10 COMMENT '用户名+IP失败次数达到该值后拦截，0表示不限制',
+  `max_ip_failures` int DEFAULT 50 COMMENT 'IP失败次数达到该值后拦截，0表示不限制',
+  `max_user_failures` int DEFAULT 20 COMMENT '用户名在所有IP上的失败次数达到该值后要求质询，0表示不限制',
+  `max_usernames_per_ip` int DEFAULT 10 COMMENT '同一IP尝试的不同用户名数达到该值后拦截，0表示不限制',
+  `mask_username` tinyint(1) DEFAULT 0 COMMENT '攻击日志中是否对用户名脱敏',
+  `enabled` tinyint(1) DEFAULT 1 COMMENT '是否启用',
+  `tenant_id` bigint unsigned NOT NULL COMMENT '租户ID',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_login_endpoints_domain_id` (`domain_id`),
+  KEY `idx_tenant_id` (`tenant_id`),
+  CONSTRAINT `fk_login_endpoints_domain` FOREIGN KEY (`domain_id`) REFERENCES `domains` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='登录接口表';
+
 -- =============================================================================
 -- 插入测试数据
 -- =============================================================================
@@ -314,17 +738,17 @@ INSERT INTO domains (id, domain, protocol, port, backend_url, tenant_id, enabled
 (9, 'test.example.com', 'http', 80, 'http://localhost:7000', 6, 0, NOW(), NOW());
 
 -- 插入WAF规则数据
-INSERT INTO rules (id, name, description, match_type, pattern, match_mode, action, response_code, response_msg, priority, tenant_id, enabled, created_at, updated_at) VALUES
-(1, 'SQL注入防护', '防止SQL注入攻击', 'body', '(?i)(union|select|insert|update|delete|drop|create|alter|exec|script)', 'regex', 'block', 403, '检测到SQL注入攻击', 10, 1, 1, NOW(), NOW()),
-(2, 'XSS防护', '防止跨站脚本攻击', 'body', '(?i)(<script|javascript:|on\\w+\\s*=)', 'regex', 'block', 403, '检测到XSS攻击', 9, 1, 1, NOW(), NOW()),
-(3, '管理员路径保护', '保护管理员访问路径', 'uri', '/admin', 'contains', 'block', 403, '禁止访问管理员路径', 8, 2, 1, NOW(), NOW()),
-(4, '敏感文件保护', '保护敏感文件访问', 'uri', '\\.(env|config|ini|log)$', 'regex', 'block', 403, '禁止访问敏感文件', 7, 2, 1, NOW(), NOW()),
-(5, '恶意爬虫拦截', '拦截恶意爬虫', 'user_agent', 'bot', 'contains', 'block', 403, '检测到恶意爬虫', 6, 3, 1, NOW(), NOW()),
-(6, 'API频率限制', 'API访问频率限制', 'uri', '/api/', 'contains', 'log', 200, '', 5, 3, 1, NOW(), NOW()),
-(7, '博客垃圾评论防护', '防止垃圾评论', 'body', 'spam', 'contains', 'block', 403, '检测到垃圾内容', 4, 4, 1, NOW(), NOW()),
-(8, '文件上传保护', '限制文件上传类型', 'uri', '/upload', 'contains', 'log', 200, '', 3, 4, 1, NOW(), NOW()),
-(9, 'API密钥验证', 'API密钥验证规则', 'header', 'X-API-Key', 'contains', 'allow', 200, '', 2, 5, 1, NOW(), NOW()),
-(10, '测试规则', '测试环境规则', 'uri', '/test', 'contains', 'log', 200, '', 1, 6, 0, NOW(), NOW());
+INSERT INTO rules (id, name, description, match_type, pattern, match_mode, action, response_code, response_msg, priority, tenant_id, enabled, tags, created_at, updated_at) VALUES
+(1, 'SQL注入防护', '防止SQL注入攻击', 'body', '(?i)(union|select|insert|update|delete|drop|create|alter|exec|script)', 'regex', 'block', 403, '检测到SQL注入攻击', 10, 1, 1, 'sqli', NOW(), NOW()),
+(2, 'XSS防护', '防止跨站脚本攻击', 'body', '(?i)(<script|javascript:|on\\w+\\s*=)', 'regex', 'block', 403, '检测到XSS攻击', 9, 1, 1, 'xss', NOW(), NOW()),
+(3, '管理员路径保护', '保护管理员访问路径', 'uri', '/admin', 'contains', 'block', 403, '禁止访问管理员路径', 8, 2, 1, 'access', NOW(), NOW()),
+(4, '敏感文件保护', '保护敏感文件访问', 'uri', '\\.(env|config|ini|log)$', 'regex', 'block', 403, '禁止访问敏感文件', 7, 2, 1, 'access', NOW(), NOW()),
+(5, '恶意爬虫拦截', '拦截恶意爬虫', 'user_agent', 'bot', 'contains', 'block', 403, '检测到恶意爬虫', 6, 3, 1, 'bot', NOW(), NOW()),
+(6, 'API频率限制', 'API访问频率限制', 'uri', '/api/', 'contains', 'log', 200, '', 5, 3, 1, 'api', NOW(), NOW()),
+(7, '博客垃圾评论防护', '防止垃圾评论', 'body', 'spam', 'contains', 'block', 403, '检测到垃圾内容', 4, 4, 1, 'spam', NOW(), NOW()),
+(8, '文件上传保护', '限制文件上传类型', 'uri', '/upload', 'contains', 'log', 200, '', 3, 4, 1, 'upload', NOW(), NOW()),
+(9, 'API密钥验证', 'API密钥验证规则', 'header', 'X-API-Key', 'contains', 'allow', 200, '', 2, 5, 1, 'api', NOW(), NOW()),
+(10, '测试规则', '测试环境规则', 'uri', '/test', 'contains', 'log', 200, '', 1, 6, 0, NULL, NOW(), NOW());
 
 -- 插入安全策略数据
 INSERT INTO policies (id, name, description, tenant_id, enabled, created_at, updated_at) VALUES